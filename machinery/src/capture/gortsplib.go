@@ -1495,7 +1495,7 @@ func (d *Decoder) decodeRaw(nalu []byte) (image.Gray, error) {
 		ys := int(fr.linesize[0])
 
 		return image.Gray{
-			Pix:    fromCPtr(unsafe.Pointer(fr.data[0]), w*h),
+			Pix:    fromCPtr(unsafe.Pointer(fr.data[0]), ys*h),
 			Stride: ys,
 			Rect:   image.Rect(0, 0, w, h),
 		}, nil
@@ -1504,6 +1504,45 @@ func (d *Decoder) decodeRaw(nalu []byte) (image.Gray, error) {
 	return image.Gray{}, nil
 }
 
+// NewDecoder allocates a decoder (H264 or H265) which isn't shared with the
+// RTSP clients. Decoding P-frames needs the state of the previous frames, so
+// whoever decodes every frame of a stream needs a decoder of its own.
+func NewDecoder(codecName string) (*Decoder, error) {
+	return newDecoder(codecName)
+}
+
+// DecodeGray decodes a packet and returns a copy of the luma of the frame, or
+// nil when the decoder didn't output a frame (yet).
+func (d *Decoder) DecodeGray(data []byte) (*image.Gray, error) {
+	img, err := d.decodeRaw(data)
+	if err != nil || img.Rect.Empty() {
+		return nil, err
+	}
+	width := img.Rect.Dx()
+	gray := image.NewGray(img.Rect)
+	for y := 0; y < img.Rect.Dy(); y++ {
+		copy(gray.Pix[y*width:(y+1)*width], img.Pix[y*img.Stride:y*img.Stride+width])
+	}
+	return gray, nil
+}
+
+// DecodeYCbCr decodes a packet and returns the frame, or nil when the decoder
+// didn't output a frame (yet). The frame is only valid until the next call.
+func (d *Decoder) DecodeYCbCr(data []byte) (*image.YCbCr, error) {
+	img, err := d.decode(data)
+	if err != nil || img.Rect.Empty() {
+		return nil, err
+	}
+	return &img, nil
+}
+
+// Skip decodes a packet without returning the frame, which keeps the state of
+// the decoder up to date.
+func (d *Decoder) Skip(data []byte) error {
+	_, err := d.decodeRaw(data)
+	return err
+}
+
 func fromCPtr(buf unsafe.Pointer, size int) (ret []uint8) {
 	hdr := (*reflect.SliceHeader)((unsafe.Pointer(&ret)))
 	hdr.Cap = size
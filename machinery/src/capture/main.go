@@ -10,6 +10,7 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
@@ -19,6 +20,7 @@ import (
 	"github.com/kerberos-io/agent/machinery/src/log"
 	"github.com/kerberos-io/agent/machinery/src/models"
 	"github.com/kerberos-io/agent/machinery/src/packets"
+	"github.com/kerberos-io/agent/machinery/src/recordings"
 	"github.com/kerberos-io/agent/machinery/src/utils"
 	"github.com/kerberos-io/agent/machinery/src/video"
 	"go.opentelemetry.io/otel/trace"
@@ -67,13 +69,26 @@ func recordingUploadMetadata(name, deviceKey string, timestamp int64, mp4Video *
 	return metadata
 }
 
+// indexAndQueueRecording adds a finalized recording to the recording index,
+// and queues it for upload.
+func indexAndQueueRecording(configDirectory string, metadata models.RecordingUploadMetadata) {
+	recordings.Add(configDirectory, metadata.FileName, func(recording *models.Recording) {
+		recording.Duration = metadata.Duration
+		recording.Zones = metadata.Zones
+		recording.Labels = metadata.Labels
+	})
+	if err := queueRecordingForUpload(configDirectory, metadata); err == nil {
+		recordings.SetUploadState(metadata.FileName, models.RecordingUploadPending)
+	}
+}
+
 // queueRecordingForUpload creates the marker consumed by the upload worker and
 // stores metadata captured from the finalized recording.
-func queueRecordingForUpload(configDirectory string, metadata models.RecordingUploadMetadata) {
+func queueRecordingForUpload(configDirectory string, metadata models.RecordingUploadMetadata) error {
 	payload, err := json.Marshal(metadata)
 	if err != nil {
 		log.Log.Error("capture.main.queueRecordingForUpload(): " + err.Error())
-		return
+		return err
 	}
 
 	// Publish the marker with a same-filesystem rename. Writing directly to the
@@ -97,6 +112,25 @@ func queueRecordingForUpload(configDirectory string, metadata models.RecordingUp
 	if err != nil {
 		log.Log.Error("capture.main.queueRecordingForUpload(): " + err.Error())
 	}
+	return err
+}
+
+// RequeueRecording queues a recording which is still on disk for upload again,
+// e.g. after it was uploaded already or its upload was cancelled. Only the
+// metadata which can be derived from the name is known at this point.
+func RequeueRecording(configDirectory string, deviceKey string, fileName string) error {
+	metadata := models.RecordingUploadMetadata{
+		FileName:  filepath.Base(fileName),
+		DeviceKey: deviceKey,
+	}
+	if seconds, err := strconv.ParseInt(strings.SplitN(metadata.FileName, "_", 2)[0], 10, 64); err == nil {
+		metadata.Timestamp = seconds * 1000
+	}
+	if err := queueRecordingForUpload(configDirectory, metadata); err != nil {
+		return err
+	}
+	recordings.SetUploadState(metadata.FileName, models.RecordingUploadPending)
+	return nil
 }
 
 const (
@@ -183,13 +217,23 @@ func CleanupRecordingDirectory(configDirectory string, configuration *models.Con
 	// Only when EVERY recording on disk is still pending upload do we fall back to
 	// deleting the oldest pending one, as a last resort to keep the disk bounded
 	// (otherwise a long outage would fill the disk and stop new recordings).
-	name, pending, err := pickRecordingToCleanup(recordingsDirectory, cloudDirectory)
+	var name string
+	var pending bool
+	if index := recordings.Default(); index != nil {
+		name, pending, err = pickIndexedRecordingToCleanup(index, cloudDirectory)
+	} else {
+		name, pending, err = pickRecordingToCleanup(recordingsDirectory, cloudDirectory)
+	}
 	if err != nil {
 		log.Log.Info("HandleRecordStream: something went wrong, " + err.Error())
 		return
 	}
 
-	if err := os.Remove(recordingsDirectory + "/" + name); err != nil {
+	err = os.Remove(recordingsDirectory + "/" + name)
+	if err == nil || os.IsNotExist(err) {
+		recordings.Remove(name)
+	}
+	if err != nil {
 		log.Log.Info("HandleRecordStream: something went wrong, " + err.Error())
 		return
 	}
@@ -318,6 +362,30 @@ func pickRecordingToCleanup(recordingsDirectory, cloudDirectory string) (string,
 	return "", false, os.ErrNotExist
 }
 
+// pickIndexedRecordingToCleanup is pickRecordingToCleanup with the recording
+// index, so the recordings directory doesn't have to be read.
+func pickIndexedRecordingToCleanup(index *recordings.Index, cloudDirectory string) (string, bool, error) {
+	var oldestSafeName, oldestAnyName string
+	index.Oldest(func(recording models.Recording) bool {
+		if oldestAnyName == "" {
+			oldestAnyName = recording.Key
+		}
+		if recordingPendingUpload(cloudDirectory, recording.Key) {
+			return true
+		}
+		oldestSafeName = recording.Key
+		return false
+	})
+
+	if oldestSafeName != "" {
+		return oldestSafeName, false, nil
+	}
+	if oldestAnyName != "" {
+		return oldestAnyName, true, nil
+	}
+	return "", false, os.ErrNotExist
+}
+
 func uploadMarkerNames(recordingName string) []string {
 	return []string{models.RecordingUploadMetadataFileName(recordingName), filepath.Base(recordingName)}
 }
@@ -502,7 +570,8 @@ func HandleRecordStream(queue *packets.Queue, configDirectory string, configurat
 						}
 					}
 
-					queueRecordingForUpload(configDirectory, recordingUploadMetadata(name, config.Key, startRecording, mp4Video))
+					indexAndQueueRecording(configDirectory, recordingUploadMetadata(name, config.Key, startRecording, mp4Video))
+					models.EmitOutputEvent(configuration, communication, conditions.PolicyOutputs(), models.OutputEventRecordingFinished, name)
 
 					recordingStatus = "idle"
 
@@ -587,6 +656,7 @@ func HandleRecordStream(queue *packets.Queue, configDirectory string, configurat
 
 					// Notify the hub / live-view UI that this camera started recording.
 					publishRecordingState(mqttClient, hubKey, configuration, true)
+					models.EmitOutputEvent(configuration, communication, conditions.PolicyOutputs(), models.OutputEventRecordingStarted, name)
 
 				} else if start {
 
@@ -659,7 +729,8 @@ func HandleRecordStream(queue *packets.Queue, configDirectory string, configurat
 						}
 					}
 
-					queueRecordingForUpload(configDirectory, recordingUploadMetadata(name, config.Key, startRecording, mp4Video))
+					indexAndQueueRecording(configDirectory, recordingUploadMetadata(name, config.Key, startRecording, mp4Video))
+					models.EmitOutputEvent(configuration, communication, conditions.PolicyOutputs(), models.OutputEventRecordingFinished, name)
 
 					recordingStatus = "idle"
 
@@ -691,6 +762,18 @@ func HandleRecordStream(queue *packets.Queue, configDirectory string, configurat
 				now := time.Now().UnixMilli()
 				motionTimestamp := now
 
+				// The condition URI can override the post-recording, the
+				// recording is still closed at the maximum length.
+				postRecording := postRecording
+				if override := conditions.LastDecision().PostRecording; override > 0 {
+					postRecording = override * 1000
+				}
+
+				// The motion zones which fired, and the objects which were
+				// detected, during the recording.
+				zones := utils.AppendUnique(nil, motion.Zones)
+				labels := utils.AppendUnique(nil, motion.Labels)
+
 				start := false
 
 				if cursorError == nil {
@@ -776,6 +859,8 @@ func HandleRecordStream(queue *packets.Queue, configDirectory string, configurat
 					select {
 					case motion := <-communication.HandleMotion:
 						motionTimestamp = now
+						zones = utils.AppendUnique(zones, motion.Zones)
+						labels = utils.AppendUnique(labels, motion.Labels)
 						log.Log.Info("capture.main.HandleRecordStream(motiondetection): motion detected while recording. Expanding recording.")
 						numberOfChanges := motion.NumberOfChanges
 						log.Log.Info("capture.main.HandleRecordStream(motiondetection): Received message with recording data, detected changes to save: " + strconv.Itoa(numberOfChanges))
@@ -827,6 +912,7 @@ func HandleRecordStream(queue *packets.Queue, configDirectory string, configurat
 
 						// Notify the hub / live-view UI that this camera started recording.
 						publishRecordingState(mqttClient, hubKey, configuration, true)
+						models.EmitOutputEvent(configuration, communication, conditions.PolicyOutputs(), models.OutputEventRecordingStarted, name)
 					}
 					if start {
 						writeSampleToMP4(mp4Video, videoTrack, audioTrack, pkt)
@@ -929,7 +1015,11 @@ func HandleRecordStream(queue *packets.Queue, configDirectory string, configurat
 					}
 				}
 
-				queueRecordingForUpload(configDirectory, recordingUploadMetadata(name, config.Key, displayTime, mp4Video))
+				metadata := recordingUploadMetadata(name, config.Key, displayTime, mp4Video)
+				metadata.Zones = zones
+				metadata.Labels = labels
+				indexAndQueueRecording(configDirectory, metadata)
+				models.EmitOutputEvent(configuration, communication, conditions.PolicyOutputs(), models.OutputEventRecordingFinished, name)
 
 				// Clean up the recording directory if necessary.
 				CleanupRecordingDirectory(configDirectory, configuration)
@@ -1071,6 +1161,12 @@ func Base64Image(captureDevice *Capture, communication *models.Communication, co
 }
 
 func JpegImage(captureDevice *Capture, communication *models.Communication) image.YCbCr {
+	return JpegImageContext(context.Background(), captureDevice, communication)
+}
+
+// JpegImageContext is JpegImage, but stops waiting for a keyframe when the
+// context is done, and then returns an empty image.
+func JpegImageContext(ctx context.Context, captureDevice *Capture, communication *models.Communication) image.YCbCr {
 	// We'll try to get a snapshot from the camera.
 	var queue *packets.Queue
 	var cursor *packets.QueueCursor
@@ -1092,7 +1188,7 @@ func JpegImage(captureDevice *Capture, communication *models.Communication) imag
 	count := 0
 	for count < 3 {
 		if queue != nil && cursor != nil && rtspClient != nil {
-			pkt, err := cursor.ReadPacket()
+			pkt, err := cursor.ReadPacketContext(ctx)
 			if err == nil {
 				if !pkt.IsKeyFrame {
 					continue
@@ -1104,6 +1200,8 @@ func JpegImage(captureDevice *Capture, communication *models.Communication) imag
 				} else {
 					break
 				}
+			} else if ctx.Err() != nil {
+				break
 			}
 		} else {
 			break
@@ -22,11 +22,13 @@ import (
 
 	"github.com/kerberos-io/agent/machinery/src/capture"
 	"github.com/kerberos-io/agent/machinery/src/cloud/livesnapshot"
+	"github.com/kerberos-io/agent/machinery/src/conditions"
 	"github.com/kerberos-io/agent/machinery/src/encryption"
 	"github.com/kerberos-io/agent/machinery/src/log"
 	"github.com/kerberos-io/agent/machinery/src/models"
 	"github.com/kerberos-io/agent/machinery/src/onvif"
 	"github.com/kerberos-io/agent/machinery/src/packets"
+	"github.com/kerberos-io/agent/machinery/src/recordings"
 	"github.com/kerberos-io/agent/machinery/src/utils"
 	"github.com/kerberos-io/agent/machinery/src/webrtc"
 )
@@ -54,6 +56,17 @@ func HandleUpload(configDirectory string, configuration *models.Configuration, c
 		// Half a second delay between two uploads
 		delay := 500 * time.Millisecond
 
+		// Every recording is uploaded to each of the targets, by default only
+		// the one selected by Cloud.
+		targets := uploadTargets(config)
+
+		// Cap the upload rate, shared by all uploaders.
+		if config.UploadSchedule != nil {
+			setUploadBandwidthLimit(config.UploadSchedule.BandwidthLimit)
+		} else {
+			setUploadBandwidthLimit(0)
+		}
+
 	loop:
 		for {
 			// This will check if we need to stop the thread,
@@ -64,10 +77,22 @@ func HandleUpload(configDirectory string, configuration *models.Configuration, c
 			case <-time.After(2 * time.Second):
 			}
 
+			// Only upload within the upload windows, if any.
+			if !inUploadWindow(config, time.Now()) {
+				log.Log.Debug("HandleUpload: outside of the upload window, waiting.")
+				continue
+			}
+
 			ff, err := utils.ReadDirectory(watchDirectory)
 			if err != nil {
 				log.Log.Error("HandleUpload: " + err.Error())
 			} else {
+				sortUploadQueue(ff, config)
+				queued := map[string]bool{}
+				for _, f := range ff {
+					queued[f.Name()] = true
+				}
+				pending := map[string]int{}
 				for _, f := range ff {
 
 					// This will check if we need to stop the thread,
@@ -78,46 +103,35 @@ func HandleUpload(configDirectory string, configuration *models.Configuration, c
 					default:
 					}
 
+					// The upload window might have closed in the meantime.
+					if !inUploadWindow(config, time.Now()) {
+						log.Log.Info("HandleUpload: upload window closed, pausing uploads.")
+						break
+					}
+
 					markerFileName := f.Name()
 					fileName := models.RecordingFileNameFromUploadMarker(markerFileName)
-					uploaded := false
-					configured := false
-					err = nil
-					if config.Cloud == "s3" || config.Cloud == "kerberoshub" {
-						uploaded, configured, err = UploadKerberosHub(configuration, fileName)
-					} else if config.Cloud == "kstorage" || config.Cloud == "kerberosvault" {
-						uploaded, configured, err = UploadKerberosVault(configuration, fileName)
-					} else if config.Cloud == "dropbox" {
-						uploaded, configured, err = UploadDropbox(configuration, fileName)
-					} else if config.Cloud == "gdrive" {
-						// Todo: implement gdrive upload
-					} else if config.Cloud == "onedrive" {
-						// Todo: implement onedrive upload
-					} else if config.Cloud == "minio" {
-						// Todo: implement minio upload
-					} else if config.Cloud == "webdav" {
-						// Todo: implement webdav upload
-					} else if config.Cloud == "ftp" {
-						// Todo: implement ftp upload
-					} else if config.Cloud == "sftp" {
-						// Todo: implement sftp upload
-					} else if config.Cloud == "aws" {
-						// Todo: need to be updated, was previously used for hub.
-						uploaded, configured, err = UploadS3(configuration, fileName)
-					} else if config.Cloud == "azure" {
-						// Todo: implement azure upload
-					} else if config.Cloud == "google" {
-						// Todo: implement google upload
+					unlock := lockUpload(fileName)
+					if _, err := os.Stat(watchDirectory + markerFileName); err != nil {
+						// The upload was cancelled in the meantime.
+						unlock()
+						continue
 					}
-					// And so on... (have a look here -> https://github.com/kerberos-io/agent/issues/95)
+					attempted, failed, done, replicated := uploadMarker(configDirectory, configuration, targets, markerFileName, pending)
 
-					// Check if the file is uploaded, if so, remove it.
-					if uploaded {
-						delay = 500 * time.Millisecond // reset
+					if done {
 						err := os.Remove(watchDirectory + markerFileName)
 						if err != nil {
 							log.Log.Error("HandleUpload: " + err.Error())
 						}
+						removeUploadTargetMarkers(configDirectory, targets, markerFileName)
+					}
+					unlock()
+
+					// Check if the file is uploaded to all targets, if so, remove it.
+					if replicated {
+						recordings.SetUploadState(fileName, models.RecordingUploadFinished)
+						models.EmitOutputEvent(configuration, communication, conditions.PolicyOutputs(), models.OutputEventUploadFinished, fileName)
 
 						// Check if we need to remove the original recording
 						// removeAfterUpload is set to false by default
@@ -125,22 +139,27 @@ func HandleUpload(configDirectory string, configuration *models.Configuration, c
 							err := os.Remove(configDirectory + "/data/recordings/" + fileName)
 							if err != nil {
 								log.Log.Error("HandleUpload: " + err.Error())
+							} else {
+								recordings.Remove(fileName)
 							}
 						}
-					} else if !configured {
-						err := os.Remove(watchDirectory + markerFileName)
-						if err != nil {
-							log.Log.Error("HandleUpload: " + err.Error())
-						}
-					} else {
+					}
+
+					if failed {
 						delay = 5 * time.Second // slow down
-						if err != nil {
-							log.Log.Error("HandleUpload: " + err.Error())
-						}
+					} else if replicated {
+						delay = 500 * time.Millisecond // reset
 					}
 
+					// Targets which are backing off aren't retried, so there
+					// is no need to wait before the next recording.
+					if !attempted {
+						continue
+					}
 					time.Sleep(delay)
 				}
+				setUploadTargetsPending(targets, pending)
+				pruneUploadTargetMarkers(configDirectory, targets, queued)
 			}
 		}
 	}
@@ -1287,6 +1306,14 @@ func VerifyPersistence(c *gin.Context, configDirectory string) {
 
 		if config.Cloud == "dropbox" {
 			VerifyDropbox(config, c)
+		} else if config.Cloud == "ftp" {
+			VerifyFTP(config, c)
+		} else if config.Cloud == "sftp" {
+			VerifySFTP(config, c)
+		} else if config.Cloud == "webdav" {
+			VerifyWebDAV(config, c)
+		} else if config.Cloud == "minio" {
+			VerifyMinIO(config, c)
 		} else if config.Cloud == "s3" || config.Cloud == "kerberoshub" {
 
 			if config.HubURI == "" ||
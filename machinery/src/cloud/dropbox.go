@@ -65,7 +65,7 @@ func UploadDropbox(configuration *models.Configuration, fileName string) (bool,
 					},
 				},
 			},
-		}, file)
+		}, limitUploadReader(file))
 
 		if err != nil {
 			log.Log.Error("UploadDropbox: Error uploading file: " + err.Error())
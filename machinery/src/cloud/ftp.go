@@ -0,0 +1,167 @@
+package cloud
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jlaffaye/ftp"
+	"github.com/kerberos-io/agent/machinery/src/log"
+	"github.com/kerberos-io/agent/machinery/src/models"
+)
+
+const ftpTimeout = 30 * time.Second
+
+// UploadFTP uploads the recording to an FTP or FTPS server. The file is written
+// under a temporary name and renamed once complete, so a reader on the server
+// never picks up a partial recording.
+func UploadFTP(configuration *models.Configuration, fileName string) (bool, bool, error) {
+
+	config := configuration.Config
+
+	if config.FTP == nil || config.FTP.Host == "" || config.FTP.Username == "" {
+		err := "UploadFTP: FTP not properly configured"
+		log.Log.Info(err)
+		return false, false, errors.New(err)
+	}
+
+	file, err := os.Open("data/recordings/" + fileName)
+	if err != nil {
+		log.Log.Info("UploadFTP: skipping " + fileName + ", file doesn't exist anymore")
+		return false, false, nil
+	}
+	defer file.Close()
+
+	log.Log.Info("UploadFTP: Uploading to " + config.FTP.Host)
+	log.Log.Info("UploadFTP: Upload started for " + fileName)
+
+	conn, err := connectFTP(config.FTP)
+	if err != nil {
+		log.Log.Error("UploadFTP: " + err.Error())
+		return false, true, err
+	}
+	defer conn.Quit()
+
+	directory := renderUploadDirectory(config.FTP.Directory, config, fileName)
+	if err := storeFTP(conn, directory, fileName, limitUploadReader(file)); err != nil {
+		log.Log.Error("UploadFTP: " + err.Error())
+		return false, true, err
+	}
+
+	log.Log.Info("UploadFTP: File uploaded successfully, " + uploadPath(directory, fileName))
+	return true, true, nil
+}
+
+// VerifyFTP verifies the FTP settings by uploading and removing a test file.
+func VerifyFTP(config models.Config, c *gin.Context) {
+	if config.FTP == nil || config.FTP.Host == "" || config.FTP.Username == "" {
+		c.JSON(400, models.APIResponse{
+			Data: "FTP host and username are not set.",
+		})
+		return
+	}
+
+	conn, err := connectFTP(config.FTP)
+	if err != nil {
+		c.JSON(400, models.APIResponse{
+			Data: "Something went wrong while connecting to the FTP server: " + err.Error(),
+		})
+		return
+	}
+	defer conn.Quit()
+
+	fileName := "kerberos-agent-test.mp4"
+	directory := renderUploadDirectory(config.FTP.Directory, config, fileName)
+	if err := storeFTP(conn, directory, fileName, bytes.NewReader(TestFile)); err != nil {
+		c.JSON(400, models.APIResponse{
+			Data: "Something went wrong while uploading to the FTP server: " + err.Error(),
+		})
+		return
+	}
+	if err := conn.Delete(uploadPath(directory, fileName)); err != nil {
+		log.Log.Warning("cloud.VerifyFTP(): could not remove test file: " + err.Error())
+	}
+	c.JSON(200, models.APIResponse{
+		Data: "FTP is working fine.",
+	})
+}
+
+// connectFTP dials and logs in. TLS "explicit" upgrades the control connection
+// with AUTH TLS, "implicit" connects over TLS directly (usually port 990).
+func connectFTP(settings *models.FTP) (*ftp.ServerConn, error) {
+	options := []ftp.DialOption{ftp.DialWithTimeout(ftpTimeout)}
+	defaultPort := "21"
+
+	switch strings.ToLower(settings.TLS) {
+	case "explicit":
+		options = append(options, ftp.DialWithExplicitTLS(ftpTLSConfig(settings.Host)))
+	case "implicit":
+		options = append(options, ftp.DialWithTLS(ftpTLSConfig(settings.Host)))
+		defaultPort = "990"
+	case "", "false":
+	default:
+		return nil, errors.New("unknown FTP TLS mode: " + settings.TLS)
+	}
+
+	conn, err := ftp.Dial(hostWithDefaultPort(settings.Host, defaultPort), options...)
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.Login(settings.Username, settings.Password); err != nil {
+		conn.Quit()
+		return nil, err
+	}
+	return conn, nil
+}
+
+func ftpTLSConfig(host string) *tls.Config {
+	serverName := host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		serverName = h
+	}
+	return &tls.Config{
+		ServerName:         serverName,
+		InsecureSkipVerify: os.Getenv("AGENT_TLS_INSECURE") == "true",
+	}
+}
+
+// storeFTP creates the directory (one level at a time, as FTP has no mkdir -p)
+// and uploads the content under a temporary name before renaming it.
+func storeFTP(conn *ftp.ServerConn, directory string, fileName string, content io.Reader) error {
+	current := ""
+	for _, segment := range strings.Split(directory, "/") {
+		if segment == "" {
+			continue
+		}
+		current = path.Join(current, segment)
+		// An error usually means the directory already exists; a real problem
+		// surfaces when storing the file.
+		conn.MakeDir(current)
+	}
+
+	target := uploadPath(directory, fileName)
+	partial := target + ".part"
+	if err := conn.Stor(partial, content); err != nil {
+		return err
+	}
+	if err := conn.Rename(partial, target); err != nil {
+		conn.Delete(partial)
+		return err
+	}
+	return nil
+}
+
+// hostWithDefaultPort appends the port when the host doesn't specify one.
+func hostWithDefaultPort(host string, port string) string {
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return host
+	}
+	return net.JoinHostPort(strings.Trim(host, "[]"), port)
+}
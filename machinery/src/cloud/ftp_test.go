@@ -0,0 +1,206 @@
+package cloud
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/kerberos-io/agent/machinery/src/models"
+)
+
+// ftpServer is an in-process FTP server, with the commands the uploader uses,
+// serving root. It keeps the directories created with MKD.
+type ftpServer struct {
+	root     string
+	password string
+	mutex    sync.Mutex
+	created  []string
+}
+
+func startFTPServer(t *testing.T, root string, password string) (string, *ftpServer) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	server := &ftpServer{root: root, password: password}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn)
+		}
+	}()
+	return listener.Addr().String(), server
+}
+
+func (s *ftpServer) directories() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]string(nil), s.created...)
+}
+
+func (s *ftpServer) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	reply := func(format string, args ...interface{}) {
+		fmt.Fprintf(conn, format+"\r\n", args...)
+	}
+
+	reply("220 ready")
+	loggedIn := false
+	var data net.Listener
+	var renameFrom string
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		command, argument, _ := strings.Cut(strings.TrimRight(line, "\r\n"), " ")
+		path := filepath.Join(s.root, filepath.FromSlash(filepath.Clean("/"+argument)))
+		if !loggedIn && command != "USER" && command != "PASS" && command != "QUIT" {
+			reply("530 not logged in")
+			continue
+		}
+		switch command {
+		case "USER":
+			reply("331 password required")
+		case "PASS":
+			if argument != s.password {
+				reply("530 login incorrect")
+				continue
+			}
+			loggedIn = true
+			reply("230 logged in")
+		case "TYPE":
+			reply("200 type set")
+		case "EPSV":
+			if data, err = net.Listen("tcp", "127.0.0.1:0"); err != nil {
+				reply("425 can't open data connection")
+				continue
+			}
+			reply("229 entering extended passive mode (|||%d|)", data.Addr().(*net.TCPAddr).Port)
+		case "STOR":
+			if data == nil {
+				reply("425 use EPSV first")
+				continue
+			}
+			reply("150 opening data connection")
+			dataConn, err := data.Accept()
+			data.Close()
+			data = nil
+			if err != nil {
+				reply("425 can't open data connection")
+				continue
+			}
+			file, err := os.Create(path)
+			if err == nil {
+				_, err = io.Copy(file, dataConn)
+				file.Close()
+			}
+			dataConn.Close()
+			if err != nil {
+				reply("550 %v", err)
+				continue
+			}
+			reply("226 transfer complete")
+		case "MKD":
+			if err := os.Mkdir(path, 0755); err != nil {
+				reply("550 %v", err)
+				continue
+			}
+			s.mutex.Lock()
+			s.created = append(s.created, argument)
+			s.mutex.Unlock()
+			reply("257 \"%s\" created", argument)
+		case "RNFR":
+			renameFrom = path
+			reply("350 ready for RNTO")
+		case "RNTO":
+			if err := os.Rename(renameFrom, path); err != nil {
+				reply("550 %v", err)
+				continue
+			}
+			reply("250 renamed")
+		case "DELE":
+			if err := os.Remove(path); err != nil {
+				reply("550 %v", err)
+				continue
+			}
+			reply("250 deleted")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 command not implemented")
+		}
+	}
+}
+
+func TestUploadFTPCreatesDirectoryAndRenames(t *testing.T) {
+	root := t.TempDir()
+	address, server := startFTPServer(t, root, "secret")
+
+	fileName := "1704200000_6-967003_front_0-0-0-0_0_0.mp4"
+	content := []byte("recording")
+	withRecording(t, fileName, content)
+
+	configuration := &models.Configuration{}
+	configuration.Config.Name = "front/door"
+	configuration.Config.Timezone = "UTC"
+	configuration.Config.FTP = &models.FTP{
+		Host:      address,
+		Username:  "agent",
+		Password:  "secret",
+		Directory: "/{camera}/{yyyy}/{mm}/{dd}/",
+	}
+	uploaded, configured, err := UploadFTP(configuration, fileName)
+	if err != nil || !uploaded || !configured {
+		t.Fatalf("UploadFTP() = %v, %v, %v, want uploaded", uploaded, configured, err)
+	}
+	// Uploading the same recording again overwrites it, the directories
+	// exist already.
+	if uploaded, _, err := UploadFTP(configuration, fileName); err != nil || !uploaded {
+		t.Fatalf("UploadFTP() second upload = %v, %v", uploaded, err)
+	}
+
+	// The directory is created one level at a time.
+	want := []string{"front-door", "front-door/2024", "front-door/2024/01", "front-door/2024/01/02"}
+	if created := server.directories(); strings.Join(created, ",") != strings.Join(want, ",") {
+		t.Fatalf("created directories = %v, want %v", created, want)
+	}
+	stored, err := os.ReadFile(filepath.Join(root, "front-door", "2024", "01", "02", fileName))
+	if err != nil {
+		t.Fatalf("read uploaded file: %v", err)
+	}
+	if !bytes.Equal(stored, content) {
+		t.Fatalf("uploaded content = %q, want %q", stored, content)
+	}
+	if _, err := os.Stat(filepath.Join(root, "front-door", "2024", "01", "02", fileName+".part")); !os.IsNotExist(err) {
+		t.Fatalf("partial file left behind: %v", err)
+	}
+}
+
+func TestUploadFTPWrongPassword(t *testing.T) {
+	address, _ := startFTPServer(t, t.TempDir(), "secret")
+
+	fileName := "1704200000_6-967003_front_0-0-0-0_0_0.mp4"
+	withRecording(t, fileName, []byte("recording"))
+
+	configuration := &models.Configuration{}
+	configuration.Config.FTP = &models.FTP{Host: address, Username: "agent", Password: "wrong"}
+	if uploaded, configured, err := UploadFTP(configuration, fileName); err == nil || uploaded || !configured {
+		t.Fatalf("UploadFTP() = %v, %v, %v, want a retryable error", uploaded, configured, err)
+	}
+}
@@ -116,7 +116,7 @@ func UploadKerberosHub(configuration *models.Configuration, fileName string) (bo
 	}
 
 	// Now we know we are allowed to upload to the hub, we can start uploading.
-	req, err = http.NewRequest("POST", config.HubURI+"/storage/upload", file)
+	req, err = http.NewRequest("POST", config.HubURI+"/storage/upload", limitUploadReader(file))
 	if err != nil {
 		errorMessage := "UploadKerberosHub: error reading POST request, " + config.KStorage.URI + "/storage/upload: " + err.Error()
 		log.Log.Error(errorMessage)
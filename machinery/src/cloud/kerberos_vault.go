@@ -157,7 +157,7 @@ func uploadVaultLegacy(vault models.KStorage, publicKey, deviceKey, fileName, la
 		uri = uri[:len(uri)-1]
 	}
 
-	req, err := http.NewRequest("POST", uri+"/storage", file)
+	req, err := http.NewRequest("POST", uri+"/storage", limitUploadReader(file))
 	if err != nil {
 		errorMessage := label + ": error reading request, " + uri + "/storage: " + err.Error()
 		log.Log.Error(errorMessage)
@@ -0,0 +1,254 @@
+package cloud
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kerberos-io/agent/machinery/src/log"
+	"github.com/kerberos-io/agent/machinery/src/models"
+	"github.com/minio/minio-go/v6"
+	"github.com/minio/minio-go/v6/pkg/credentials"
+	"github.com/minio/minio-go/v6/pkg/encrypt"
+)
+
+const (
+	minioDefaultPartSize = 64 // MB
+	minioMinimumPartSize = 5  // MB, the S3 minimum for all but the last part.
+)
+
+// UploadMinIO uploads the recording to an S3-compatible storage. Unlike
+// UploadS3 (the legacy Kerberos Hub path) the bucket and credentials are
+// owned by the user. The object is tagged with the recording metadata from
+// the upload marker, so lifecycle rules can act on it.
+func UploadMinIO(configuration *models.Configuration, fileName string) (bool, bool, error) {
+
+	config := configuration.Config
+
+	if config.MinIO == nil || config.MinIO.Endpoint == "" || config.MinIO.Bucket == "" ||
+		config.MinIO.AccessKey == "" || config.MinIO.SecretKey == "" {
+		err := "UploadMinIO: MinIO not properly configured"
+		log.Log.Info(err)
+		return false, false, errors.New(err)
+	}
+
+	file, err := os.Open("data/recordings/" + fileName)
+	if err != nil {
+		log.Log.Info("UploadMinIO: skipping " + fileName + ", file doesn't exist anymore")
+		return false, false, nil
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return false, true, err
+	}
+
+	log.Log.Info("UploadMinIO: Uploading to " + config.MinIO.Endpoint + "/" + config.MinIO.Bucket)
+	log.Log.Info("UploadMinIO: Upload started for " + fileName)
+
+	client, err := newMinIOClient(config.MinIO)
+	if err != nil {
+		log.Log.Error("UploadMinIO: " + err.Error())
+		return false, true, err
+	}
+	options, err := minioPutOptions(config.MinIO)
+	if err != nil {
+		log.Log.Error("UploadMinIO: " + err.Error())
+		return false, true, err
+	}
+	options.UserTags = minioTags(config, fileName)
+
+	key := minioObjectKey(config.MinIO.Key, config, fileName)
+	if _, err := client.PutObject(config.MinIO.Bucket, key, limitUploadReader(file), info.Size(), options); err != nil {
+		log.Log.Error("UploadMinIO: Uploading Failed, " + err.Error())
+		return false, true, err
+	}
+
+	log.Log.Info("UploadMinIO: File uploaded successfully, " + key)
+	return true, true, nil
+}
+
+// VerifyMinIO verifies the MinIO settings by writing and removing a test
+// object.
+func VerifyMinIO(config models.Config, c *gin.Context) {
+	if config.MinIO == nil || config.MinIO.Endpoint == "" || config.MinIO.Bucket == "" ||
+		config.MinIO.AccessKey == "" || config.MinIO.SecretKey == "" {
+		c.JSON(400, models.APIResponse{
+			Data: "MinIO endpoint, bucket and credentials are not set.",
+		})
+		return
+	}
+
+	client, err := newMinIOClient(config.MinIO)
+	if err == nil {
+		var options minio.PutObjectOptions
+		options, err = minioPutOptions(config.MinIO)
+		if err == nil {
+			key := minioObjectKey(config.MinIO.Key, config, "kerberos-agent-test.mp4")
+			_, err = client.PutObject(config.MinIO.Bucket, key, bytes.NewReader(TestFile), int64(len(TestFile)), options)
+			if err == nil {
+				if err := client.RemoveObject(config.MinIO.Bucket, key); err != nil {
+					log.Log.Warning("cloud.VerifyMinIO(): could not remove test object: " + err.Error())
+				}
+			}
+		}
+	}
+	if err != nil {
+		c.JSON(400, models.APIResponse{
+			Data: "Something went wrong while uploading to the MinIO bucket: " + err.Error(),
+		})
+		return
+	}
+	c.JSON(200, models.APIResponse{
+		Data: "MinIO is working fine.",
+	})
+}
+
+func newMinIOClient(settings *models.MinIO) (*minio.Client, error) {
+	endpoint := settings.Endpoint
+	secure := true
+	if strings.HasPrefix(endpoint, "http://") {
+		secure = false
+	}
+	endpoint = strings.TrimPrefix(strings.TrimPrefix(endpoint, "http://"), "https://")
+	endpoint = strings.TrimSuffix(endpoint, "/")
+
+	lookup := minio.BucketLookupAuto
+	if settings.PathStyle == "true" {
+		lookup = minio.BucketLookupPath
+	} else if settings.PathStyle == "false" {
+		lookup = minio.BucketLookupDNS
+	}
+
+	client, err := minio.NewWithOptions(endpoint, &minio.Options{
+		Creds:        credentials.NewStaticV4(settings.AccessKey, settings.SecretKey, ""),
+		Secure:       secure,
+		Region:       settings.Region,
+		BucketLookup: lookup,
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Reuse the transport of the vault uploads, it honours AGENT_TLS_INSECURE
+	// and detects a storage that stops responding.
+	client.SetCustomTransport(newVaultHTTPClient(0).Transport)
+	return client, nil
+}
+
+// minioPutOptions translates the encryption and multipart settings.
+func minioPutOptions(settings *models.MinIO) (minio.PutObjectOptions, error) {
+	options := minio.PutObjectOptions{ContentType: "video/mp4"}
+
+	partSize := settings.PartSize
+	if partSize <= 0 {
+		partSize = minioDefaultPartSize
+	} else if partSize < minioMinimumPartSize {
+		partSize = minioMinimumPartSize
+	}
+	options.PartSize = uint64(partSize) * 1024 * 1024
+
+	switch strings.ToLower(settings.SSE) {
+	case "":
+	case "s3", "aes256":
+		options.ServerSideEncryption = encrypt.NewSSE()
+	case "kms", "aws:kms":
+		sse, err := encrypt.NewSSEKMS(settings.SSEKMSKeyID, nil)
+		if err != nil {
+			return options, err
+		}
+		options.ServerSideEncryption = sse
+	case "c", "sse-c":
+		key, err := base64.StdEncoding.DecodeString(settings.SSECustomerKey)
+		if err != nil {
+			return options, errors.New("invalid SSE-C key: " + err.Error())
+		}
+		sse, err := encrypt.NewSSEC(key)
+		if err != nil {
+			return options, err
+		}
+		options.ServerSideEncryption = sse
+	default:
+		return options, errors.New("unknown server-side encryption: " + settings.SSE)
+	}
+	return options, nil
+}
+
+// minioObjectKey renders the object key template. Next to the placeholders of
+// renderUploadDirectory it supports {filename}; a template without it is used
+// as the directory.
+func minioObjectKey(template string, config models.Config, fileName string) string {
+	fileName = path.Base(fileName)
+	if template == "" {
+		return fileName
+	}
+	if !strings.Contains(template, "{filename}") {
+		return uploadPath(renderUploadDirectory(template, config, fileName), fileName)
+	}
+	// The filename is substituted last, so the other placeholders are still
+	// rendered from it and a name can't introduce a placeholder of its own.
+	key := renderUploadDirectory(strings.ReplaceAll(template, "{filename}", "\x00"), config, fileName)
+	return strings.ReplaceAll(key, "\x00", fileName)
+}
+
+// minioTags describes the recording as object tags. Values are limited to the
+// characters S3 accepts in a tag.
+func minioTags(config models.Config, fileName string) map[string]string {
+	name := config.Name
+	if config.FriendlyName != "" {
+		name = config.FriendlyName
+	}
+	tags := map[string]string{
+		"camera":     minioTagValue(name),
+		"device-key": minioTagValue(config.Key),
+	}
+	if metadata, ok := queuedRecordingMetadata(fileName); ok {
+		if metadata.DeviceKey != "" {
+			tags["device-key"] = minioTagValue(metadata.DeviceKey)
+		}
+		if metadata.Timestamp > 0 {
+			tags["timestamp"] = strconv.FormatInt(metadata.Timestamp, 10)
+		}
+		if metadata.Duration > 0 {
+			tags["duration"] = strconv.FormatUint(metadata.Duration, 10)
+		}
+		if len(metadata.Zones) > 0 {
+			tags["zones"] = minioTagValue(strings.Join(metadata.Zones, " "))
+		}
+		if len(metadata.Labels) > 0 {
+			tags["labels"] = minioTagValue(strings.Join(metadata.Labels, " "))
+		}
+	}
+	if fps := queuedRecordingFPS(fileName); fps != "" {
+		tags["fps"] = fps
+	}
+	if site := minioTagValue(config.HubSite); site != "" {
+		tags["site"] = site
+	}
+	for key, value := range tags {
+		if value == "" {
+			delete(tags, key)
+		}
+	}
+	return tags
+}
+
+func minioTagValue(value string) string {
+	value = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		case strings.ContainsRune(" +-=._:/@", r):
+			return r
+		}
+		return '-'
+	}, value)
+	if len(value) > 256 {
+		value = value[:256]
+	}
+	return value
+}
@@ -0,0 +1,107 @@
+package cloud
+
+import (
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/kerberos-io/agent/machinery/src/models"
+)
+
+func TestMinIOObjectKey(t *testing.T) {
+	config := models.Config{Name: "front", Key: "camera1", Timezone: "UTC"}
+	fileName := "1704200000_6-967003_front_200-200-400-400_24_769.mp4"
+
+	tests := map[string]string{
+		"":                                 fileName,
+		"{camera}/{yyyy}/{mm}":             "front/2024/01/" + fileName,
+		"/recordings/{key}/{filename}":     "recordings/camera1/" + fileName,
+		"{site}/{dd}-{hh}-{filename}":      "unknown/02-12-" + fileName,
+		"../{filename}/../../{camera}.mp4": "front.mp4",
+	}
+	for template, want := range tests {
+		if got := minioObjectKey(template, config, fileName); got != want {
+			t.Errorf("minioObjectKey(%q) = %q, want %q", template, got, want)
+		}
+	}
+}
+
+func TestMinIOPutOptions(t *testing.T) {
+	options, err := minioPutOptions(&models.MinIO{PartSize: 1})
+	if err != nil {
+		t.Fatalf("minioPutOptions() error = %v", err)
+	}
+	if options.PartSize != minioMinimumPartSize*1024*1024 || options.ServerSideEncryption != nil {
+		t.Fatalf("minioPutOptions() = %+v, want the minimum part size without encryption", options)
+	}
+
+	if _, err := minioPutOptions(&models.MinIO{SSE: "c", SSECustomerKey: base64.StdEncoding.EncodeToString([]byte("short"))}); err == nil {
+		t.Fatal("minioPutOptions() with a short SSE-C key: error = nil")
+	}
+	if _, err := minioPutOptions(&models.MinIO{SSE: "rot13"}); err == nil {
+		t.Fatal("minioPutOptions() with an unknown SSE: error = nil")
+	}
+}
+
+func TestMinIOPutObjectPathStyleWithTags(t *testing.T) {
+	var gotPath, gotTagging, gotSSE string
+	var gotBody []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			w.WriteHeader(http.StatusNotImplemented)
+			return
+		}
+		gotPath = r.URL.Path
+		gotTagging = r.Header.Get("X-Amz-Tagging")
+		gotSSE = r.Header.Get("X-Amz-Server-Side-Encryption")
+		gotBody, _ = io.ReadAll(r.Body)
+		w.Header().Set("ETag", `"d41d8cd98f00b204e9800998ecf8427e"`)
+	}))
+	defer server.Close()
+
+	settings := &models.MinIO{
+		Endpoint:  server.URL,
+		Bucket:    "recordings",
+		Region:    "us-east-1",
+		AccessKey: "access",
+		SecretKey: "secret",
+		PathStyle: "true",
+		SSE:       "s3",
+		Key:       "{camera}/{filename}",
+	}
+	config := models.Config{Name: "front door", Key: "camera1", MinIO: settings}
+
+	client, err := newMinIOClient(settings)
+	if err != nil {
+		t.Fatalf("newMinIOClient() error = %v", err)
+	}
+	options, err := minioPutOptions(settings)
+	if err != nil {
+		t.Fatalf("minioPutOptions() error = %v", err)
+	}
+	options.UserTags = minioTags(config, "1704200000_6-967003_front_0-0-0-0_0_0.mp4")
+
+	key := minioObjectKey(settings.Key, config, "1704200000_6-967003_front_0-0-0-0_0_0.mp4")
+	if _, err := client.PutObject(settings.Bucket, key, strings.NewReader("recording"), 9, options); err != nil {
+		t.Fatalf("PutObject() error = %v", err)
+	}
+
+	if gotPath != "/recordings/front door/1704200000_6-967003_front_0-0-0-0_0_0.mp4" {
+		t.Fatalf("path = %q, want a path-style request", gotPath)
+	}
+	// Over plain HTTP the body uses the chunked streaming signature.
+	if !strings.Contains(string(gotBody), "recording") {
+		t.Fatalf("body = %q", gotBody)
+	}
+	if gotSSE != "AES256" {
+		t.Fatalf("server-side encryption = %q, want AES256", gotSSE)
+	}
+	tags, err := url.ParseQuery(gotTagging)
+	if err != nil || tags.Get("camera") != "front door" || tags.Get("device-key") != "camera1" {
+		t.Fatalf("tagging = %q", gotTagging)
+	}
+}
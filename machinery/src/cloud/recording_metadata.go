@@ -15,6 +15,8 @@ import (
 const recordingFPSHeader = "X-Kerberos-Storage-Fps"
 const recordingDurationHeader = "X-Kerberos-Storage-Duration"
 const recordingTimestampHeader = "X-Kerberos-Storage-Timestamp"
+const recordingZonesHeader = "X-Kerberos-Storage-Zones"
+const recordingLabelsHeader = "X-Kerberos-Storage-Labels"
 
 // queuedRecordingFPS reads the FPS snapshot written into the upload marker
 // when the recording was finalized. Historical empty markers intentionally
@@ -84,5 +86,11 @@ func setQueuedRecordingMetadataHeaders(header http.Header, fileName string) {
 		if metadata.Timestamp > 0 {
 			header.Set(recordingTimestampHeader, strconv.FormatInt(metadata.Timestamp, 10))
 		}
+		if len(metadata.Zones) > 0 {
+			header.Set(recordingZonesHeader, strings.Join(metadata.Zones, ","))
+		}
+		if len(metadata.Labels) > 0 {
+			header.Set(recordingLabelsHeader, strings.Join(metadata.Labels, ","))
+		}
 	}
 }
@@ -14,6 +14,8 @@ import (
 	"github.com/minio/minio-go/v6"
 )
 
+// UploadS3 is the legacy Kerberos Hub upload, straight into the Hub bucket on
+// AWS. Use UploadMinIO to store recordings in a bucket of your own.
 func UploadS3(configuration *models.Configuration, fileName string) (bool, bool, error) {
 
 	config := configuration.Config
@@ -108,7 +110,7 @@ func UploadS3(configuration *models.Configuration, fileName string) (bool, bool,
 
 	n, err := s3Client.PutObject(config.S3.Bucket,
 		config.S3.Username+"/"+fileName,
-		file,
+		limitUploadReader(file),
 		fileInfo.Size(),
 		minio.PutObjectOptions{
 			ContentType:  "video/mp4",
@@ -0,0 +1,205 @@
+package cloud
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kerberos-io/agent/machinery/src/log"
+	"github.com/kerberos-io/agent/machinery/src/models"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// UploadSFTP uploads the recording to an SFTP server. Like UploadFTP the file
+// is written under a temporary name and renamed once complete.
+func UploadSFTP(configuration *models.Configuration, fileName string) (bool, bool, error) {
+
+	config := configuration.Config
+
+	if config.FTP == nil || config.FTP.Host == "" || config.FTP.Username == "" ||
+		(config.FTP.Password == "" && config.FTP.PrivateKey == "") {
+		err := "UploadSFTP: SFTP not properly configured"
+		log.Log.Info(err)
+		return false, false, errors.New(err)
+	}
+	if config.FTP.HostKey == "" && config.FTP.InsecureHostKey != "true" {
+		err := "UploadSFTP: no host key configured for the SFTP server"
+		log.Log.Info(err)
+		return false, false, errors.New(err)
+	}
+
+	file, err := os.Open("data/recordings/" + fileName)
+	if err != nil {
+		log.Log.Info("UploadSFTP: skipping " + fileName + ", file doesn't exist anymore")
+		return false, false, nil
+	}
+	defer file.Close()
+
+	log.Log.Info("UploadSFTP: Uploading to " + config.FTP.Host)
+	log.Log.Info("UploadSFTP: Upload started for " + fileName)
+
+	client, err := connectSFTP(config.FTP)
+	if err != nil {
+		log.Log.Error("UploadSFTP: " + err.Error())
+		return false, true, err
+	}
+	defer client.Close()
+
+	directory := renderUploadDirectory(config.FTP.Directory, config, fileName)
+	if err := storeSFTP(client, directory, fileName, limitUploadReader(file)); err != nil {
+		log.Log.Error("UploadSFTP: " + err.Error())
+		return false, true, err
+	}
+
+	log.Log.Info("UploadSFTP: File uploaded successfully, " + uploadPath(directory, fileName))
+	return true, true, nil
+}
+
+// VerifySFTP verifies the SFTP settings by uploading and removing a test file.
+func VerifySFTP(config models.Config, c *gin.Context) {
+	if config.FTP == nil || config.FTP.Host == "" || config.FTP.Username == "" {
+		c.JSON(400, models.APIResponse{
+			Data: "SFTP host and username are not set.",
+		})
+		return
+	}
+
+	client, err := connectSFTP(config.FTP)
+	if err != nil {
+		c.JSON(400, models.APIResponse{
+			Data: "Something went wrong while connecting to the SFTP server: " + err.Error(),
+		})
+		return
+	}
+	defer client.Close()
+
+	fileName := "kerberos-agent-test.mp4"
+	directory := renderUploadDirectory(config.FTP.Directory, config, fileName)
+	if err := storeSFTP(client, directory, fileName, bytes.NewReader(TestFile)); err != nil {
+		c.JSON(400, models.APIResponse{
+			Data: "Something went wrong while uploading to the SFTP server: " + err.Error(),
+		})
+		return
+	}
+	if err := client.Remove(uploadPath(directory, fileName)); err != nil {
+		log.Log.Warning("cloud.VerifySFTP(): could not remove test file: " + err.Error())
+	}
+	c.JSON(200, models.APIResponse{
+		Data: "SFTP is working fine.",
+	})
+}
+
+// sftpClient wraps the SFTP session together with its SSH connection, so both
+// are closed at once.
+type sftpClient struct {
+	*sftp.Client
+	conn *ssh.Client
+}
+
+func (s *sftpClient) Close() error {
+	s.Client.Close()
+	return s.conn.Close()
+}
+
+func connectSFTP(settings *models.FTP) (*sftpClient, error) {
+	var auth []ssh.AuthMethod
+	if settings.PrivateKey != "" {
+		signer, err := ssh.ParsePrivateKey([]byte(settings.PrivateKey))
+		var missing *ssh.PassphraseMissingError
+		if errors.As(err, &missing) && settings.Password != "" {
+			signer, err = ssh.ParsePrivateKeyWithPassphrase([]byte(settings.PrivateKey), []byte(settings.Password))
+		}
+		if err != nil {
+			return nil, errors.New("invalid private key: " + err.Error())
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if settings.Password != "" {
+		auth = append(auth, ssh.Password(settings.Password))
+	}
+
+	hostKeyCallback, err := sftpHostKeyCallback(settings)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := ssh.Dial("tcp", hostWithDefaultPort(settings.Host, "22"), &ssh.ClientConfig{
+		User:            settings.Username,
+		Auth:            auth,
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         ftpTimeout,
+	})
+	if err != nil {
+		return nil, err
+	}
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &sftpClient{Client: client, conn: conn}, nil
+}
+
+// sftpHostKeyCallback pins the server to the configured SHA256 fingerprint.
+// Without a fingerprint the connection is refused, unless InsecureHostKey is
+// "true": then any host key is accepted, which is logged as a warning.
+func sftpHostKeyCallback(settings *models.FTP) (ssh.HostKeyCallback, error) {
+	fingerprint := settings.HostKey
+	if fingerprint == "" {
+		if settings.InsecureHostKey != "true" {
+			return nil, errors.New("no host key configured, set the SHA256 fingerprint of the SFTP server")
+		}
+		log.Log.Warning("cloud.sftpHostKeyCallback(): no host key configured, the identity of the SFTP server is not verified.")
+		return ssh.InsecureIgnoreHostKey(), nil
+	}
+	if !strings.HasPrefix(fingerprint, "SHA256:") {
+		fingerprint = "SHA256:" + fingerprint
+	}
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		if got := ssh.FingerprintSHA256(key); got != fingerprint {
+			return errors.New("host key mismatch for " + hostname + ": got " + got)
+		}
+		return nil
+	}, nil
+}
+
+// storeSFTP creates the directory and uploads the content under a temporary
+// name before renaming it. Paths are relative to the login directory.
+func storeSFTP(client *sftpClient, directory string, fileName string, content io.Reader) error {
+	if directory != "" {
+		if err := client.MkdirAll(directory); err != nil {
+			return err
+		}
+	}
+
+	target := uploadPath(directory, fileName)
+	partial := target + ".part"
+	remote, err := client.Create(partial)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(remote, content); err != nil {
+		remote.Close()
+		client.Remove(partial)
+		return err
+	}
+	if err := remote.Close(); err != nil {
+		client.Remove(partial)
+		return err
+	}
+
+	// A plain SFTP rename fails when the target exists; prefer the POSIX
+	// rename extension, which overwrites, when the server supports it.
+	if err := client.PosixRename(partial, target); err != nil {
+		client.Remove(target)
+		if err := client.Rename(partial, target); err != nil {
+			client.Remove(partial)
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+package cloud
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kerberos-io/agent/machinery/src/models"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// startSFTPServer runs an in-process SSH server with the sftp subsystem,
+// serving root. It returns the address and the host key fingerprint.
+func startSFTPServer(t *testing.T, root string, password string) (string, string) {
+	t.Helper()
+
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate host key: %v", err)
+	}
+	hostKey, err := ssh.NewSignerFromKey(privateKey)
+	if err != nil {
+		t.Fatalf("host key signer: %v", err)
+	}
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(meta ssh.ConnMetadata, pass []byte) (*ssh.Permissions, error) {
+			if meta.User() == "agent" && string(pass) == password {
+				return nil, nil
+			}
+			return nil, os.ErrPermission
+		},
+	}
+	config.AddHostKey(hostKey)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveSFTPConn(conn, config, root)
+		}
+	}()
+	return listener.Addr().String(), ssh.FingerprintSHA256(hostKey.PublicKey())
+}
+
+func serveSFTPConn(conn net.Conn, config *ssh.ServerConfig, root string) {
+	_, channels, requests, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(requests)
+	for newChannel := range channels {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "unknown channel type")
+			continue
+		}
+		channel, channelRequests, err := newChannel.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			for req := range channelRequests {
+				req.Reply(req.Type == "subsystem" && string(req.Payload[4:]) == "sftp", nil)
+			}
+		}()
+		server, err := sftp.NewServer(channel, sftp.WithServerWorkingDirectory(root))
+		if err != nil {
+			return
+		}
+		go func() {
+			server.Serve()
+			server.Close()
+		}()
+	}
+}
+
+func TestStoreSFTPCreatesDirectoryAndRenames(t *testing.T) {
+	root := t.TempDir()
+	address, fingerprint := startSFTPServer(t, root, "secret")
+
+	settings := &models.FTP{Host: address, Username: "agent", Password: "secret", HostKey: fingerprint}
+	client, err := connectSFTP(settings)
+	if err != nil {
+		t.Fatalf("connectSFTP() error = %v", err)
+	}
+	defer client.Close()
+
+	content := []byte("recording")
+	if err := storeSFTP(client, "front/2024/01/02", "1704200000_6-967003_front_0-0-0-0_0_0.mp4", bytes.NewReader(content)); err != nil {
+		t.Fatalf("storeSFTP() error = %v", err)
+	}
+	// Uploading the same recording again overwrites it.
+	if err := storeSFTP(client, "front/2024/01/02", "1704200000_6-967003_front_0-0-0-0_0_0.mp4", bytes.NewReader(content)); err != nil {
+		t.Fatalf("storeSFTP() second upload error = %v", err)
+	}
+
+	stored, err := os.ReadFile(filepath.Join(root, "front", "2024", "01", "02", "1704200000_6-967003_front_0-0-0-0_0_0.mp4"))
+	if err != nil {
+		t.Fatalf("read uploaded file: %v", err)
+	}
+	if !bytes.Equal(stored, content) {
+		t.Fatalf("uploaded content = %q, want %q", stored, content)
+	}
+	if _, err := os.Stat(filepath.Join(root, "front", "2024", "01", "02", "1704200000_6-967003_front_0-0-0-0_0_0.mp4.part")); !os.IsNotExist(err) {
+		t.Fatalf("partial file left behind: %v", err)
+	}
+}
+
+func TestConnectSFTPRejectsUnknownHostKey(t *testing.T) {
+	address, _ := startSFTPServer(t, t.TempDir(), "secret")
+
+	settings := &models.FTP{Host: address, Username: "agent", Password: "secret", HostKey: "SHA256:AAAA"}
+	if client, err := connectSFTP(settings); err == nil {
+		client.Close()
+		t.Fatal("connectSFTP() error = nil, want a host key mismatch")
+	}
+}
+
+func TestConnectSFTPRequiresHostKey(t *testing.T) {
+	address, _ := startSFTPServer(t, t.TempDir(), "secret")
+
+	settings := &models.FTP{Host: address, Username: "agent", Password: "secret"}
+	if client, err := connectSFTP(settings); err == nil {
+		client.Close()
+		t.Fatal("connectSFTP() error = nil, want an error without a host key")
+	}
+
+	settings.InsecureHostKey = "true"
+	client, err := connectSFTP(settings)
+	if err != nil {
+		t.Fatalf("connectSFTP() with InsecureHostKey error = %v", err)
+	}
+	client.Close()
+}
+
+func TestRenderUploadDirectory(t *testing.T) {
+	config := models.Config{Name: "front/door", Key: "camera1", Timezone: "UTC"}
+	fileName := "1704200000_6-967003_front_200-200-400-400_24_769.mp4"
+
+	if got := renderUploadDirectory("/{camera}/{yyyy}/{mm}/{dd}/", config, fileName); got != "front-door/2024/01/02" {
+		t.Fatalf("renderUploadDirectory() = %q, want %q", got, "front-door/2024/01/02")
+	}
+	if got := renderUploadDirectory("{key}/../../{hh}", config, fileName); got != "12" {
+		t.Fatalf("renderUploadDirectory() = %q, want %q", got, "12")
+	}
+	if got := renderUploadDirectory("", config, fileName); got != "" {
+		t.Fatalf("renderUploadDirectory() = %q, want empty", got)
+	}
+}
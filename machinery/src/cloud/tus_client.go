@@ -423,7 +423,7 @@ func tusHead(client *http.Client, uploadURL string, setHeaders tusHeaderFunc) (i
 // upload URL using a single PATCH request. The body is read straight from the
 // *os.File, so the recording is never fully buffered in memory.
 func tusPatch(client *http.Client, uploadURL string, offset, length int64, file io.Reader, setHeaders tusHeaderFunc) (int64, int, string, error) {
-	req, err := http.NewRequest("PATCH", uploadURL, io.LimitReader(file, length))
+	req, err := http.NewRequest("PATCH", uploadURL, limitUploadReader(io.LimitReader(file, length)))
 	if err != nil {
 		return offset, 0, "", err
 	}
@@ -0,0 +1,62 @@
+package cloud
+
+import (
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kerberos-io/agent/machinery/src/models"
+)
+
+// renderUploadDirectory expands a directory template, such as
+// "{camera}/{yyyy}/{mm}/{dd}", for a recording. The date is taken from the
+// recording name (unix timestamp prefix) in the timezone of the agent, so a
+// recording ends up in the same directory no matter when it is uploaded.
+//
+// Supported placeholders: {camera} (name), {key} (device key), {site},
+// {yyyy}, {mm}, {dd} and {hh}. The result has no leading or trailing slash.
+func renderUploadDirectory(template string, config models.Config, fileName string) string {
+	if template == "" {
+		return ""
+	}
+
+	timestamp := time.Now()
+	if seconds, err := strconv.ParseInt(strings.SplitN(path.Base(fileName), "_", 2)[0], 10, 64); err == nil {
+		timestamp = time.Unix(seconds, 0)
+	}
+	if location, err := time.LoadLocation(config.Timezone); err == nil && config.Timezone != "" {
+		timestamp = timestamp.In(location)
+	}
+
+	directory := strings.NewReplacer(
+		"{camera}", sanitizeUploadPathSegment(config.Name),
+		"{key}", sanitizeUploadPathSegment(config.Key),
+		"{site}", sanitizeUploadPathSegment(config.HubSite),
+		"{yyyy}", timestamp.Format("2006"),
+		"{mm}", timestamp.Format("01"),
+		"{dd}", timestamp.Format("02"),
+		"{hh}", timestamp.Format("15"),
+	).Replace(template)
+
+	directory = path.Clean("/" + directory)
+	return strings.Trim(directory, "/")
+}
+
+// sanitizeUploadPathSegment makes a value safe to use as a single directory.
+func sanitizeUploadPathSegment(value string) string {
+	value = strings.NewReplacer("/", "-", "\\", "-", "..", "-").Replace(value)
+	if value == "" {
+		return "unknown"
+	}
+	return value
+}
+
+// uploadPath joins the rendered directory and the file name. The result is
+// relative, so it resolves against the login directory of the account.
+func uploadPath(directory string, fileName string) string {
+	if directory == "" {
+		return fileName
+	}
+	return directory + "/" + fileName
+}
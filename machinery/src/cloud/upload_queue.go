@@ -0,0 +1,181 @@
+package cloud
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/kerberos-io/agent/machinery/src/capture"
+	"github.com/kerberos-io/agent/machinery/src/log"
+	"github.com/kerberos-io/agent/machinery/src/models"
+	"github.com/kerberos-io/agent/machinery/src/recordings"
+	"github.com/kerberos-io/agent/machinery/src/utils"
+)
+
+// ListUploadQueue returns the recordings waiting to be uploaded, in the order
+// they will be uploaded, with the state of every upload target.
+func ListUploadQueue(configDirectory string, configuration *models.Configuration) []models.UploadQueueEntry {
+	targets := uploadTargets(configuration.Config)
+	now := time.Now()
+
+	entries := []models.UploadQueueEntry{}
+	files, _ := utils.ReadDirectory(filepath.Join(configDirectory, "data", "cloud"))
+	sortUploadQueue(files, configuration.Config)
+	for _, f := range files {
+		if f.IsDir() || strings.HasPrefix(f.Name(), ".") {
+			continue
+		}
+		fileName := models.RecordingFileNameFromUploadMarker(f.Name())
+		entry := models.UploadQueueEntry{
+			FileName: fileName,
+			QueuedAt: f.ModTime().Unix(),
+			Age:      int64(now.Sub(f.ModTime()).Seconds()),
+			Status:   models.UploadTargetPending,
+			Targets:  []models.UploadTargetMarker{},
+		}
+		if info, err := os.Stat(filepath.Join(configDirectory, "data", "recordings", fileName)); err == nil {
+			entry.Size = info.Size()
+		}
+
+		var lastAttempt int64
+		for _, target := range targets {
+			marker := readUploadTargetMarker(configDirectory, target.Name, f.Name(), fileName)
+			entry.Targets = append(entry.Targets, marker)
+			if marker.Attempts > entry.Attempts {
+				entry.Attempts = marker.Attempts
+			}
+			if marker.LastError != "" && marker.LastAttempt >= lastAttempt {
+				entry.LastError = marker.LastError
+				lastAttempt = marker.LastAttempt
+			}
+			if marker.Status == models.UploadTargetPending && uploadTargetBackingOff(target, now) {
+				entry.Status = "backing_off"
+				uploadTargetStatusesMutex.Lock()
+				if retryAt := uploadTargetState(target).RetryAt; entry.RetryAt == 0 || retryAt < entry.RetryAt {
+					entry.RetryAt = retryAt
+				}
+				uploadTargetStatusesMutex.Unlock()
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// RetryUploads makes the selected recordings eligible for upload right away:
+// the backoff of the targets which still need them is cleared, and best effort
+// targets which gave up get another chance.
+func RetryUploads(configDirectory string, configuration *models.Configuration, request models.UploadQueueRequest) []models.UploadQueueResult {
+	targets := uploadTargets(configuration.Config)
+	return applyUploadQueueAction(configDirectory, request, true, func(fileName string, markerFileName string) error {
+		if markerFileName == "" {
+			return errors.New("recording is not queued")
+		}
+		for _, target := range targets {
+			marker := readUploadTargetMarker(configDirectory, target.Name, markerFileName, fileName)
+			if marker.Status == models.UploadTargetUploaded || marker.Status == models.UploadTargetSkipped {
+				continue
+			}
+			if marker.Status == models.UploadTargetFailed {
+				marker.Status = models.UploadTargetPending
+				marker.Attempts = 0
+				writeUploadTargetMarker(configDirectory, markerFileName, marker)
+			}
+			uploadTargetStatusesMutex.Lock()
+			uploadTargetState(target).RetryAt = 0
+			uploadTargetStatusesMutex.Unlock()
+		}
+		log.Log.Info("cloud.RetryUploads(): retrying " + fileName)
+		return nil
+	})
+}
+
+// CancelUploads removes the selected recordings from the upload queue. The
+// recordings themselves are kept.
+func CancelUploads(configDirectory string, configuration *models.Configuration, request models.UploadQueueRequest) []models.UploadQueueResult {
+	targets := uploadTargets(configuration.Config)
+	return applyUploadQueueAction(configDirectory, request, true, func(fileName string, markerFileName string) error {
+		if markerFileName == "" {
+			return errors.New("recording is not queued")
+		}
+		if err := os.Remove(filepath.Join(configDirectory, "data", "cloud", markerFileName)); err != nil {
+			return err
+		}
+		removeUploadTargetMarkers(configDirectory, targets, markerFileName)
+		recordings.SetUploadState(fileName, models.RecordingUploadCancelled)
+		log.Log.Info("cloud.CancelUploads(): cancelled the upload of " + fileName)
+		return nil
+	})
+}
+
+// RequeueUploads queues recordings which are still on disk, but no longer in
+// the upload queue (uploaded or cancelled), for upload to every target.
+func RequeueUploads(configDirectory string, configuration *models.Configuration, request models.UploadQueueRequest) []models.UploadQueueResult {
+	return applyUploadQueueAction(configDirectory, request, false, func(fileName string, markerFileName string) error {
+		if markerFileName != "" {
+			return errors.New("recording is already queued")
+		}
+		if _, err := os.Stat(filepath.Join(configDirectory, "data", "recordings", fileName)); err != nil {
+			return errors.New("recording not found")
+		}
+		if err := capture.RequeueRecording(configDirectory, configuration.Config.Key, fileName); err != nil {
+			return err
+		}
+		log.Log.Info("cloud.RequeueUploads(): queued " + fileName + " again")
+		return nil
+	})
+}
+
+// applyUploadQueueAction runs the action for every selected recording, with
+// the name of its queue marker (empty when it isn't queued). The markers of the
+// recording are locked, an upload in progress is finished first.
+func applyUploadQueueAction(configDirectory string, request models.UploadQueueRequest, allowAll bool, action func(fileName string, markerFileName string) error) []models.UploadQueueResult {
+	results := []models.UploadQueueResult{}
+
+	fileNames := request.FileNames
+	if request.All {
+		if !allowAll {
+			return append(results, models.UploadQueueResult{Error: "this action can't be applied to the whole queue"})
+		}
+		fileNames = nil
+		files, _ := utils.ReadDirectory(filepath.Join(configDirectory, "data", "cloud"))
+		for _, f := range files {
+			if !f.IsDir() && !strings.HasPrefix(f.Name(), ".") {
+				fileNames = append(fileNames, f.Name())
+			}
+		}
+	}
+
+	for _, name := range fileNames {
+		result := models.UploadQueueResult{FileName: name}
+		if name == "" || filepath.Base(name) != name || strings.HasPrefix(name, ".") {
+			result.Error = "invalid recording name"
+			results = append(results, result)
+			continue
+		}
+		fileName := models.RecordingFileNameFromUploadMarker(name)
+		result.FileName = fileName
+		unlock := lockUpload(fileName)
+		if err := action(fileName, queuedUploadMarker(configDirectory, fileName)); err != nil {
+			result.Error = err.Error()
+		} else {
+			result.Success = true
+		}
+		unlock()
+		results = append(results, result)
+	}
+	return results
+}
+
+// queuedUploadMarker returns the name of the queue marker of a recording, or
+// an empty string when it isn't queued. Older agents used the recording name.
+func queuedUploadMarker(configDirectory string, fileName string) string {
+	for _, markerFileName := range []string{models.RecordingUploadMetadataFileName(fileName), fileName} {
+		if _, err := os.Stat(filepath.Join(configDirectory, "data", "cloud", markerFileName)); err == nil {
+			return markerFileName
+		}
+	}
+	return ""
+}
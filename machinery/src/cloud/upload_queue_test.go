@@ -0,0 +1,140 @@
+package cloud
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kerberos-io/agent/machinery/src/models"
+)
+
+func setupUploadQueue(t *testing.T, fileNames ...string) string {
+	t.Helper()
+	configDirectory := t.TempDir()
+	for _, directory := range []string{"cloud", "recordings"} {
+		if err := os.MkdirAll(filepath.Join(configDirectory, "data", directory), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, fileName := range fileNames {
+		os.WriteFile(filepath.Join(configDirectory, "data", "recordings", fileName), []byte("recording"), 0644)
+		os.WriteFile(filepath.Join(configDirectory, "data", "cloud", models.RecordingUploadMetadataFileName(fileName)), []byte("{}"), 0644)
+	}
+	return configDirectory
+}
+
+func TestListUploadQueue(t *testing.T) {
+	resetUploadTargetStatuses(t)
+	fileName := "1704200000_6-967003_front_0-0-0-0_0_0.mp4"
+	configDirectory := setupUploadQueue(t, fileName)
+	configuration := &models.Configuration{Config: models.Config{UploadTargets: []*models.UploadTarget{
+		{Name: "vault", Cloud: "kstorage"},
+		{Name: "nas", Cloud: "sftp", Required: "false"},
+	}}}
+
+	markerFileName := models.RecordingUploadMetadataFileName(fileName)
+	writeUploadTargetMarker(configDirectory, markerFileName, models.UploadTargetMarker{
+		Target: "nas", FileName: fileName, Status: models.UploadTargetPending, Attempts: 2, LastAttempt: 10, LastError: "connection refused",
+	})
+	recordUploadTargetResult(configuration.Config.UploadTargets[1], false, nil, time.Now())
+
+	entries := ListUploadQueue(configDirectory, configuration)
+	if len(entries) != 1 {
+		t.Fatalf("ListUploadQueue() = %d entries, want 1", len(entries))
+	}
+	entry := entries[0]
+	if entry.FileName != fileName || entry.Size != int64(len("recording")) || entry.Attempts != 2 ||
+		entry.LastError != "connection refused" || entry.Status != "backing_off" || entry.RetryAt == 0 || len(entry.Targets) != 2 {
+		t.Fatalf("ListUploadQueue() entry = %+v", entry)
+	}
+}
+
+func TestRetryCancelAndRequeueUploads(t *testing.T) {
+	resetUploadTargetStatuses(t)
+	queued := "1704200000_6-967003_front_0-0-0-0_0_0.mp4"
+	uploaded := "1704200100_6-967003_front_0-0-0-0_0_0.mp4"
+	configDirectory := setupUploadQueue(t, queued)
+	os.WriteFile(filepath.Join(configDirectory, "data", "recordings", uploaded), []byte("recording"), 0644)
+
+	target := &models.UploadTarget{Name: "nas", Cloud: "sftp", Required: "false"}
+	configuration := &models.Configuration{Config: models.Config{Key: "camera1", UploadTargets: []*models.UploadTarget{target}}}
+	markerFileName := models.RecordingUploadMetadataFileName(queued)
+	writeUploadTargetMarker(configDirectory, markerFileName, models.UploadTargetMarker{
+		Target: "nas", FileName: queued, Status: models.UploadTargetFailed, Attempts: 3,
+	})
+	recordUploadTargetResult(target, false, nil, time.Now())
+
+	results := RetryUploads(configDirectory, configuration, models.UploadQueueRequest{FileNames: []string{queued, uploaded, "../config.json"}})
+	if len(results) != 3 || !results[0].Success || results[1].Success || results[2].Success {
+		t.Fatalf("RetryUploads() = %+v", results)
+	}
+	if marker := readUploadTargetMarker(configDirectory, "nas", markerFileName, queued); marker.Status != models.UploadTargetPending || marker.Attempts != 0 {
+		t.Fatalf("retried marker = %+v, want pending without attempts", marker)
+	}
+	if uploadTargetBackingOff(target, time.Now()) {
+		t.Fatal("target is still backing off after a retry")
+	}
+
+	results = RequeueUploads(configDirectory, configuration, models.UploadQueueRequest{FileNames: []string{uploaded, queued}})
+	if !results[0].Success || results[1].Success {
+		t.Fatalf("RequeueUploads() = %+v", results)
+	}
+	if marker := queuedUploadMarker(configDirectory, uploaded); marker == "" {
+		t.Fatal("requeued recording is not in the queue")
+	}
+	if results := RequeueUploads(configDirectory, configuration, models.UploadQueueRequest{All: true}); results[0].Success {
+		t.Fatal("RequeueUploads() accepted the whole queue")
+	}
+
+	results = CancelUploads(configDirectory, configuration, models.UploadQueueRequest{All: true})
+	if len(results) != 2 || !results[0].Success || !results[1].Success {
+		t.Fatalf("CancelUploads() = %+v", results)
+	}
+	if entries := ListUploadQueue(configDirectory, configuration); len(entries) != 0 {
+		t.Fatalf("queue after cancel = %+v, want empty", entries)
+	}
+	if _, err := os.Stat(uploadTargetMarkerPath(configDirectory, "nas", markerFileName)); !os.IsNotExist(err) {
+		t.Fatal("target marker left behind after cancel")
+	}
+	if _, err := os.Stat(filepath.Join(configDirectory, "data", "recordings", queued)); err != nil {
+		t.Fatal("cancel removed the recording")
+	}
+}
+
+func TestCancelUploadsWaitsForUploadInProgress(t *testing.T) {
+	resetUploadTargetStatuses(t)
+	fileName := "1704200000_6-967003_front_0-0-0-0_0_0.mp4"
+	configDirectory := setupUploadQueue(t, fileName)
+	configuration := &models.Configuration{Config: models.Config{UploadTargets: []*models.UploadTarget{
+		{Name: "nas", Cloud: "sftp"},
+	}}}
+
+	// The upload loop holds the markers of the recording.
+	unlock := lockUpload(fileName)
+	done := make(chan []models.UploadQueueResult, 1)
+	go func() {
+		done <- CancelUploads(configDirectory, configuration, models.UploadQueueRequest{FileNames: []string{fileName}})
+	}()
+	select {
+	case <-done:
+		t.Fatal("CancelUploads() didn't wait for the upload in progress")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	unlock()
+	select {
+	case results := <-done:
+		if len(results) != 1 || !results[0].Success {
+			t.Fatalf("CancelUploads() = %+v", results)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("CancelUploads() is still waiting")
+	}
+
+	uploadLocksMutex.Lock()
+	defer uploadLocksMutex.Unlock()
+	if len(uploadLocks) != 0 {
+		t.Fatalf("upload locks left behind: %v", uploadLocks)
+	}
+}
@@ -0,0 +1,163 @@
+package cloud
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kerberos-io/agent/machinery/src/conditions"
+	"github.com/kerberos-io/agent/machinery/src/models"
+	"golang.org/x/time/rate"
+)
+
+// The limiter hands out tokens (bytes) in bursts of this size, a read never
+// asks for more than that at once.
+const uploadBandwidthBurst = 32 * 1024
+
+// uploadLimiter is shared by all uploaders, so the cap applies to the total
+// upload rate of the agent. A nil limiter means unlimited.
+var uploadLimiter *rate.Limiter
+var uploadLimiterMutex sync.Mutex
+
+// setUploadBandwidthLimit (re)configures the upload limiter, in kbit/s. Zero
+// or less removes the limit.
+func setUploadBandwidthLimit(kbps int) {
+	uploadLimiterMutex.Lock()
+	defer uploadLimiterMutex.Unlock()
+	if kbps <= 0 {
+		uploadLimiter = nil
+		return
+	}
+	bytesPerSecond := rate.Limit(float64(kbps) * 1000 / 8)
+	if uploadLimiter == nil {
+		uploadLimiter = rate.NewLimiter(bytesPerSecond, uploadBandwidthBurst)
+		return
+	}
+	uploadLimiter.SetLimit(bytesPerSecond)
+}
+
+// limitUploadReader wraps the body of an upload, so it is read no faster than
+// the bandwidth limit. Without limit the reader is returned as is. A reader
+// which is also an io.ReaderAt and io.Seeker (a file) stays one, so the MinIO
+// client reads the parts from it instead of buffering them in memory.
+func limitUploadReader(r io.Reader) io.Reader {
+	uploadLimiterMutex.Lock()
+	limiter := uploadLimiter
+	uploadLimiterMutex.Unlock()
+	if limiter == nil {
+		return r
+	}
+	reader := &throttledReader{reader: r, limiter: limiter}
+	if file, ok := r.(seekReaderAt); ok {
+		return &throttledFile{throttledReader: reader, file: file}
+	}
+	return reader
+}
+
+type seekReaderAt interface {
+	io.ReaderAt
+	io.Seeker
+}
+
+type throttledReader struct {
+	reader  io.Reader
+	limiter *rate.Limiter
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	if len(p) > uploadBandwidthBurst {
+		p = p[:uploadBandwidthBurst]
+	}
+	n, err := t.reader.Read(p)
+	if n > 0 {
+		if werr := t.limiter.WaitN(context.Background(), n); werr != nil && err == nil {
+			err = werr
+		}
+	}
+	return n, err
+}
+
+type throttledFile struct {
+	*throttledReader
+	file seekReaderAt
+}
+
+func (t *throttledFile) ReadAt(p []byte, off int64) (int, error) {
+	read := 0
+	for read < len(p) {
+		chunk := p[read:]
+		if len(chunk) > uploadBandwidthBurst {
+			chunk = chunk[:uploadBandwidthBurst]
+		}
+		n, err := t.file.ReadAt(chunk, off+int64(read))
+		read += n
+		if n > 0 {
+			if werr := t.limiter.WaitN(context.Background(), n); werr != nil && err == nil {
+				err = werr
+			}
+		}
+		if err != nil {
+			return read, err
+		}
+	}
+	return read, nil
+}
+
+func (t *throttledFile) Seek(offset int64, whence int) (int64, error) {
+	return t.file.Seek(offset, whence)
+}
+
+// inUploadWindow tells if uploads are allowed now, according to the upload
+// timetable (in the timezone of the agent). Without timetable they always are.
+func inUploadWindow(config models.Config, now time.Time) bool {
+	if config.UploadSchedule == nil || len(config.UploadSchedule.Timetable) == 0 {
+		return true
+	}
+	if location, err := time.LoadLocation(config.Timezone); err == nil && config.Timezone != "" {
+		now = now.In(location)
+	}
+	return conditions.InTimetable(config.UploadSchedule.Timetable, now)
+}
+
+// uploadPriority ranks a recording by its name (timestamp_..._region_changes_
+// duration): continuous recordings have an empty region and no changes, they
+// go after motion and manual recordings.
+func uploadPriority(fileName string) int {
+	parts := strings.Split(strings.TrimSuffix(filepath.Base(fileName), filepath.Ext(fileName)), "_")
+	if len(parts) >= 6 && parts[len(parts)-3] == "0-0-0-0" && parts[len(parts)-2] == "0" {
+		return 1
+	}
+	return 0
+}
+
+func uploadTimestamp(fileName string) int64 {
+	timestamp, _ := strconv.ParseInt(strings.SplitN(filepath.Base(fileName), "_", 2)[0], 10, 64)
+	return timestamp
+}
+
+// sortUploadQueue orders the queue markers in the order they are uploaded.
+// With "oldest" that is first in, first out, otherwise motion and manual
+// recordings go first and newer recordings before older ones.
+func sortUploadQueue(files []os.FileInfo, config models.Config) {
+	order := ""
+	if config.UploadSchedule != nil {
+		order = config.UploadSchedule.Order
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		ti, tj := uploadTimestamp(files[i].Name()), uploadTimestamp(files[j].Name())
+		if order == "oldest" {
+			return ti < tj
+		}
+		pi, pj := uploadPriority(files[i].Name()), uploadPriority(files[j].Name())
+		if pi != pj {
+			return pi < pj
+		}
+		return ti > tj
+	})
+}
@@ -0,0 +1,103 @@
+package cloud
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kerberos-io/agent/machinery/src/models"
+)
+
+func TestLimitUploadReaderCapsThroughput(t *testing.T) {
+	setUploadBandwidthLimit(1024) // 128000 bytes/s
+	defer setUploadBandwidthLimit(0)
+
+	content := make([]byte, 96*1024)
+	start := time.Now()
+	n, err := io.Copy(io.Discard, limitUploadReader(bytes.NewReader(content)))
+	if err != nil || n != int64(len(content)) {
+		t.Fatalf("io.Copy() = %d, %v", n, err)
+	}
+	// The first burst is free, the remaining 64KB take half a second.
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Fatalf("read %d bytes in %v, the limit isn't applied", n, elapsed)
+	}
+
+	// A file keeps its io.ReaderAt, which is limited as well.
+	reader, ok := limitUploadReader(bytes.NewReader(content)).(io.ReaderAt)
+	if !ok {
+		t.Fatal("limitUploadReader() hides io.ReaderAt")
+	}
+	if _, ok := reader.(io.Seeker); !ok {
+		t.Fatal("limitUploadReader() hides io.Seeker")
+	}
+	start = time.Now()
+	if n, err := reader.ReadAt(make([]byte, 64*1024), 32*1024); err != nil || n != 64*1024 {
+		t.Fatalf("ReadAt() = %d, %v", n, err)
+	}
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Fatalf("read at in %v, the limit isn't applied", elapsed)
+	}
+
+	setUploadBandwidthLimit(0)
+	if reader := bytes.NewReader(content); limitUploadReader(reader) != io.Reader(reader) {
+		t.Fatal("limitUploadReader() wraps the reader without limit")
+	}
+}
+
+func TestInUploadWindow(t *testing.T) {
+	// Sunday only between 01:00 and 02:00, the other days always.
+	timetable := []*models.Timetable{{Start1: 3600, End1: 7200}}
+	config := models.Config{Timezone: "UTC", UploadSchedule: &models.UploadSchedule{Timetable: timetable}}
+
+	sunday := time.Date(2024, 1, 7, 0, 30, 0, 0, time.UTC)
+	if inUploadWindow(config, sunday) {
+		t.Fatal("inUploadWindow() = true outside of the window")
+	}
+	if !inUploadWindow(config, sunday.Add(time.Hour)) {
+		t.Fatal("inUploadWindow() = false within the window")
+	}
+	if !inUploadWindow(config, sunday.Add(24*time.Hour)) {
+		t.Fatal("inUploadWindow() = false on a day without entry")
+	}
+	if !inUploadWindow(models.Config{}, sunday) {
+		t.Fatal("inUploadWindow() = false without upload schedule")
+	}
+}
+
+func TestSortUploadQueue(t *testing.T) {
+	directory := t.TempDir()
+	names := []string{
+		"1704200000_6-967003_front_0-0-0-0_0_60000.metadata",
+		"1704200100_6-967003_front_200-200-400-400_24_8000.metadata",
+		"1704200200_6-967003_front_0-0-0-0_0_60000.metadata",
+		"1704200300_6-967003_front_0-0-0-0_-1_10000.metadata",
+	}
+	for _, name := range names {
+		os.WriteFile(filepath.Join(directory, name), nil, 0644)
+	}
+
+	for _, test := range []struct {
+		order string
+		want  []string
+	}{
+		{"", []string{names[3], names[1], names[2], names[0]}},
+		{"oldest", names},
+	} {
+		files, _ := os.ReadDir(directory)
+		var infos []os.FileInfo
+		for _, f := range files {
+			info, _ := f.Info()
+			infos = append(infos, info)
+		}
+		sortUploadQueue(infos, models.Config{UploadSchedule: &models.UploadSchedule{Order: test.order}})
+		for i, info := range infos {
+			if info.Name() != test.want[i] {
+				t.Fatalf("order %q: position %d = %s, want %s", test.order, i, info.Name(), test.want[i])
+			}
+		}
+	}
+}
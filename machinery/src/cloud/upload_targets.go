@@ -0,0 +1,320 @@
+package cloud
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kerberos-io/agent/machinery/src/log"
+	"github.com/kerberos-io/agent/machinery/src/models"
+	"github.com/kerberos-io/agent/machinery/src/utils"
+)
+
+const (
+	// A best effort target gives up on a recording after this many attempts.
+	uploadTargetOptionalAttempts = 3
+	uploadTargetMinBackoff       = 5 * time.Second
+	uploadTargetMaxBackoff       = 5 * time.Minute
+)
+
+// uploadTargetStatuses keeps the retry/backoff state of every upload target,
+// by target name. It is also what the dashboard shows.
+var uploadTargetStatuses = map[string]*models.UploadTargetStatus{}
+var uploadTargetStatusesMutex sync.Mutex
+
+// uploadLocks serializes the upload loop and the queue actions (retry, cancel)
+// on a recording, so they don't overwrite each other's markers. A lock is
+// dropped once nobody holds or waits for it.
+var uploadLocks = map[string]*uploadLock{}
+var uploadLocksMutex sync.Mutex
+
+type uploadLock struct {
+	sync.Mutex
+	users int
+}
+
+// lockUpload locks the markers of the recording, and returns the function
+// which unlocks them.
+func lockUpload(fileName string) func() {
+	uploadLocksMutex.Lock()
+	lock, ok := uploadLocks[fileName]
+	if !ok {
+		lock = &uploadLock{}
+		uploadLocks[fileName] = lock
+	}
+	lock.users++
+	uploadLocksMutex.Unlock()
+
+	lock.Lock()
+	return func() {
+		lock.Unlock()
+		uploadLocksMutex.Lock()
+		lock.users--
+		if lock.users == 0 {
+			delete(uploadLocks, fileName)
+		}
+		uploadLocksMutex.Unlock()
+	}
+}
+
+// uploadTargets returns the targets a recording is uploaded to. Without
+// UploadTargets this is a single, required, target: Cloud.
+func uploadTargets(config models.Config) []*models.UploadTarget {
+	var targets []*models.UploadTarget
+	for _, target := range config.UploadTargets {
+		if target != nil && target.Name != "" && target.Cloud != "" {
+			targets = append(targets, target)
+		}
+	}
+	if len(targets) == 0 {
+		targets = append(targets, &models.UploadTarget{Name: config.Cloud, Cloud: config.Cloud})
+	}
+	return targets
+}
+
+func uploadTargetRequired(target *models.UploadTarget) bool {
+	return target.Required != "false"
+}
+
+// uploadTargetConfiguration returns a copy of the configuration with Cloud and
+// the backend settings of the target, so the regular uploaders can be used.
+func uploadTargetConfiguration(configuration *models.Configuration, target *models.UploadTarget) *models.Configuration {
+	targetConfiguration := *configuration
+	config := &targetConfiguration.Config
+	config.Cloud = target.Cloud
+	if target.KStorage != nil {
+		config.KStorage = target.KStorage
+	}
+	if target.Dropbox != nil {
+		config.Dropbox = target.Dropbox
+	}
+	if target.FTP != nil {
+		config.FTP = target.FTP
+	}
+	if target.WebDAV != nil {
+		config.WebDAV = target.WebDAV
+	}
+	if target.MinIO != nil {
+		config.MinIO = target.MinIO
+	}
+	return &targetConfiguration
+}
+
+// uploadRecording uploads the recording with the backend selected by Cloud. A
+// backend which is unknown or not implemented isn't configured, with an error.
+func uploadRecording(configuration *models.Configuration, fileName string) (uploaded bool, configured bool, err error) {
+	config := configuration.Config
+	if config.Cloud == "s3" || config.Cloud == "kerberoshub" {
+		uploaded, configured, err = UploadKerberosHub(configuration, fileName)
+	} else if config.Cloud == "kstorage" || config.Cloud == "kerberosvault" {
+		uploaded, configured, err = UploadKerberosVault(configuration, fileName)
+	} else if config.Cloud == "dropbox" {
+		uploaded, configured, err = UploadDropbox(configuration, fileName)
+	} else if config.Cloud == "minio" {
+		uploaded, configured, err = UploadMinIO(configuration, fileName)
+	} else if config.Cloud == "webdav" {
+		uploaded, configured, err = UploadWebDAV(configuration, fileName)
+	} else if config.Cloud == "ftp" {
+		uploaded, configured, err = UploadFTP(configuration, fileName)
+	} else if config.Cloud == "sftp" {
+		uploaded, configured, err = UploadSFTP(configuration, fileName)
+	} else if config.Cloud == "aws" {
+		// Todo: need to be updated, was previously used for hub.
+		uploaded, configured, err = UploadS3(configuration, fileName)
+	} else if config.Cloud == "gdrive" || config.Cloud == "onedrive" || config.Cloud == "azure" || config.Cloud == "google" {
+		// Todo: implement gdrive, onedrive, azure and google upload
+		err = errors.New("upload to " + config.Cloud + " is not implemented")
+	} else {
+		err = errors.New("unknown upload backend \"" + config.Cloud + "\"")
+	}
+	// And so on... (have a look here -> https://github.com/kerberos-io/agent/issues/95)
+	return uploaded, configured, err
+}
+
+// uploadTargetDirectory is where the per target markers are kept. Like the tus
+// sidecars it lives outside data/cloud, which is scanned for recordings.
+func uploadTargetDirectory(configDirectory string, target string) string {
+	return filepath.Join(configDirectory, "data", "uploads", sanitizeUploadPathSegment(target))
+}
+
+func uploadTargetMarkerPath(configDirectory string, target string, markerFileName string) string {
+	return filepath.Join(uploadTargetDirectory(configDirectory, target), markerFileName+".json")
+}
+
+func readUploadTargetMarker(configDirectory string, target string, markerFileName string, fileName string) models.UploadTargetMarker {
+	marker := models.UploadTargetMarker{Target: target, FileName: fileName, Status: models.UploadTargetPending}
+	if value, err := os.ReadFile(uploadTargetMarkerPath(configDirectory, target, markerFileName)); err == nil {
+		json.Unmarshal(value, &marker)
+	}
+	return marker
+}
+
+func writeUploadTargetMarker(configDirectory string, markerFileName string, marker models.UploadTargetMarker) {
+	directory := uploadTargetDirectory(configDirectory, marker.Target)
+	if err := os.MkdirAll(directory, 0755); err != nil {
+		log.Log.Error("cloud.writeUploadTargetMarker(): " + err.Error())
+		return
+	}
+	value, _ := json.Marshal(marker)
+	if err := os.WriteFile(uploadTargetMarkerPath(configDirectory, marker.Target, markerFileName), value, 0644); err != nil {
+		log.Log.Error("cloud.writeUploadTargetMarker(): " + err.Error())
+	}
+}
+
+func removeUploadTargetMarkers(configDirectory string, targets []*models.UploadTarget, markerFileName string) {
+	for _, target := range targets {
+		os.Remove(uploadTargetMarkerPath(configDirectory, target.Name, markerFileName))
+	}
+}
+
+// pruneUploadTargetMarkers removes the target markers of recordings which are
+// no longer queued, e.g. because auto-clean removed them.
+func pruneUploadTargetMarkers(configDirectory string, targets []*models.UploadTarget, queued map[string]bool) {
+	for _, target := range targets {
+		files, _ := utils.ReadDirectory(uploadTargetDirectory(configDirectory, target.Name))
+		for _, f := range files {
+			if !queued[strings.TrimSuffix(f.Name(), ".json")] {
+				os.Remove(filepath.Join(uploadTargetDirectory(configDirectory, target.Name), f.Name()))
+			}
+		}
+	}
+}
+
+func uploadTargetState(target *models.UploadTarget) *models.UploadTargetStatus {
+	status, ok := uploadTargetStatuses[target.Name]
+	if !ok {
+		status = &models.UploadTargetStatus{Name: target.Name}
+		uploadTargetStatuses[target.Name] = status
+	}
+	status.Cloud = target.Cloud
+	status.Required = uploadTargetRequired(target)
+	return status
+}
+
+// uploadTargetBackingOff tells if the target failed recently, in which case
+// it is skipped until the backoff expires.
+func uploadTargetBackingOff(target *models.UploadTarget, now time.Time) bool {
+	uploadTargetStatusesMutex.Lock()
+	defer uploadTargetStatusesMutex.Unlock()
+	return uploadTargetState(target).RetryAt > now.Unix()
+}
+
+func recordUploadTargetResult(target *models.UploadTarget, uploaded bool, err error, now time.Time) {
+	uploadTargetStatusesMutex.Lock()
+	defer uploadTargetStatusesMutex.Unlock()
+	status := uploadTargetState(target)
+	if uploaded {
+		status.Uploaded++
+		status.Failures = 0
+		status.LastError = ""
+		status.LastSuccess = now.Unix()
+		status.RetryAt = 0
+		return
+	}
+
+	status.Failures++
+	if err != nil {
+		status.LastError = err.Error()
+	}
+	backoff := uploadTargetMinBackoff << uint(min(status.Failures-1, 10))
+	if backoff > uploadTargetMaxBackoff {
+		backoff = uploadTargetMaxBackoff
+	}
+	status.RetryAt = now.Add(backoff).Unix()
+}
+
+func setUploadTargetsPending(targets []*models.UploadTarget, pending map[string]int) {
+	uploadTargetStatusesMutex.Lock()
+	defer uploadTargetStatusesMutex.Unlock()
+	for _, target := range targets {
+		uploadTargetState(target).Pending = pending[target.Name]
+	}
+}
+
+// GetUploadTargetStatus returns the status of the configured upload targets.
+func GetUploadTargetStatus(configuration *models.Configuration) []models.UploadTargetStatus {
+	uploadTargetStatusesMutex.Lock()
+	defer uploadTargetStatusesMutex.Unlock()
+	statuses := []models.UploadTargetStatus{}
+	for _, target := range uploadTargets(configuration.Config) {
+		if target.Cloud == "" {
+			continue
+		}
+		statuses = append(statuses, *uploadTargetState(target))
+	}
+	sort.SliceStable(statuses, func(i, j int) bool {
+		return statuses[i].Required && !statuses[j].Required
+	})
+	return statuses
+}
+
+// uploadMarker uploads a queued recording to every target which doesn't have
+// it yet. It returns whether an upload was attempted, whether one of them
+// failed, whether the recording is done (every required target has it or
+// isn't configured, every best effort target succeeded or gave up) and
+// whether it was replicated (done, and every required target has it).
+// pending counts, per target, the recordings still to upload.
+func uploadMarker(configDirectory string, configuration *models.Configuration, targets []*models.UploadTarget, markerFileName string, pending map[string]int) (attempted bool, failed bool, done bool, replicated bool) {
+	fileName := models.RecordingFileNameFromUploadMarker(markerFileName)
+	if _, err := os.Stat(configDirectory + "/data/recordings/" + fileName); os.IsNotExist(err) {
+		// The recording is gone, there is nothing left to upload.
+		return false, false, true, false
+	}
+	done = true
+	uploadedAny := false
+	skippedRequired := false
+	for _, target := range targets {
+		marker := readUploadTargetMarker(configDirectory, target.Name, markerFileName, fileName)
+
+		if marker.Status == models.UploadTargetPending {
+			now := time.Now()
+			if uploadTargetBackingOff(target, now) {
+				done = false
+				pending[target.Name]++
+				continue
+			}
+
+			attempted = true
+			uploaded, configured, err := uploadRecording(uploadTargetConfiguration(configuration, target), fileName)
+			if !configured && err == nil {
+				err = errors.New("the recording could not be read")
+			}
+
+			marker.LastAttempt = now.Unix()
+			if uploaded {
+				marker.Status = models.UploadTargetUploaded
+				marker.LastError = ""
+				recordUploadTargetResult(target, true, nil, now)
+			} else if !configured {
+				log.Log.Error("HandleUpload: " + target.Name + ": " + err.Error())
+				marker.Status = models.UploadTargetSkipped
+				marker.LastError = err.Error()
+			} else {
+				failed = true
+				marker.Attempts++
+				if err != nil {
+					log.Log.Error("HandleUpload: " + target.Name + ": " + err.Error())
+					marker.LastError = err.Error()
+				}
+				recordUploadTargetResult(target, false, err, now)
+				if !uploadTargetRequired(target) && marker.Attempts >= uploadTargetOptionalAttempts {
+					log.Log.Warning("HandleUpload: " + target.Name + ": giving up on " + fileName)
+					marker.Status = models.UploadTargetFailed
+				} else {
+					done = false
+					pending[target.Name]++
+				}
+			}
+			writeUploadTargetMarker(configDirectory, markerFileName, marker)
+		}
+
+		uploadedAny = uploadedAny || marker.Status == models.UploadTargetUploaded
+		skippedRequired = skippedRequired || (uploadTargetRequired(target) && marker.Status == models.UploadTargetSkipped)
+	}
+	return attempted, failed, done, done && uploadedAny && !skippedRequired
+}
@@ -0,0 +1,177 @@
+package cloud
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/kerberos-io/agent/machinery/src/models"
+	"golang.org/x/net/webdav"
+)
+
+func resetUploadTargetStatuses(t *testing.T) {
+	uploadTargetStatusesMutex.Lock()
+	uploadTargetStatuses = map[string]*models.UploadTargetStatus{}
+	uploadTargetStatusesMutex.Unlock()
+	t.Cleanup(func() {
+		uploadTargetStatusesMutex.Lock()
+		uploadTargetStatuses = map[string]*models.UploadTargetStatus{}
+		uploadTargetStatusesMutex.Unlock()
+	})
+}
+
+func TestUploadMarkerWaitsForEveryRequiredTarget(t *testing.T) {
+	resetUploadTargetStatuses(t)
+	configDirectory := t.TempDir()
+	t.Chdir(configDirectory)
+
+	fileName := "1704200000_6-967003_front_0-0-0-0_0_0.mp4"
+	markerFileName := models.RecordingUploadMetadataFileName(fileName)
+	os.MkdirAll(filepath.Join("data", "recordings"), 0755)
+	os.WriteFile(filepath.Join("data", "recordings", fileName), []byte("recording"), 0644)
+
+	storage := t.TempDir()
+	healthy := httptest.NewServer(&webdav.Handler{FileSystem: webdav.Dir(storage), LockSystem: webdav.NewMemLS()})
+	defer healthy.Close()
+	var down atomic.Bool
+	down.Store(true)
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if down.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer flaky.Close()
+
+	targets := []*models.UploadTarget{
+		{Name: "primary", Cloud: "webdav", WebDAV: &models.WebDAV{URL: healthy.URL}},
+		{Name: "secondary", Cloud: "webdav", WebDAV: &models.WebDAV{URL: flaky.URL}},
+	}
+	configuration := &models.Configuration{}
+
+	attempted, failed, done, _ := uploadMarker(configDirectory, configuration, targets, markerFileName, map[string]int{})
+	if !attempted || !failed || done {
+		t.Fatalf("first pass: attempted=%v failed=%v done=%v, want an attempt which isn't done", attempted, failed, done)
+	}
+	if _, err := os.Stat(filepath.Join(storage, fileName)); err != nil {
+		t.Fatalf("primary target didn't receive the recording: %v", err)
+	}
+	if marker := readUploadTargetMarker(configDirectory, "secondary", markerFileName, fileName); marker.Attempts != 1 || marker.LastError == "" {
+		t.Fatalf("secondary marker = %+v, want one failed attempt", marker)
+	}
+
+	// The secondary target backs off, the primary one isn't uploaded again.
+	pending := map[string]int{}
+	attempted, _, done, _ = uploadMarker(configDirectory, configuration, targets, markerFileName, pending)
+	if attempted || done || pending["secondary"] != 1 || pending["primary"] != 0 {
+		t.Fatalf("backoff pass: attempted=%v done=%v pending=%v", attempted, done, pending)
+	}
+
+	down.Store(false)
+	uploadTargetStatusesMutex.Lock()
+	uploadTargetStatuses["secondary"].RetryAt = 0
+	uploadTargetStatusesMutex.Unlock()
+
+	attempted, failed, done, replicated := uploadMarker(configDirectory, configuration, targets, markerFileName, map[string]int{})
+	if !attempted || failed || !done || !replicated {
+		t.Fatalf("retry pass: attempted=%v failed=%v done=%v replicated=%v, want the recording replicated", attempted, failed, done, replicated)
+	}
+
+	statuses := GetUploadTargetStatus(&models.Configuration{Config: models.Config{UploadTargets: targets}})
+	if len(statuses) != 2 || statuses[0].Uploaded != 1 || statuses[1].Uploaded != 1 || statuses[1].Failures != 0 {
+		t.Fatalf("statuses = %+v", statuses)
+	}
+}
+
+func TestUploadMarkerGivesUpOnOptionalTarget(t *testing.T) {
+	resetUploadTargetStatuses(t)
+	configDirectory := t.TempDir()
+	t.Chdir(configDirectory)
+
+	fileName := "1704200000_6-967003_front_0-0-0-0_0_0.mp4"
+	markerFileName := models.RecordingUploadMetadataFileName(fileName)
+	os.MkdirAll(filepath.Join("data", "recordings"), 0755)
+	os.WriteFile(filepath.Join("data", "recordings", fileName), []byte("recording"), 0644)
+
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+
+	targets := []*models.UploadTarget{
+		{Name: "archive", Cloud: "webdav", Required: "false", WebDAV: &models.WebDAV{URL: down.URL}},
+	}
+	configuration := &models.Configuration{}
+
+	for attempt := 1; attempt <= uploadTargetOptionalAttempts; attempt++ {
+		uploadTargetStatusesMutex.Lock()
+		if status, ok := uploadTargetStatuses["archive"]; ok {
+			status.RetryAt = 0
+		}
+		uploadTargetStatusesMutex.Unlock()
+
+		_, _, done, replicated := uploadMarker(configDirectory, configuration, targets, markerFileName, map[string]int{})
+		if replicated {
+			t.Fatal("a recording which wasn't uploaded is reported as replicated")
+		}
+		if done != (attempt == uploadTargetOptionalAttempts) {
+			t.Fatalf("attempt %d: done = %v", attempt, done)
+		}
+	}
+	if marker := readUploadTargetMarker(configDirectory, "archive", markerFileName, fileName); marker.Status != models.UploadTargetFailed {
+		t.Fatalf("marker status = %q, want %q", marker.Status, models.UploadTargetFailed)
+	}
+}
+
+func TestUploadMarkerDropsMissingRecording(t *testing.T) {
+	resetUploadTargetStatuses(t)
+	configDirectory := t.TempDir()
+	t.Chdir(configDirectory)
+
+	targets := uploadTargets(models.Config{Cloud: "webdav", WebDAV: &models.WebDAV{URL: "http://127.0.0.1:1"}})
+	configuration := &models.Configuration{Config: models.Config{Cloud: "webdav", WebDAV: &models.WebDAV{URL: "http://127.0.0.1:1"}}}
+
+	_, _, done, replicated := uploadMarker(configDirectory, configuration, targets, "1704200000_missing.metadata", map[string]int{})
+	if !done || replicated {
+		t.Fatalf("done=%v replicated=%v, want the marker dropped without replication", done, replicated)
+	}
+}
+
+func TestUploadMarkerSkipsUnknownTarget(t *testing.T) {
+	resetUploadTargetStatuses(t)
+	configDirectory := t.TempDir()
+	t.Chdir(configDirectory)
+
+	fileName := "1704200000_6-967003_front_0-0-0-0_0_0.mp4"
+	markerFileName := models.RecordingUploadMetadataFileName(fileName)
+	os.MkdirAll(filepath.Join("data", "recordings"), 0755)
+	os.WriteFile(filepath.Join("data", "recordings", fileName), []byte("recording"), 0644)
+
+	storage := t.TempDir()
+	healthy := httptest.NewServer(&webdav.Handler{FileSystem: webdav.Dir(storage), LockSystem: webdav.NewMemLS()})
+	defer healthy.Close()
+
+	targets := []*models.UploadTarget{
+		{Name: "primary", Cloud: "webdav", WebDAV: &models.WebDAV{URL: healthy.URL}},
+		{Name: "typo", Cloud: "webdva"},
+	}
+	configuration := &models.Configuration{}
+
+	_, _, done, replicated := uploadMarker(configDirectory, configuration, targets, markerFileName, map[string]int{})
+	if !done || replicated {
+		t.Fatalf("done=%v replicated=%v, want the marker done without replication", done, replicated)
+	}
+	if _, err := os.Stat(filepath.Join(storage, fileName)); err != nil {
+		t.Fatalf("primary target didn't receive the recording: %v", err)
+	}
+	if marker := readUploadTargetMarker(configDirectory, "typo", markerFileName, fileName); marker.Status != models.UploadTargetSkipped || marker.LastError == "" {
+		t.Fatalf("typo marker = %+v, want it skipped with an error", marker)
+	}
+	if _, err := os.Stat(filepath.Join("data", "recordings", fileName)); err != nil {
+		t.Fatalf("the recording was removed: %v", err)
+	}
+}
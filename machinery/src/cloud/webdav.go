@@ -0,0 +1,202 @@
+package cloud
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kerberos-io/agent/machinery/src/log"
+	"github.com/kerberos-io/agent/machinery/src/models"
+)
+
+const webdavDefaultChunkSize = 10 // MB
+
+// nextcloudFilesPattern matches the files endpoint of a Nextcloud (or ownCloud
+// Infinite Scale) WebDAV URL; the chunked upload API lives next to it.
+var nextcloudFilesPattern = regexp.MustCompile(`^(.*/remote\.php/dav)/files/([^/]+)`)
+
+// UploadWebDAV uploads the recording to a WebDAV server, creating the directory
+// (MKCOL) first. Large recordings are uploaded in chunks when the server
+// supports the Nextcloud chunked upload API, and with a single streaming PUT
+// otherwise.
+func UploadWebDAV(configuration *models.Configuration, fileName string) (bool, bool, error) {
+
+	config := configuration.Config
+
+	if config.WebDAV == nil || config.WebDAV.URL == "" {
+		err := "UploadWebDAV: WebDAV not properly configured"
+		log.Log.Info(err)
+		return false, false, errors.New(err)
+	}
+
+	file, err := os.Open("data/recordings/" + fileName)
+	if err != nil {
+		log.Log.Info("UploadWebDAV: skipping " + fileName + ", file doesn't exist anymore")
+		return false, false, nil
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return false, true, err
+	}
+
+	log.Log.Info("UploadWebDAV: Uploading to " + config.WebDAV.URL)
+	log.Log.Info("UploadWebDAV: Upload started for " + fileName)
+
+	directory := renderUploadDirectory(config.WebDAV.Directory, config, fileName)
+	if err := storeWebDAV(config.WebDAV, directory, fileName, limitUploadReader(file), info.Size()); err != nil {
+		log.Log.Error("UploadWebDAV: " + err.Error())
+		return false, true, err
+	}
+
+	log.Log.Info("UploadWebDAV: File uploaded successfully, " + uploadPath(directory, fileName))
+	return true, true, nil
+}
+
+// VerifyWebDAV verifies the WebDAV settings by uploading and removing a test
+// file.
+func VerifyWebDAV(config models.Config, c *gin.Context) {
+	if config.WebDAV == nil || config.WebDAV.URL == "" {
+		c.JSON(400, models.APIResponse{
+			Data: "WebDAV url is not set.",
+		})
+		return
+	}
+
+	fileName := "kerberos-agent-test.mp4"
+	directory := renderUploadDirectory(config.WebDAV.Directory, config, fileName)
+	if err := storeWebDAV(config.WebDAV, directory, fileName, bytes.NewReader(TestFile), int64(len(TestFile))); err != nil {
+		c.JSON(400, models.APIResponse{
+			Data: "Something went wrong while uploading to the WebDAV server: " + err.Error(),
+		})
+		return
+	}
+	if _, err := webdavRequest(config.WebDAV, http.MethodDelete, webdavURL(config.WebDAV.URL, uploadPath(directory, fileName)), nil, -1, nil); err != nil {
+		log.Log.Warning("cloud.VerifyWebDAV(): could not remove test file: " + err.Error())
+	}
+	c.JSON(200, models.APIResponse{
+		Data: "WebDAV is working fine.",
+	})
+}
+
+func storeWebDAV(settings *models.WebDAV, directory string, fileName string, content io.Reader, size int64) error {
+	if err := mkcolWebDAV(settings, directory); err != nil {
+		return err
+	}
+
+	target := webdavURL(settings.URL, uploadPath(directory, fileName))
+	chunkSize := int64(settings.ChunkSize)
+	if chunkSize <= 0 {
+		chunkSize = webdavDefaultChunkSize
+	}
+	chunkSize = chunkSize * 1024 * 1024
+	if size > chunkSize && nextcloudFilesPattern.MatchString(settings.URL) {
+		return chunkedUploadNextcloud(settings, target, content, size, chunkSize)
+	}
+
+	_, err := webdavRequest(settings, http.MethodPut, target, content, size, nil)
+	return err
+}
+
+// mkcolWebDAV creates the directory one level at a time. A 405 response means
+// the collection already exists.
+func mkcolWebDAV(settings *models.WebDAV, directory string) error {
+	current := ""
+	for _, segment := range strings.Split(directory, "/") {
+		if segment == "" {
+			continue
+		}
+		current = uploadPath(current, segment)
+		status, err := webdavRequest(settings, "MKCOL", webdavURL(settings.URL, current)+"/", nil, -1, nil)
+		if err != nil && status != http.StatusMethodNotAllowed {
+			return errors.New("could not create " + current + ": " + err.Error())
+		}
+	}
+	return nil
+}
+
+// chunkedUploadNextcloud implements the Nextcloud chunked upload (v2): the
+// chunks are stored in a temporary upload collection and assembled on the
+// server by moving the virtual ".file" to the destination.
+func chunkedUploadNextcloud(settings *models.WebDAV, target string, content io.Reader, size int64, chunkSize int64) error {
+	match := nextcloudFilesPattern.FindStringSubmatch(settings.URL)
+	uploads := match[1] + "/uploads/" + match[2] + "/kerberos-" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	headers := map[string]string{
+		"Destination":     target,
+		"OC-Total-Length": strconv.FormatInt(size, 10),
+	}
+
+	if _, err := webdavRequest(settings, "MKCOL", uploads, nil, -1, headers); err != nil {
+		return errors.New("could not start chunked upload: " + err.Error())
+	}
+
+	chunk := 1
+	for offset := int64(0); offset < size; offset += chunkSize {
+		length := chunkSize
+		if size-offset < length {
+			length = size - offset
+		}
+		name := strings.Repeat("0", 5-len(strconv.Itoa(chunk))) + strconv.Itoa(chunk)
+		if _, err := webdavRequest(settings, http.MethodPut, uploads+"/"+name, io.LimitReader(content, length), length, headers); err != nil {
+			webdavRequest(settings, http.MethodDelete, uploads, nil, -1, nil)
+			return errors.New("could not upload chunk " + name + ": " + err.Error())
+		}
+		chunk++
+	}
+
+	if _, err := webdavRequest(settings, "MOVE", uploads+"/.file", nil, -1, headers); err != nil {
+		webdavRequest(settings, http.MethodDelete, uploads, nil, -1, nil)
+		return errors.New("could not assemble chunks: " + err.Error())
+	}
+	return nil
+}
+
+// webdavRequest performs a request and returns the status code. A size of -1
+// means the request has no (known) length.
+func webdavRequest(settings *models.WebDAV, method string, endpoint string, body io.Reader, size int64, headers map[string]string) (int, error) {
+	req, err := http.NewRequest(method, endpoint, body)
+	if err != nil {
+		return 0, err
+	}
+	if size >= 0 && body != nil {
+		req.ContentLength = size
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	if settings.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+settings.Token)
+	} else if settings.Username != "" {
+		req.SetBasicAuth(settings.Username, settings.Password)
+	}
+
+	// No overall timeout: a large recording may take a while to stream, the
+	// transport timeouts catch a server that went away.
+	resp, err := newVaultHTTPClient(0).Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, errors.New(method + " " + resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// webdavURL joins the base URL and a relative path, escaping every segment.
+func webdavURL(base string, relative string) string {
+	segments := strings.Split(relative, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.TrimSuffix(base, "/") + "/" + strings.Join(segments, "/")
+}
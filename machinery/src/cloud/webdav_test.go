@@ -0,0 +1,110 @@
+package cloud
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/kerberos-io/agent/machinery/src/models"
+	"golang.org/x/net/webdav"
+)
+
+func TestStoreWebDAVAgainstWebDAVServer(t *testing.T) {
+	root := t.TempDir()
+	handler := &webdav.Handler{
+		FileSystem: webdav.Dir(root),
+		LockSystem: webdav.NewMemLS(),
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "agent" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	settings := &models.WebDAV{URL: server.URL + "/", Username: "agent", Password: "secret"}
+	content := []byte("recording")
+	for i := 0; i < 2; i++ {
+		// The second upload hits existing collections (MKCOL returns 405).
+		if err := storeWebDAV(settings, "front door/2024/01", "video.mp4", bytes.NewReader(content), int64(len(content))); err != nil {
+			t.Fatalf("storeWebDAV() error = %v", err)
+		}
+	}
+
+	stored, err := os.ReadFile(filepath.Join(root, "front door", "2024", "01", "video.mp4"))
+	if err != nil {
+		t.Fatalf("read uploaded file: %v", err)
+	}
+	if !bytes.Equal(stored, content) {
+		t.Fatalf("uploaded content = %q, want %q", stored, content)
+	}
+
+	settings.Password = "wrong"
+	if err := storeWebDAV(settings, "", "video.mp4", bytes.NewReader(content), int64(len(content))); err == nil {
+		t.Fatal("storeWebDAV() with wrong credentials: error = nil, want an error")
+	}
+}
+
+func TestStoreWebDAVNextcloudChunkedUpload(t *testing.T) {
+	var mutex sync.Mutex
+	chunks := map[string][]byte{}
+	var assembled []byte
+	var destination, authorization string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		authorization = r.Header.Get("Authorization")
+		switch {
+		case r.Method == "MKCOL":
+			w.WriteHeader(http.StatusCreated)
+		case r.Method == http.MethodPut && strings.Contains(r.URL.Path, "/uploads/agent/"):
+			body, _ := io.ReadAll(r.Body)
+			chunks[filepath.Base(r.URL.Path)] = body
+			w.WriteHeader(http.StatusCreated)
+		case r.Method == "MOVE" && strings.HasSuffix(r.URL.Path, "/.file"):
+			names := make([]string, 0, len(chunks))
+			for name := range chunks {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				assembled = append(assembled, chunks[name]...)
+			}
+			destination = r.Header.Get("Destination")
+			w.WriteHeader(http.StatusCreated)
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	settings := &models.WebDAV{URL: server.URL + "/remote.php/dav/files/agent", Token: "token", ChunkSize: 1}
+	content := bytes.Repeat([]byte("0123456789"), 250*1024) // 2.5MB, three chunks
+	if err := storeWebDAV(settings, "front", "video.mp4", bytes.NewReader(content), int64(len(content))); err != nil {
+		t.Fatalf("storeWebDAV() error = %v", err)
+	}
+
+	if len(chunks) != 3 {
+		t.Fatalf("chunks = %d, want 3", len(chunks))
+	}
+	if !bytes.Equal(assembled, content) {
+		t.Fatal("assembled content differs from the recording")
+	}
+	if want := server.URL + "/remote.php/dav/files/agent/front/video.mp4"; destination != want {
+		t.Fatalf("Destination = %q, want %q", destination, want)
+	}
+	if authorization != "Bearer token" {
+		t.Fatalf("Authorization = %q, want the bearer token", authorization)
+	}
+}
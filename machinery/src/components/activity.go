@@ -0,0 +1,99 @@
+package components
+
+import (
+	"bytes"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kerberos-io/agent/machinery/src/computervision"
+	"github.com/kerberos-io/agent/machinery/src/models"
+)
+
+// GetActivityHeatmap godoc
+// @Router /api/activity/heatmap [get]
+// @ID activity-heatmap
+// @Tags activity
+// @Param from query int false "Start of the range, unix seconds (default 24 hours ago, at most 31 days before to)"
+// @Param to query int false "End of the range, unix seconds (default now)"
+// @Param format query string false "json (default) or png"
+// @Summary Get the motion heatmap of a time range.
+// @Description Get how often motion was detected in every cell of a grid over the frame, per hour, summed over the range. As png the heatmap can be laid over a snapshot.
+// @Success 200 {object} models.ActivityHeatmap
+func GetActivityHeatmap(c *gin.Context, configDirectory string, configuration *models.Configuration) {
+	from, to, ok := activityRange(c, configuration)
+	if !ok {
+		return
+	}
+	heatmap := computervision.GetActivityHeatmap(configDirectory, from, to)
+	if c.Query("format") != "png" {
+		c.JSON(200, heatmap)
+		return
+	}
+	var image bytes.Buffer
+	if err := computervision.EncodeHeatmapPNG(&image, heatmap); err != nil {
+		c.JSON(500, models.APIResponse{
+			Data: "Something went wrong: " + err.Error(),
+		})
+		return
+	}
+	c.Data(200, "image/png", image.Bytes())
+}
+
+// GetActivityTimeline godoc
+// @Router /api/activity/timeline [get]
+// @ID activity-timeline
+// @Tags activity
+// @Param from query int false "Start of the range, unix seconds (default 24 hours ago, at most 31 days before to)"
+// @Param to query int false "End of the range, unix seconds (default now)"
+// @Summary Get the motion activity per minute of a time range.
+// @Description Get the number of motion events and changed pixels of every minute with motion within the range.
+// @Success 200
+func GetActivityTimeline(c *gin.Context, configDirectory string, configuration *models.Configuration) {
+	from, to, ok := activityRange(c, configuration)
+	if !ok {
+		return
+	}
+	c.JSON(200, gin.H{
+		"from":     from.Unix(),
+		"to":       to.Unix(),
+		"timeline": computervision.GetActivityTimeline(configDirectory, from, to),
+	})
+}
+
+// activityRange reads the from and to query parameters, in the timezone of
+// the agent: the last 24 hours by default. The range can't be longer than the
+// activity is kept.
+func activityRange(c *gin.Context, configuration *models.Configuration) (time.Time, time.Time, bool) {
+	loc, err := time.LoadLocation(configuration.Config.Timezone)
+	if err != nil {
+		loc = time.Local
+	}
+	to := time.Now().In(loc)
+	if value := c.Query("to"); value != "" {
+		seconds, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			c.JSON(400, models.APIResponse{Data: "Invalid to: " + value})
+			return to, to, false
+		}
+		to = time.Unix(seconds, 0).In(loc)
+	}
+	from := to.Add(-24 * time.Hour)
+	if value := c.Query("from"); value != "" {
+		seconds, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			c.JSON(400, models.APIResponse{Data: "Invalid from: " + value})
+			return from, to, false
+		}
+		from = time.Unix(seconds, 0).In(loc)
+	}
+	if !from.Before(to) {
+		c.JSON(400, models.APIResponse{Data: "from should be before to."})
+		return from, to, false
+	}
+	if to.Sub(from) > computervision.ActivityRetention {
+		c.JSON(400, models.APIResponse{Data: "The range should not be longer than " + strconv.Itoa(int(computervision.ActivityRetention/(24*time.Hour))) + " days."})
+		return from, to, false
+	}
+	return from, to, true
+}
@@ -0,0 +1,36 @@
+package components
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kerberos-io/agent/machinery/src/models"
+)
+
+func TestActivityRange(t *testing.T) {
+	configuration := &models.Configuration{}
+	configuration.Config.Timezone = "UTC"
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/api/activity/timeline", func(c *gin.Context) {
+		GetActivityTimeline(c, t.TempDir(), configuration)
+	})
+
+	for query, code := range map[string]int{
+		"":                               http.StatusOK,
+		"?from=1700000000&to=1700086400": http.StatusOK,
+		"?from=1700086400&to=1700000000": http.StatusBadRequest,
+		"?from=1700000000&to=1702678400": http.StatusOK, // 31 days.
+		"?from=1700000000&to=1702678401": http.StatusBadRequest,
+		"?from=0&to=1700000000":          http.StatusBadRequest,
+		"?from=yesterday&to=1700000000":  http.StatusBadRequest,
+	} {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest("GET", "/api/activity/timeline"+query, nil))
+		if recorder.Code != code {
+			t.Errorf("GET %q = %d, want %d", query, recorder.Code, code)
+		}
+	}
+}
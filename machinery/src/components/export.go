@@ -0,0 +1,504 @@
+package components
+
+import (
+	"cmp"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kerberos-io/agent/machinery/src/encryption"
+	"github.com/kerberos-io/agent/machinery/src/log"
+	"github.com/kerberos-io/agent/machinery/src/models"
+	"github.com/kerberos-io/agent/machinery/src/recordings"
+	"github.com/kerberos-io/agent/machinery/src/utils"
+	"github.com/kerberos-io/agent/machinery/src/video"
+)
+
+const (
+	// The longest time range of an export.
+	maxExportRange = 24 * time.Hour
+	// Finished exports are removed after this time.
+	exportRetention = 7 * 24 * time.Hour
+)
+
+// exportJob is an export and the function to cancel it.
+type exportJob struct {
+	export models.Export
+	cancel context.CancelFunc
+}
+
+// The exports, they are written one at a time (exportSlot) to data/exports.
+// A finished export is kept there with its details, so it outlives a restart
+// (see LoadExports).
+var (
+	exportsMutex sync.Mutex
+	exports      = map[string]*exportJob{}
+	exportSlot   = make(chan struct{}, 1)
+)
+
+// CreateExport godoc
+// @Router /api/exports [post]
+// @ID export-create
+// @Security Bearer
+// @Tags recordings
+// @Param exportRequest body models.ExportRequest true "Export request"
+// @Summary Export a time range of the recordings as a single MP4.
+// @Description Start a job which stitches the recordings between start and end into a single MP4, without re-encoding: the clip starts at the keyframe before start. The export can be encrypted with the symmetric key and signed with the private key of the agent.
+// @Success 202 {object} models.Export
+func CreateExport(c *gin.Context, configDirectory string, configuration *models.Configuration) {
+	var request models.ExportRequest
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(400, models.APIResponse{
+			Data: "Something went wrong: " + err.Error(),
+		})
+		return
+	}
+	if request.End <= request.Start {
+		c.JSON(400, models.APIResponse{
+			Data: "The end of the export should be after its start",
+		})
+		return
+	}
+	if time.Duration(request.End-request.Start)*time.Second > maxExportRange {
+		c.JSON(400, models.APIResponse{
+			Data: "An export can't be longer than " + maxExportRange.String(),
+		})
+		return
+	}
+	config := configuration.Config
+	if request.Encrypt && (config.Encryption == nil || config.Encryption.SymmetricKey == "") {
+		c.JSON(400, models.APIResponse{
+			Data: "No symmetric key configured to encrypt the export",
+		})
+		return
+	}
+	if request.Sign && (config.Signing == nil || config.Signing.PrivateKey == "") {
+		c.JSON(400, models.APIResponse{
+			Data: "No private key configured to sign the export",
+		})
+		return
+	}
+
+	sources := exportSources(configDirectory, configuration, request.Start*1000, request.End*1000)
+	if len(sources) == 0 {
+		c.JSON(404, models.APIResponse{
+			Data: "No recordings found between the start and end of the export",
+		})
+		return
+	}
+
+	id := make([]byte, 4)
+	rand.Read(id)
+	ctx, cancel := context.WithCancel(context.Background())
+	job := &exportJob{
+		export: models.Export{
+			ID:      strconv.FormatInt(time.Now().Unix(), 10) + "-" + hex.EncodeToString(id),
+			Status:  models.ExportQueued,
+			Start:   request.Start,
+			End:     request.End,
+			Created: time.Now().Unix(),
+		},
+		cancel: cancel,
+	}
+	exportsMutex.Lock()
+	removeOldExports(configDirectory, time.Now())
+	exports[job.export.ID] = job
+	export := job.export
+	exportsMutex.Unlock()
+
+	go runExport(ctx, job, request, sources, configDirectory, config)
+	c.JSON(202, export)
+}
+
+// GetExports godoc
+// @Router /api/exports [get]
+// @ID exports
+// @Security Bearer
+// @Tags recordings
+// @Summary Get the exports.
+// @Description Get the exports, the newest first. Finished exports are kept for 7 days.
+// @Success 200 {array} models.Export
+func GetExports(c *gin.Context) {
+	exportsMutex.Lock()
+	list := []models.Export{}
+	for _, job := range exports {
+		list = append(list, job.export)
+	}
+	exportsMutex.Unlock()
+	slices.SortFunc(list, func(a models.Export, b models.Export) int {
+		return cmp.Or(cmp.Compare(b.Created, a.Created), cmp.Compare(b.ID, a.ID))
+	})
+	c.JSON(200, list)
+}
+
+// GetExport godoc
+// @Router /api/exports/{id} [get]
+// @ID export
+// @Security Bearer
+// @Tags recordings
+// @Param id path string true "The id of the export"
+// @Summary Get the status and progress of an export.
+// @Description Get the status and progress of an export.
+// @Success 200 {object} models.Export
+func GetExport(c *gin.Context) {
+	export, ok := getExport(c.Param("id"))
+	if !ok {
+		c.JSON(404, models.APIResponse{
+			Data: "Export not found",
+		})
+		return
+	}
+	c.JSON(200, export)
+}
+
+// DownloadExport godoc
+// @Router /api/exports/{id}/download [get]
+// @ID export-download
+// @Security Bearer
+// @Tags recordings
+// @Param id path string true "The id of the export"
+// @Summary Download an export.
+// @Description Download a finished export, as it was written: an encrypted export is not decrypted.
+// @Success 200
+// @Success 206
+func DownloadExport(c *gin.Context, configDirectory string) {
+	export, ok := getExport(c.Param("id"))
+	if !ok || export.Status != models.ExportFinished {
+		c.JSON(404, models.APIResponse{
+			Data: "Export not found",
+		})
+		return
+	}
+	file, err := os.Open(exportPath(configDirectory, export.ID))
+	if err != nil {
+		c.JSON(404, models.APIResponse{
+			Data: "Export not found",
+		})
+		return
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		c.JSON(500, models.APIResponse{
+			Data: "Something went wrong: " + err.Error(),
+		})
+		return
+	}
+	name := "export_" + strconv.FormatInt(export.Start, 10) + "_" + strconv.FormatInt(export.End, 10) + ".mp4"
+	c.Header("Content-Disposition", "attachment; filename=\""+name+"\"")
+	c.Header("Content-Type", "video/mp4")
+	http.ServeContent(c.Writer, c.Request, name, info.ModTime(), file)
+}
+
+// DeleteExport godoc
+// @Router /api/exports/{id} [delete]
+// @ID export-delete
+// @Security Bearer
+// @Tags recordings
+// @Param id path string true "The id of the export"
+// @Summary Cancel or remove an export.
+// @Description Cancel an export which is queued or running, or remove a finished export.
+// @Success 200 {object} models.APIResponse
+func DeleteExport(c *gin.Context, configDirectory string) {
+	id := c.Param("id")
+	exportsMutex.Lock()
+	job, ok := exports[id]
+	if ok {
+		delete(exports, id)
+	}
+	exportsMutex.Unlock()
+	if !ok {
+		c.JSON(404, models.APIResponse{
+			Data: "Export not found",
+		})
+		return
+	}
+	// A running export removes its file when it is cancelled.
+	job.cancel()
+	removeExportFiles(configDirectory, id)
+	c.JSON(200, models.APIResponse{
+		Data: "Export removed",
+	})
+}
+
+func getExport(id string) (models.Export, bool) {
+	exportsMutex.Lock()
+	defer exportsMutex.Unlock()
+	job, ok := exports[id]
+	if !ok {
+		return models.Export{}, false
+	}
+	return job.export, true
+}
+
+func updateExport(job *exportJob, update func(export *models.Export)) {
+	exportsMutex.Lock()
+	defer exportsMutex.Unlock()
+	update(&job.export)
+}
+
+func exportPath(configDirectory string, id string) string {
+	return configDirectory + "/data/exports/" + id + ".mp4"
+}
+
+// exportInfoPath is the file with the details of a finished export.
+func exportInfoPath(configDirectory string, id string) string {
+	return configDirectory + "/data/exports/" + id + ".json"
+}
+
+func removeExportFiles(configDirectory string, id string) {
+	for _, path := range []string{exportPath(configDirectory, id), exportPath(configDirectory, id) + ".tmp", exportInfoPath(configDirectory, id)} {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			log.Log.Error("components.export.removeExportFiles(): " + err.Error())
+		}
+	}
+}
+
+// LoadExports restores the finished exports of earlier runs from
+// data/exports. What is left of exports which didn't finish, and the exports
+// older than exportRetention, are removed.
+func LoadExports(configDirectory string) {
+	files, err := os.ReadDir(configDirectory + "/data/exports")
+	if err != nil {
+		return
+	}
+	exportsMutex.Lock()
+	defer exportsMutex.Unlock()
+	for _, file := range files {
+		id, _, _ := strings.Cut(file.Name(), ".")
+		if _, ok := exports[id]; ok {
+			continue
+		}
+		var export models.Export
+		data, err := os.ReadFile(exportInfoPath(configDirectory, id))
+		if err == nil {
+			err = json.Unmarshal(data, &export)
+		}
+		if _, statErr := os.Stat(exportPath(configDirectory, id)); err != nil || statErr != nil || export.ID != id || export.Status != models.ExportFinished {
+			removeExportFiles(configDirectory, id)
+			continue
+		}
+		exports[id] = &exportJob{export: export, cancel: func() {}}
+	}
+	removeOldExports(configDirectory, time.Now())
+}
+
+// removeOldExports removes the exports which finished longer than
+// exportRetention ago, exportsMutex should be held.
+func removeOldExports(configDirectory string, now time.Time) {
+	for id, job := range exports {
+		if job.export.Status != models.ExportQueued && job.export.Status != models.ExportRunning &&
+			now.Sub(time.Unix(job.export.Finished, 0)) > exportRetention {
+			delete(exports, id)
+			removeExportFiles(configDirectory, id)
+		}
+	}
+}
+
+// runExport writes an export, after the exports before it.
+func runExport(ctx context.Context, job *exportJob, request models.ExportRequest, sources []video.ExportSource, configDirectory string, config models.Config) {
+	defer job.cancel()
+	select {
+	case exportSlot <- struct{}{}:
+		defer func() { <-exportSlot }()
+	case <-ctx.Done():
+		updateExport(job, func(export *models.Export) {
+			export.Status = models.ExportCancelled
+			export.Finished = time.Now().Unix()
+		})
+		return
+	}
+	updateExport(job, func(export *models.Export) {
+		export.Status = models.ExportRunning
+	})
+
+	// The export is signed as the recordings are, only when requested.
+	if !request.Sign {
+		config.Signing = nil
+	}
+	path := exportPath(configDirectory, job.export.ID)
+	err := os.MkdirAll(configDirectory+"/data/exports", 0755)
+	var result video.ExportResult
+	if err == nil {
+		result, err = video.Export(ctx, path, sources, request.Start*1000, request.End*1000, &config, func(done float64) {
+			updateExport(job, func(export *models.Export) {
+				// The last percent is for the encryption.
+				export.Progress = int(done * 99)
+			})
+		})
+	}
+	if err == nil && request.Encrypt {
+		err = encryptExport(path, config.Encryption.SymmetricKey)
+	}
+	var size int64
+	if err == nil {
+		var info os.FileInfo
+		if info, err = os.Stat(path); err == nil {
+			size = info.Size()
+		}
+	}
+
+	if err != nil {
+		os.Remove(path)
+		status := models.ExportFailed
+		if errors.Is(err, context.Canceled) {
+			status = models.ExportCancelled
+		} else {
+			log.Log.Error("components.export.runExport(): " + job.export.ID + ": " + err.Error())
+		}
+		updateExport(job, func(export *models.Export) {
+			export.Status = status
+			export.Error = err.Error()
+			export.Finished = time.Now().Unix()
+		})
+		return
+	}
+	log.Log.Info("components.export.runExport(): " + job.export.ID + ": exported " + strconv.Itoa(len(result.Recordings)) + " recordings")
+	var finished models.Export
+	updateExport(job, func(export *models.Export) {
+		export.Status = models.ExportFinished
+		export.Progress = 100
+		export.ClipStart = result.Start
+		export.ClipEnd = result.End
+		export.Duration = result.Duration
+		export.Size = size
+		export.Recordings = result.Recordings
+		export.Encrypted = request.Encrypt
+		export.Signed = request.Sign
+		export.Finished = time.Now().Unix()
+		finished = *export
+	})
+	// Without its details the export is removed on the next start.
+	data, err := json.Marshal(finished)
+	if err == nil {
+		err = os.WriteFile(exportInfoPath(configDirectory, finished.ID), data, 0644)
+	}
+	if err != nil {
+		log.Log.Error("components.export.runExport(): " + job.export.ID + ": could not write the details: " + err.Error())
+	}
+}
+
+// encryptExport encrypts an export, as the recordings are encrypted. The
+// export is encrypted as it is read, so its size doesn't matter.
+func encryptExport(path string, symmetricKey string) error {
+	source, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+	destination, err := os.Create(path + ".tmp")
+	if err != nil {
+		return err
+	}
+	writer, err := encryption.NewAesWriter(destination, symmetricKey)
+	if err == nil {
+		_, err = io.Copy(writer, source)
+	}
+	if err == nil {
+		err = writer.Close()
+	}
+	if closeErr := destination.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path + ".tmp")
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// exportSources returns the recordings between start and end (unix
+// milliseconds), the oldest first. The recording which started before start
+// is included, as it might run into the export.
+func exportSources(configDirectory string, configuration *models.Configuration, start int64, end int64) []video.ExportSource {
+	candidates := []models.Recording{}
+	if index := recordings.Default(); index != nil {
+		filter := models.EventFilter{TimestampOffsetEnd: (end + 999) / 1000}
+		for _, recording := range index.Query(filter) {
+			candidates = append(candidates, recording)
+			if recording.Timestamp <= start {
+				break
+			}
+		}
+	} else if files, err := utils.ReadDirectory(configDirectory + "/data/recordings"); err == nil {
+		for _, file := range files {
+			if recording, ok := models.ParseRecordingName(file.Name()); ok {
+				candidates = append(candidates, recording)
+			}
+		}
+	}
+	slices.SortFunc(candidates, func(a models.Recording, b models.Recording) int {
+		return cmp.Compare(a.Timestamp, b.Timestamp)
+	})
+
+	// Only the last recording which started before start can run into it.
+	first := 0
+	for i, recording := range candidates {
+		if recording.Timestamp <= start {
+			first = i
+		}
+	}
+
+	sources := []video.ExportSource{}
+	for _, recording := range candidates[first:] {
+		if recording.Timestamp >= end {
+			break
+		}
+		if recording.Duration > 0 && recording.Timestamp+int64(recording.Duration) < start {
+			continue
+		}
+		sources = append(sources, video.ExportSource{
+			Name:  recording.Key,
+			Start: recording.Timestamp,
+			Open: func() (io.ReadCloser, error) {
+				return openRecording(configDirectory, configuration, recording.Key)
+			},
+		})
+	}
+	return sources
+}
+
+// openRecording opens a recording, and decrypts it when it is encrypted.
+func openRecording(configDirectory string, configuration *models.Configuration, key string) (io.ReadCloser, error) {
+	path, ok := recordingPath(configDirectory, key)
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if !encryption.IsEncrypted(file) {
+		return file, nil
+	}
+	encryptionSettings := configuration.Config.Encryption
+	if encryptionSettings == nil || encryptionSettings.SymmetricKey == "" {
+		file.Close()
+		return nil, errors.New("the recording is encrypted, but no symmetric key is configured")
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	reader, err := encryption.NewAesReader(file, info.Size(), encryptionSettings.SymmetricKey)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{reader, file}, nil
+}
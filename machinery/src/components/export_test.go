@@ -0,0 +1,180 @@
+package components
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kerberos-io/agent/machinery/src/encryption"
+	"github.com/kerberos-io/agent/machinery/src/models"
+	"github.com/kerberos-io/agent/machinery/src/video"
+)
+
+func writeTestRecording(t *testing.T, path string) {
+	t.Helper()
+	sps := []byte{0x67, 0x42, 0xc0, 0x1e, 0xd9, 0x00, 0xa0, 0x47, 0xfe, 0xc8}
+	pps := []byte{0x68, 0xce, 0x38, 0x80}
+	mp4Video := video.NewMP4(path, [][]byte{sps}, [][]byte{pps}, nil, 10)
+	mp4Video.SetWidth(640)
+	mp4Video.SetHeight(480)
+	videoTrack := mp4Video.AddVideoTrack("H264")
+	for i := 0; i < 150; i++ {
+		nalType := byte(0x01)
+		if i%25 == 0 {
+			nalType = 0x65
+		}
+		frame := append([]byte{0x00, 0x00, 0x00, 0x01, nalType}, bytes.Repeat([]byte{byte(i)}, 100)...)
+		if err := mp4Video.AddSampleToTrack(videoTrack, i%25 == 0, frame, uint64(i)*40, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mp4Video.Close(&models.Config{})
+}
+
+func TestExport(t *testing.T) {
+	configDirectory := t.TempDir()
+	if err := os.MkdirAll(configDirectory+"/data/recordings", 0755); err != nil {
+		t.Fatal(err)
+	}
+	// Two recordings of 6 seconds, the second one encrypted.
+	first := configDirectory + "/data/recordings/1700000000_6-000_camera_0-0-100-100_24_6000.mp4"
+	second := configDirectory + "/data/recordings/1700000006_6-000_camera_0-0-100-100_24_6000.mp4"
+	writeTestRecording(t, first)
+	writeTestRecording(t, second)
+	contents, err := os.ReadFile(second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted, err := encryption.AesEncrypt(contents, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(second, encrypted, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	configuration := &models.Configuration{}
+	configuration.Config.Encryption = &models.Encryption{SymmetricKey: "secret"}
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/api/exports", func(c *gin.Context) {
+		CreateExport(c, configDirectory, configuration)
+	})
+	router.GET("/api/exports/:id", func(c *gin.Context) {
+		GetExport(c)
+	})
+	router.GET("/api/exports/:id/download", func(c *gin.Context) {
+		DownloadExport(c, configDirectory)
+	})
+	router.DELETE("/api/exports/:id", func(c *gin.Context) {
+		DeleteExport(c, configDirectory)
+	})
+	request := func(method string, path string, body string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return recorder
+	}
+
+	if response := request("POST", "/api/exports", `{"start": 1700000000, "end": 1700000000}`); response.Code != http.StatusBadRequest {
+		t.Errorf("expected an empty range to be refused, got %d", response.Code)
+	}
+	if response := request("POST", "/api/exports", `{"start": 1700000000, "end": 1700000010, "sign": true}`); response.Code != http.StatusBadRequest {
+		t.Errorf("expected signing without a private key to be refused, got %d", response.Code)
+	}
+	if response := request("POST", "/api/exports", `{"start": 1700001000, "end": 1700001010}`); response.Code != http.StatusNotFound {
+		t.Errorf("expected a range without recordings to be not found, got %d", response.Code)
+	}
+
+	response := request("POST", "/api/exports", `{"start": 1700000003, "end": 1700000009, "encrypt": true}`)
+	if response.Code != http.StatusAccepted {
+		t.Fatalf("expected the export to be accepted, got %d: %s", response.Code, response.Body.String())
+	}
+	var export models.Export
+	if err := json.Unmarshal(response.Body.Bytes(), &export); err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); export.Status == models.ExportQueued || export.Status == models.ExportRunning; {
+		if time.Now().After(deadline) {
+			t.Fatal("the export didn't finish")
+		}
+		time.Sleep(10 * time.Millisecond)
+		json.Unmarshal(request("GET", "/api/exports/"+export.ID, "").Body.Bytes(), &export)
+	}
+	if export.Status != models.ExportFinished || export.Progress != 100 || !export.Encrypted {
+		t.Fatalf("unexpected export %+v", export)
+	}
+	if export.ClipStart != 1700000003000 || export.Duration != 6000 || len(export.Recordings) != 2 {
+		t.Errorf("expected 6 seconds of both recordings from 3s, got %+v", export)
+	}
+
+	response = request("GET", "/api/exports/"+export.ID+"/download", "")
+	if response.Code != http.StatusOK || !bytes.HasPrefix(response.Body.Bytes(), []byte("Salted__")) {
+		t.Errorf("expected the encrypted export, got %d", response.Code)
+	}
+	if decrypted, err := encryption.AesDecrypt(response.Body.Bytes(), "secret"); err != nil || len(decrypted) == 0 {
+		t.Errorf("expected the export to decrypt with the symmetric key: %v", err)
+	}
+
+	// After a restart the finished export is restored, and what is left of an
+	// unfinished one is removed.
+	leftover := exportPath(configDirectory, "1700000000-00000000")
+	if err := os.WriteFile(leftover, []byte("partial"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	exportsMutex.Lock()
+	exports = map[string]*exportJob{}
+	exportsMutex.Unlock()
+	LoadExports(configDirectory)
+	if response = request("GET", "/api/exports/"+export.ID, ""); response.Code != http.StatusOK {
+		t.Errorf("expected the export to be restored, got %d", response.Code)
+	}
+	if _, err := os.Stat(leftover); !os.IsNotExist(err) {
+		t.Errorf("expected the unfinished export to be removed")
+	}
+
+	if response = request("DELETE", "/api/exports/"+export.ID, ""); response.Code != http.StatusOK {
+		t.Errorf("expected the export to be removed, got %d", response.Code)
+	}
+	if _, err := os.Stat(exportPath(configDirectory, export.ID)); !os.IsNotExist(err) {
+		t.Errorf("expected the file of the export to be removed")
+	}
+	if _, err := os.Stat(exportInfoPath(configDirectory, export.ID)); !os.IsNotExist(err) {
+		t.Errorf("expected the details of the export to be removed")
+	}
+}
+
+func TestRemoveOldExports(t *testing.T) {
+	configDirectory := t.TempDir()
+	if err := os.MkdirAll(configDirectory+"/data/exports", 0755); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	exportsMutex.Lock()
+	defer exportsMutex.Unlock()
+	exports = map[string]*exportJob{}
+	for id, finished := range map[string]time.Time{"old": now.Add(-exportRetention - time.Hour), "recent": now.Add(-time.Hour)} {
+		exports[id] = &exportJob{export: models.Export{ID: id, Status: models.ExportFinished, Finished: finished.Unix()}}
+		os.WriteFile(exportPath(configDirectory, id), nil, 0644)
+	}
+	exports["running"] = &exportJob{export: models.Export{ID: "running", Status: models.ExportRunning}}
+
+	removeOldExports(configDirectory, now)
+	if _, ok := exports["old"]; ok {
+		t.Error("expected the old export to be removed")
+	}
+	if _, err := os.Stat(exportPath(configDirectory, "old")); !os.IsNotExist(err) {
+		t.Error("expected the file of the old export to be removed")
+	}
+	if _, ok := exports["recent"]; !ok {
+		t.Error("expected the recent export to be kept")
+	}
+	if _, ok := exports["running"]; !ok {
+		t.Error("expected the running export to be kept")
+	}
+}
@@ -15,11 +15,14 @@ import (
 	"github.com/kerberos-io/agent/machinery/src/capture"
 	"github.com/kerberos-io/agent/machinery/src/cloud"
 	"github.com/kerberos-io/agent/machinery/src/computervision"
+	"github.com/kerberos-io/agent/machinery/src/conditions"
 	configService "github.com/kerberos-io/agent/machinery/src/config"
 	"github.com/kerberos-io/agent/machinery/src/log"
 	"github.com/kerberos-io/agent/machinery/src/models"
 	"github.com/kerberos-io/agent/machinery/src/onvif"
+	"github.com/kerberos-io/agent/machinery/src/outputs"
 	"github.com/kerberos-io/agent/machinery/src/packets"
+	"github.com/kerberos-io/agent/machinery/src/recordings"
 	routers "github.com/kerberos-io/agent/machinery/src/routers/mqtt"
 	"github.com/kerberos-io/agent/machinery/src/utils"
 	"github.com/kerberos-io/agent/machinery/src/webrtc"
@@ -39,6 +42,16 @@ func Bootstrap(ctx context.Context, configDirectory string, configuration *model
 	// This is send to Kerberos Hub in a heartbeat.
 	uptimeStart := time.Now()
 
+	// The timetable calendar is read from the config directory.
+	conditions.UseConfigDirectory(configDirectory)
+
+	// Open the recording index, it is checked against the recordings
+	// directory so changes made while the agent was stopped are picked up.
+	recordings.Open(configDirectory)
+
+	// The finished exports of earlier runs can still be downloaded.
+	LoadExports(configDirectory)
+
 	// Initiate the packet counter, this is being used to detect
 	// if a camera is going blocky, or got disconnected.
 	var packageCounter atomic.Value
@@ -75,6 +88,7 @@ func Bootstrap(ctx context.Context, configDirectory string, configuration *model
 	communication.HandleLiveHDPeers = make(chan string, 1)
 	communication.HandleLiveHLS = make(chan string, 1)
 	communication.HandleAudio = make(chan models.AudioDataPartial, 10)
+	communication.HandleOutput = make(chan models.OutputMessage, 100)
 	communication.IsConfiguring = abool.New()
 	communication.IsRecordingManual = abool.New()
 	communication.RecordingManualHeartbeat = &atomic.Int64{}
@@ -85,7 +99,11 @@ func Bootstrap(ctx context.Context, configDirectory string, configuration *model
 
 	// Before starting the agent, we have a control goroutine, that might
 	// do several checks to see if the agent is still operational.
-	go ControlAgent(communication)
+	go ControlAgent(configuration, communication)
+
+	// Dispatch the lifecycle events (motion, recordings, uploads, disconnects)
+	// to the configured outputs.
+	go outputs.HandleOutputs(configDirectory, configuration, communication, captureDevice)
 
 	// Handle heartbeats
 	go cloud.HandleHeartBeat(configuration, communication, uptimeStart)
@@ -324,10 +342,19 @@ func RunAgent(configDirectory string, configuration *models.Configuration, commu
 	communication.HandleMotion = make(chan models.MotionDataPartial, 10)
 	if subStreamEnabled {
 		motionCursor := subQueue.Latest()
-		go computervision.ProcessMotion(motionCursor, configuration, communication, mqttClient, rtspSubClient)
+		go computervision.ProcessMotion(motionCursor, configDirectory, configuration, communication, mqttClient, rtspSubClient)
 	} else {
 		motionCursor := queue.Latest()
-		go computervision.ProcessMotion(motionCursor, configuration, communication, mqttClient, rtspClient)
+		go computervision.ProcessMotion(motionCursor, configDirectory, configuration, communication, mqttClient, rtspClient)
+	}
+
+	// Handle tamper detection if enabled.
+	if subStreamEnabled {
+		tamperCursor := subQueue.Latest()
+		go computervision.ProcessTamper(tamperCursor, configuration, communication, mqttClient, rtspSubClient)
+	} else {
+		tamperCursor := queue.Latest()
+		go computervision.ProcessTamper(tamperCursor, configuration, communication, mqttClient, rtspClient)
 	}
 
 	// Handle realtime processing if enabled.
@@ -485,7 +512,7 @@ func packetAgeString(timer *atomic.Value) string {
 // ControlAgent will check if the camera is still connected, if not it will restart the agent.
 // In the other thread we are keeping track of the number of packets received, and particular the keyframe packets.
 // Once we are not receiving any packets anymore, we will restart the agent.
-func ControlAgent(communication *models.Communication) {
+func ControlAgent(configuration *models.Configuration, communication *models.Communication) {
 	log.Log.Debug("components.Kerberos.ControlAgent(): started")
 	packageCounter := communication.PackageCounter
 	packageSubCounter := communication.PackageCounterSub
@@ -518,6 +545,7 @@ func ControlAgent(communication *models.Communication) {
 				if occurence == 3 {
 					log.Log.Info(fmt.Sprintf("components.Kerberos.ControlAgent(): Restarting machinery because of blocking mainstream. (stalledKeyframeCounter=%d, lastPacket=%s ago, isConfiguring=%t)",
 						packetsR, packetAgeString(communication.LastPacketTimer), communication.IsConfiguring.IsSet()))
+					models.EmitOutputEvent(configuration, communication, conditions.PolicyOutputs(), models.OutputEventCameraDisconnected, "")
 					select {
 					case communication.HandleBootstrap <- "restart":
 						log.Log.Info("components.Kerberos.ControlAgent(): Restarting machinery because of blocking substream.")
@@ -591,7 +619,13 @@ func GetDashboard(c *gin.Context, configDirectory string, configuration *models.
 
 	// The total number of recordings stored in the directory.
 	recordingDirectory := configDirectory + "/data/recordings"
-	numberOfRecordings := utils.NumberOfMP4sInDirectory(recordingDirectory)
+	index := recordings.Default()
+	numberOfRecordings := 0
+	if index != nil {
+		numberOfRecordings = index.Count()
+	} else {
+		numberOfRecordings = utils.NumberOfMP4sInDirectory(recordingDirectory)
+	}
 	activeWebRTCReaders := webrtc.GetActivePeerConnectionCount()
 	pendingWebRTCHandshakes := 0
 	if communication.HandleLiveHDHandshake != nil {
@@ -601,8 +635,11 @@ func GetDashboard(c *gin.Context, configDirectory string, configuration *models.
 	// All days stored in this agent.
 	days := []string{}
 	latestEvents := []models.Media{}
-	files, err := utils.ReadDirectory(recordingDirectory)
-	if err == nil {
+	if index != nil {
+		loc, _ := time.LoadLocation(configuration.Config.Timezone)
+		days = index.Days(loc)
+		latestEvents = utils.GetRecordingsFormatted(index.Query(models.EventFilter{NumberOfElements: 5}), recordingDirectory, configuration)
+	} else if files, err := utils.ReadDirectory(recordingDirectory); err == nil {
 		events := utils.GetSortedDirectory(files)
 
 		// Get All days
@@ -623,6 +660,8 @@ func GetDashboard(c *gin.Context, configDirectory string, configuration *models.
 		"webrtcPending":      pendingWebRTCHandshakes,
 		"days":               days,
 		"latestEvents":       latestEvents,
+		"uploadTargets":      cloud.GetUploadTargetStatus(configuration),
+		"conditions":         conditions.LastDecision(),
 	})
 }
 
@@ -643,6 +682,12 @@ func GetLatestEvents(c *gin.Context, configDirectory string, configuration *mode
 			eventFilter.NumberOfElements = 10
 		}
 		recordingDirectory := configDirectory + "/data/recordings"
+		if index := recordings.Default(); index != nil {
+			c.JSON(200, gin.H{
+				"events": utils.GetRecordingsFormatted(index.Query(eventFilter), recordingDirectory, configuration),
+			})
+			return
+		}
 		files, err := utils.ReadDirectory(recordingDirectory)
 		if err == nil {
 			events := utils.GetSortedDirectory(files)
@@ -671,6 +716,13 @@ func GetLatestEvents(c *gin.Context, configDirectory string, configuration *mode
 // @Description Get all days stored in the recordings directory.
 // @Success 200
 func GetDays(c *gin.Context, configDirectory string, configuration *models.Configuration, communication *models.Communication) {
+	if index := recordings.Default(); index != nil {
+		loc, _ := time.LoadLocation(configuration.Config.Timezone)
+		c.JSON(200, gin.H{
+			"events": index.Days(loc),
+		})
+		return
+	}
 	recordingDirectory := configDirectory + "/data/recordings"
 	files, err := utils.ReadDirectory(recordingDirectory)
 	if err == nil {
@@ -0,0 +1,189 @@
+package components
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kerberos-io/agent/machinery/src/encryption"
+	"github.com/kerberos-io/agent/machinery/src/log"
+	"github.com/kerberos-io/agent/machinery/src/models"
+)
+
+const (
+	defaultRecordingURLExpiry = 5 * time.Minute
+	maxRecordingURLExpiry     = 24 * time.Hour
+)
+
+// recordingURLSecret signs the recording URLs: the JWT secret when set, so
+// other services can sign them too, else a random secret per run.
+var recordingURLSecret = func() []byte {
+	if secret := os.Getenv("AGENT_JWT_SECRET"); secret != "" {
+		return []byte(secret)
+	}
+	secret := make([]byte, 32)
+	rand.Read(secret)
+	return secret
+}()
+
+// GetRecording godoc
+// @Router /api/recordings/{key} [get]
+// @ID recording
+// @Security Bearer
+// @Tags recordings
+// @Param key path string true "The key (file name) of the recording"
+// @Param download query bool false "Download the recording as attachment"
+// @Summary Stream or download a recording.
+// @Description Stream or download a recording. Range requests are supported (206) to seek, encrypted recordings are decrypted on the fly.
+// @Success 200
+// @Success 206
+func GetRecording(c *gin.Context, configDirectory string, configuration *models.Configuration) {
+	serveRecording(c, configDirectory, configuration, c.Param("key"))
+}
+
+// GetRecordingURL godoc
+// @Router /api/recordings/{key}/url [post]
+// @ID recording-url
+// @Security Bearer
+// @Tags recordings
+// @Param key path string true "The key (file name) of the recording"
+// @Param expires query int false "Seconds the URL is valid (default 300, at most 86400)"
+// @Summary Get a signed, short-lived URL of a recording.
+// @Description Get a signed URL of a recording, which can be used without authentication until it expires (e.g. to embed the recording in other tools).
+// @Success 200
+func GetRecordingURL(c *gin.Context, configDirectory string, configuration *models.Configuration) {
+	key := c.Param("key")
+	if _, ok := recordingPath(configDirectory, key); !ok {
+		c.JSON(404, models.APIResponse{
+			Data: "Recording not found",
+		})
+		return
+	}
+	expiry := defaultRecordingURLExpiry
+	if seconds, err := strconv.Atoi(c.Query("expires")); err == nil && seconds > 0 {
+		expiry = min(time.Duration(seconds)*time.Second, maxRecordingURLExpiry)
+	}
+	expires := time.Now().Add(expiry).Unix()
+	c.JSON(200, gin.H{
+		"url":     SignedRecordingURL(key, expires),
+		"expires": expires,
+	})
+}
+
+// GetSignedRecording godoc
+// @Router /api/recordings/{key}/signed [get]
+// @ID recording-signed
+// @Tags recordings
+// @Param key path string true "The key (file name) of the recording"
+// @Param expires query int true "Expiry of the URL, unix seconds"
+// @Param signature query string true "Signature of the URL"
+// @Param download query bool false "Download the recording as attachment"
+// @Summary Stream or download a recording with a signed URL.
+// @Description Stream or download a recording with a URL signed by /api/recordings/{key}/url, no authentication is needed until it expires.
+// @Success 200
+// @Success 206
+func GetSignedRecording(c *gin.Context, configDirectory string, configuration *models.Configuration) {
+	key := c.Param("key")
+	expires, err := strconv.ParseInt(c.Query("expires"), 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		c.JSON(403, models.APIResponse{
+			Data: "URL expired",
+		})
+		return
+	}
+	expected := signRecording(key, expires)
+	if !hmac.Equal([]byte(c.Query("signature")), []byte(expected)) {
+		c.JSON(403, models.APIResponse{
+			Data: "Invalid signature",
+		})
+		return
+	}
+	serveRecording(c, configDirectory, configuration, key)
+}
+
+// SignedRecordingURL returns the path of a recording which is valid, without
+// authentication, until expires (unix seconds).
+func SignedRecordingURL(key string, expires int64) string {
+	return "/api/recordings/" + url.PathEscape(key) + "/signed?expires=" + strconv.FormatInt(expires, 10) + "&signature=" + signRecording(key, expires)
+}
+
+// signRecording returns the HMAC-SHA256 signature of "<key>.<expires>".
+func signRecording(key string, expires int64) string {
+	mac := hmac.New(sha256.New, recordingURLSecret)
+	mac.Write([]byte(key))
+	mac.Write([]byte("."))
+	mac.Write([]byte(strconv.FormatInt(expires, 10)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// recordingPath returns the path of a recording, the key can't leave the
+// recordings directory.
+func recordingPath(configDirectory string, key string) (string, bool) {
+	if key == "" || key == "." || key == ".." || strings.ContainsAny(key, "/\\") {
+		return "", false
+	}
+	path := configDirectory + "/data/recordings/" + key
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return "", false
+	}
+	return path, true
+}
+
+// serveRecording writes the recording, with support for range requests. An
+// encrypted recording is decrypted while it is read.
+func serveRecording(c *gin.Context, configDirectory string, configuration *models.Configuration, key string) {
+	path, ok := recordingPath(configDirectory, key)
+	if !ok {
+		c.JSON(404, models.APIResponse{
+			Data: "Recording not found",
+		})
+		return
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		c.JSON(404, models.APIResponse{
+			Data: "Recording not found",
+		})
+		return
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		c.JSON(500, models.APIResponse{
+			Data: "Something went wrong: " + err.Error(),
+		})
+		return
+	}
+
+	var content io.ReadSeeker = file
+	encryptionSettings := configuration.Config.Encryption
+	if encryptionSettings != nil && encryptionSettings.Recordings == "true" && encryptionSettings.SymmetricKey != "" && encryption.IsEncrypted(file) {
+		reader, err := encryption.NewAesReader(file, info.Size(), encryptionSettings.SymmetricKey)
+		if err != nil {
+			log.Log.Error("components.recordings.serveRecording(): " + key + ": " + err.Error())
+			c.JSON(500, models.APIResponse{
+				Data: "Unable to decrypt the recording",
+			})
+			return
+		}
+		content = reader
+	}
+
+	disposition := "inline"
+	if c.Query("download") == "true" {
+		disposition = "attachment"
+	}
+	c.Header("Content-Disposition", disposition+"; filename=\""+key+"\"")
+	c.Header("Content-Type", "video/mp4")
+	http.ServeContent(c.Writer, c.Request, key, info.ModTime(), content)
+}
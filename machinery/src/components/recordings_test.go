@@ -0,0 +1,94 @@
+package components
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kerberos-io/agent/machinery/src/encryption"
+	"github.com/kerberos-io/agent/machinery/src/models"
+)
+
+func recordingsRouter(configDirectory string, configuration *models.Configuration) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/api/recordings/:key/signed", func(c *gin.Context) {
+		GetSignedRecording(c, configDirectory, configuration)
+	})
+	r.GET("/api/recordings/:key", func(c *gin.Context) {
+		GetRecording(c, configDirectory, configuration)
+	})
+	return r
+}
+
+func TestGetRecording(t *testing.T) {
+	configDirectory := t.TempDir()
+	if err := os.MkdirAll(configDirectory+"/data/recordings", 0755); err != nil {
+		t.Fatal(err)
+	}
+	content := make([]byte, 100000)
+	for i := range content {
+		content[i] = byte(i * 7)
+	}
+	encrypted, err := encryption.AesEncrypt(content, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := "1700000000_6-474162_camera_200-200-400-400_24_769.mp4"
+	if err := os.WriteFile(configDirectory+"/data/recordings/"+key, encrypted, 0644); err != nil {
+		t.Fatal(err)
+	}
+	configuration := &models.Configuration{}
+	configuration.Config.Encryption = &models.Encryption{Recordings: "true", SymmetricKey: "secret"}
+	router := recordingsRouter(configDirectory, configuration)
+
+	get := func(path string, header string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest("GET", path, nil)
+		if header != "" {
+			request.Header.Set("Range", header)
+		}
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	response := get("/api/recordings/"+key, "")
+	if response.Code != http.StatusOK || !bytes.Equal(response.Body.Bytes(), content) {
+		t.Fatalf("expected the decrypted recording, got %d with %d bytes", response.Code, response.Body.Len())
+	}
+
+	// A range crossing AES blocks.
+	response = get("/api/recordings/"+key, "bytes=1000-50009")
+	if response.Code != http.StatusPartialContent || !bytes.Equal(response.Body.Bytes(), content[1000:50010]) {
+		t.Errorf("expected bytes 1000-50009, got %d with %d bytes", response.Code, response.Body.Len())
+	}
+	if contentRange := response.Header().Get("Content-Range"); contentRange != "bytes 1000-50009/100000" {
+		t.Errorf("unexpected Content-Range %s", contentRange)
+	}
+	response = get("/api/recordings/"+key, "bytes=-5")
+	if response.Code != http.StatusPartialContent || !bytes.Equal(response.Body.Bytes(), content[len(content)-5:]) {
+		t.Errorf("expected the last 5 bytes, got %d with %d bytes", response.Code, response.Body.Len())
+	}
+
+	if response = get("/api/recordings/..%2Fconfig", ""); response.Code != http.StatusNotFound {
+		t.Errorf("expected a key outside the recordings to be not found, got %d", response.Code)
+	}
+
+	// Signed URLs.
+	expires := time.Now().Add(time.Minute).Unix()
+	if response = get(SignedRecordingURL(key, expires), "bytes=0-9"); response.Code != http.StatusPartialContent || !bytes.Equal(response.Body.Bytes(), content[:10]) {
+		t.Errorf("expected the signed URL to serve the recording, got %d", response.Code)
+	}
+	tampered := "/api/recordings/" + key + "/signed?expires=" + strconv.FormatInt(expires+60, 10) + "&signature=" + signRecording(key, expires)
+	if response = get(tampered, ""); response.Code != http.StatusForbidden {
+		t.Errorf("expected a tampered URL to be forbidden, got %d", response.Code)
+	}
+	if response = get(SignedRecordingURL(key, time.Now().Add(-time.Minute).Unix()), ""); response.Code != http.StatusForbidden {
+		t.Errorf("expected an expired URL to be forbidden, got %d", response.Code)
+	}
+}
@@ -0,0 +1,94 @@
+package components
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kerberos-io/agent/machinery/src/cloud"
+	"github.com/kerberos-io/agent/machinery/src/models"
+)
+
+// GetUploads godoc
+// @Router /api/uploads [get]
+// @ID uploads
+// @Tags uploads
+// @Param limit query int false "Maximum number of recordings to return"
+// @Param offset query int false "Number of recordings to skip"
+// @Summary Get the recordings waiting in the upload queue.
+// @Description Get the recordings waiting in the upload queue, in upload order, with their size, age, attempts, last error and the state of every upload target.
+// @Success 200
+func GetUploads(c *gin.Context, configDirectory string, configuration *models.Configuration) {
+	entries := cloud.ListUploadQueue(configDirectory, configuration)
+	total := len(entries)
+
+	offset, _ := strconv.Atoi(c.Query("offset"))
+	if offset > 0 && offset < total {
+		entries = entries[offset:]
+	} else if offset >= total {
+		entries = []models.UploadQueueEntry{}
+	}
+	if limit, err := strconv.Atoi(c.Query("limit")); err == nil && limit >= 0 && limit < len(entries) {
+		entries = entries[:limit]
+	}
+
+	c.JSON(200, gin.H{
+		"total":   total,
+		"uploads": entries,
+		"targets": cloud.GetUploadTargetStatus(configuration),
+	})
+}
+
+// RetryUploads godoc
+// @Router /api/uploads/retry [post]
+// @ID uploads-retry
+// @Tags uploads
+// @Param request body models.UploadQueueRequest true "Recordings to retry"
+// @Summary Retry the upload of queued recordings now.
+// @Description Retry the upload of queued recordings now, instead of waiting for the backoff of the upload targets.
+// @Success 200 {object} models.APIResponse
+func RetryUploads(c *gin.Context, configDirectory string, configuration *models.Configuration) {
+	handleUploadQueueAction(c, configDirectory, configuration, cloud.RetryUploads)
+}
+
+// CancelUploads godoc
+// @Router /api/uploads/cancel [post]
+// @ID uploads-cancel
+// @Tags uploads
+// @Param request body models.UploadQueueRequest true "Recordings to cancel"
+// @Summary Remove recordings from the upload queue.
+// @Description Remove recordings from the upload queue, the recordings are kept on disk.
+// @Success 200 {object} models.APIResponse
+func CancelUploads(c *gin.Context, configDirectory string, configuration *models.Configuration) {
+	handleUploadQueueAction(c, configDirectory, configuration, cloud.CancelUploads)
+}
+
+// RequeueUploads godoc
+// @Router /api/uploads/requeue [post]
+// @ID uploads-requeue
+// @Tags uploads
+// @Param request body models.UploadQueueRequest true "Recordings to queue again"
+// @Summary Queue recordings for upload again.
+// @Description Queue recordings which are still on disk, but were already uploaded or cancelled, for upload again.
+// @Success 200 {object} models.APIResponse
+func RequeueUploads(c *gin.Context, configDirectory string, configuration *models.Configuration) {
+	handleUploadQueueAction(c, configDirectory, configuration, cloud.RequeueUploads)
+}
+
+func handleUploadQueueAction(c *gin.Context, configDirectory string, configuration *models.Configuration, action func(string, *models.Configuration, models.UploadQueueRequest) []models.UploadQueueResult) {
+	var request models.UploadQueueRequest
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(400, models.APIResponse{
+			Data: "Something went wrong: " + err.Error(),
+		})
+		return
+	}
+	if len(request.FileNames) == 0 && !request.All {
+		c.JSON(400, models.APIResponse{
+			Data: "No recordings selected.",
+		})
+		return
+	}
+	c.JSON(200, models.APIResponse{
+		Data: action(configDirectory, configuration, request),
+	})
+}
@@ -0,0 +1,268 @@
+package computervision
+
+import (
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kerberos-io/agent/machinery/src/log"
+	"github.com/kerberos-io/agent/machinery/src/models"
+)
+
+const (
+	// The heatmap is a grid of this many cells laid over the frame.
+	heatmapColumns = 32
+	heatmapRows    = 18
+	// The pixel size of a cell in the PNG of the heatmap.
+	heatmapCellSize = 20
+	// The activity of the day is written to disk at most this often.
+	activityFlushInterval = time.Minute
+)
+
+// ActivityRetention is how long the activity is kept, days older than this are
+// removed. It is also the longest range which can be queried.
+const ActivityRetention = 31 * 24 * time.Hour
+
+// activityDay is the motion activity of a day, persisted as
+// data/activity/<date>.json.
+type activityDay struct {
+	Heatmap  map[int][]int                  `json:"heatmap"`  // Per hour: the grid, row by row.
+	Timeline map[int]*models.ActivityMinute `json:"timeline"` // Per minute of the day.
+}
+
+// activityLog accumulates the activity of the current day, in memory, and
+// writes it to disk every activityFlushInterval.
+type activityLog struct {
+	mutex     sync.Mutex
+	directory string
+	date      string
+	day       *activityDay
+	dirty     bool
+	flushed   time.Time
+}
+
+var activity activityLog
+
+// recordActivity adds a motion event, with the clusters of changes in a frame
+// of cols x rows pixels, to the heatmap and the timeline.
+func recordActivity(configDirectory string, now time.Time, cols int, rows int, changes int, rectangles []models.MotionRectangle) {
+	if cols <= 0 || rows <= 0 {
+		return
+	}
+	directory := configDirectory + "/data/activity"
+	date := now.Format("2006-01-02")
+
+	activity.mutex.Lock()
+	defer activity.mutex.Unlock()
+	if activity.directory != directory || activity.date != date {
+		activity.flush()
+		activity.directory = directory
+		activity.date = date
+		activity.day = readActivityDay(directory, date)
+		removeOldActivity(directory, now)
+	}
+
+	grid := activity.day.Heatmap[now.Hour()]
+	if len(grid) != heatmapColumns*heatmapRows {
+		grid = make([]int, heatmapColumns*heatmapRows)
+		activity.day.Heatmap[now.Hour()] = grid
+	}
+	for _, rectangle := range rectangles {
+		column1, row1 := heatmapCell(rectangle.X, rectangle.Y, cols, rows)
+		column2, row2 := heatmapCell(rectangle.X+rectangle.Width-1, rectangle.Y+rectangle.Height-1, cols, rows)
+		for row := row1; row <= row2; row++ {
+			for column := column1; column <= column2; column++ {
+				grid[row*heatmapColumns+column]++
+			}
+		}
+	}
+
+	minuteOfDay := now.Hour()*60 + now.Minute()
+	minute := activity.day.Timeline[minuteOfDay]
+	if minute == nil {
+		minute = &models.ActivityMinute{Timestamp: now.Truncate(time.Minute).Unix()}
+		activity.day.Timeline[minuteOfDay] = minute
+	}
+	minute.Changes += changes
+	minute.Events++
+
+	activity.dirty = true
+	if time.Since(activity.flushed) >= activityFlushInterval {
+		activity.flush()
+	}
+}
+
+// flushActivity writes the activity of the current day to disk.
+func flushActivity() {
+	activity.mutex.Lock()
+	defer activity.mutex.Unlock()
+	activity.flush()
+}
+
+func (a *activityLog) flush() {
+	if !a.dirty || a.day == nil {
+		return
+	}
+	data, err := json.Marshal(a.day)
+	if err == nil {
+		err = os.MkdirAll(a.directory, 0755)
+	}
+	if err == nil {
+		file := filepath.Join(a.directory, a.date+".json")
+		if err = os.WriteFile(file+".tmp", data, 0644); err == nil {
+			err = os.Rename(file+".tmp", file)
+		}
+	}
+	if err != nil {
+		log.Log.Error("computervision.activity.flush(): could not write the activity of " + a.date + ": " + err.Error())
+		return
+	}
+	a.dirty = false
+	a.flushed = time.Now()
+}
+
+// heatmapCell returns the cell of the grid a pixel is in.
+func heatmapCell(x int, y int, cols int, rows int) (int, int) {
+	column := min(max(x*heatmapColumns/cols, 0), heatmapColumns-1)
+	row := min(max(y*heatmapRows/rows, 0), heatmapRows-1)
+	return column, row
+}
+
+func readActivityDay(directory string, date string) *activityDay {
+	day := &activityDay{}
+	if data, err := os.ReadFile(filepath.Join(directory, date+".json")); err == nil {
+		if err := json.Unmarshal(data, day); err != nil {
+			log.Log.Warning("computervision.activity.readActivityDay(): could not read the activity of " + date + ": " + err.Error())
+		}
+	}
+	if day.Heatmap == nil {
+		day.Heatmap = map[int][]int{}
+	}
+	if day.Timeline == nil {
+		day.Timeline = map[int]*models.ActivityMinute{}
+	}
+	return day
+}
+
+func removeOldActivity(directory string, now time.Time) {
+	files, err := os.ReadDir(directory)
+	if err != nil {
+		return
+	}
+	oldest := now.Add(-ActivityRetention).Format("2006-01-02")
+	for _, file := range files {
+		date, found := strings.CutSuffix(file.Name(), ".json")
+		if found && date < oldest {
+			os.Remove(filepath.Join(directory, file.Name()))
+		}
+	}
+}
+
+// forEachActivityDay calls f with the activity of every day of the range, in
+// the timezone of from, including the activity not written to disk yet. The
+// days are read from disk without holding the mutex, so the motion loop isn't
+// held back by a query: only the current day, in memory, is read under it.
+func forEachActivityDay(configDirectory string, from time.Time, to time.Time, f func(date time.Time, day *activityDay)) {
+	directory := configDirectory + "/data/activity"
+	for date := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, from.Location()); date.Before(to); date = date.AddDate(0, 0, 1) {
+		name := date.Format("2006-01-02")
+		if !forCurrentActivityDay(directory, name, func(day *activityDay) { f(date, day) }) {
+			f(date, readActivityDay(directory, name))
+		}
+	}
+}
+
+// forCurrentActivityDay calls f with the activity of the date under the mutex,
+// when it is the current day. It returns false otherwise.
+func forCurrentActivityDay(directory string, date string, f func(day *activityDay)) bool {
+	activity.mutex.Lock()
+	defer activity.mutex.Unlock()
+	if activity.day == nil || activity.directory != directory || activity.date != date {
+		return false
+	}
+	f(activity.day)
+	return true
+}
+
+// GetActivityHeatmap returns the heatmap of the hours which overlap the range,
+// the heatmap is kept per hour.
+func GetActivityHeatmap(configDirectory string, from time.Time, to time.Time) models.ActivityHeatmap {
+	heatmap := models.ActivityHeatmap{
+		From:    from.Unix(),
+		To:      to.Unix(),
+		Columns: heatmapColumns,
+		Rows:    heatmapRows,
+		Cells:   make([]int, heatmapColumns*heatmapRows),
+	}
+	hourFrom := from.Truncate(time.Hour)
+	forEachActivityDay(configDirectory, from, to, func(date time.Time, day *activityDay) {
+		for hour, grid := range day.Heatmap {
+			start := time.Date(date.Year(), date.Month(), date.Day(), hour, 0, 0, 0, date.Location())
+			if start.Before(hourFrom) || !start.Before(to) || len(grid) != len(heatmap.Cells) {
+				continue
+			}
+			for cell, count := range grid {
+				heatmap.Cells[cell] += count
+			}
+		}
+	})
+	for _, count := range heatmap.Cells {
+		heatmap.Max = max(heatmap.Max, count)
+	}
+	return heatmap
+}
+
+// GetActivityTimeline returns the minutes with motion within the range, in
+// chronological order.
+func GetActivityTimeline(configDirectory string, from time.Time, to time.Time) []models.ActivityMinute {
+	timeline := []models.ActivityMinute{}
+	minuteFrom := from.Truncate(time.Minute).Unix()
+	forEachActivityDay(configDirectory, from, to, func(date time.Time, day *activityDay) {
+		for minuteOfDay := 0; minuteOfDay < 24*60; minuteOfDay++ {
+			if minute := day.Timeline[minuteOfDay]; minute != nil && minute.Timestamp >= minuteFrom && minute.Timestamp < to.Unix() {
+				timeline = append(timeline, *minute)
+			}
+		}
+	})
+	return timeline
+}
+
+// EncodeHeatmapPNG draws the heatmap as a PNG, from transparent (no motion)
+// over blue and yellow to red (most motion), so it can be laid over a
+// snapshot of the camera.
+func EncodeHeatmapPNG(w io.Writer, heatmap models.ActivityHeatmap) error {
+	img := image.NewNRGBA(image.Rect(0, 0, heatmap.Columns*heatmapCellSize, heatmap.Rows*heatmapCellSize))
+	for cell, count := range heatmap.Cells {
+		if count == 0 || heatmap.Max == 0 {
+			continue
+		}
+		colour := heatColor(float64(count) / float64(heatmap.Max))
+		column := cell % heatmap.Columns
+		row := cell / heatmap.Columns
+		for y := row * heatmapCellSize; y < (row+1)*heatmapCellSize; y++ {
+			for x := column * heatmapCellSize; x < (column+1)*heatmapCellSize; x++ {
+				img.SetNRGBA(x, y, colour)
+			}
+		}
+	}
+	return png.Encode(w, img)
+}
+
+// heatColor maps a value from 0 to 1 on blue, yellow and red, more opaque as
+// the value grows.
+func heatColor(value float64) color.NRGBA {
+	alpha := uint8(80 + 150*value)
+	if value < 0.5 {
+		ratio := value * 2
+		return color.NRGBA{R: uint8(255 * ratio), G: uint8(255 * ratio), B: uint8(255 * (1 - ratio)), A: alpha}
+	}
+	ratio := (value - 0.5) * 2
+	return color.NRGBA{R: 255, G: uint8(255 * (1 - ratio)), A: alpha}
+}
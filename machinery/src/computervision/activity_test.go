@@ -0,0 +1,55 @@
+package computervision
+
+import (
+	"bytes"
+	"image/png"
+	"testing"
+	"time"
+
+	"github.com/kerberos-io/agent/machinery/src/models"
+)
+
+func TestActivityHeatmapAndTimeline(t *testing.T) {
+	directory := t.TempDir()
+	loc := time.FixedZone("test", 2*60*60)
+	start := time.Date(2026, 3, 10, 23, 58, 30, 0, loc)
+
+	// A frame of 320x180 pixels: a cell of the heatmap is 10x10 pixels.
+	left := []models.MotionRectangle{{X: 0, Y: 0, Width: 20, Height: 10}}
+	right := []models.MotionRectangle{{X: 315, Y: 175, Width: 5, Height: 5}}
+	recordActivity(directory, start, 320, 180, 100, left)
+	recordActivity(directory, start.Add(10*time.Second), 320, 180, 50, left)
+	recordActivity(directory, start.Add(2*time.Minute), 320, 180, 30, right) // The next day.
+	flushActivity()
+
+	// The current day isn't in memory any more.
+	activity = activityLog{}
+
+	heatmap := GetActivityHeatmap(directory, start.Add(-time.Hour), start.Add(time.Hour))
+	if heatmap.Cells[0] != 2 || heatmap.Cells[1] != 2 || heatmap.Cells[2] != 0 || heatmap.Cells[len(heatmap.Cells)-1] != 1 || heatmap.Max != 2 {
+		t.Fatalf("heatmap = %+v", heatmap)
+	}
+	if heatmap := GetActivityHeatmap(directory, start.Add(2*time.Minute), start.Add(time.Hour)); heatmap.Cells[0] != 0 || heatmap.Max != 1 {
+		t.Fatalf("heatmap of the next day = %+v", heatmap)
+	}
+
+	timeline := GetActivityTimeline(directory, start.Add(-time.Hour), start.Add(time.Hour))
+	if len(timeline) != 2 || timeline[0].Events != 2 || timeline[0].Changes != 150 || timeline[1].Timestamp != start.Add(2*time.Minute).Truncate(time.Minute).Unix() {
+		t.Fatalf("timeline = %+v", timeline)
+	}
+
+	var image bytes.Buffer
+	if err := EncodeHeatmapPNG(&image, heatmap); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := png.Decode(&image)
+	if err != nil || decoded.Bounds().Dx() != heatmapColumns*heatmapCellSize {
+		t.Fatalf("png = %v, %v", decoded.Bounds(), err)
+	}
+	if _, _, _, alpha := decoded.At(0, 0).RGBA(); alpha == 0 {
+		t.Fatal("the cell with motion is transparent")
+	}
+	if _, _, _, alpha := decoded.At(heatmapCellSize*5, heatmapCellSize*5).RGBA(); alpha != 0 {
+		t.Fatal("a cell without motion isn't transparent")
+	}
+}
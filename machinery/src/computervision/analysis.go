@@ -0,0 +1,198 @@
+package computervision
+
+import (
+	"image"
+	"slices"
+	"time"
+
+	"github.com/kerberos-io/agent/machinery/src/capture"
+	"github.com/kerberos-io/agent/machinery/src/log"
+	"github.com/kerberos-io/agent/machinery/src/packets"
+)
+
+const (
+	// The load of the analysis is measured over this window.
+	analysisLoadWindow = 10 * time.Second
+	// Above this share of the time spent decoding, or when the packets are
+	// this far behind, the analysis falls back to keyframes only ...
+	analysisMaxLoad = 0.5
+	analysisMaxLag  = 2 * time.Second
+	// ... for this long.
+	analysisBackoff = time.Minute
+)
+
+// frameDecoder decodes every packet of a stream, see capture.NewDecoder.
+type frameDecoder interface {
+	DecodeGray(data []byte) (*image.Gray, error)
+	DecodeYCbCr(data []byte) (*image.YCbCr, error)
+	Skip(data []byte) error
+	Close()
+}
+
+// analysisPacer selects the frames which are analysed, at most fps per second
+// (keyframes always are), and falls back to keyframes only under load.
+type analysisPacer struct {
+	interval           int64 // Milliseconds.
+	lastAnalysed       int64
+	keyframesOnlyUntil time.Time
+	windowStart        time.Time
+	busy               time.Duration
+}
+
+func newAnalysisPacer(fps int) *analysisPacer {
+	return &analysisPacer{interval: int64(1000 / fps)}
+}
+
+func (p *analysisPacer) keyframesOnly(now time.Time) bool {
+	return now.Before(p.keyframesOnlyUntil)
+}
+
+// due tells if the frame of the packet is analysed.
+func (p *analysisPacer) due(pkt packets.Packet) bool {
+	if pkt.IsKeyFrame || pkt.CurrentTime-p.lastAnalysed >= p.interval {
+		p.lastAnalysed = pkt.CurrentTime
+		return true
+	}
+	return false
+}
+
+// record accounts the time spent on a packet, and how far it is behind. It
+// returns true when the analysis falls back to keyframes only.
+func (p *analysisPacer) record(busy time.Duration, lag time.Duration, now time.Time) bool {
+	if p.windowStart.IsZero() {
+		p.windowStart = now
+	}
+	p.busy += busy
+	overloaded := lag > analysisMaxLag
+	if elapsed := now.Sub(p.windowStart); elapsed >= analysisLoadWindow {
+		overloaded = overloaded || float64(p.busy)/float64(elapsed) > analysisMaxLoad
+		p.windowStart = now
+		p.busy = 0
+	}
+	if overloaded {
+		p.keyframesOnlyUntil = now.Add(analysisBackoff)
+		p.windowStart = time.Time{}
+		p.busy = 0
+	}
+	return overloaded
+}
+
+// frameSource decodes the packets motion detection reads. Without pacer only
+// keyframes are decoded, with the decoder of the RTSP client. With pacer every
+// packet goes through a decoder of its own, so P-frames decode, and the frames
+// the pacer selects are returned.
+type frameSource struct {
+	rtspClient capture.RTSPClient
+	decoder    frameDecoder
+	pacer      *analysisPacer
+	color      bool // Also decode the colour frame, for the object detector.
+	synced     bool // The decoder started from a keyframe.
+}
+
+// newFrameSource returns the frame source for the analysis rate: fps zero (or
+// less) is keyframes only.
+func newFrameSource(rtspClient capture.RTSPClient, fps int, color bool) *frameSource {
+	source := &frameSource{rtspClient: rtspClient, color: color}
+	if fps > 0 {
+		source.pacer = newAnalysisPacer(fps)
+	}
+	return source
+}
+
+func (s *frameSource) Close() {
+	if s.decoder != nil {
+		s.decoder.Close()
+		s.decoder = nil
+	}
+}
+
+// frame decodes the packet and returns its frame, when it is analysed.
+func (s *frameSource) frame(pkt packets.Packet, now time.Time) (Frame, bool) {
+	frame := Frame{Timestamp: now}
+	if len(pkt.Data) == 0 || !pkt.IsVideo && !pkt.IsKeyFrame {
+		return frame, false
+	}
+
+	if s.pacer == nil || s.decoder == nil && !s.openDecoder(pkt) {
+		if !pkt.IsKeyFrame {
+			return frame, false
+		}
+		if s.color {
+			if colorImage, err := s.rtspClient.DecodePacket(pkt); err == nil {
+				frame.Image = &colorImage
+				frame.Gray = grayFromYCbCr(&colorImage)
+			}
+		} else if grayImage, err := s.rtspClient.DecodePacketRaw(pkt); err == nil {
+			frame.Gray = &grayImage
+		}
+		return frame, frame.Gray != nil
+	}
+
+	// P-frames only decode from a keyframe on, and are left out altogether
+	// while falling back to keyframes only.
+	if !pkt.IsKeyFrame && (!s.synced || s.pacer.keyframesOnly(now)) {
+		s.synced = false
+		return frame, false
+	}
+	s.synced = true
+
+	start := time.Now()
+	var err error
+	if !s.pacer.due(pkt) {
+		err = s.decoder.Skip(pkt.Data)
+	} else if s.color {
+		var colorImage *image.YCbCr
+		if colorImage, err = s.decoder.DecodeYCbCr(pkt.Data); colorImage != nil {
+			frame.Image = colorImage
+			frame.Gray = grayFromYCbCr(colorImage)
+		}
+	} else {
+		frame.Gray, err = s.decoder.DecodeGray(pkt.Data)
+	}
+	if err != nil {
+		log.Log.Debug("computervision.analysis.frame(): " + err.Error())
+		s.synced = false
+	}
+
+	lag := now.Sub(time.UnixMilli(pkt.CurrentTime))
+	if pkt.CurrentTime > 0 && s.pacer.record(time.Since(start), lag, now) {
+		log.Log.Warning("computervision.analysis.frame(): motion analysis can't keep up, analysing keyframes only for " + analysisBackoff.String() + ".")
+	}
+	return frame, frame.Gray != nil
+}
+
+// openDecoder allocates the decoder for the codec of the stream.
+func (s *frameSource) openDecoder(pkt packets.Packet) bool {
+	decoder, err := capture.NewDecoder(pkt.Codec)
+	if err != nil {
+		log.Log.Error("computervision.analysis.openDecoder(): " + err.Error() + ", analysing keyframes only.")
+		s.pacer = nil
+		return false
+	}
+	s.decoder = decoder
+	return true
+}
+
+// snapshot returns a copy of the frame of the packet, for the outputs: the
+// decoders reuse their buffers. It is the colour frame when it was decoded, or
+// when the packet is a keyframe, the grayscale frame otherwise.
+func (s *frameSource) snapshot(frame Frame, pkt packets.Packet) image.Image {
+	if frame.Image != nil {
+		snapshot := *frame.Image
+		snapshot.Y = slices.Clone(snapshot.Y)
+		snapshot.Cb = slices.Clone(snapshot.Cb)
+		snapshot.Cr = slices.Clone(snapshot.Cr)
+		return &snapshot
+	}
+	if pkt.IsKeyFrame && s.rtspClient != nil {
+		if colorImage, err := s.rtspClient.DecodePacket(pkt); err == nil && !colorImage.Rect.Empty() {
+			return &colorImage
+		}
+	}
+	if frame.Gray == nil {
+		return nil
+	}
+	snapshot := *frame.Gray
+	snapshot.Pix = slices.Clone(snapshot.Pix)
+	return &snapshot
+}
@@ -0,0 +1,87 @@
+package computervision
+
+import (
+	"image"
+	"testing"
+	"time"
+
+	"github.com/kerberos-io/agent/machinery/src/packets"
+)
+
+type fakeDecoder struct {
+	decoded []bool // Per packet: was the frame returned.
+}
+
+func (d *fakeDecoder) DecodeGray(data []byte) (*image.Gray, error) {
+	d.decoded = append(d.decoded, true)
+	return image.NewGray(image.Rect(0, 0, 4, 4)), nil
+}
+
+func (d *fakeDecoder) DecodeYCbCr(data []byte) (*image.YCbCr, error) {
+	d.decoded = append(d.decoded, true)
+	return image.NewYCbCr(image.Rect(0, 0, 4, 4), image.YCbCrSubsampleRatio420), nil
+}
+
+func (d *fakeDecoder) Skip(data []byte) error {
+	d.decoded = append(d.decoded, false)
+	return nil
+}
+
+func (d *fakeDecoder) Close() {}
+
+func TestFrameSourceAnalysesAtTheConfiguredRate(t *testing.T) {
+	decoder := &fakeDecoder{}
+	source := newFrameSource(nil, 5, false)
+	source.decoder = decoder
+
+	// 25 fps, starting with two P-frames which can't be decoded yet.
+	now := time.Now()
+	analysed := 0
+	for i := 0; i < 52; i++ {
+		pkt := packets.Packet{IsVideo: true, IsKeyFrame: i == 2, Data: []byte{1}, CurrentTime: now.UnixMilli() + int64(i*40)}
+		if _, ok := source.frame(pkt, time.UnixMilli(pkt.CurrentTime)); ok {
+			analysed++
+		}
+	}
+	if len(decoder.decoded) != 50 {
+		t.Fatalf("decoded %d packets, want 50 from the keyframe on", len(decoder.decoded))
+	}
+	if analysed != 10 {
+		t.Fatalf("analysed %d frames in two seconds, want 10", analysed)
+	}
+}
+
+func TestFrameSourceFallsBackToKeyframesUnderLoad(t *testing.T) {
+	decoder := &fakeDecoder{}
+	source := newFrameSource(nil, 5, true)
+	source.decoder = decoder
+
+	now := time.Now()
+	keyframe := packets.Packet{IsVideo: true, IsKeyFrame: true, Data: []byte{1}, CurrentTime: now.Add(-5 * time.Second).UnixMilli()}
+	if frame, ok := source.frame(keyframe, now); !ok || frame.Image == nil || frame.Gray == nil {
+		t.Fatal("the keyframe isn't analysed")
+	}
+	if !source.pacer.keyframesOnly(now) {
+		t.Fatal("a lag of 5 seconds doesn't fall back to keyframes only")
+	}
+
+	pFrame := packets.Packet{IsVideo: true, Data: []byte{1}, CurrentTime: now.UnixMilli()}
+	if _, ok := source.frame(pFrame, now.Add(time.Second)); ok || len(decoder.decoded) != 1 {
+		t.Fatal("a P-frame is decoded while analysing keyframes only")
+	}
+
+	// After the backoff P-frames wait for the next keyframe.
+	later := now.Add(analysisBackoff + time.Second)
+	pFrame.CurrentTime = later.UnixMilli()
+	if _, ok := source.frame(pFrame, later); ok || len(decoder.decoded) != 1 {
+		t.Fatal("a P-frame is decoded before the next keyframe")
+	}
+	keyframe.CurrentTime = later.UnixMilli()
+	if _, ok := source.frame(keyframe, later); !ok {
+		t.Fatal("the keyframe after the backoff isn't analysed")
+	}
+	pFrame.CurrentTime = later.Add(200 * time.Millisecond).UnixMilli()
+	if _, ok := source.frame(pFrame, later.Add(200*time.Millisecond)); !ok {
+		t.Fatal("P-frames aren't analysed again after the backoff")
+	}
+}
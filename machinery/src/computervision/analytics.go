@@ -0,0 +1,282 @@
+package computervision
+
+import (
+	"image"
+	"math"
+	"slices"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	geo "github.com/kellydunn/golang-geo"
+	"github.com/kerberos-io/agent/machinery/src/conditions"
+	"github.com/kerberos-io/agent/machinery/src/log"
+	"github.com/kerberos-io/agent/machinery/src/models"
+)
+
+const (
+	// A track crossing the same tripwire again within this time (e.g. a blob
+	// jittering on the line) isn't reported again.
+	tripwireDebounce = 2 * time.Second
+	// The default dwell time of a loitering zone.
+	loiteringDwellTime = 30 * time.Second
+	// Blobs are matched across frames within this share of the frame diagonal.
+	trackerMaxDistance = 0.2
+)
+
+// tripwire is a tripwire of the region, in the pixel space of the frame.
+type tripwire struct {
+	name      string
+	from, to  image.Point
+	direction string
+}
+
+// loiteringZone is a loitering zone of the region, in the pixel space of the
+// frame.
+type loiteringZone struct {
+	name      string
+	polygon   geo.Polygon
+	dwellTime time.Duration
+}
+
+// AnalyticsEvent is a tripwire crossing (Type line_crossed) or an object
+// loitering (Type loitering_detected), see models.OutputEventLineCrossed.
+type AnalyticsEvent struct {
+	Type      string                 `json:"type"`
+	Name      string                 `json:"name"`
+	TrackID   int                    `json:"trackId"`
+	Direction string                 `json:"direction,omitempty"`
+	Dwell     int                    `json:"dwell,omitempty"` // Seconds.
+	Rectangle models.MotionRectangle `json:"rectangle"`
+}
+
+// Analytics tracks the motion blobs across frames, and raises an event when
+// a track crosses a tripwire or stays in a loitering zone.
+type Analytics struct {
+	tracker   *CentroidTracker
+	tripwires []tripwire
+	loitering []loiteringZone
+}
+
+// NewAnalytics returns the analytics of the tripwires and loitering zones of
+// the region, scaled with the base width and height ratios to a frame of cols
+// x rows pixels, or nil when there are none. The motion blobs are only found
+// within the motion zones, so tripwires and loitering zones outside every
+// motion zone can't fire: they are left out, with a warning.
+func NewAnalytics(region *models.Region, zones []MotionZone, cols int, rows int, widthRatio float64, heightRatio float64) *Analytics {
+	if region == nil {
+		return nil
+	}
+	scale := func(c models.Coordinate) image.Point {
+		return image.Point{X: int(c.X * widthRatio), Y: int(c.Y * heightRatio)}
+	}
+
+	analytics := &Analytics{}
+	for index, wire := range region.Tripwires {
+		if wire.Enabled == "false" || len(wire.Coordinates) != 2 {
+			continue
+		}
+		line := tripwire{
+			name:      regionName(wire.Name, wire.ID, "tripwire", index),
+			from:      scale(wire.Coordinates[0]),
+			to:        scale(wire.Coordinates[1]),
+			direction: wire.Direction,
+		}
+		if !line.inMotionZones(zones, cols, rows) {
+			log.Log.Warning("computervision.analytics.NewAnalytics(): tripwire " + line.name + " is outside every motion zone, so it is ignored: draw a motion zone over it.")
+			continue
+		}
+		analytics.tripwires = append(analytics.tripwires, line)
+	}
+	for index, zone := range region.Loitering {
+		if zone.Enabled == "false" || len(zone.Coordinates) < 3 {
+			continue
+		}
+		polygon := geo.Polygon{}
+		for _, c := range zone.Coordinates {
+			p := scale(c)
+			polygon.Add(geo.NewPoint(float64(p.X), float64(p.Y)))
+		}
+		dwellTime := loiteringDwellTime
+		if zone.DwellTime > 0 {
+			dwellTime = time.Duration(zone.DwellTime) * time.Second
+		}
+		area := loiteringZone{
+			name:      regionName(zone.Name, zone.ID, "loitering", index),
+			polygon:   polygon,
+			dwellTime: dwellTime,
+		}
+		if !area.inMotionZones(zones, cols, rows) {
+			log.Log.Warning("computervision.analytics.NewAnalytics(): loitering zone " + area.name + " is outside every motion zone, so it is ignored: draw a motion zone over it.")
+			continue
+		}
+		analytics.loitering = append(analytics.loitering, area)
+	}
+	if len(analytics.tripwires) == 0 && len(analytics.loitering) == 0 {
+		return nil
+	}
+
+	diagonal := math.Hypot(float64(cols), float64(rows))
+	analytics.tracker = NewCentroidTracker(int(diagonal * trackerMaxDistance))
+	return analytics
+}
+
+// Update tracks the motion blobs of a frame, and returns the tripwires they
+// crossed and the loitering zones they stayed in too long.
+func (a *Analytics) Update(rectangles []models.MotionRectangle, now time.Time) []AnalyticsEvent {
+	var events []AnalyticsEvent
+	for _, track := range a.tracker.Update(rectangles, now) {
+		for index, wire := range a.tripwires {
+			direction := wire.crossing(track.Previous, track.Centroid)
+			if direction == "" || now.Sub(track.crossed[index]) < tripwireDebounce {
+				continue
+			}
+			if wire.direction != "" && wire.direction != "both" && wire.direction != direction {
+				continue
+			}
+			track.crossed[index] = now
+			events = append(events, AnalyticsEvent{
+				Type:      models.OutputEventLineCrossed,
+				Name:      wire.name,
+				TrackID:   track.ID,
+				Direction: direction,
+				Rectangle: track.Rectangle,
+			})
+		}
+
+		for index, zone := range a.loitering {
+			if !zone.polygon.Contains(geo.NewPoint(float64(track.Centroid.X), float64(track.Centroid.Y))) {
+				delete(track.entered, index)
+				delete(track.reported, index)
+				continue
+			}
+			entered, ok := track.entered[index]
+			if !ok {
+				track.entered[index] = now
+				continue
+			}
+			if dwell := now.Sub(entered); dwell >= zone.dwellTime && !track.reported[index] {
+				track.reported[index] = true
+				events = append(events, AnalyticsEvent{
+					Type:      models.OutputEventLoiteringDetected,
+					Name:      zone.name,
+					TrackID:   track.ID,
+					Dwell:     int(dwell.Seconds()),
+					Rectangle: track.Rectangle,
+				})
+			}
+		}
+	}
+	return events
+}
+
+// inMotionZones tells if a pixel of the frame is in one of the motion zones.
+func inMotionZones(zones []MotionZone, cols int, rows int, x int, y int) bool {
+	if x < 0 || x >= cols || y < 0 || y >= rows {
+		return false
+	}
+	return slices.ContainsFunc(zones, func(zone MotionZone) bool {
+		_, found := slices.BinarySearch(zone.Coordinates, y*cols+x)
+		return found
+	})
+}
+
+// inMotionZones tells if a point of the tripwire is in one of the motion
+// zones.
+func (w tripwire) inMotionZones(zones []MotionZone, cols int, rows int) bool {
+	dx, dy := w.to.X-w.from.X, w.to.Y-w.from.Y
+	steps := max(dx, -dx, dy, -dy, 1)
+	for step := 0; step <= steps; step++ {
+		x := w.from.X + dx*step/steps
+		y := w.from.Y + dy*step/steps
+		if inMotionZones(zones, cols, rows, x, y) {
+			return true
+		}
+	}
+	return false
+}
+
+// inMotionZones tells if the loitering zone overlaps one of the motion zones.
+func (z loiteringZone) inMotionZones(zones []MotionZone, cols int, rows int) bool {
+	bounds := image.Rectangle{}
+	for index, point := range z.polygon.Points() {
+		corner := image.Rect(int(point.Lat()), int(point.Lng()), int(point.Lat())+1, int(point.Lng())+1)
+		if index == 0 {
+			bounds = corner
+		} else {
+			bounds = bounds.Union(corner)
+		}
+	}
+	bounds = bounds.Intersect(image.Rect(0, 0, cols, rows))
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if inMotionZones(zones, cols, rows, x, y) && z.polygon.Contains(geo.NewPoint(float64(x), float64(y))) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// side tells on which side of the tripwire a point is, looking from the first
+// to the second point: negative is left, positive is right (the y axis points
+// down).
+func (w tripwire) side(p image.Point) int {
+	return (w.to.X-w.from.X)*(p.Y-w.from.Y) - (w.to.Y-w.from.Y)*(p.X-w.from.X)
+}
+
+// crossing returns the direction in which the move from a to b crosses the
+// tripwire, "left-to-right" or "right-to-left", or "".
+func (w tripwire) crossing(a image.Point, b image.Point) string {
+	sideA, sideB := w.side(a), w.side(b)
+	if sideA == 0 || sideB == 0 || (sideA < 0) == (sideB < 0) {
+		return ""
+	}
+	// The ends of the tripwire have to be on either side of the move too.
+	move := tripwire{from: a, to: b}
+	if sideFrom, sideTo := move.side(w.from), move.side(w.to); sideFrom != 0 && sideTo != 0 && (sideFrom < 0) == (sideTo < 0) {
+		return ""
+	}
+	if sideA < 0 {
+		return "left-to-right"
+	}
+	return "right-to-left"
+}
+
+// publishAnalyticsEvent sends the event to the hub, and to the outputs of its
+// type, with the snapshot of the frame it was detected on.
+func publishAnalyticsEvent(configuration *models.Configuration, communication *models.Communication, mqttClient mqtt.Client, event AnalyticsEvent, snapshot func() image.Image) {
+	config := configuration.Config
+	log.Log.Info("computervision.analytics.publishAnalyticsEvent(): " + event.Type + " " + event.Name + ".")
+
+	if config.Offline != "true" && mqttClient != nil {
+		if config.HubKey != "" {
+			message := models.Message{
+				Payload: models.Payload{
+					Action:   event.Type,
+					DeviceId: config.Key,
+					Value: map[string]interface{}{
+						"timestamp": time.Now().Unix(),
+						"event":     event,
+					},
+				},
+			}
+			payload, err := models.PackageMQTTMessage(configuration, message)
+			if err == nil {
+				mqttClient.Publish("kerberos/hub/"+config.HubKey, 2, false, payload)
+			} else {
+				log.Log.Info("computervision.analytics.publishAnalyticsEvent(): failed to package MQTT message: " + err.Error())
+			}
+		} else {
+			mqttClient.Publish("kerberos/agent/"+config.Key, 2, false, event.Type)
+		}
+	}
+
+	if message, ok := models.NewOutputMessage(configuration, conditions.PolicyOutputs(), event.Type, ""); ok {
+		rectangle := event.Rectangle
+		message.Rectangle = &rectangle
+		message.Zones = []string{event.Name}
+		message.Reason = event.Direction
+		message.Snapshot = snapshot()
+		models.QueueOutputMessage(communication, message)
+	}
+}
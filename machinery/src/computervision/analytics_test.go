@@ -0,0 +1,118 @@
+package computervision
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kerberos-io/agent/machinery/src/models"
+)
+
+func TestCentroidTracker(t *testing.T) {
+	tracker := NewCentroidTracker(20)
+	now := time.Now()
+	tracks := tracker.Update([]models.MotionRectangle{{X: 0, Y: 0, Width: 10, Height: 10}, {X: 100, Y: 100, Width: 10, Height: 10}}, now)
+	if len(tracks) != 2 || tracks[0].ID != 1 || tracks[1].ID != 2 {
+		t.Fatalf("tracks = %+v", tracks)
+	}
+
+	// Both blobs moved a bit, the second one is listed first now.
+	tracks = tracker.Update([]models.MotionRectangle{{X: 105, Y: 100, Width: 10, Height: 10}, {X: 5, Y: 5, Width: 10, Height: 10}}, now.Add(time.Second))
+	for _, track := range tracks {
+		if track.ID == 1 && track.Centroid.X != 10 || track.ID == 2 && track.Centroid.X != 110 || track.ID > 2 {
+			t.Fatalf("track %d at %v", track.ID, track.Centroid)
+		}
+	}
+
+	// A blob too far away is a new track, the old ones expire.
+	tracks = tracker.Update([]models.MotionRectangle{{X: 200, Y: 0, Width: 10, Height: 10}}, now.Add(5*time.Second))
+	if len(tracks) != 1 || tracks[0].ID != 3 || len(tracker.Tracks()) != 1 {
+		t.Fatalf("tracks = %+v, followed %d", tracks, len(tracker.Tracks()))
+	}
+}
+
+func TestAnalyticsTripwiresAndLoitering(t *testing.T) {
+	// The region editor works on 640x360, the frame is 320x180.
+	region := &models.Region{
+		Tripwires: []models.Tripwire{
+			// A vertical line in the middle, top to bottom: its left is the
+			// right half of the frame.
+			{Name: "gate", Coordinates: []models.Coordinate{{X: 320, Y: 0}, {X: 320, Y: 360}}},
+			{Name: "entry", Direction: "left-to-right", Coordinates: []models.Coordinate{{X: 320, Y: 0}, {X: 320, Y: 360}}},
+		},
+		Loitering: []models.LoiteringZone{
+			{Name: "door", DwellTime: 10, Coordinates: []models.Coordinate{{X: 0, Y: 0}, {X: 200, Y: 0}, {X: 200, Y: 360}, {X: 0, Y: 360}}},
+		},
+	}
+	// Motion is detected in the whole frame.
+	zones := buildMotionZones([]models.Polygon{
+		{Coordinates: []models.Coordinate{{X: 0, Y: 0}, {X: 640, Y: 0}, {X: 640, Y: 360}, {X: 0, Y: 360}}},
+	}, 320, 180, 0.5, 0.5, 150)
+	analytics := NewAnalytics(region, zones, 320, 180, 0.5, 0.5)
+	if analytics == nil {
+		t.Fatal("NewAnalytics() = nil")
+	}
+	if NewAnalytics(&models.Region{}, zones, 320, 180, 1, 1) != nil {
+		t.Fatal("NewAnalytics() without tripwires or loitering zones isn't nil")
+	}
+
+	blob := func(x int) []models.MotionRectangle {
+		return []models.MotionRectangle{{X: x - 5, Y: 80, Width: 10, Height: 20}}
+	}
+	now := time.Now()
+
+	// Walking from the left to the right of the frame crosses the gate from
+	// its right to its left, so not the entry.
+	var events []AnalyticsEvent
+	for i, x := range []int{130, 150, 170, 190} {
+		events = append(events, analytics.Update(blob(x), now.Add(time.Duration(i)*time.Second))...)
+	}
+	if len(events) != 1 || events[0].Type != models.OutputEventLineCrossed || events[0].Name != "gate" || events[0].Direction != "right-to-left" {
+		t.Fatalf("events = %+v", events)
+	}
+
+	// Walking back crosses both, then the blob stays at the door.
+	events = nil
+	for i, x := range []int{170, 150, 90, 92, 88, 90, 91} {
+		events = append(events, analytics.Update(blob(x), now.Add(time.Duration(10+i*3)*time.Second))...)
+	}
+	if len(events) != 3 || events[0].Name != "gate" || events[1].Name != "entry" || events[1].Direction != "left-to-right" {
+		t.Fatalf("events = %+v", events)
+	}
+	if events[2].Type != models.OutputEventLoiteringDetected || events[2].Name != "door" || events[2].Dwell < 10 || events[2].TrackID != events[0].TrackID {
+		t.Fatalf("loitering event = %+v", events[2])
+	}
+}
+
+func TestAnalyticsOutsideMotionZones(t *testing.T) {
+	// Motion is only detected in the left half of the frame.
+	zones := buildMotionZones([]models.Polygon{
+		{Coordinates: []models.Coordinate{{X: 0, Y: 0}, {X: 160, Y: 0}, {X: 160, Y: 180}, {X: 0, Y: 180}}},
+	}, 320, 180, 1, 1, 150)
+	region := &models.Region{
+		Tripwires: []models.Tripwire{
+			{Name: "left", Coordinates: []models.Coordinate{{X: 80, Y: 0}, {X: 80, Y: 180}}},
+			{Name: "right", Coordinates: []models.Coordinate{{X: 240, Y: 0}, {X: 240, Y: 180}}},
+			// Crosses into the motion zone.
+			{Name: "across", Coordinates: []models.Coordinate{{X: 300, Y: 90}, {X: 100, Y: 90}}},
+		},
+		Loitering: []models.LoiteringZone{
+			{Name: "bench", Coordinates: []models.Coordinate{{X: 200, Y: 20}, {X: 300, Y: 20}, {X: 300, Y: 160}, {X: 200, Y: 160}}},
+			{Name: "door", Coordinates: []models.Coordinate{{X: 140, Y: 20}, {X: 300, Y: 20}, {X: 300, Y: 160}, {X: 140, Y: 160}}},
+		},
+	}
+	analytics := NewAnalytics(region, zones, 320, 180, 1, 1)
+	if analytics == nil {
+		t.Fatal("NewAnalytics() = nil")
+	}
+	if len(analytics.tripwires) != 2 || analytics.tripwires[0].name != "left" || analytics.tripwires[1].name != "across" {
+		t.Errorf("tripwires = %+v, want left and across", analytics.tripwires)
+	}
+	if len(analytics.loitering) != 1 || analytics.loitering[0].name != "door" {
+		t.Errorf("loitering zones = %+v, want door", analytics.loitering)
+	}
+
+	// Without motion zones nothing can fire.
+	if NewAnalytics(region, nil, 320, 180, 1, 1) != nil {
+		t.Error("NewAnalytics() without motion zones isn't nil")
+	}
+}
@@ -0,0 +1,196 @@
+package computervision
+
+import (
+	"errors"
+	"image"
+	"slices"
+
+	"github.com/kerberos-io/agent/machinery/src/models"
+)
+
+const (
+	// The share of the background which is replaced by every frame.
+	backgroundLearningRate = 0.05
+	// Pixels which differ from the background are learned slower, so objects
+	// which stop moving only become background after a while.
+	backgroundForegroundRate = backgroundLearningRate / 10
+	// A pixel differs from the background when the difference is more than
+	// this many standard deviations of the pixel, within these bounds.
+	backgroundDeviations = 2.5
+	backgroundMinDiff    = 15
+	backgroundMaxDiff    = 60
+	// When more than this share of the pixels differs, the scene changed as a
+	// whole (e.g. an IR switchover), the background starts over.
+	backgroundGlobalChange = 0.6
+)
+
+// MotionDetector is a Detector which finds motion within the motion zones.
+// Motion returns the number of changed pixels and the clusters of changes of
+// the last frame, for the live-view overlay.
+type MotionDetector interface {
+	Detector
+	Motion() (changes int, rectangles []models.MotionRectangle)
+	Reset()
+}
+
+// NewMotionDetector returns the motion detector of the algorithm: "background"
+// for the background model, frame differencing otherwise.
+func NewMotionDetector(algorithm string, zones []MotionZone, previous ...*image.Gray) MotionDetector {
+	if algorithm == "background" {
+		detector := NewBackgroundDetector(zones)
+		for _, frame := range previous {
+			detector.learn(frame, nil)
+		}
+		return detector
+	}
+	return NewFrameDiffDetector(zones, previous...)
+}
+
+// BackgroundDetector detects motion against a running average of the frames,
+// with a variance per pixel, instead of the previous two frames. Slow changes,
+// like the light during the day, become part of the background. A shift of the
+// brightness of the whole frame is subtracted before the comparison, and a
+// change of most of the frame starts the background over, so light changes
+// don't trigger.
+type BackgroundDetector struct {
+	Zones      []MotionZone
+	Changes    int
+	Rectangles []models.MotionRectangle
+	bounds     image.Rectangle
+	mean       []float32
+	variance   []float32
+	pixels     []int // The pixels of all zones, the model only covers these.
+}
+
+// NewBackgroundDetector returns a background model for the zones.
+func NewBackgroundDetector(zones []MotionZone) *BackgroundDetector {
+	detector := &BackgroundDetector{Zones: zones}
+	for _, zone := range zones {
+		detector.pixels = append(detector.pixels, zone.Coordinates...)
+	}
+	slices.Sort(detector.pixels)
+	detector.pixels = slices.Compact(detector.pixels)
+	return detector
+}
+
+// Reset forgets the background, e.g. when detection was paused.
+func (d *BackgroundDetector) Reset() {
+	d.mean = nil
+	d.variance = nil
+	d.Changes = 0
+	d.Rectangles = nil
+}
+
+func (d *BackgroundDetector) Motion() (int, []models.MotionRectangle) {
+	return d.Changes, d.Rectangles
+}
+
+func (d *BackgroundDetector) Detect(frame Frame) ([]Detection, error) {
+	if frame.Gray == nil {
+		return nil, errors.New("computervision.BackgroundDetector.Detect(): no frame")
+	}
+	reached, changes, rectangle, rectangles, zones := d.FindMotion(frame.Gray, activeMotionZones(d.Zones, frame.Timestamp))
+	d.Changes = changes
+	d.Rectangles = rectangles
+	if !reached {
+		return nil, nil
+	}
+	return []Detection{{Label: "motion", Confidence: 1, Rectangle: rectangle, Zones: zones}}, nil
+}
+
+// FindMotion compares the frame with the background, with the same outputs as
+// the frame differencing FindMotion, and learns the frame.
+func (d *BackgroundDetector) FindMotion(img *image.Gray, zones []MotionZone) (thresholdReached bool, changesDetected int, motionRectangle models.MotionRectangle, motionRectangles []models.MotionRectangle, firedZones []string) {
+	if len(d.pixels) > 0 && d.pixels[len(d.pixels)-1] >= len(img.Pix) {
+		return
+	}
+	if d.mean == nil || img.Bounds() != d.bounds {
+		d.learn(img, nil)
+		return
+	}
+
+	shift := d.brightnessShift(img)
+	foreground := make([]bool, len(d.mean))
+	changed := 0
+	for _, pixel := range d.pixels {
+		if d.differs(img, pixel, shift) {
+			foreground[pixel] = true
+			changed++
+		}
+	}
+	if len(d.pixels) > 0 && float64(changed)/float64(len(d.pixels)) > backgroundGlobalChange {
+		d.mean = nil
+		d.learn(img, nil)
+		return
+	}
+
+	cols := d.bounds.Dx()
+	rows := d.bounds.Dy()
+	thresholdReached, changesDetected, motionRectangle, motionRectangles, firedZones = findMotionInZones(zones, func(coordinatesToCheck []int) (int, models.MotionRectangle, []models.MotionRectangle) {
+		changes := 0
+		var pixelList [][]int
+		for _, pixel := range coordinatesToCheck {
+			if foreground[pixel] {
+				changes++
+				pixelList = append(pixelList, []int{pixel % cols, pixel / cols})
+			}
+		}
+		rectangle, rectangles := motionRectanglesOf(pixelList, cols, rows)
+		return changes, rectangle, rectangles
+	})
+	d.learn(img, foreground)
+	return
+}
+
+// brightnessShift is the average difference between the frame and the
+// background, over a sample of the pixels: the global brightness change.
+func (d *BackgroundDetector) brightnessShift(img *image.Gray) float32 {
+	var sum float32
+	count := 0
+	for i := 0; i < len(d.pixels); i += 16 {
+		pixel := d.pixels[i]
+		sum += float32(img.Pix[pixel]) - d.mean[pixel]
+		count++
+	}
+	if count == 0 {
+		return 0
+	}
+	return sum / float32(count)
+}
+
+func (d *BackgroundDetector) differs(img *image.Gray, pixel int, shift float32) bool {
+	diff := float32(img.Pix[pixel]) - d.mean[pixel] - shift
+	threshold := backgroundDeviations * backgroundDeviations * d.variance[pixel]
+	threshold = min(max(threshold, backgroundMinDiff*backgroundMinDiff), backgroundMaxDiff*backgroundMaxDiff)
+	return diff*diff > threshold
+}
+
+// learn updates the background with the frame. Without background yet, the
+// frame is the background.
+func (d *BackgroundDetector) learn(img *image.Gray, foreground []bool) {
+	if img == nil {
+		return
+	}
+	if d.mean == nil || img.Bounds() != d.bounds {
+		d.bounds = img.Bounds()
+		size := d.bounds.Dx() * d.bounds.Dy()
+		d.mean = make([]float32, size)
+		d.variance = make([]float32, size)
+		for _, pixel := range d.pixels {
+			if pixel < size {
+				d.mean[pixel] = float32(img.Pix[pixel])
+				d.variance[pixel] = backgroundMinDiff * backgroundMinDiff
+			}
+		}
+		return
+	}
+	for _, pixel := range d.pixels {
+		rate := float32(backgroundLearningRate)
+		if foreground != nil && foreground[pixel] {
+			rate = backgroundForegroundRate
+		}
+		diff := float32(img.Pix[pixel]) - d.mean[pixel]
+		d.mean[pixel] += rate * diff
+		d.variance[pixel] += rate * (diff*diff - d.variance[pixel])
+	}
+}
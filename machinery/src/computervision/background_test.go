@@ -0,0 +1,63 @@
+package computervision
+
+import (
+	"image"
+	"testing"
+	"time"
+)
+
+func TestBackgroundDetector(t *testing.T) {
+	const cols, rows = 20, 20
+	var coordinates []int
+	for pixel := 0; pixel < cols*rows; pixel++ {
+		coordinates = append(coordinates, pixel)
+	}
+	detector := NewMotionDetector("background", []MotionZone{{Name: "frame", Coordinates: coordinates, PixelChangeThreshold: 10}})
+	if _, ok := detector.(*BackgroundDetector); !ok {
+		t.Fatalf("NewMotionDetector() = %T, want a background detector", detector)
+	}
+
+	frameOf := func(value func(pixel int) int) *image.Gray {
+		img := image.NewGray(image.Rect(0, 0, cols, rows))
+		for pixel := range img.Pix {
+			img.Pix[pixel] = uint8(value(pixel))
+		}
+		return img
+	}
+	scene := func(pixel int) int { return 40 + (pixel*37)%120 }
+
+	for i := 0; i < 5; i++ {
+		if detections, err := detector.Detect(Frame{Gray: frameOf(scene), Timestamp: time.Now()}); err != nil || detections != nil {
+			t.Fatalf("frame %d: Detect() = %v, %v, want the background to be learned", i, detections, err)
+		}
+	}
+
+	// The light goes up over the whole frame.
+	brighter := frameOf(func(pixel int) int { return scene(pixel) + 40 })
+	if detections, _ := detector.Detect(Frame{Gray: brighter, Timestamp: time.Now()}); detections != nil {
+		t.Fatalf("Detect() = %+v for a global brightness shift", detections)
+	}
+
+	// An object enters the frame.
+	object := frameOf(func(pixel int) int {
+		if pixel < 50 {
+			return 255
+		}
+		return scene(pixel)
+	})
+	detections, err := detector.Detect(Frame{Gray: object, Timestamp: time.Now()})
+	if err != nil || len(detections) != 1 || detections[0].Label != "motion" || detections[0].Zones[0] != "frame" {
+		t.Fatalf("Detect() = %+v, %v for an object", detections, err)
+	}
+	if changes, _ := detector.Motion(); changes < 40 {
+		t.Fatalf("Motion() = %d changes, want about 50", changes)
+	}
+
+	// The camera switches to infrared: the whole scene changes.
+	infrared := frameOf(func(pixel int) int { return 255 - scene(pixel) })
+	for i := 0; i < 2; i++ {
+		if detections, _ := detector.Detect(Frame{Gray: infrared, Timestamp: time.Now()}); detections != nil {
+			t.Fatalf("frame %d: Detect() = %+v after an infrared switchover", i, detections)
+		}
+	}
+}
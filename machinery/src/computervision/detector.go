@@ -0,0 +1,233 @@
+package computervision
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/jpeg"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kerberos-io/agent/machinery/src/conditions"
+	"github.com/kerberos-io/agent/machinery/src/models"
+)
+
+// Frame is a decoded frame handed to a detector. Gray is always set, Image
+// (the colour frame) only when the detector needs it.
+type Frame struct {
+	Gray      *image.Gray
+	Image     *image.YCbCr
+	Timestamp time.Time // In the timezone of the agent.
+}
+
+// Detection is something a detector found in a frame: motion, or an object of
+// a class such as person or car. The rectangle is in the pixel space of the
+// frame, Zones are the motion zones it is in.
+type Detection struct {
+	Label      string                 `json:"label"`
+	Confidence float64                `json:"confidence"`
+	Rectangle  models.MotionRectangle `json:"rectangle"`
+	Zones      []string               `json:"zones,omitempty"`
+}
+
+// Detector finds motion or objects in decoded frames.
+type Detector interface {
+	Detect(frame Frame) ([]Detection, error)
+}
+
+// NewDetector returns the object detector configured in Detector, or nil when
+// frame differencing alone is used (the default).
+func NewDetector(settings *models.Detector) (Detector, error) {
+	if settings == nil || settings.Type == "" || settings.Type == "framediff" {
+		return nil, nil
+	}
+	switch settings.Type {
+	case "http":
+		if settings.URL == "" {
+			return nil, errors.New("computervision.NewDetector(): no url set for the http detector")
+		}
+		return NewHTTPDetector(settings), nil
+	}
+	return nil, errors.New("computervision.NewDetector(): unknown detector " + settings.Type)
+}
+
+// activeMotionZones returns the zones which are within their schedule.
+func activeMotionZones(zones []MotionZone, now time.Time) []MotionZone {
+	var active []MotionZone
+	for _, zone := range zones {
+		if conditions.InTimetable(zone.Timetable, now) {
+			active = append(active, zone)
+		}
+	}
+	return active
+}
+
+// FrameDiffDetector detects motion by differencing the frame with the two
+// previous ones, within the motion zones (see FindMotion). It returns a single
+// "motion" detection with the zones which fired. Changes and Rectangles hold
+// the number of changed pixels and the clusters of changes of the last frame,
+// for the live-view overlay.
+type FrameDiffDetector struct {
+	Zones      []MotionZone
+	Changes    int
+	Rectangles []models.MotionRectangle
+	frames     [2]*image.Gray
+}
+
+// NewFrameDiffDetector returns a frame differencing detector for the zones.
+// The previous frames are optional, without them the first two frames only
+// fill the history.
+func NewFrameDiffDetector(zones []MotionZone, previous ...*image.Gray) *FrameDiffDetector {
+	detector := &FrameDiffDetector{Zones: zones}
+	for _, frame := range previous {
+		detector.push(frame)
+	}
+	return detector
+}
+
+func (d *FrameDiffDetector) push(frame *image.Gray) {
+	d.frames[0], d.frames[1] = d.frames[1], frame
+}
+
+func (d *FrameDiffDetector) Motion() (int, []models.MotionRectangle) {
+	return d.Changes, d.Rectangles
+}
+
+// Reset forgets the previous frames, e.g. when detection was paused.
+func (d *FrameDiffDetector) Reset() {
+	d.frames = [2]*image.Gray{}
+	d.Changes = 0
+	d.Rectangles = nil
+}
+
+func (d *FrameDiffDetector) Detect(frame Frame) ([]Detection, error) {
+	if frame.Gray == nil {
+		return nil, errors.New("computervision.FrameDiffDetector.Detect(): no frame")
+	}
+	defer d.push(frame.Gray)
+	if d.frames[0] == nil || d.frames[1] == nil || d.frames[0].Bounds() != frame.Gray.Bounds() || d.frames[1].Bounds() != frame.Gray.Bounds() {
+		return nil, nil
+	}
+
+	reached, changes, rectangle, rectangles, zones := FindMotion([3]*image.Gray{d.frames[0], d.frames[1], frame.Gray}, activeMotionZones(d.Zones, frame.Timestamp))
+	d.Changes = changes
+	d.Rectangles = rectangles
+	if !reached {
+		return nil, nil
+	}
+	return []Detection{{Label: "motion", Confidence: 1, Rectangle: rectangle, Zones: zones}}, nil
+}
+
+// HTTPDetector sends the frame, as JPEG, to a local inference server (e.g. a
+// YOLO/ONNX container) and keeps the detections of the configured classes.
+// The server answers with:
+//
+//	{"detections": [{"label": "person", "confidence": 0.87, "box": [x1, y1, x2, y2]}]}
+type HTTPDetector struct {
+	URL           string
+	Classes       []string
+	MinConfidence float64
+	client        *http.Client
+}
+
+// NewHTTPDetector returns an inference detector, with a default timeout of 2
+// seconds and a default minimum confidence of 0.5.
+func NewHTTPDetector(settings *models.Detector) *HTTPDetector {
+	timeout := 2 * time.Second
+	if settings.Timeout > 0 {
+		timeout = time.Duration(settings.Timeout) * time.Millisecond
+	}
+	minConfidence := 0.5
+	if settings.MinConfidence > 0 {
+		minConfidence = settings.MinConfidence
+	}
+	return &HTTPDetector{
+		URL:           settings.URL,
+		Classes:       settings.Classes,
+		MinConfidence: minConfidence,
+		client:        &http.Client{Timeout: timeout},
+	}
+}
+
+type httpDetectorResponse struct {
+	Detections []struct {
+		Label      string    `json:"label"`
+		Confidence float64   `json:"confidence"`
+		Box        []float64 `json:"box"`
+	} `json:"detections"`
+}
+
+func (d *HTTPDetector) Detect(frame Frame) ([]Detection, error) {
+	if frame.Image == nil {
+		return nil, errors.New("computervision.HTTPDetector.Detect(): no colour frame")
+	}
+	var body bytes.Buffer
+	if err := jpeg.Encode(&body, frame.Image, &jpeg.Options{Quality: 80}); err != nil {
+		return nil, err
+	}
+
+	resp, err := d.client.Post(d.URL, "image/jpeg", &body)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New("computervision.HTTPDetector.Detect(): " + d.URL + " responded " + strconv.Itoa(resp.StatusCode))
+	}
+	var response httpDetectorResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, err
+	}
+
+	var detections []Detection
+	for _, result := range response.Detections {
+		if result.Confidence < d.MinConfidence || len(result.Box) != 4 {
+			continue
+		}
+		if len(d.Classes) > 0 && !slices.ContainsFunc(d.Classes, func(class string) bool { return strings.EqualFold(class, result.Label) }) {
+			continue
+		}
+		x1, y1, x2, y2 := int(result.Box[0]), int(result.Box[1]), int(result.Box[2]), int(result.Box[3])
+		detections = append(detections, Detection{
+			Label:      strings.ToLower(result.Label),
+			Confidence: result.Confidence,
+			Rectangle:  models.MotionRectangle{X: x1, Y: y1, Width: x2 - x1, Height: y2 - y1},
+		})
+	}
+	return detections, nil
+}
+
+// detectionsInZones keeps the detections of which the centre is in one of the
+// zones (of a frame cols pixels wide), and sets the zones they are in.
+func detectionsInZones(detections []Detection, zones []MotionZone, cols int) []Detection {
+	var inZones []Detection
+	for _, detection := range detections {
+		x := detection.Rectangle.X + detection.Rectangle.Width/2
+		y := detection.Rectangle.Y + detection.Rectangle.Height/2
+		detection.Zones = nil
+		for _, zone := range zones {
+			// The coordinates of a zone are in ascending order.
+			if _, found := slices.BinarySearch(zone.Coordinates, y*cols+x); found && x >= 0 && x < cols {
+				detection.Zones = append(detection.Zones, zone.Name)
+			}
+		}
+		if len(detection.Zones) > 0 {
+			inZones = append(inZones, detection)
+		}
+	}
+	return inZones
+}
+
+// grayFromYCbCr copies the luma of a colour frame, which is the gray frame.
+func grayFromYCbCr(img *image.YCbCr) *image.Gray {
+	gray := image.NewGray(img.Rect)
+	width := img.Rect.Dx()
+	for y := 0; y < img.Rect.Dy(); y++ {
+		copy(gray.Pix[y*gray.Stride:y*gray.Stride+width], img.Y[y*img.YStride:y*img.YStride+width])
+	}
+	return gray
+}
@@ -0,0 +1,89 @@
+package computervision
+
+import (
+	"image"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/kerberos-io/agent/machinery/src/models"
+)
+
+func TestFrameDiffDetector(t *testing.T) {
+	const cols, rows = 20, 20
+	var coordinates []int
+	for pixel := 0; pixel < cols*rows; pixel++ {
+		coordinates = append(coordinates, pixel)
+	}
+	detector := NewFrameDiffDetector([]MotionZone{{Name: "frame", Coordinates: coordinates, PixelChangeThreshold: 10}})
+
+	still := image.NewGray(image.Rect(0, 0, cols, rows))
+	moving := image.NewGray(image.Rect(0, 0, cols, rows))
+	for pixel := 0; pixel < 50; pixel++ {
+		moving.Pix[pixel] = 255
+	}
+
+	for i, frame := range []*image.Gray{still, still} {
+		if detections, err := detector.Detect(Frame{Gray: frame, Timestamp: time.Now()}); err != nil || detections != nil {
+			t.Fatalf("frame %d: Detect() = %v, %v, want the history to fill up", i, detections, err)
+		}
+	}
+	detections, err := detector.Detect(Frame{Gray: moving, Timestamp: time.Now()})
+	if err != nil || len(detections) != 1 || detections[0].Label != "motion" || detections[0].Zones[0] != "frame" || detector.Changes != 50 {
+		t.Fatalf("Detect() = %+v, %v, changes %d", detections, err, detector.Changes)
+	}
+
+	detector.Reset()
+	if detections, _ := detector.Detect(Frame{Gray: moving, Timestamp: time.Now()}); detections != nil {
+		t.Fatal("Detect() reported motion right after a reset")
+	}
+}
+
+func TestHTTPDetectorFiltersClasses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "image/jpeg" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"detections": [
+			{"label": "Person", "confidence": 0.9, "box": [2, 2, 6, 10]},
+			{"label": "person", "confidence": 0.2, "box": [12, 2, 16, 10]},
+			{"label": "tree", "confidence": 0.95, "box": [0, 0, 20, 20]},
+			{"label": "car", "confidence": 0.8, "box": [12, 12, 18, 18]}
+		]}`))
+	}))
+	defer server.Close()
+
+	detector, err := NewDetector(&models.Detector{Type: "http", URL: server.URL, Classes: []string{"person", "car"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame := Frame{Image: image.NewYCbCr(image.Rect(0, 0, 20, 20), image.YCbCrSubsampleRatio420)}
+	detections, err := detector.Detect(frame)
+	if err != nil || len(detections) != 2 || detections[0].Label != "person" || detections[1].Label != "car" {
+		t.Fatalf("Detect() = %+v, %v", detections, err)
+	}
+	if detections[0].Rectangle != (models.MotionRectangle{X: 2, Y: 2, Width: 4, Height: 8}) {
+		t.Fatalf("rectangle = %+v", detections[0].Rectangle)
+	}
+
+	// Only the person is within the driveway (the left half).
+	var driveway []int
+	for y := 0; y < 20; y++ {
+		for x := 0; x < 10; x++ {
+			driveway = append(driveway, y*20+x)
+		}
+	}
+	inZones := detectionsInZones(detections, []MotionZone{{Name: "driveway", Coordinates: driveway}}, 20)
+	if len(inZones) != 1 || inZones[0].Label != "person" || inZones[0].Zones[0] != "driveway" {
+		t.Fatalf("detectionsInZones() = %+v", inZones)
+	}
+
+	if _, err := NewDetector(&models.Detector{Type: "http"}); err == nil {
+		t.Fatal("NewDetector() accepted an http detector without url")
+	}
+	if detector, err := NewDetector(&models.Detector{}); detector != nil || err != nil {
+		t.Fatal("NewDetector() returned an object detector by default")
+	}
+}
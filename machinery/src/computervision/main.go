@@ -2,6 +2,8 @@ package computervision
 
 import (
 	"image"
+	"slices"
+	"strconv"
 	"time"
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
@@ -11,18 +13,50 @@ import (
 	"github.com/kerberos-io/agent/machinery/src/log"
 	"github.com/kerberos-io/agent/machinery/src/models"
 	"github.com/kerberos-io/agent/machinery/src/packets"
+	"github.com/kerberos-io/agent/machinery/src/utils"
 )
 
-func ProcessMotion(motionCursor *packets.QueueCursor, configuration *models.Configuration, communication *models.Communication, mqttClient mqtt.Client, rtspClient capture.RTSPClient) {
+// motionOutputCooldown is the minimum time between two motion_detected output
+// events.
+const motionOutputCooldown = 10 * time.Second
+
+// MotionZone is a polygon of the motion region, as the list of pixel indexes
+// it covers, with its own sensitivity. Zones are evaluated independently.
+type MotionZone struct {
+	Name                 string
+	Coordinates          []int
+	PixelChangeThreshold int // Number of changed pixels required to fire.
+	MinBlobSize          int // Minimum area of the largest cluster of changes, 0 is any.
+	Timetable            []*models.Timetable
+}
+
+// motionZoneName returns the name reported when the zone fires: its name, its
+// id, or its position in the region.
+func motionZoneName(polygon models.Polygon, index int) string {
+	return regionName(polygon.Name, polygon.ID, "zone", index)
+}
+
+// regionName returns the name of an element of the region: its name, its id,
+// or the kind and its position.
+func regionName(name string, id string, kind string, index int) string {
+	if name != "" {
+		return name
+	}
+	if id != "" {
+		return id
+	}
+	return kind + "-" + strconv.Itoa(index+1)
+}
+
+func ProcessMotion(motionCursor *packets.QueueCursor, configDirectory string, configuration *models.Configuration, communication *models.Communication, mqttClient mqtt.Client, rtspClient capture.RTSPClient) {
 
 	log.Log.Debug("computervision.main.ProcessMotion(): start motion detection")
 	config := configuration.Config
 	loc, _ := time.LoadLocation(config.Timezone)
 
-	var isPixelChangeThresholdReached = false
-	var changesToReturn = 0
-	var motionRectangle models.MotionRectangle
-	var motionRectangles []models.MotionRectangle
+	// Motion is evaluated on every keyframe; only emit a motion_detected output
+	// event once per motionOutputCooldown so the outputs are not flooded.
+	var lastMotionOutput time.Time
 
 	// Resolve the motion sensitivity (pixel-change threshold). Nil, zero, and
 	// negative values use the historical default so older configurations keep
@@ -55,6 +89,15 @@ func ProcessMotion(motionCursor *packets.QueueCursor, configuration *models.Conf
 		hubKey := config.HubKey
 		deviceKey := config.Key
 
+		// Frames are decoded at the analysis rate, or keyframes only. The
+		// object detector, when configured, needs the colour frames.
+		objectDetector, err := NewDetector(config.Detector)
+		if err != nil {
+			log.Log.Error("computervision.main.ProcessMotion(): " + err.Error() + ", using motion only.")
+		}
+		source := newFrameSource(rtspClient, config.Capture.AnalysisFPS, objectDetector != nil)
+		defer source.Close()
+
 		// Initialise first 2 elements
 		var imageArray [3]*image.Gray
 
@@ -66,12 +109,9 @@ func ProcessMotion(motionCursor *packets.QueueCursor, configuration *models.Conf
 		for cursorError == nil {
 			pkt, cursorError = motionCursor.ReadPacket()
 			// Check If valid package.
-			if len(pkt.Data) > 0 && pkt.IsKeyFrame {
-				grayImage, err := rtspClient.DecodePacketRaw(pkt)
-				if err == nil {
-					imageArray[j] = &grayImage
-					j++
-				}
+			if frame, ok := source.frame(pkt, time.Now()); ok {
+				imageArray[j] = frame.Gray
+				j++
 			}
 			if j == 3 {
 				break
@@ -97,31 +137,17 @@ func ProcessMotion(motionCursor *packets.QueueCursor, configuration *models.Conf
 			}
 		}
 
-		// Calculate mask
-		var polyObjects []geo.Polygon
-		if config.Region != nil {
-			for _, polygon := range config.Region.Polygon {
-				coords := polygon.Coordinates
-				poly := geo.Polygon{}
-				for _, c := range coords {
-					x := c.X * baseWidthRatio
-					y := c.Y * baseHeightRatio
-					p := geo.NewPoint(x, y)
-					if !poly.Contains(p) {
-						poly.Add(p)
-					}
-				}
-				polyObjects = append(polyObjects, poly)
-			}
-		}
-
 		// Frame dimensions + the motion region polygon(s) in image space, shipped
 		// with each motion event so the live view can draw a motion-debug overlay
-		// (the boxes below + the detection region).
+		// (the boxes below + the detection region and the excluded areas).
 		var imageCols, imageRows int
 		var regionPolygons [][]map[string]int
+		var excludedPolygons [][]map[string]int
 		if config.Region != nil {
 			for _, polygon := range config.Region.Polygon {
+				if polygon.Enabled == "false" {
+					continue
+				}
 				var pts []map[string]int
 				for _, c := range polygon.Coordinates {
 					pts = append(pts, map[string]int{
@@ -129,58 +155,57 @@ func ProcessMotion(motionCursor *packets.QueueCursor, configuration *models.Conf
 						"y": int(c.Y * baseHeightRatio),
 					})
 				}
-				if len(pts) > 0 {
+				if len(pts) == 0 {
+					continue
+				}
+				if polygon.Exclude == "true" {
+					excludedPolygons = append(excludedPolygons, pts)
+				} else {
 					regionPolygons = append(regionPolygons, pts)
 				}
 			}
 		}
 
 		img := imageArray[0]
-		var coordinatesPerRegion [][]int
+		var zones []MotionZone
 		totalCoordinates := 0
-		if img != nil {
+		if img != nil && config.Region != nil {
 			bounds := img.Bounds()
-			rows := bounds.Dy()
-			cols := bounds.Dx()
-			imageCols = cols
-			imageRows = rows
-
-			// Build a SEPARATE coordinate list per region. Motion is evaluated
-			// independently per region: pixels are NOT shared between regions, so
-			// the threshold must be exceeded within a single region to trigger.
-			coordinatesPerRegion = make([][]int, len(polyObjects))
-			for y := 0; y < rows; y++ {
-				for x := 0; x < cols; x++ {
-					point := geo.NewPoint(float64(x), float64(y))
-					for idx, poly := range polyObjects {
-						if poly.Contains(point) {
-							coordinatesPerRegion[idx] = append(coordinatesPerRegion[idx], y*cols+x)
-							totalCoordinates++
-						}
-					}
-				}
+			imageCols = bounds.Dx()
+			imageRows = bounds.Dy()
+			zones = buildMotionZones(config.Region.Polygon, imageCols, imageRows, baseWidthRatio, baseHeightRatio, pixelThreshold)
+			for _, zone := range zones {
+				totalCoordinates += len(zone.Coordinates)
 			}
 		}
 
+		// Tripwires and loitering zones follow the motion blobs across the
+		// analysed frames, the blobs are found within the motion zones.
+		analytics := NewAnalytics(config.Region, zones, imageCols, imageRows, baseWidthRatio, baseHeightRatio)
+
 		// If no region is set, we'll skip the motion detection
 		if totalCoordinates > 0 {
 
+			// Motion is detected with frame differencing or a background
+			// model. An object detector, when configured, confirms the motion
+			// and decides what triggers.
+			motionDetector := NewMotionDetector(config.Capture.MotionAlgorithm, zones, imageArray[0], imageArray[1])
+
+			// The motion events are accumulated in the heatmap and timeline.
+			defer flushActivity()
+
 			// Start the motion detection
 			i := 0
 
 			for cursorError == nil {
 				pkt, cursorError = motionCursor.ReadPacket()
 
-				// Check If valid package.
-				if len(pkt.Data) == 0 || !pkt.IsKeyFrame {
+				// Check If valid package, and if its frame is analysed.
+				frame, ok := source.frame(pkt, time.Now().In(loc))
+				if !ok {
 					continue
 				}
 
-				grayImage, err := rtspClient.DecodePacketRaw(pkt)
-				if err == nil {
-					imageArray[2] = &grayImage
-				}
-
 				// We might have different conditions enabled such as time window or uri response.
 				// We'll validate those conditions and if not valid we'll not do anything.
 				detectMotion, err := conditions.Validate(loc, configuration)
@@ -194,11 +219,47 @@ func ProcessMotion(motionCursor *packets.QueueCursor, configuration *models.Conf
 				// emit motion events for the live-view overlay.
 				if config.Capture.Motion != "false" || continuousMode {
 
-					if detectMotion {
+					if !detectMotion {
+						// Start over once the conditions are valid again.
+						motionDetector.Reset()
+					} else {
+
+						detections, _ := motionDetector.Detect(frame)
+						if analytics != nil {
+							_, blobs := motionDetector.Motion()
+							for _, event := range analytics.Update(blobs, frame.Timestamp) {
+								publishAnalyticsEvent(configuration, communication, mqttClient, event, func() image.Image {
+									return source.snapshot(frame, pkt)
+								})
+							}
+						}
+						var labels []string
+						if len(detections) > 0 && objectDetector != nil {
+							objects, err := objectDetector.Detect(frame)
+							if err != nil {
+								// Don't miss events when the inference server is down.
+								log.Log.Warning("computervision.main.ProcessMotion(): object detection failed, triggering on motion: " + err.Error())
+							} else {
+								detections = detectionsInZones(objects, activeMotionZones(zones, frame.Timestamp), imageCols)
+								for _, detection := range detections {
+									if !slices.Contains(labels, detection.Label) {
+										labels = append(labels, detection.Label)
+									}
+								}
+							}
+						}
 
-						// Remember additional information about the result of findmotion
-						isPixelChangeThresholdReached, changesToReturn, motionRectangle, motionRectangles = FindMotion(imageArray, coordinatesPerRegion, pixelThreshold)
-						if isPixelChangeThresholdReached {
+						if len(detections) > 0 {
+							changesToReturn, motionRectangles := motionDetector.Motion()
+							motionRectangle := detections[0].Rectangle
+							var firedZones []string
+							for _, detection := range detections[1:] {
+								motionRectangle = unionMotionRectangle(motionRectangle, detection.Rectangle)
+							}
+							for _, detection := range detections {
+								firedZones = utils.AppendUnique(firedZones, detection.Zones)
+							}
+							recordActivity(configDirectory, frame.Timestamp, imageCols, imageRows, changesToReturn, motionRectangles)
 
 							// If offline mode is disabled, send a message to the hub
 							if config.Offline != "true" {
@@ -222,12 +283,15 @@ func ProcessMotion(motionCursor *packets.QueueCursor, configuration *models.Conf
 													"mainWidth":  configuration.Config.Capture.IPCamera.Width,
 													"mainHeight": configuration.Config.Capture.IPCamera.Height,
 													"regions":    motionRectangles,
+													"excluded":   excludedPolygons,
 													"polygon":    regionPolygons, // Motion sensitivity = the pixel-change threshold that must
 													// be exceeded before motion triggers. The live view renders
 													// a reference square of sqrt(threshold) px (in this MOTION
 													// frame's pixel space) so the user can visually gauge how
 													// large a moving object must be before it is detected.
 													"pixelChangeThreshold": pixelThreshold,
+													"zones":                firedZones,
+													"detections":           detections,
 												},
 											},
 										}
@@ -243,6 +307,18 @@ func ProcessMotion(motionCursor *packets.QueueCursor, configuration *models.Conf
 								}
 							}
 
+							if time.Since(lastMotionOutput) >= motionOutputCooldown {
+								if message, ok := models.NewOutputMessage(configuration, conditions.PolicyOutputs(), models.OutputEventMotionDetected, ""); ok {
+									rectangle := motionRectangle
+									message.Rectangle = &rectangle
+									message.Zones = firedZones
+									message.Snapshot = source.snapshot(frame, pkt)
+									if models.QueueOutputMessage(communication, message) {
+										lastMotionOutput = time.Now()
+									}
+								}
+							}
+
 							// Trigger motion-based recording — but NOT in continuous mode:
 							// there the recorder runs the continuous branch and does not
 							// drain HandleMotion, so a (blocking) send would hang the motion
@@ -253,14 +329,14 @@ func ProcessMotion(motionCursor *packets.QueueCursor, configuration *models.Conf
 									Timestamp:       time.Now().Unix(),
 									NumberOfChanges: changesToReturn,
 									Rectangle:       motionRectangle,
+									Zones:           firedZones,
+									Labels:          labels,
 								}
 								communication.HandleMotion <- dataToPass //Save data to the channel
 							}
 						}
 					}
 
-					imageArray[0] = imageArray[1]
-					imageArray[1] = imageArray[2]
 					i++
 				}
 			}
@@ -274,41 +350,128 @@ func ProcessMotion(motionCursor *packets.QueueCursor, configuration *models.Conf
 	log.Log.Debug("computervision.main.ProcessMotion(): stop the motion detection.")
 }
 
-func FindMotion(imageArray [3]*image.Gray, coordinatesPerRegion [][]int, pixelChangeThreshold int) (thresholdReached bool, changesDetected int, motionRectangle models.MotionRectangle, motionRectangles []models.MotionRectangle) {
+// buildMotionZones turns the polygons of the region into motion zones, with
+// the pixels (of a cols x rows frame) each of them covers. The polygons are
+// scaled with the base width and height ratios. Disabled polygons are ignored,
+// exclusion polygons are subtracted from every zone. With exclusion polygons
+// only, the rest of the frame is a single zone: "frame".
+func buildMotionZones(polygons []models.Polygon, cols int, rows int, widthRatio float64, heightRatio float64, pixelThreshold int) []MotionZone {
+	var zones []MotionZone
+	var included []geo.Polygon
+	var excluded []geo.Polygon
+	for index, polygon := range polygons {
+		if polygon.Enabled == "false" {
+			continue
+		}
+		poly := geo.Polygon{}
+		for _, c := range polygon.Coordinates {
+			p := geo.NewPoint(c.X*widthRatio, c.Y*heightRatio)
+			if !poly.Contains(p) {
+				poly.Add(p)
+			}
+		}
+		if polygon.Exclude == "true" {
+			excluded = append(excluded, poly)
+			continue
+		}
+
+		zone := MotionZone{
+			Name:                 motionZoneName(polygon, index),
+			PixelChangeThreshold: pixelThreshold,
+			MinBlobSize:          polygon.MinBlobSize,
+			Timetable:            polygon.Timetable,
+		}
+		if polygon.PixelChangeThreshold > 0 {
+			zone.PixelChangeThreshold = polygon.PixelChangeThreshold
+		}
+		zones = append(zones, zone)
+		included = append(included, poly)
+	}
+
+	wholeFrame := len(zones) == 0 && len(excluded) > 0
+	if wholeFrame {
+		zones = append(zones, MotionZone{Name: "frame", PixelChangeThreshold: pixelThreshold})
+	}
+
+	// Build a SEPARATE coordinate list per zone. Motion is evaluated
+	// independently per zone: pixels are NOT shared between zones, so the
+	// threshold must be exceeded within a single zone to trigger.
+	for y := 0; y < rows; y++ {
+		for x := 0; x < cols; x++ {
+			point := geo.NewPoint(float64(x), float64(y))
+			if slices.ContainsFunc(excluded, func(poly geo.Polygon) bool { return poly.Contains(point) }) {
+				continue
+			}
+			if wholeFrame {
+				zones[0].Coordinates = append(zones[0].Coordinates, y*cols+x)
+				continue
+			}
+			for idx, poly := range included {
+				if poly.Contains(point) {
+					zones[idx].Coordinates = append(zones[idx].Coordinates, y*cols+x)
+				}
+			}
+		}
+	}
+	return zones
+}
+
+// FindMotion evaluates every zone on its own: pixels are not shared between
+// zones, so a zone fires when its own threshold is exceeded within it, and its
+// largest cluster of changes is at least its minimum blob size. It returns the
+// names of the zones which fired. The rectangle (recording metadata) covers
+// the zones which fired, the per-cluster rectangles (live-view overlay) are
+// aggregated across all zones.
+func FindMotion(imageArray [3]*image.Gray, zones []MotionZone) (thresholdReached bool, changesDetected int, motionRectangle models.MotionRectangle, motionRectangles []models.MotionRectangle, firedZones []string) {
 	image1 := imageArray[0]
 	image2 := imageArray[1]
 	image3 := imageArray[2]
 	threshold := 60
 
-	// Evaluate each region INDEPENDENTLY — pixels are not shared between regions,
-	// so the threshold must be exceeded within a single region to trigger. The
-	// overall rectangle (recording metadata) and the per-cluster rectangles
-	// (live-view overlay) are aggregated across all regions.
+	return findMotionInZones(zones, func(coordinatesToCheck []int) (int, models.MotionRectangle, []models.MotionRectangle) {
+		return AbsDiffBitwiseAndThreshold(image1, image2, image3, threshold, coordinatesToCheck)
+	})
+}
+
+// findMotionInZones evaluates the zones with the changes the detection finds
+// within the coordinates of a zone, see FindMotion.
+func findMotionInZones(zones []MotionZone, detect func(coordinatesToCheck []int) (int, models.MotionRectangle, []models.MotionRectangle)) (thresholdReached bool, changesDetected int, motionRectangle models.MotionRectangle, motionRectangles []models.MotionRectangle, firedZones []string) {
 	var combinedRectangles []models.MotionRectangle
 	var overall models.MotionRectangle
 	haveOverall := false
 	totalChanges := 0
-	for _, coordinatesToCheck := range coordinatesPerRegion {
-		if len(coordinatesToCheck) == 0 {
+	for _, zone := range zones {
+		if len(zone.Coordinates) == 0 {
 			continue
 		}
-		changes, rect, rects := AbsDiffBitwiseAndThreshold(image1, image2, image3, threshold, coordinatesToCheck)
+		changes, rect, rects := detect(zone.Coordinates)
 		totalChanges += changes
-		if changes > pixelChangeThreshold {
-			thresholdReached = true
-		}
 		combinedRectangles = append(combinedRectangles, rects...)
-		if changes > 0 {
-			if !haveOverall {
-				overall = rect
-				haveOverall = true
-			} else {
-				overall = unionMotionRectangle(overall, rect)
-			}
+		if changes <= zone.PixelChangeThreshold || largestMotionRectangle(rects) < zone.MinBlobSize {
+			continue
+		}
+		thresholdReached = true
+		firedZones = append(firedZones, zone.Name)
+		if !haveOverall {
+			overall = rect
+			haveOverall = true
+		} else {
+			overall = unionMotionRectangle(overall, rect)
 		}
 	}
 
-	return thresholdReached, totalChanges, overall, combinedRectangles
+	return thresholdReached, totalChanges, overall, combinedRectangles, firedZones
+}
+
+// largestMotionRectangle returns the area of the largest rectangle.
+func largestMotionRectangle(rectangles []models.MotionRectangle) int {
+	largest := 0
+	for _, rectangle := range rectangles {
+		if area := rectangle.Width * rectangle.Height; area > largest {
+			largest = area
+		}
+	}
+	return largest
 }
 
 // unionMotionRectangle returns the smallest rectangle that contains both a and b.
@@ -353,6 +516,13 @@ func AbsDiffBitwiseAndThreshold(img1 *image.Gray, img2 *image.Gray, img3 *image.
 		}
 	}
 
+	motionRectangle, motionRectangles := motionRectanglesOf(pixelList, cols, rows)
+	return changes, motionRectangle, motionRectangles
+}
+
+// motionRectanglesOf returns the bounding box of the changed pixels, and the
+// boxes of the clusters of changes.
+func motionRectanglesOf(pixelList [][]int, cols int, rows int) (models.MotionRectangle, []models.MotionRectangle) {
 	// Calculate rectangle of pixelList (startX, startY, endX, endY)
 	var motionRectangle models.MotionRectangle
 	if len(pixelList) > 0 {
@@ -389,7 +559,7 @@ func AbsDiffBitwiseAndThreshold(img1 *image.Gray, img2 *image.Gray, img3 *image.
 	// two objects move in opposite corners). Cheap grid-based connected components.
 	motionRectangles := clusterMotionRectangles(pixelList, cols, rows)
 
-	return changes, motionRectangle, motionRectangles
+	return motionRectangle, motionRectangles
 }
 
 // clusterMotionRectangles groups the changed-pixel coordinates into a handful of
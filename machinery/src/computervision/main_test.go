@@ -0,0 +1,106 @@
+package computervision
+
+import (
+	"image"
+	"slices"
+	"testing"
+
+	"github.com/kerberos-io/agent/machinery/src/models"
+)
+
+func TestFindMotionPerZone(t *testing.T) {
+	const cols, rows = 20, 20
+	var images [3]*image.Gray
+	for i := range images {
+		images[i] = image.NewGray(image.Rect(0, 0, cols, rows))
+	}
+	// A 4x4 object appears in the left half.
+	for y := 2; y < 6; y++ {
+		for x := 2; x < 6; x++ {
+			images[2].Pix[y*cols+x] = 255
+		}
+	}
+
+	var left, right []int
+	for y := 0; y < rows; y++ {
+		for x := 0; x < cols; x++ {
+			if x < cols/2 {
+				left = append(left, y*cols+x)
+			} else {
+				right = append(right, y*cols+x)
+			}
+		}
+	}
+
+	for _, test := range []struct {
+		name  string
+		zones []MotionZone
+		want  []string
+	}{
+		{"fires in its zone only", []MotionZone{
+			{Name: "driveway", Coordinates: left, PixelChangeThreshold: 10},
+			{Name: "street", Coordinates: right, PixelChangeThreshold: 10},
+		}, []string{"driveway"}},
+		{"threshold per zone", []MotionZone{
+			{Name: "driveway", Coordinates: left, PixelChangeThreshold: 20},
+		}, nil},
+		{"minimum blob size", []MotionZone{
+			{Name: "driveway", Coordinates: left, PixelChangeThreshold: 10, MinBlobSize: 100},
+		}, nil},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			reached, changes, rectangle, _, zones := FindMotion(images, test.zones)
+			if changes != 16 {
+				t.Fatalf("changes = %d, want 16", changes)
+			}
+			if reached != (len(test.want) > 0) || !slices.Equal(zones, test.want) {
+				t.Fatalf("reached = %v, zones = %v, want %v", reached, zones, test.want)
+			}
+			if reached && rectangle != (models.MotionRectangle{X: 2, Y: 2, Width: 3, Height: 3}) {
+				t.Fatalf("rectangle = %+v", rectangle)
+			}
+		})
+	}
+}
+
+func TestMotionZoneName(t *testing.T) {
+	if name := motionZoneName(models.Polygon{ID: "0", Name: "driveway"}, 0); name != "driveway" {
+		t.Fatalf("motionZoneName() = %q, want the name", name)
+	}
+	if name := motionZoneName(models.Polygon{ID: "a1"}, 0); name != "a1" {
+		t.Fatalf("motionZoneName() = %q, want the id", name)
+	}
+	if name := motionZoneName(models.Polygon{}, 2); name != "zone-3" {
+		t.Fatalf("motionZoneName() = %q, want zone-3", name)
+	}
+}
+
+func TestBuildMotionZonesSubtractsExclusions(t *testing.T) {
+	square := func(x1, y1, x2, y2 float64) []models.Coordinate {
+		return []models.Coordinate{{X: x1, Y: y1}, {X: x2, Y: y1}, {X: x2, Y: y2}, {X: x1, Y: y2}}
+	}
+	tree := models.Polygon{ID: "1", Exclude: "true", Coordinates: square(0, 0, 10, 10)}
+
+	zones := buildMotionZones([]models.Polygon{
+		{ID: "0", Name: "garden", Coordinates: square(0, 0, 20, 20)},
+		tree,
+		{ID: "2", Enabled: "false", Exclude: "true", Coordinates: square(10, 10, 20, 20)},
+	}, 20, 20, 1, 1, 150)
+	if len(zones) != 1 || zones[0].Name != "garden" {
+		t.Fatalf("zones = %+v, want the garden zone only", zones)
+	}
+	for _, pixel := range zones[0].Coordinates {
+		if x, y := pixel%20, pixel/20; x < 9 && y < 9 {
+			t.Fatalf("pixel (%d,%d) of the excluded area is part of the zone", x, y)
+		}
+	}
+	if !slices.Contains(zones[0].Coordinates, 15*20+15) {
+		t.Fatal("pixel (15,15) is missing from the zone")
+	}
+
+	// Exclusions only: the rest of the frame is detected.
+	zones = buildMotionZones([]models.Polygon{tree}, 20, 20, 1, 1, 150)
+	if len(zones) != 1 || zones[0].Name != "frame" || !slices.Contains(zones[0].Coordinates, 15*20+15) || slices.Contains(zones[0].Coordinates, 5*20+5) {
+		t.Fatalf("zones = %+v, want the frame without the excluded area", zones)
+	}
+}
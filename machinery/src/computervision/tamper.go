@@ -0,0 +1,250 @@
+package computervision
+
+import (
+	"image"
+	"math"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/kerberos-io/agent/machinery/src/capture"
+	"github.com/kerberos-io/agent/machinery/src/conditions"
+	"github.com/kerberos-io/agent/machinery/src/log"
+	"github.com/kerberos-io/agent/machinery/src/models"
+	"github.com/kerberos-io/agent/machinery/src/packets"
+)
+
+const (
+	// A frame is analysed for tampering at most this often.
+	tamperInterval = time.Second
+	// The reference frame is renewed this often while the camera isn't
+	// tampered, so it follows the light during the day.
+	tamperReferenceInterval = 5 * time.Minute
+	// The scene is compared on a thumbnail of this many blocks.
+	tamperThumbnailColumns = 16
+	tamperThumbnailRows    = 9
+	// Below this contrast or sharpness the reference itself is too flat (e.g.
+	// a dark night) to tell a covered or defocused camera.
+	tamperMinContrast  = 5
+	tamperMinSharpness = 1
+)
+
+// tamperFeatures describe a frame: its luminance, contrast (the standard
+// deviation of the luminance), sharpness (the edge energy) and a normalised
+// thumbnail to compare the scene with.
+type tamperFeatures struct {
+	luminance float64
+	contrast  float64
+	sharpness float64
+	thumbnail []float64
+}
+
+func tamperFeaturesOf(img *image.Gray) tamperFeatures {
+	bounds := img.Bounds()
+	cols, rows := bounds.Dx(), bounds.Dy()
+	features := tamperFeatures{thumbnail: make([]float64, tamperThumbnailColumns*tamperThumbnailRows)}
+	if cols < 2 || rows < 2 {
+		return features
+	}
+
+	var sum, squares, edges float64
+	counts := make([]int, len(features.thumbnail))
+	for y := 0; y < rows-1; y++ {
+		row := img.Pix[y*img.Stride : y*img.Stride+cols]
+		next := img.Pix[(y+1)*img.Stride : (y+1)*img.Stride+cols]
+		for x := 0; x < cols-1; x++ {
+			value := float64(row[x])
+			sum += value
+			squares += value * value
+			edges += math.Abs(value-float64(row[x+1])) + math.Abs(value-float64(next[x]))
+			block := y*tamperThumbnailRows/rows*tamperThumbnailColumns + x*tamperThumbnailColumns/cols
+			features.thumbnail[block] += value
+			counts[block]++
+		}
+	}
+	pixels := float64((cols - 1) * (rows - 1))
+	features.luminance = sum / pixels
+	features.contrast = math.Sqrt(max(squares/pixels-features.luminance*features.luminance, 0))
+	features.sharpness = edges / pixels
+
+	// Zero mean and unit length, so the similarity of two thumbnails doesn't
+	// depend on the brightness or contrast.
+	var norm float64
+	for block := range features.thumbnail {
+		if counts[block] > 0 {
+			features.thumbnail[block] /= float64(counts[block])
+		}
+		features.thumbnail[block] -= features.luminance
+		norm += features.thumbnail[block] * features.thumbnail[block]
+	}
+	if norm > 0 {
+		for block := range features.thumbnail {
+			features.thumbnail[block] /= math.Sqrt(norm)
+		}
+	}
+	return features
+}
+
+// similarity is the correlation of the thumbnails, from -1 to 1.
+func (f tamperFeatures) similarity(other tamperFeatures) float64 {
+	var dot float64
+	for block := range f.thumbnail {
+		dot += f.thumbnail[block] * other.thumbnail[block]
+	}
+	return dot
+}
+
+// TamperAnalyser compares frames with a reference frame, and tells when the
+// camera is covered (the contrast is gone), defocused (the sharpness is gone)
+// or moved (the scene changed). The camera is tampered once this holds for
+// the hold time, and restored once it doesn't for the hold time.
+type TamperAnalyser struct {
+	Tampered bool
+	Reason   string
+
+	sensitivity   float64 // From 0 to 1.
+	holdTime      time.Duration
+	reference     *tamperFeatures
+	referenceTime time.Time
+	changeSince   time.Time // Since when the state differs from Tampered.
+}
+
+// NewTamperAnalyser returns a tamper analyser with the sensitivity and hold
+// time of the settings, 50 and 10 seconds by default.
+func NewTamperAnalyser(settings *models.Tamper) *TamperAnalyser {
+	sensitivity := 50
+	holdTime := 10
+	if settings != nil && settings.Sensitivity > 0 {
+		sensitivity = min(settings.Sensitivity, 100)
+	}
+	if settings != nil && settings.HoldTime > 0 {
+		holdTime = settings.HoldTime
+	}
+	return &TamperAnalyser{
+		sensitivity: float64(sensitivity) / 100,
+		holdTime:    time.Duration(holdTime) * time.Second,
+	}
+}
+
+// suspect returns why the frame looks tampered, or "".
+func (a *TamperAnalyser) suspect(features tamperFeatures) string {
+	reference := a.reference
+	if reference.contrast >= tamperMinContrast && features.contrast < reference.contrast*(0.15+0.35*a.sensitivity) {
+		return "covered"
+	}
+	if reference.sharpness >= tamperMinSharpness && features.sharpness < reference.sharpness*(0.2+0.4*a.sensitivity) {
+		return "defocused"
+	}
+	if reference.contrast >= tamperMinContrast && features.similarity(*reference) < 0.3+0.6*a.sensitivity {
+		return "moved"
+	}
+	return ""
+}
+
+// Analyse compares the frame with the reference. It returns true when the
+// camera became tampered (see Reason) or was restored.
+func (a *TamperAnalyser) Analyse(img *image.Gray, now time.Time) bool {
+	features := tamperFeaturesOf(img)
+	if a.reference == nil {
+		a.reference = &features
+		a.referenceTime = now
+		return false
+	}
+
+	reason := a.suspect(features)
+	if (reason != "") == a.Tampered {
+		a.changeSince = time.Time{}
+		if !a.Tampered && now.Sub(a.referenceTime) >= tamperReferenceInterval {
+			a.reference = &features
+			a.referenceTime = now
+		}
+		return false
+	}
+	if a.changeSince.IsZero() {
+		a.changeSince = now
+	}
+	if now.Sub(a.changeSince) < a.holdTime {
+		return false
+	}
+
+	a.changeSince = time.Time{}
+	a.Tampered = reason != ""
+	a.Reason = reason
+	if !a.Tampered {
+		// The camera might be put back slightly differently.
+		a.reference = &features
+		a.referenceTime = now
+	}
+	return true
+}
+
+// ProcessTamper analyses the keyframes for tampering, alongside the motion
+// detection, and raises an event through MQTT and the outputs when the camera
+// becomes tampered or is restored.
+func ProcessTamper(tamperCursor *packets.QueueCursor, configuration *models.Configuration, communication *models.Communication, mqttClient mqtt.Client, rtspClient capture.RTSPClient) {
+	config := configuration.Config
+	if config.Tamper == nil || config.Tamper.Enabled != "true" {
+		return
+	}
+	log.Log.Info("computervision.tamper.ProcessTamper(): tamper detection is enabled, so starting the tamper detection.")
+
+	analyser := NewTamperAnalyser(config.Tamper)
+	var lastAnalysed time.Time
+	for {
+		pkt, err := tamperCursor.ReadPacket()
+		if err != nil {
+			break
+		}
+		if !pkt.IsKeyFrame || time.Since(lastAnalysed) < tamperInterval {
+			continue
+		}
+		img, err := rtspClient.DecodePacketRaw(pkt)
+		if err != nil {
+			continue
+		}
+		lastAnalysed = time.Now()
+		if !analyser.Analyse(&img, lastAnalysed) {
+			continue
+		}
+
+		event := models.OutputEventTamperCleared
+		state := "restored"
+		if analyser.Tampered {
+			event = models.OutputEventTamperDetected
+			state = "tampered"
+			log.Log.Warning("computervision.tamper.ProcessTamper(): the camera is tampered: " + analyser.Reason + ".")
+		} else {
+			log.Log.Info("computervision.tamper.ProcessTamper(): the camera is restored.")
+		}
+
+		if config.Offline != "true" && mqttClient != nil {
+			if config.HubKey != "" {
+				message := models.Message{
+					Payload: models.Payload{
+						Action:   "tamper",
+						DeviceId: config.Key,
+						Value: map[string]interface{}{
+							"timestamp": lastAnalysed.Unix(),
+							"state":     state,
+							"reason":    analyser.Reason,
+						},
+					},
+				}
+				payload, err := models.PackageMQTTMessage(configuration, message)
+				if err == nil {
+					mqttClient.Publish("kerberos/hub/"+config.HubKey, 2, false, payload)
+				} else {
+					log.Log.Info("computervision.tamper.ProcessTamper(): failed to package MQTT message: " + err.Error())
+				}
+			} else {
+				mqttClient.Publish("kerberos/agent/"+config.Key, 2, false, "tamper")
+			}
+		}
+
+		if message, ok := models.NewOutputMessage(configuration, conditions.PolicyOutputs(), event, ""); ok {
+			message.Reason = analyser.Reason
+			models.QueueOutputMessage(communication, message)
+		}
+	}
+
+	log.Log.Debug("computervision.tamper.ProcessTamper(): stop the tamper detection.")
+}
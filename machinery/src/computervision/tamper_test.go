@@ -0,0 +1,79 @@
+package computervision
+
+import (
+	"image"
+	"testing"
+	"time"
+
+	"github.com/kerberos-io/agent/machinery/src/models"
+)
+
+func tamperScene(value func(x int, y int) int) *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, 64, 36))
+	for y := 0; y < 36; y++ {
+		for x := 0; x < 64; x++ {
+			img.Pix[y*img.Stride+x] = uint8(min(max(value(x, y), 0), 255))
+		}
+	}
+	return img
+}
+
+func TestTamperAnalyser(t *testing.T) {
+	// A scene with a bright left half and a checkered right half.
+	scene := func(x int, y int) int {
+		if x < 32 {
+			return 200
+		}
+		return 40 + 120*((x/2+y/2)%2)
+	}
+	// The scene out of focus: the checkers blur into gray.
+	blurred := func(x int, y int) int {
+		if x < 32 {
+			return 200
+		}
+		return 100
+	}
+	// The camera turned: the bright half is now at the bottom.
+	turned := func(x int, y int) int {
+		if y >= 18 {
+			return 200
+		}
+		return 40 + 120*((x/2+y/2)%2)
+	}
+	covered := func(x int, y int) int { return 20 }
+
+	for _, test := range []struct {
+		name  string
+		frame func(x int, y int) int
+	}{
+		{"covered", covered},
+		{"defocused", blurred},
+		{"moved", turned},
+	} {
+		analyser := NewTamperAnalyser(&models.Tamper{HoldTime: 5})
+		now := time.Now()
+		if analyser.Analyse(tamperScene(scene), now) || analyser.Analyse(tamperScene(scene), now.Add(time.Second)) {
+			t.Fatalf("%s: the reference scene looks tampered", test.name)
+		}
+
+		// Brightness changes of the whole scene aren't tampering.
+		brighter := func(x int, y int) int { return scene(x, y) + 30 }
+		if analyser.Analyse(tamperScene(brighter), now.Add(2*time.Second)) || analyser.Tampered {
+			t.Fatalf("%s: a brighter scene looks tampered", test.name)
+		}
+
+		if analyser.Analyse(tamperScene(test.frame), now.Add(3*time.Second)) {
+			t.Fatalf("%s: tampered before the hold time", test.name)
+		}
+		if !analyser.Analyse(tamperScene(test.frame), now.Add(8*time.Second)) || !analyser.Tampered || analyser.Reason != test.name {
+			t.Fatalf("%s: tampered %v, reason %q", test.name, analyser.Tampered, analyser.Reason)
+		}
+
+		if analyser.Analyse(tamperScene(scene), now.Add(9*time.Second)) {
+			t.Fatalf("%s: restored before the hold time", test.name)
+		}
+		if !analyser.Analyse(tamperScene(scene), now.Add(14*time.Second)) || analyser.Tampered {
+			t.Fatalf("%s: not restored", test.name)
+		}
+	}
+}
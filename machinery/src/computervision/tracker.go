@@ -0,0 +1,112 @@
+package computervision
+
+import (
+	"image"
+	"slices"
+	"time"
+
+	"github.com/kerberos-io/agent/machinery/src/models"
+)
+
+// A track which isn't matched for this long is dropped.
+const trackMaxAge = 3 * time.Second
+
+// Track is a motion blob followed across the analysed frames.
+type Track struct {
+	ID        int
+	Rectangle models.MotionRectangle
+	Centroid  image.Point
+	Previous  image.Point // The centroid in the previous frame it was matched in.
+	FirstSeen time.Time
+	LastSeen  time.Time
+	// Since when the track is in a loitering zone, and if it was reported, per
+	// loitering zone.
+	entered  map[int]time.Time
+	reported map[int]bool
+	// When the track crossed a tripwire last, per tripwire.
+	crossed map[int]time.Time
+}
+
+// CentroidTracker assigns IDs to the motion blobs of consecutive frames: a
+// blob is the track with the nearest centroid, within MaxDistance pixels.
+type CentroidTracker struct {
+	MaxDistance int
+	tracks      []*Track
+	nextID      int
+}
+
+// NewCentroidTracker returns a tracker which matches blobs which moved at most
+// maxDistance pixels between two analysed frames.
+func NewCentroidTracker(maxDistance int) *CentroidTracker {
+	return &CentroidTracker{MaxDistance: maxDistance, nextID: 1}
+}
+
+func centroidOf(rectangle models.MotionRectangle) image.Point {
+	return image.Point{X: rectangle.X + rectangle.Width/2, Y: rectangle.Y + rectangle.Height/2}
+}
+
+// Update matches the blobs of a frame with the tracks, the closest pairs
+// first, and returns the tracks which were matched or started.
+func (t *CentroidTracker) Update(rectangles []models.MotionRectangle, now time.Time) []*Track {
+	type pair struct {
+		track     *Track
+		blob      int
+		distance2 int
+	}
+	var pairs []pair
+	for _, track := range t.tracks {
+		for blob, rectangle := range rectangles {
+			d := centroidOf(rectangle).Sub(track.Centroid)
+			if distance2 := d.X*d.X + d.Y*d.Y; distance2 <= t.MaxDistance*t.MaxDistance {
+				pairs = append(pairs, pair{track, blob, distance2})
+			}
+		}
+	}
+	slices.SortStableFunc(pairs, func(a, b pair) int { return a.distance2 - b.distance2 })
+
+	var updated []*Track
+	matched := make([]bool, len(rectangles))
+	matchedTracks := map[*Track]bool{}
+	for _, p := range pairs {
+		if matched[p.blob] || matchedTracks[p.track] {
+			continue
+		}
+		matched[p.blob] = true
+		matchedTracks[p.track] = true
+		p.track.Previous = p.track.Centroid
+		p.track.Centroid = centroidOf(rectangles[p.blob])
+		p.track.Rectangle = rectangles[p.blob]
+		p.track.LastSeen = now
+		updated = append(updated, p.track)
+	}
+	for blob, rectangle := range rectangles {
+		if matched[blob] {
+			continue
+		}
+		centroid := centroidOf(rectangle)
+		track := &Track{
+			ID:        t.nextID,
+			Rectangle: rectangle,
+			Centroid:  centroid,
+			Previous:  centroid,
+			FirstSeen: now,
+			LastSeen:  now,
+			entered:   map[int]time.Time{},
+			reported:  map[int]bool{},
+			crossed:   map[int]time.Time{},
+		}
+		t.nextID++
+		t.tracks = append(t.tracks, track)
+		updated = append(updated, track)
+	}
+
+	t.tracks = slices.DeleteFunc(t.tracks, func(track *Track) bool {
+		return now.Sub(track.LastSeen) > trackMaxAge
+	})
+	return updated
+}
+
+// Tracks returns the tracks which are followed.
+func (t *CentroidTracker) Tracks() []*Track {
+	return t.tracks
+}
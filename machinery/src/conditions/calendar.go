@@ -0,0 +1,451 @@
+package conditions
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kerberos-io/agent/machinery/src/models"
+)
+
+var (
+	calendarsMutex  sync.Mutex
+	configDirectory = "."
+	calendars       = map[string]*Calendar{} // Per path, reloaded when the file changes.
+)
+
+// UseConfigDirectory sets the directory the timetable calendar is read from,
+// see models.Config.TimetableCalendar.
+func UseConfigDirectory(directory string) {
+	calendarsMutex.Lock()
+	defer calendarsMutex.Unlock()
+	configDirectory = directory
+}
+
+func configDirectoryPath() string {
+	calendarsMutex.Lock()
+	defer calendarsMutex.Unlock()
+	return configDirectory
+}
+
+// Calendar is an iCalendar (.ics) file, its events are the windows of the
+// days they occur on. Events repeat with a daily, weekly, monthly or yearly
+// RRULE (INTERVAL, COUNT, UNTIL and BYDAY), EXDATE skips occurrences and
+// cancelled events are ignored.
+type Calendar struct {
+	events  []calendarEvent
+	modTime time.Time
+
+	mutex   sync.Mutex
+	windows map[string][]models.TimeWindow // Per day, as computed by Windows.
+}
+
+type calendarEvent struct {
+	start    time.Time      // The wall clock of DTSTART, in UTC.
+	location *time.Location // nil for floating times, in the timezone of the agent.
+	allDay   bool
+	days     int // The length of an all-day event.
+	duration time.Duration
+
+	frequency     string
+	interval      int
+	count         int
+	until         time.Time
+	untilFloating bool // until is a wall clock, in the location of the event.
+	weekdays      []time.Weekday
+	excluded      map[string]bool // The dates (2006-01-02) of EXDATE.
+}
+
+// LoadCalendar reads the calendar at path, it is only parsed again when the
+// file changed.
+func LoadCalendar(path string) (*Calendar, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	calendarsMutex.Lock()
+	calendar, ok := calendars[path]
+	calendarsMutex.Unlock()
+	if ok && calendar.modTime.Equal(info.ModTime()) {
+		return calendar, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	calendar, err = ParseCalendar(file)
+	if err != nil {
+		return nil, errors.New(path + ": " + err.Error())
+	}
+	calendar.modTime = info.ModTime()
+	calendarsMutex.Lock()
+	calendars[path] = calendar
+	calendarsMutex.Unlock()
+	return calendar, nil
+}
+
+// ParseCalendar parses the events of an iCalendar.
+func ParseCalendar(reader io.Reader) (*Calendar, error) {
+	// Unfold the lines: a line starting with a space or tab continues the
+	// previous one.
+	var lines []string
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if len(lines) > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			lines[len(lines)-1] += line[1:]
+		} else if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	calendar := &Calendar{windows: map[string][]models.TimeWindow{}}
+	var properties map[string][]calendarProperty
+	for _, line := range lines {
+		switch {
+		case line == "BEGIN:VEVENT":
+			properties = map[string][]calendarProperty{}
+		case line == "END:VEVENT":
+			if properties != nil {
+				if event, ok := parseCalendarEvent(properties); ok {
+					calendar.events = append(calendar.events, event)
+				}
+			}
+			properties = nil
+		case properties != nil:
+			property := parseCalendarProperty(line)
+			properties[property.name] = append(properties[property.name], property)
+		}
+	}
+	if len(calendar.events) == 0 {
+		return nil, errors.New("no events in calendar")
+	}
+	return calendar, nil
+}
+
+type calendarProperty struct {
+	name   string
+	params map[string]string
+	value  string
+}
+
+// parseCalendarProperty splits NAME;PARAM=VALUE:VALUE, the colon separating
+// the value can't be within quotes.
+func parseCalendarProperty(line string) calendarProperty {
+	quoted := false
+	colon := len(line)
+	for i, c := range line {
+		if c == '"' {
+			quoted = !quoted
+		} else if c == ':' && !quoted {
+			colon = i
+			break
+		}
+	}
+	property := calendarProperty{params: map[string]string{}}
+	if colon < len(line) {
+		property.value = line[colon+1:]
+	}
+	parts := strings.Split(line[:colon], ";")
+	property.name = strings.ToUpper(parts[0])
+	for _, param := range parts[1:] {
+		if key, value, ok := strings.Cut(param, "="); ok {
+			property.params[strings.ToUpper(key)] = strings.Trim(value, "\"")
+		}
+	}
+	return property
+}
+
+func parseCalendarEvent(properties map[string][]calendarProperty) (event calendarEvent, ok bool) {
+	if status := properties["STATUS"]; len(status) > 0 && strings.EqualFold(status[0].value, "CANCELLED") {
+		return event, false
+	}
+	dtstart := properties["DTSTART"]
+	if len(dtstart) == 0 {
+		return event, false
+	}
+	start, location, allDay, err := parseCalendarTime(dtstart[0])
+	if err != nil {
+		return event, false
+	}
+	event.start, event.location, event.allDay = start, location, allDay
+	event.interval = 1
+
+	if dtend := properties["DTEND"]; len(dtend) > 0 {
+		end, endLocation, _, err := parseCalendarTime(dtend[0])
+		if err != nil {
+			return event, false
+		}
+		if allDay {
+			event.days = int(end.Sub(start).Hours()/24 + 0.5)
+		} else {
+			event.duration = absoluteTime(end, endLocation).Sub(absoluteTime(start, location))
+		}
+	} else if duration := properties["DURATION"]; len(duration) > 0 {
+		d, err := parseCalendarDuration(duration[0].value)
+		if err != nil {
+			return event, false
+		}
+		if allDay {
+			event.days = int(d.Hours() / 24)
+		} else {
+			event.duration = d
+		}
+	} else if allDay {
+		event.days = 1
+	}
+
+	if rrule := properties["RRULE"]; len(rrule) > 0 {
+		for _, part := range strings.Split(rrule[0].value, ";") {
+			key, value, _ := strings.Cut(part, "=")
+			switch strings.ToUpper(key) {
+			case "FREQ":
+				event.frequency = strings.ToUpper(value)
+			case "INTERVAL":
+				if interval, err := strconv.Atoi(value); err == nil && interval > 0 {
+					event.interval = interval
+				}
+			case "COUNT":
+				if count, err := strconv.Atoi(value); err == nil {
+					event.count = count
+				}
+			case "UNTIL":
+				until, untilLocation, untilAllDay, err := parseCalendarTime(calendarProperty{value: value})
+				if err == nil {
+					if untilAllDay {
+						until = until.AddDate(0, 0, 1).Add(-time.Second)
+					}
+					event.until = absoluteTime(until, untilLocation)
+					event.untilFloating = untilLocation == nil
+				}
+			case "BYDAY":
+				for _, day := range strings.Split(value, ",") {
+					if weekday, ok := calendarWeekdays[strings.ToUpper(day[max(len(day)-2, 0):])]; ok {
+						event.weekdays = append(event.weekdays, weekday)
+					}
+				}
+			}
+		}
+	}
+
+	event.excluded = map[string]bool{}
+	for _, exdate := range properties["EXDATE"] {
+		for _, value := range strings.Split(exdate.value, ",") {
+			excluded, excludedLocation, _, err := parseCalendarTime(calendarProperty{params: exdate.params, value: value})
+			if err != nil {
+				continue
+			}
+			// Compare the date in the timezone of the event.
+			if excludedLocation != nil && location != nil {
+				excluded = absoluteTime(excluded, excludedLocation).In(location)
+			}
+			event.excluded[excluded.Format("2006-01-02")] = true
+		}
+	}
+	return event, true
+}
+
+var calendarWeekdays = map[string]time.Weekday{
+	"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday,
+	"TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday,
+}
+
+// parseCalendarTime parses a DATE or DATE-TIME value. The wall clock is
+// returned in UTC, with the location it is in: UTC with a Z suffix, the TZID
+// or nil for floating times.
+func parseCalendarTime(property calendarProperty) (clock time.Time, location *time.Location, allDay bool, err error) {
+	value := property.value
+	if len(value) == 8 {
+		clock, err = time.Parse("20060102", value)
+		return clock, nil, true, err
+	}
+	if strings.HasSuffix(value, "Z") {
+		clock, err = time.Parse("20060102T150405", strings.TrimSuffix(value, "Z"))
+		return clock, time.UTC, false, err
+	}
+	clock, err = time.Parse("20060102T150405", value)
+	if tzid := property.params["TZID"]; tzid != "" && err == nil {
+		if location, err := time.LoadLocation(tzid); err == nil {
+			return clock, location, false, nil
+		}
+	}
+	return clock, nil, false, err
+}
+
+// parseCalendarDuration parses a duration as P1W, P1D or PT8H30M.
+func parseCalendarDuration(value string) (time.Duration, error) {
+	value = strings.TrimPrefix(value, "+")
+	if !strings.HasPrefix(value, "P") {
+		return 0, errors.New("invalid duration " + value)
+	}
+	var duration time.Duration
+	number := ""
+	for _, c := range value[1:] {
+		if c >= '0' && c <= '9' {
+			number += string(c)
+			continue
+		}
+		if c == 'T' {
+			continue
+		}
+		n, err := strconv.Atoi(number)
+		if err != nil {
+			return 0, errors.New("invalid duration " + value)
+		}
+		number = ""
+		switch c {
+		case 'W':
+			duration += time.Duration(n) * 7 * 24 * time.Hour
+		case 'D':
+			duration += time.Duration(n) * 24 * time.Hour
+		case 'H':
+			duration += time.Duration(n) * time.Hour
+		case 'M':
+			duration += time.Duration(n) * time.Minute
+		case 'S':
+			duration += time.Duration(n) * time.Second
+		default:
+			return 0, errors.New("invalid duration " + value)
+		}
+	}
+	return duration, nil
+}
+
+// absoluteTime places a wall clock in its location, floating times in UTC.
+func absoluteTime(clock time.Time, location *time.Location) time.Time {
+	if location == nil {
+		location = time.UTC
+	}
+	return time.Date(clock.Year(), clock.Month(), clock.Day(), clock.Hour(), clock.Minute(), clock.Second(), 0, location)
+}
+
+// Windows returns the windows of the day of date (in its location), in which
+// an event of the calendar takes place.
+func (calendar *Calendar) Windows(date time.Time) []models.TimeWindow {
+	location := date.Location()
+	dayStart := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, location)
+	dayEnd := dayStart.AddDate(0, 0, 1)
+	key := dayStart.Format(time.RFC3339) + " " + location.String()
+
+	calendar.mutex.Lock()
+	defer calendar.mutex.Unlock()
+	if windows, ok := calendar.windows[key]; ok {
+		return windows
+	}
+
+	windows := []models.TimeWindow{}
+	for _, event := range calendar.events {
+		eventLocation := event.location
+		if eventLocation == nil {
+			eventLocation = location
+		}
+		event.occurrences(eventLocation, dayEnd, func(start time.Time, end time.Time) {
+			if !end.After(dayStart) {
+				return
+			}
+			window := models.TimeWindow{End: 24 * 60 * 60}
+			if start.After(dayStart) {
+				start = start.In(location)
+				window.Start = start.Hour()*60*60 + start.Minute()*60 + start.Second()
+			}
+			if end.Before(dayEnd) {
+				end = end.In(location)
+				window.End = end.Hour()*60*60 + end.Minute()*60 + end.Second()
+			}
+			if window.End > window.Start {
+				windows = append(windows, window)
+			}
+		})
+	}
+
+	// Keep the windows of a few days, the agent asks for today and yesterday.
+	if len(calendar.windows) > 32 {
+		calendar.windows = map[string][]models.TimeWindow{}
+	}
+	calendar.windows[key] = windows
+	return windows
+}
+
+// occurrences calls found for every occurrence of the event which starts
+// before the end.
+func (event calendarEvent) occurrences(location *time.Location, before time.Time, found func(start time.Time, end time.Time)) {
+	first := time.Date(event.start.Year(), event.start.Month(), event.start.Day(), 0, 0, 0, 0, time.UTC)
+	weekdays := event.weekdays
+	if len(weekdays) == 0 && event.frequency == "WEEKLY" {
+		weekdays = []time.Weekday{first.Weekday()}
+	}
+	firstWeek := first.AddDate(0, 0, -((int(first.Weekday()) + 6) % 7)) // Weeks start on Monday.
+
+	n := 0
+	for day := first; ; day = day.AddDate(0, 0, 1) {
+		start := time.Date(day.Year(), day.Month(), day.Day(), event.start.Hour(), event.start.Minute(), event.start.Second(), 0, location)
+		if !start.Before(before) {
+			return
+		}
+		if !event.until.IsZero() {
+			until := event.until
+			if event.untilFloating {
+				until = absoluteTime(until, location)
+			}
+			if start.After(until) {
+				return
+			}
+		}
+
+		days := int(day.Sub(first).Hours() / 24)
+		months := (day.Year()-first.Year())*12 + int(day.Month()-first.Month())
+		matches := false
+		switch event.frequency {
+		case "DAILY":
+			matches = days%event.interval == 0
+		case "WEEKLY":
+			matches = (int(day.Sub(firstWeek).Hours()/24)/7)%event.interval == 0
+		case "MONTHLY":
+			matches = day.Day() == first.Day() && months%event.interval == 0
+		case "YEARLY":
+			matches = day.Day() == first.Day() && day.Month() == first.Month() && (day.Year()-first.Year())%event.interval == 0
+		default:
+			matches = days == 0
+		}
+		if matches && len(weekdays) > 0 {
+			matches = false
+			for _, weekday := range weekdays {
+				if day.Weekday() == weekday {
+					matches = true
+				}
+			}
+		}
+		if !matches {
+			if event.frequency == "" {
+				return
+			}
+			continue
+		}
+
+		n++
+		if event.count > 0 && n > event.count {
+			return
+		}
+		if event.excluded[day.Format("2006-01-02")] {
+			continue
+		}
+		end := start.Add(event.duration)
+		if event.allDay {
+			end = start.AddDate(0, 0, event.days)
+		}
+		found(start, end)
+		if event.frequency == "" {
+			return
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package conditions
+
+import (
+	"os"
+	"strings"
+
+	"github.com/kerberos-io/agent/machinery/src/models"
+)
+
+// isFileFlagValid tells if the file of the condition exists, and contains its
+// value when set.
+func isFileFlagValid(condition *models.Condition) (bool, string) {
+	if condition.Path == "" {
+		return false, "no file set"
+	}
+	content, err := os.ReadFile(condition.Path)
+	if err != nil {
+		return false, "file " + condition.Path + " not found"
+	}
+	if condition.Value != "" && strings.TrimSpace(string(content)) != condition.Value {
+		return false, "file " + condition.Path + " is not " + condition.Value
+	}
+	return true, "file " + condition.Path + " found"
+}
+
+// isEnvFlagValid tells if the environment variable of the condition has its
+// value, "true" by default.
+func isEnvFlagValid(condition *models.Condition) (bool, string) {
+	value := condition.Value
+	if value == "" {
+		value = "true"
+	}
+	if condition.Name == "" {
+		return false, "no environment variable set"
+	}
+	if os.Getenv(condition.Name) != value {
+		return false, condition.Name + " is not " + value
+	}
+	return true, condition.Name + " is " + value
+}
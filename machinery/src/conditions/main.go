@@ -2,27 +2,140 @@ package conditions
 
 import (
 	"errors"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/kerberos-io/agent/machinery/src/log"
 	"github.com/kerberos-io/agent/machinery/src/models"
 )
 
+// The chain when no conditions are configured: the time window and the
+// condition URI.
+var defaultConditions = []*models.Condition{{Type: "timewindow"}, {Type: "uri"}}
+
+var (
+	lastDecisionMutex sync.Mutex
+	lastDecision      models.ConditionDecision
+)
+
+// Validate evaluates the conditions, see models.Conditions. When they aren't
+// valid the error tells why.
 func Validate(loc *time.Location, configuration *models.Configuration) (valid bool, err error) {
-	valid = true
-	err = nil
+	decision := Evaluate(loc, configuration)
+	if !decision.Valid {
+		err = errors.New(decision.Reason)
+	}
+	return decision.Valid, err
+}
 
-	withinTimeInterval := IsWithinTimeInterval(loc, configuration)
-	if !withinTimeInterval {
-		valid = false
-		err = errors.New("time interval not valid")
-		return
+// Evaluate evaluates the conditions, and keeps the decision for the
+// dashboard, see LastDecision.
+func Evaluate(loc *time.Location, configuration *models.Configuration) models.ConditionDecision {
+	list := defaultConditions
+	operator := "and"
+	if conditions := configuration.Config.Conditions; conditions != nil && len(conditions.List) > 0 {
+		list = conditions.List
+		if strings.EqualFold(conditions.Operator, "or") {
+			operator = "or"
+		}
 	}
-	validUriResponse := IsValidUriResponse(configuration)
-	if !validUriResponse {
-		valid = false
-		err = errors.New("uri response not valid")
-		return
+
+	decision := models.ConditionDecision{
+		Valid:     operator == "and",
+		Operator:  operator,
+		Timestamp: time.Now().Unix(),
 	}
+	var reasons []string
+	uriEvaluated := false
+	for _, condition := range list {
+		if condition == nil {
+			continue
+		}
+		valid, reason := evaluate(condition, loc, configuration)
+		uriEvaluated = uriEvaluated || condition.Type == "uri"
+		if condition.Negate == "true" {
+			valid = !valid
+			reason = "not (" + reason + ")"
+		}
+		decision.Conditions = append(decision.Conditions, models.ConditionResult{Type: condition.Type, Valid: valid, Reason: reason})
 
-	return
+		// The reason is the first condition deciding: an invalid one with
+		// "and", a valid one with "or".
+		if operator == "and" && !valid {
+			decision.Valid = false
+			decision.Reason = reason
+			break
+		}
+		if operator == "or" && valid {
+			decision.Valid = true
+			decision.Reason = reason
+			break
+		}
+		reasons = append(reasons, reason)
+	}
+	if decision.Reason == "" {
+		if decision.Valid {
+			decision.Reason = "all conditions valid"
+		} else {
+			decision.Reason = strings.Join(reasons, ", ")
+		}
+	}
+
+	// The ConditionURI can steer the post-recording and the outputs, when it
+	// was asked in this evaluation: the chain might have been decided before.
+	if response, ok := uriResponse(configuration); ok && uriEvaluated {
+		decision.PostRecording = response.PostRecording
+		decision.Outputs = response.Outputs
+	}
+
+	lastDecisionMutex.Lock()
+	if decision.Valid != lastDecision.Valid || decision.Reason != lastDecision.Reason {
+		if decision.Valid {
+			log.Log.Info("conditions.main.Evaluate(): conditions valid (" + decision.Reason + "), enabling detection and recording.")
+		} else {
+			log.Log.Info("conditions.main.Evaluate(): conditions not valid (" + decision.Reason + "), disabling detection and recording.")
+		}
+	}
+	lastDecision = decision
+	lastDecisionMutex.Unlock()
+	return decision
+}
+
+// LastDecision returns the decision of the last evaluation of the conditions.
+func LastDecision() models.ConditionDecision {
+	lastDecisionMutex.Lock()
+	defer lastDecisionMutex.Unlock()
+	return lastDecision
+}
+
+// PolicyOutputs returns the output rules which are fired on top of
+// Config.Outputs, as decided by the ConditionURI in the last evaluation (see
+// models.ConditionResponse).
+func PolicyOutputs() []*models.OutputRule {
+	return LastDecision().Outputs
+}
+
+// evaluate returns if the condition is valid, and why.
+func evaluate(condition *models.Condition, loc *time.Location, configuration *models.Configuration) (bool, string) {
+	switch condition.Type {
+	case "timewindow":
+		if IsWithinTimeInterval(loc, configuration) {
+			return true, "time interval valid"
+		}
+		return false, "time interval not valid"
+	case "uri":
+		return isURIValid(configuration)
+	case "mqtt":
+		return isMQTTStateValid(condition)
+	case "sun":
+		return isSunValid(condition, time.Now().In(loc))
+	case "onvif_input":
+		return isOnvifInputValid(condition, configuration)
+	case "file":
+		return isFileFlagValid(condition)
+	case "env":
+		return isEnvFlagValid(condition)
+	}
+	return false, "unknown condition " + condition.Type
 }
@@ -0,0 +1,161 @@
+package conditions
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/kerberos-io/agent/machinery/src/models"
+)
+
+func conditionsConfiguration(operator string, list ...*models.Condition) *models.Configuration {
+	configuration := &models.Configuration{}
+	configuration.Config.Conditions = &models.Conditions{Operator: operator, List: list}
+	return configuration
+}
+
+func TestEvaluate(t *testing.T) {
+	t.Setenv("AGENT_TEST_ARMED", "true")
+	flag := filepath.Join(t.TempDir(), "armed")
+	if err := os.WriteFile(flag, []byte("yes\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	env := &models.Condition{Type: "env", Name: "AGENT_TEST_ARMED"}
+	file := &models.Condition{Type: "file", Path: flag, Value: "yes"}
+	missing := &models.Condition{Type: "file", Path: flag + ".missing"}
+
+	decision := Evaluate(time.UTC, conditionsConfiguration("and", env, file))
+	if !decision.Valid || len(decision.Conditions) != 2 {
+		t.Errorf("expected both conditions to be valid, got %+v", decision)
+	}
+
+	decision = Evaluate(time.UTC, conditionsConfiguration("and", env, missing, file))
+	if decision.Valid || decision.Reason != "file "+flag+".missing not found" {
+		t.Errorf("expected the missing file to decide, got %+v", decision)
+	}
+	if len(decision.Conditions) != 2 {
+		t.Errorf("expected the chain to stop at the missing file, got %d results", len(decision.Conditions))
+	}
+	if last := LastDecision(); last.Reason != decision.Reason {
+		t.Errorf("expected the last decision to be kept, got %+v", last)
+	}
+
+	decision = Evaluate(time.UTC, conditionsConfiguration("or", missing, env))
+	if !decision.Valid || decision.Reason != "AGENT_TEST_ARMED is true" {
+		t.Errorf("expected the env flag to decide, got %+v", decision)
+	}
+
+	negated := &models.Condition{Type: "file", Path: flag + ".missing", Negate: "true"}
+	decision = Evaluate(time.UTC, conditionsConfiguration("and", negated))
+	if !decision.Valid {
+		t.Errorf("expected the negated missing file to be valid, got %+v", decision)
+	}
+}
+
+func TestMQTTState(t *testing.T) {
+	condition := &models.Condition{Type: "mqtt", Topic: "test/alarm"}
+	if valid, _ := isMQTTStateValid(condition); valid {
+		t.Errorf("expected no state to be invalid")
+	}
+	SetMQTTState("test/alarm", "Armed\n")
+	if valid, reason := isMQTTStateValid(condition); !valid {
+		t.Errorf("expected armed to be valid, got %s", reason)
+	}
+	SetMQTTState("test/alarm", "disarmed")
+	if valid, _ := isMQTTStateValid(condition); valid {
+		t.Errorf("expected disarmed to be invalid")
+	}
+}
+
+// subscribeToken is the token of a finished subscription.
+type subscribeToken struct{ err error }
+
+func (s subscribeToken) Wait() bool                     { return true }
+func (s subscribeToken) WaitTimeout(time.Duration) bool { return true }
+func (s subscribeToken) Done() <-chan struct{} {
+	done := make(chan struct{})
+	close(done)
+	return done
+}
+func (s subscribeToken) Error() error { return s.err }
+
+// retainedClient delivers a retained message while subscribing, like a broker
+// does, or fails the subscription.
+type retainedClient struct {
+	mqtt.Client
+	retained      string
+	err           error
+	subscriptions int
+}
+
+type retainedMessage struct {
+	mqtt.Message
+	payload string
+}
+
+func (m retainedMessage) Payload() []byte { return []byte(m.payload) }
+
+func (c *retainedClient) Subscribe(topic string, qos byte, callback mqtt.MessageHandler) mqtt.Token {
+	c.subscriptions++
+	if c.err == nil {
+		callback(c, retainedMessage{payload: c.retained})
+	}
+	return subscribeToken{err: c.err}
+}
+
+func TestMQTTStateSubscribes(t *testing.T) {
+	defer UseMQTTClient(nil)
+	condition := &models.Condition{Type: "mqtt", Topic: "test/subscribe"}
+
+	failing := &retainedClient{err: errors.New("not authorized")}
+	UseMQTTClient(failing)
+	isMQTTStateValid(condition)
+	isMQTTStateValid(condition)
+	if failing.subscriptions != 2 {
+		t.Errorf("expected a failed subscription to be retried, got %d subscriptions", failing.subscriptions)
+	}
+
+	client := &retainedClient{retained: "armed"}
+	UseMQTTClient(client)
+	done := make(chan bool, 1)
+	go func() {
+		valid, _ := isMQTTStateValid(condition)
+		done <- valid
+	}()
+	select {
+	case valid := <-done:
+		if !valid {
+			t.Errorf("expected the retained message to be valid")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("isMQTTStateValid() deadlocked on the retained message")
+	}
+	isMQTTStateValid(condition)
+	if client.subscriptions != 1 {
+		t.Errorf("expected a single subscription, got %d", client.subscriptions)
+	}
+}
+
+func TestSunTimes(t *testing.T) {
+	// Amsterdam, on the longest day of 2024.
+	sunrise, sunset, _, ok := sunTimes(time.Date(2024, 6, 21, 10, 0, 0, 0, time.UTC), 52.37, 4.90)
+	if !ok {
+		t.Fatal("expected a sunrise and sunset")
+	}
+	expectedSunrise := time.Date(2024, 6, 21, 3, 18, 0, 0, time.UTC)
+	expectedSunset := time.Date(2024, 6, 21, 20, 7, 0, 0, time.UTC)
+	if sunrise.Sub(expectedSunrise).Abs() > 5*time.Minute {
+		t.Errorf("expected sunrise near %s, got %s", expectedSunrise, sunrise.UTC())
+	}
+	if sunset.Sub(expectedSunset).Abs() > 5*time.Minute {
+		t.Errorf("expected sunset near %s, got %s", expectedSunset, sunset.UTC())
+	}
+
+	// Tromsø has no sunset in June.
+	if _, _, polarDay, ok := sunTimes(time.Date(2024, 6, 21, 0, 0, 0, 0, time.UTC), 69.65, 18.96); ok || !polarDay {
+		t.Errorf("expected polar day in Tromsø")
+	}
+}
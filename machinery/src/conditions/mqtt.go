@@ -0,0 +1,81 @@
+package conditions
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/kerberos-io/agent/machinery/src/log"
+	"github.com/kerberos-io/agent/machinery/src/models"
+)
+
+var (
+	mqttStateMutex sync.Mutex
+	mqttClient     mqtt.Client
+	mqttSubscribed = map[string]bool{}
+	mqttStates     = map[string]string{} // The last message per topic.
+)
+
+// UseMQTTClient sets the client the MQTT conditions subscribe with, once it is
+// connected. The topics are subscribed to again.
+func UseMQTTClient(client mqtt.Client) {
+	mqttStateMutex.Lock()
+	defer mqttStateMutex.Unlock()
+	mqttClient = client
+	mqttSubscribed = map[string]bool{}
+}
+
+// SetMQTTState sets the last message of a topic.
+func SetMQTTState(topic string, state string) {
+	mqttStateMutex.Lock()
+	defer mqttStateMutex.Unlock()
+	mqttStates[topic] = strings.TrimSpace(state)
+}
+
+// isMQTTStateValid tells if the last message on the topic of the condition is
+// its value, "armed" by default. The topic is subscribed to on first use,
+// until a message arrives the condition isn't valid.
+func isMQTTStateValid(condition *models.Condition) (bool, string) {
+	if condition.Topic == "" {
+		return false, "no mqtt topic set"
+	}
+	value := condition.Value
+	if value == "" {
+		value = "armed"
+	}
+
+	mqttStateMutex.Lock()
+	client := mqttClient
+	subscribed := mqttSubscribed[condition.Topic]
+	mqttStateMutex.Unlock()
+	if client != nil && !subscribed {
+		// Not holding the lock: a retained message is delivered, through
+		// SetMQTTState, while subscribing.
+		topic := condition.Topic
+		token := client.Subscribe(topic, 1, func(c mqtt.Client, msg mqtt.Message) {
+			SetMQTTState(topic, string(msg.Payload()))
+		})
+		if token.Wait() && token.Error() == nil {
+			mqttStateMutex.Lock()
+			if mqttClient == client {
+				mqttSubscribed[topic] = true
+			}
+			mqttStateMutex.Unlock()
+			log.Log.Info("conditions.mqtt.isMQTTStateValid(): subscribed to " + topic)
+		} else {
+			log.Log.Error("conditions.mqtt.isMQTTStateValid(): could not subscribe to " + topic + ": " + fmt.Sprint(token.Error()))
+		}
+	}
+
+	mqttStateMutex.Lock()
+	defer mqttStateMutex.Unlock()
+	state, ok := mqttStates[condition.Topic]
+	if !ok {
+		return false, "no state received on " + condition.Topic
+	}
+	if !strings.EqualFold(state, value) {
+		return false, condition.Topic + " is " + state
+	}
+	return true, condition.Topic + " is " + state
+}
@@ -0,0 +1,113 @@
+package conditions
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kerberos-io/agent/machinery/src/log"
+	"github.com/kerberos-io/agent/machinery/src/models"
+	"github.com/kerberos-io/agent/machinery/src/onvif"
+)
+
+// The ONVIF device is connected to again after this long, when it failed.
+const onvifInputRetry = 10 * time.Second
+
+var (
+	onvifInputsMutex   sync.Mutex
+	onvifInputsWatched bool
+	onvifInputs        = map[string]bool{} // Per token: is the input active.
+)
+
+// isOnvifInputValid tells if the digital input of the condition is active, or
+// inactive with value "false". The inputs are watched on first use.
+func isOnvifInputValid(condition *models.Condition, configuration *models.Configuration) (bool, string) {
+	if condition.Input == "" {
+		return false, "no onvif input set"
+	}
+	want := condition.Value != "false"
+
+	onvifInputsMutex.Lock()
+	defer onvifInputsMutex.Unlock()
+	if !onvifInputsWatched {
+		onvifInputsWatched = true
+		go watchOnvifInputs(configuration)
+	}
+	active, ok := onvifInputs[condition.Input]
+	if !ok {
+		return false, "onvif input " + condition.Input + " unknown"
+	}
+	state := "inactive"
+	if active {
+		state = "active"
+	}
+	return active == want, "onvif input " + condition.Input + " " + state
+}
+
+// watchOnvifInputs keeps the state of the digital inputs of the camera, while
+// conditions use them. onvif.GetDigitalInputs lists the inputs, which are
+// inactive until the event subscription tells otherwise.
+func watchOnvifInputs(configuration *models.Configuration) {
+	for {
+		camera := configuration.Config.Capture.IPCamera
+		if camera.ONVIFXAddr == "" || !usesCondition(configuration, "onvif_input") {
+			time.Sleep(onvifInputRetry)
+			continue
+		}
+
+		device, _, err := onvif.ConnectToOnvifDevice(&camera)
+		if err != nil {
+			log.Log.Error("conditions.onvif.watchOnvifInputs(): " + err.Error())
+			time.Sleep(onvifInputRetry)
+			continue
+		}
+		inputs, err := onvif.GetDigitalInputs(device)
+		if err != nil {
+			log.Log.Error("conditions.onvif.watchOnvifInputs(): " + err.Error())
+			time.Sleep(onvifInputRetry)
+			continue
+		}
+		onvifInputsMutex.Lock()
+		onvifInputs = map[string]bool{}
+		for _, input := range inputs.DigitalInputs {
+			onvifInputs[string(input.Token)] = false
+		}
+		onvifInputsMutex.Unlock()
+
+		pullPoint, err := onvif.CreatePullPointSubscription(device)
+		if err != nil {
+			log.Log.Error("conditions.onvif.watchOnvifInputs(): " + err.Error())
+			time.Sleep(onvifInputRetry)
+			continue
+		}
+		for camera.ONVIFXAddr == configuration.Config.Capture.IPCamera.ONVIFXAddr && usesCondition(configuration, "onvif_input") {
+			// Waits for events for up to 5 seconds.
+			events, err := onvif.GetEventMessages(device, pullPoint)
+			if err != nil {
+				break
+			}
+			onvifInputsMutex.Lock()
+			for _, event := range events {
+				if token, found := strings.CutSuffix(event.Key, "-input"); found && event.Type == "input" {
+					onvifInputs[token] = event.Value == "true"
+				}
+			}
+			onvifInputsMutex.Unlock()
+		}
+		onvif.UnsubscribePullPoint(device, pullPoint)
+	}
+}
+
+// usesCondition tells if a condition of the type is configured.
+func usesCondition(configuration *models.Configuration, conditionType string) bool {
+	conditions := configuration.Config.Conditions
+	if conditions == nil {
+		return false
+	}
+	for _, condition := range conditions.List {
+		if condition != nil && condition.Type == conditionType {
+			return true
+		}
+	}
+	return false
+}
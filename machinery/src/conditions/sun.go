@@ -0,0 +1,56 @@
+package conditions
+
+import (
+	"math"
+	"time"
+
+	"github.com/kerberos-io/agent/machinery/src/models"
+)
+
+// sunTimes returns the sunrise and sunset of the day of date at the location,
+// with the sunrise equation. Without sunrise or sunset (polar day or night)
+// ok is false, and polarDay tells which of the two.
+func sunTimes(date time.Time, latitude float64, longitude float64) (sunrise time.Time, sunset time.Time, polarDay bool, ok bool) {
+	const rad = math.Pi / 180
+	noon := time.Date(date.Year(), date.Month(), date.Day(), 12, 0, 0, 0, time.UTC)
+	julianDay := float64(noon.Unix())/86400 + 2440587.5
+	n := math.Round(julianDay - 2451545.0 + 0.0008)
+
+	meanSolarTime := n - longitude/360
+	anomaly := math.Mod(357.5291+0.98560028*meanSolarTime, 360)
+	center := 1.9148*math.Sin(anomaly*rad) + 0.02*math.Sin(2*anomaly*rad) + 0.0003*math.Sin(3*anomaly*rad)
+	eclipticLongitude := math.Mod(anomaly+center+180+102.9372, 360)
+	transit := 2451545.0 + meanSolarTime + 0.0053*math.Sin(anomaly*rad) - 0.0069*math.Sin(2*eclipticLongitude*rad)
+	declination := math.Asin(math.Sin(eclipticLongitude*rad) * math.Sin(23.4397*rad))
+
+	cosHourAngle := (math.Sin(-0.833*rad) - math.Sin(latitude*rad)*math.Sin(declination)) / (math.Cos(latitude*rad) * math.Cos(declination))
+	if cosHourAngle < -1 || cosHourAngle > 1 {
+		return time.Time{}, time.Time{}, cosHourAngle < -1, false
+	}
+	hourAngle := math.Acos(cosHourAngle) / rad
+
+	fromJulian := func(julian float64) time.Time {
+		return time.Unix(int64((julian-2440587.5)*86400), 0).In(date.Location())
+	}
+	return fromJulian(transit - hourAngle/360), fromJulian(transit + hourAngle/360), false, true
+}
+
+// isSunValid tells if it is day (between sunrise and sunset) at the location
+// of the condition, or night with value "night".
+func isSunValid(condition *models.Condition, now time.Time) (bool, string) {
+	sunrise, sunset, polarDay, ok := sunTimes(now, condition.Latitude, condition.Longitude)
+	day := polarDay
+	if ok {
+		day = !now.Before(sunrise) && now.Before(sunset)
+	}
+	if condition.Value == "night" {
+		if day {
+			return false, "not night"
+		}
+		return true, "night"
+	}
+	if !day {
+		return false, "not day"
+	}
+	return true, "day"
+}
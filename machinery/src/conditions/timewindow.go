@@ -12,28 +12,97 @@ func IsWithinTimeInterval(loc *time.Location, configuration *models.Configuratio
 	timeEnabled := config.Time
 	enabled = true
 	if timeEnabled != "false" {
-		now := time.Now().In(loc)
-		weekday := now.Weekday()
-		hour := now.Hour()
-		minute := now.Minute()
-		second := now.Second()
-		if config.Timetable != nil && len(config.Timetable) > 0 {
-			timeInterval := config.Timetable[int(weekday)]
-			if timeInterval != nil {
-				start1 := timeInterval.Start1
-				end1 := timeInterval.End1
-				start2 := timeInterval.Start2
-				end2 := timeInterval.End2
-				currentTimeInSeconds := hour*60*60 + minute*60 + second
-				if (currentTimeInSeconds >= start1 && currentTimeInSeconds <= end1) ||
-					(currentTimeInSeconds >= start2 && currentTimeInSeconds <= end2) {
-					log.Log.Debug("conditions.timewindow.IsWithinTimeInterval(): time interval valid, enabling recording.")
-				} else {
-					log.Log.Info("conditions.timewindow.IsWithinTimeInterval(): time interval not valid, disabling recording.")
-					enabled = false
-				}
+		var calendar *Calendar
+		if config.TimetableCalendar != "" {
+			var err error
+			calendar, err = LoadCalendar(configDirectoryPath() + "/data/config/" + config.TimetableCalendar)
+			if err != nil {
+				log.Log.Error("conditions.timewindow.IsWithinTimeInterval(): " + err.Error() + ", using the timetable.")
 			}
 		}
+		if InSchedule(config.Timetable, config.TimetableExceptions, calendar, time.Now().In(loc)) {
+			log.Log.Debug("conditions.timewindow.IsWithinTimeInterval(): time interval valid, enabling recording.")
+		} else {
+			log.Log.Info("conditions.timewindow.IsWithinTimeInterval(): time interval not valid, disabling recording.")
+			enabled = false
+		}
 	}
 	return
 }
+
+// InTimetable tells if the time falls within one of the intervals of its
+// weekday, or within a window of the previous day which crosses midnight. An
+// empty timetable, or a weekday without entry, is always valid.
+func InTimetable(timetable []*models.Timetable, now time.Time) bool {
+	return InSchedule(timetable, nil, nil, now)
+}
+
+// InSchedule tells if the time falls within the timetable, where the
+// exceptions replace the days they cover. With a calendar, its events replace
+// the timetable: a day without events has no windows. An exception covers the
+// whole day, windows of the previous day which cross midnight end at its
+// start.
+func InSchedule(timetable []*models.Timetable, exceptions []*models.TimetableException, calendar *Calendar, now time.Time) bool {
+	windows, ok, exception := windowsOn(timetable, exceptions, calendar, now)
+	if !ok {
+		return true
+	}
+	currentTimeInSeconds := now.Hour()*60*60 + now.Minute()*60 + now.Second()
+	for _, window := range windows {
+		if window.End < window.Start {
+			if currentTimeInSeconds >= window.Start {
+				return true
+			}
+		} else if currentTimeInSeconds >= window.Start && currentTimeInSeconds <= window.End {
+			return true
+		}
+	}
+	if exception {
+		return false
+	}
+
+	// The windows of yesterday which cross midnight.
+	previous, ok, _ := windowsOn(timetable, exceptions, calendar, now.AddDate(0, 0, -1))
+	if ok {
+		for _, window := range previous {
+			if window.End < window.Start && currentTimeInSeconds <= window.End {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// windowsOn returns the windows of the day of date: those of the exception
+// covering it, of the calendar, or of its weekday. ok is false when the day
+// has no entry in the timetable, exception tells if an exception covers it.
+func windowsOn(timetable []*models.Timetable, exceptions []*models.TimetableException, calendar *Calendar, date time.Time) (windows []models.TimeWindow, ok bool, exception bool) {
+	day := date.Format("2006-01-02")
+	for _, e := range exceptions {
+		if e == nil || e.Date == "" {
+			continue
+		}
+		endDate := e.EndDate
+		if endDate == "" {
+			endDate = e.Date
+		}
+		if day >= e.Date && day <= endDate {
+			return e.Windows, true, true
+		}
+	}
+
+	if calendar != nil {
+		return calendar.Windows(date), true, false
+	}
+
+	weekday := int(date.Weekday())
+	if weekday >= len(timetable) || timetable[weekday] == nil {
+		return nil, false, false
+	}
+	timeInterval := timetable[weekday]
+	windows = []models.TimeWindow{
+		{Start: timeInterval.Start1, End: timeInterval.End1},
+		{Start: timeInterval.Start2, End: timeInterval.End2},
+	}
+	return append(windows, timeInterval.Windows...), true, false
+}
@@ -0,0 +1,129 @@
+package conditions
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kerberos-io/agent/machinery/src/models"
+)
+
+// at returns 2024-12-<day> at the clock in UTC; the 23rd is a Monday.
+func at(day int, hour int, minute int) time.Time {
+	return time.Date(2024, 12, day, hour, minute, 0, 0, time.UTC)
+}
+
+func TestInSchedule(t *testing.T) {
+	// Every day from 09:00 to 12:00, 13:00 to 17:00 and 22:00 to 02:00.
+	timetable := make([]*models.Timetable, 7)
+	for i := range timetable {
+		timetable[i] = &models.Timetable{
+			Start1: 9 * 3600, End1: 12 * 3600, Start2: 13 * 3600, End2: 17 * 3600,
+			Windows: []models.TimeWindow{{Start: 22 * 3600, End: 2 * 3600}},
+		}
+	}
+	exceptions := []*models.TimetableException{
+		{Name: "Christmas", Date: "2024-12-25", EndDate: "2024-12-26"},
+		{Name: "Stocktaking", Date: "2024-12-30", Windows: []models.TimeWindow{{Start: 6 * 3600, End: 8 * 3600}}},
+	}
+
+	tests := []struct {
+		name     string
+		now      time.Time
+		expected bool
+	}{
+		{"first window", at(23, 10, 0), true},
+		{"between windows", at(23, 12, 30), false},
+		{"before midnight", at(23, 23, 0), true},
+		{"after midnight", at(24, 1, 0), true},
+		{"after the night window", at(24, 3, 0), false},
+		{"holiday", at(25, 10, 0), false},
+		{"last day of the holiday", at(26, 23, 0), false},
+		{"night window ends at the holiday", at(25, 1, 0), false},
+		{"no night window on the holiday", at(27, 1, 0), false},
+		{"night window after the holiday", at(28, 1, 0), true},
+		{"exception window", at(30, 7, 0), true},
+		{"weekday window on the exception", at(30, 10, 0), false},
+	}
+	for _, test := range tests {
+		if got := InSchedule(timetable, exceptions, nil, test.now); got != test.expected {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, got)
+		}
+	}
+
+	// Without entry for the weekday it is always valid, except on exceptions.
+	if !InSchedule(nil, exceptions, nil, at(23, 3, 0)) {
+		t.Errorf("expected an empty timetable to be valid")
+	}
+	if InSchedule(nil, exceptions, nil, at(25, 3, 0)) {
+		t.Errorf("expected the holiday to be invalid with an empty timetable")
+	}
+}
+
+const shopCalendar = `BEGIN:VCALENDAR
+VERSION:2.0
+BEGIN:VEVENT
+SUMMARY:Opening hours
+DTSTART;TZID=Europe/Amsterdam:20241202T090000
+DTEND;TZID=Europe/Amsterdam:20241202T173000
+RRULE:FREQ=WEEKLY;BYDAY=MO,TU,WE,TH,FR
+EXDATE;TZID=Europe/Amsterdam:20241225T090000,
+ 20241226T090000
+END:VEVENT
+BEGIN:VEVENT
+SUMMARY:Late night shopping
+DTSTART:20241227T180000Z
+DURATION:PT6H
+END:VEVENT
+BEGIN:VEVENT
+SUMMARY:Cancelled
+STATUS:CANCELLED
+DTSTART;VALUE=DATE:20241228
+END:VEVENT
+BEGIN:VEVENT
+SUMMARY:Inventory
+DTSTART;VALUE=DATE:20241229
+END:VEVENT
+END:VCALENDAR
+`
+
+func TestCalendar(t *testing.T) {
+	calendar, err := ParseCalendar(strings.NewReader(shopCalendar))
+	if err != nil {
+		t.Fatal(err)
+	}
+	amsterdam, err := time.LoadLocation("Europe/Amsterdam")
+	if err != nil {
+		t.Skip("no timezone database")
+	}
+	local := func(day int, hour int, minute int) time.Time {
+		return time.Date(2024, 12, day, hour, minute, 0, 0, amsterdam)
+	}
+
+	tests := []struct {
+		name     string
+		now      time.Time
+		expected bool
+	}{
+		{"opening hours", local(23, 10, 0), true},
+		{"closed in the evening", local(23, 18, 0), false},
+		{"excluded date", local(25, 10, 0), false},
+		{"friday", local(27, 12, 0), true},
+		{"late night shopping", local(27, 23, 30), true},
+		{"late night shopping after midnight", local(28, 0, 30), true},
+		{"cancelled", local(28, 12, 0), false},
+		{"all-day event", local(29, 3, 0), true},
+		{"before the first occurrence", local(1, 10, 0), false},
+	}
+	for _, test := range tests {
+		if got := InSchedule(nil, nil, calendar, test.now); got != test.expected {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, got)
+		}
+	}
+
+	// An exception still replaces the calendar.
+	exceptions := []*models.TimetableException{{Date: "2024-12-23"}}
+	if InSchedule(nil, exceptions, calendar, local(23, 10, 0)) {
+		t.Errorf("expected the exception to replace the calendar")
+	}
+}
@@ -2,58 +2,180 @@ package conditions
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
-	"fmt"
+	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
 	"os"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/kerberos-io/agent/machinery/src/log"
 	"github.com/kerberos-io/agent/machinery/src/models"
 )
 
+const (
+	defaultConditionURITimeout = 5 * time.Second
+	defaultConditionURITTL     = 30 * time.Second
+)
+
+// uriDecision is a decision of the ConditionURI, cached for the TTL.
+type uriDecision struct {
+	uri      string
+	record   bool
+	reason   string
+	response models.ConditionResponse
+	expires  time.Time
+}
+
+var (
+	uriMutex      sync.Mutex
+	uriCached     *uriDecision
+	uriRefreshing bool
+)
+
+// IsValidUriResponse tells if the ConditionURI allows recording.
 func IsValidUriResponse(configuration *models.Configuration) (enabled bool) {
+	enabled, _ = isURIValid(configuration)
+	return
+}
+
+// isURIValid tells if the ConditionURI allows recording, and why. A decision
+// is used for the TTL, after which it is refreshed in the background: only
+// the first request is waited for.
+func isURIValid(configuration *models.Configuration) (bool, string) {
+	conditionURI := configuration.Config.ConditionURI
+	if conditionURI == "" {
+		return true, "no condition uri"
+	}
+
+	uriMutex.Lock()
+	cached := uriCached
+	if cached != nil && cached.uri == conditionURI {
+		if time.Now().After(cached.expires) && !uriRefreshing {
+			uriRefreshing = true
+			go func() {
+				refreshURIDecision(configuration)
+				uriMutex.Lock()
+				uriRefreshing = false
+				uriMutex.Unlock()
+			}()
+		}
+		uriMutex.Unlock()
+		return cached.record, cached.reason
+	}
+	uriMutex.Unlock()
+
+	decision := refreshURIDecision(configuration)
+	return decision.record, decision.reason
+}
+
+// uriResponse returns the last response of the ConditionURI, if any.
+func uriResponse(configuration *models.Configuration) (models.ConditionResponse, bool) {
+	uriMutex.Lock()
+	defer uriMutex.Unlock()
+	if uriCached == nil || uriCached.uri != configuration.Config.ConditionURI || !uriCached.record {
+		return models.ConditionResponse{}, false
+	}
+	return uriCached.response, true
+}
+
+// refreshURIDecision requests a decision of the ConditionURI, and caches it.
+func refreshURIDecision(configuration *models.Configuration) *uriDecision {
 	config := configuration.Config
-	conditionURI := config.ConditionURI
-	enabled = true
-	if conditionURI != "" {
-
-		// We will send a POST request to the conditionURI, and expect a 200 response.
-		// In the payload we will send some information, so the other end can decide
-		// if it should enable or disable recording.
-
-		var client *http.Client
-		if os.Getenv("AGENT_TLS_INSECURE") == "true" {
-			tr := &http.Transport{
-				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-			}
-			client = &http.Client{Transport: tr}
-		} else {
-			client = &http.Client{}
+	timeout, ttl := defaultConditionURITimeout, defaultConditionURITTL
+	failOpen := false
+	if options := config.ConditionURIOptions; options != nil {
+		if options.Timeout > 0 {
+			timeout = time.Duration(options.Timeout) * time.Second
+		}
+		if options.TTL > 0 {
+			ttl = time.Duration(options.TTL) * time.Second
 		}
+		failOpen = options.Policy == "open"
+	}
 
-		var object = fmt.Sprintf(`{
-			"camera_id" : "%s",
-			"camera_name" : "%s",
-			"site_id" : "%s",
-			"hub_key" : "%s",
-			"timestamp" : "%s",
-		}`, config.Key, config.FriendlyName, config.HubSite, config.HubKey, time.Now().Format("2006-01-02 15:04:05"))
-
-		var jsonStr = []byte(object)
-		buffy := bytes.NewBuffer(jsonStr)
-		req, _ := http.NewRequest("POST", conditionURI, buffy)
-		req.Header.Set("Content-Type", "application/json")
-		resp, err := client.Do(req)
-		if resp != nil {
-			resp.Body.Close()
+	decision := &uriDecision{uri: config.ConditionURI, expires: time.Now().Add(ttl)}
+	response, status, err := requestConditionURI(config, timeout)
+	switch {
+	case err != nil || status >= 500:
+		if err == nil {
+			err = errors.New("response " + strconv.Itoa(status))
 		}
-		if err == nil && resp.StatusCode == 200 {
-			log.Log.Info("conditions.uri.IsValidUriResponse(): response 200, enabling recording.")
+		decision.record = failOpen
+		if failOpen {
+			decision.reason = "uri failed (" + err.Error() + "), failing open"
 		} else {
-			log.Log.Info("conditions.uri.IsValidUriResponse(): response not 200, disabling recording.")
-			enabled = false
+			decision.reason = "uri failed (" + err.Error() + "), failing closed"
 		}
+		log.Log.Error("conditions.uri.refreshURIDecision(): " + decision.reason)
+	case status != http.StatusOK:
+		decision.reason = "uri response " + strconv.Itoa(status)
+	case response.Record != nil && !*response.Record:
+		decision.reason = "uri disabled recording"
+	default:
+		decision.record = true
+		decision.reason = "uri enabled recording"
 	}
-	return
+	if response.Reason != "" && err == nil {
+		decision.reason += ": " + response.Reason
+	}
+	decision.response = response
+	log.Log.Debug("conditions.uri.refreshURIDecision(): " + decision.reason)
+
+	uriMutex.Lock()
+	uriCached = decision
+	uriMutex.Unlock()
+	return decision
+}
+
+// requestConditionURI posts a models.ConditionRequest to the ConditionURI.
+// The response body is optional, an empty or non JSON body is no decision.
+func requestConditionURI(config models.Config, timeout time.Duration) (response models.ConditionResponse, status int, err error) {
+	var client *http.Client
+	if os.Getenv("AGENT_TLS_INSECURE") == "true" {
+		tr := &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		}
+		client = &http.Client{Transport: tr}
+	} else {
+		client = &http.Client{}
+	}
+
+	body, err := json.Marshal(models.ConditionRequest{
+		CameraId:   config.Key,
+		CameraName: config.FriendlyName,
+		SiteId:     config.HubSite,
+		HubKey:     config.HubKey,
+		Timestamp:  time.Now().Format("2006-01-02 15:04:05"),
+	})
+	if err != nil {
+		return response, 0, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", config.ConditionURI, bytes.NewBuffer(body))
+	if err != nil {
+		return response, 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return response, 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK {
+		data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+		if err == nil && len(bytes.TrimSpace(data)) > 0 {
+			if err := json.Unmarshal(data, &response); err != nil {
+				log.Log.Warning("conditions.uri.requestConditionURI(): response is no valid JSON: " + err.Error())
+			}
+		}
+	}
+	return response, resp.StatusCode, nil
 }
@@ -0,0 +1,105 @@
+package conditions
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kerberos-io/agent/machinery/src/models"
+)
+
+func uriConfiguration(uri string, options *models.ConditionURIOptions) *models.Configuration {
+	configuration := &models.Configuration{}
+	configuration.Config.Key = "camera1"
+	configuration.Config.ConditionURI = uri
+	configuration.Config.ConditionURIOptions = options
+	configuration.Config.Conditions = &models.Conditions{List: []*models.Condition{{Type: "uri"}}}
+	return configuration
+}
+
+func TestConditionURI(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		var request models.ConditionRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.CameraId != "camera1" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"record": true, "post_recording": 45, "outputs": [{"event": "motion_detected", "outputs": ["webhook"]}], "reason": "business hours"}`))
+	}))
+	defer server.Close()
+
+	configuration := uriConfiguration(server.URL, &models.ConditionURIOptions{TTL: 60})
+	decision := Evaluate(time.UTC, configuration)
+	if !decision.Valid || decision.Reason != "all conditions valid" || decision.Conditions[0].Reason != "uri enabled recording: business hours" {
+		t.Fatalf("expected the uri to enable recording, got %+v", decision)
+	}
+	if decision.PostRecording != 45 || len(decision.Outputs) != 1 {
+		t.Errorf("expected the post-recording and outputs of the uri, got %+v", decision)
+	}
+	if outputs := models.OutputsForEvent(configuration.Config, PolicyOutputs(), models.OutputEventMotionDetected); len(outputs) != 1 || outputs[0] != "webhook" {
+		t.Errorf("expected the webhook to be fired on motion, got %v", outputs)
+	}
+
+	// The decision is cached for the TTL.
+	Evaluate(time.UTC, configuration)
+	if requests.Load() != 1 {
+		t.Errorf("expected 1 request, got %d", requests.Load())
+	}
+
+	// Without the uri condition the outputs are no longer fired.
+	configuration.Config.Conditions.List = []*models.Condition{{Type: "env", Name: "AGENT_TEST_UNSET", Negate: "true"}}
+	Evaluate(time.UTC, configuration)
+	if outputs := models.OutputsForEvent(configuration.Config, PolicyOutputs(), models.OutputEventMotionDetected); len(outputs) != 0 {
+		t.Errorf("expected no outputs, got %v", outputs)
+	}
+
+	// Nor when the chain is decided before the uri is asked.
+	configuration.Config.Conditions.List = []*models.Condition{{Type: "env", Name: "AGENT_TEST_UNSET"}, {Type: "uri"}}
+	decision = Evaluate(time.UTC, configuration)
+	if decision.Valid || decision.PostRecording != 0 || len(decision.Outputs) != 0 {
+		t.Errorf("expected the uri response not to apply, got %+v", decision)
+	}
+	configuration.Config.Conditions.List = []*models.Condition{{Type: "uri"}, {Type: "env", Name: "AGENT_TEST_UNSET"}}
+	if decision = Evaluate(time.UTC, configuration); decision.Valid || decision.PostRecording != 45 {
+		t.Errorf("expected the uri response to apply once asked, got %+v", decision)
+	}
+}
+
+func TestConditionURIPolicy(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	if valid, reason := isURIValid(uriConfiguration(server.URL, nil)); valid {
+		t.Errorf("expected to fail closed by default, got %s", reason)
+	}
+	if valid, reason := isURIValid(uriConfiguration(server.URL+"/open", &models.ConditionURIOptions{Policy: "open"})); !valid {
+		t.Errorf("expected to fail open, got %s", reason)
+	}
+
+	forbidden := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer forbidden.Close()
+	if valid, _ := isURIValid(uriConfiguration(forbidden.URL, &models.ConditionURIOptions{Policy: "open"})); valid {
+		t.Errorf("expected a 403 to disable recording, also when failing open")
+	}
+
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(2 * time.Second)
+	}))
+	defer slow.Close()
+	start := time.Now()
+	if valid, _ := isURIValid(uriConfiguration(slow.URL, &models.ConditionURIOptions{Timeout: 1})); valid {
+		t.Errorf("expected a timeout to fail closed")
+	}
+	if time.Since(start) > 1500*time.Millisecond {
+		t.Errorf("expected the request to time out after 1s, took %s", time.Since(start))
+	}
+}
@@ -155,6 +155,13 @@ func OpenConfig(configDirectory string, configuration *models.Configuration) {
 
 		// Merge timetable manually because it's an array
 		configuration.Config.Timetable = configuration.CustomConfig.Timetable
+		configuration.Config.TimetableExceptions = configuration.CustomConfig.TimetableExceptions
+
+		// Same for the upload targets, the custom config replaces the global one.
+		configuration.Config.UploadTargets = configuration.GlobalConfig.UploadTargets
+		if len(configuration.CustomConfig.UploadTargets) > 0 {
+			configuration.Config.UploadTargets = configuration.CustomConfig.UploadTargets
+		}
 
 		// Cleanup
 		opts = nil
@@ -281,11 +288,95 @@ func initConfigPointers(config *models.Config) {
 	if config.Dropbox == nil {
 		config.Dropbox = &models.Dropbox{}
 	}
+	if config.FTP == nil {
+		config.FTP = &models.FTP{}
+	}
+	if config.WebDAV == nil {
+		config.WebDAV = &models.WebDAV{}
+	}
+	if config.MinIO == nil {
+		config.MinIO = &models.MinIO{}
+	}
+	if config.UploadSchedule == nil {
+		config.UploadSchedule = &models.UploadSchedule{}
+	}
+	if config.Detector == nil {
+		config.Detector = &models.Detector{}
+	}
+	if config.Tamper == nil {
+		config.Tamper = &models.Tamper{}
+	}
+	if config.ConditionURIOptions == nil {
+		config.ConditionURIOptions = &models.ConditionURIOptions{}
+	}
+	if config.Conditions == nil {
+		config.Conditions = &models.Conditions{}
+	}
+	if config.Webhook == nil {
+		config.Webhook = &models.Webhook{}
+	}
+	if config.Script == nil {
+		config.Script = &models.Script{}
+	}
+	if config.OnvifRelay == nil {
+		config.OnvifRelay = &models.OnvifRelay{}
+	}
+	if config.Chat == nil {
+		config.Chat = &models.Chat{}
+	}
 	if config.Region == nil {
 		config.Region = &models.Region{}
 	}
 }
 
+// parseTimetable converts a timetable, as used in the environment variables,
+// to an entry per weekday with (start1, end1, start2, end2). Days are delimited
+// by ; and times by , starting on Sunday:
+// 0,43199,43200,86400;0,43199,43200,86400;...
+// Further start,end pairs of a day are added as its windows, a window which
+// ends before it starts crosses midnight: 0,0,0,0,79200,21600;...
+func parseTimetable(value string) []*models.Timetable {
+	var timetable []*models.Timetable
+	for _, dayString := range strings.Split(value, ";") {
+		timeString := strings.Split(dayString, ",")
+		if len(timeString) < 4 || len(timeString)%2 != 0 {
+			continue
+		}
+		times := make([]int, 0, len(timeString))
+		for _, t := range timeString {
+			seconds, err := strconv.ParseInt(strings.TrimSpace(t), 10, 64)
+			if err != nil {
+				break
+			}
+			times = append(times, int(seconds))
+		}
+		if len(times) != len(timeString) {
+			continue
+		}
+		day := &models.Timetable{
+			Start1: times[0],
+			End1:   times[1],
+			Start2: times[2],
+			End2:   times[3],
+		}
+		for i := 4; i < len(times); i += 2 {
+			day.Windows = append(day.Windows, models.TimeWindow{Start: times[i], End: times[i+1]})
+		}
+		timetable = append(timetable, day)
+	}
+	return timetable
+}
+
+// firstChatChannel returns the first chat channel, creating it if needed.
+func firstChatChannel(chat *models.Chat) *models.ChatChannel {
+	if len(chat.Channels) == 0 {
+		chat.Channels = append(chat.Channels, &models.ChatChannel{})
+	} else if chat.Channels[0] == nil {
+		chat.Channels[0] = &models.ChatChannel{}
+	}
+	return chat.Channels[0]
+}
+
 // applyAgentEnvVars applies the AGENT_* environment variables (optionally
 // carrying the given prefix, e.g. "GLOBAL_") onto configuration.Config. When
 // applyDefaults is true, defaults (such as the signing key) are applied after
@@ -297,6 +388,42 @@ func applyAgentEnvVars(configuration *models.Configuration, prefix string, apply
 	if configuration.Config.KStorageSecondary == nil {
 		configuration.Config.KStorageSecondary = &models.KStorage{}
 	}
+	if configuration.Config.FTP == nil {
+		configuration.Config.FTP = &models.FTP{}
+	}
+	if configuration.Config.WebDAV == nil {
+		configuration.Config.WebDAV = &models.WebDAV{}
+	}
+	if configuration.Config.MinIO == nil {
+		configuration.Config.MinIO = &models.MinIO{}
+	}
+	if configuration.Config.UploadSchedule == nil {
+		configuration.Config.UploadSchedule = &models.UploadSchedule{}
+	}
+	if configuration.Config.Detector == nil {
+		configuration.Config.Detector = &models.Detector{}
+	}
+	if configuration.Config.Tamper == nil {
+		configuration.Config.Tamper = &models.Tamper{}
+	}
+	if configuration.Config.ConditionURIOptions == nil {
+		configuration.Config.ConditionURIOptions = &models.ConditionURIOptions{}
+	}
+	if configuration.Config.Conditions == nil {
+		configuration.Config.Conditions = &models.Conditions{}
+	}
+	if configuration.Config.Webhook == nil {
+		configuration.Config.Webhook = &models.Webhook{}
+	}
+	if configuration.Config.Script == nil {
+		configuration.Config.Script = &models.Script{}
+	}
+	if configuration.Config.OnvifRelay == nil {
+		configuration.Config.OnvifRelay = &models.OnvifRelay{}
+	}
+	if configuration.Config.Chat == nil {
+		configuration.Config.Chat = &models.Chat{}
+	}
 
 	for _, env := range environmentVariables {
 		fullKey := strings.SplitN(env, "=", 2)[0]
@@ -407,6 +534,15 @@ func applyAgentEnvVars(configuration *models.Configuration, prefix string, apply
 					configuration.Config.Capture.PixelChangeThreshold = &count
 				}
 				break
+			case "AGENT_CAPTURE_ANALYSIS_FPS":
+				fps, err := strconv.Atoi(value)
+				if err == nil {
+					configuration.Config.Capture.AnalysisFPS = fps
+				}
+				break
+			case "AGENT_CAPTURE_MOTION_ALGORITHM":
+				configuration.Config.Capture.MotionAlgorithm = value
+				break
 			case "AGENT_CAPTURE_FRAGMENTED":
 				configuration.Config.Capture.Fragmented = value
 				break
@@ -423,44 +559,18 @@ func applyAgentEnvVars(configuration *models.Configuration, prefix string, apply
 				configuration.Config.Time = value
 				break
 			case "AGENT_TIMETABLE":
-				var timetable []*models.Timetable
-
-				// Convert value to timetable array with (start1, end1, start2, end2)
-				// Where days are limited by ; and time by ,
-				// su;mo;tu;we;th;fr;sa
-				// 0,43199,43200,86400;0,43199,43200,86400
-
-				// Split days
-				daysString := strings.Split(value, ";")
-				for _, dayString := range daysString {
-					// Split time
-					timeString := strings.Split(dayString, ",")
-					if len(timeString) == 4 {
-						start1, err := strconv.ParseInt(timeString[0], 10, 64)
-						if err != nil {
-							continue
-						}
-						end1, err := strconv.ParseInt(timeString[1], 10, 64)
-						if err != nil {
-							continue
-						}
-						start2, err := strconv.ParseInt(timeString[2], 10, 64)
-						if err != nil {
-							continue
-						}
-						end2, err := strconv.ParseInt(timeString[3], 10, 64)
-						if err != nil {
-							continue
-						}
-						timetable = append(timetable, &models.Timetable{
-							Start1: int(start1),
-							End1:   int(end1),
-							Start2: int(start2),
-							End2:   int(end2),
-						})
-					}
+				configuration.Config.Timetable = parseTimetable(value)
+				break
+			case "AGENT_TIMETABLE_EXCEPTIONS":
+				var exceptions []*models.TimetableException
+				if err := json.Unmarshal([]byte(value), &exceptions); err == nil {
+					configuration.Config.TimetableExceptions = exceptions
+				} else {
+					log.Log.Error("config.main.OverrideWithEnvironmentVariables(): AGENT_TIMETABLE_EXCEPTIONS is no valid JSON: " + err.Error())
 				}
-				configuration.Config.Timetable = timetable
+				break
+			case "AGENT_TIMETABLE_CALENDAR":
+				configuration.Config.TimetableCalendar = value
 				break
 
 			case "AGENT_REGION_POLYGON":
@@ -621,6 +731,334 @@ func applyAgentEnvVars(configuration *models.Configuration, prefix string, apply
 				configuration.Config.Dropbox.Directory = value
 				break
 
+			/* When storing in FTP or SFTP */
+			case "AGENT_FTP_HOST":
+				configuration.Config.FTP.Host = value
+				break
+			case "AGENT_FTP_USERNAME":
+				configuration.Config.FTP.Username = value
+				break
+			case "AGENT_FTP_PASSWORD":
+				configuration.Config.FTP.Password = value
+				break
+			case "AGENT_FTP_PRIVATE_KEY":
+				configuration.Config.FTP.PrivateKey = value
+				break
+			case "AGENT_FTP_HOST_KEY":
+				configuration.Config.FTP.HostKey = value
+				break
+			case "AGENT_FTP_INSECURE_HOST_KEY":
+				configuration.Config.FTP.InsecureHostKey = value
+				break
+			case "AGENT_FTP_TLS":
+				configuration.Config.FTP.TLS = value
+				break
+			case "AGENT_FTP_DIRECTORY":
+				configuration.Config.FTP.Directory = value
+				break
+
+			/* When storing in WebDAV */
+			case "AGENT_WEBDAV_URL":
+				configuration.Config.WebDAV.URL = value
+				break
+			case "AGENT_WEBDAV_USERNAME":
+				configuration.Config.WebDAV.Username = value
+				break
+			case "AGENT_WEBDAV_PASSWORD":
+				configuration.Config.WebDAV.Password = value
+				break
+			case "AGENT_WEBDAV_TOKEN":
+				configuration.Config.WebDAV.Token = value
+				break
+			case "AGENT_WEBDAV_DIRECTORY":
+				configuration.Config.WebDAV.Directory = value
+				break
+			case "AGENT_WEBDAV_CHUNK_SIZE":
+				chunkSize, err := strconv.Atoi(value)
+				if err == nil {
+					configuration.Config.WebDAV.ChunkSize = chunkSize
+				}
+				break
+
+			/* When storing in an S3-compatible storage (MinIO) */
+			case "AGENT_MINIO_ENDPOINT":
+				configuration.Config.MinIO.Endpoint = value
+				break
+			case "AGENT_MINIO_BUCKET":
+				configuration.Config.MinIO.Bucket = value
+				break
+			case "AGENT_MINIO_REGION":
+				configuration.Config.MinIO.Region = value
+				break
+			case "AGENT_MINIO_ACCESS_KEY":
+				configuration.Config.MinIO.AccessKey = value
+				break
+			case "AGENT_MINIO_SECRET_KEY":
+				configuration.Config.MinIO.SecretKey = value
+				break
+			case "AGENT_MINIO_PATH_STYLE":
+				configuration.Config.MinIO.PathStyle = value
+				break
+			case "AGENT_MINIO_SSE":
+				configuration.Config.MinIO.SSE = value
+				break
+			case "AGENT_MINIO_SSE_KMS_KEY_ID":
+				configuration.Config.MinIO.SSEKMSKeyID = value
+				break
+			case "AGENT_MINIO_SSE_CUSTOMER_KEY":
+				configuration.Config.MinIO.SSECustomerKey = value
+				break
+			case "AGENT_MINIO_PART_SIZE":
+				partSize, err := strconv.Atoi(value)
+				if err == nil {
+					configuration.Config.MinIO.PartSize = partSize
+				}
+				break
+			case "AGENT_MINIO_KEY":
+				configuration.Config.MinIO.Key = value
+				break
+
+			/* Replicate recordings to several targets, e.g. "vault:kstorage,nas:sftp:optional" */
+			case "AGENT_UPLOAD_TARGETS":
+				var targets []*models.UploadTarget
+				for _, entry := range strings.Split(value, ",") {
+					parts := strings.Split(strings.TrimSpace(entry), ":")
+					if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+						continue
+					}
+					target := &models.UploadTarget{Name: parts[0], Cloud: parts[1]}
+					if len(parts) > 2 && parts[2] == "optional" {
+						target.Required = "false"
+					}
+					targets = append(targets, target)
+				}
+				configuration.Config.UploadTargets = targets
+				break
+
+			/* Object detection */
+			case "AGENT_DETECTOR":
+				configuration.Config.Detector.Type = value
+				break
+			case "AGENT_DETECTOR_URL":
+				configuration.Config.Detector.URL = value
+				break
+			case "AGENT_DETECTOR_CLASSES":
+				var classes []string
+				for _, class := range strings.Split(value, ",") {
+					if class = strings.TrimSpace(class); class != "" {
+						classes = append(classes, class)
+					}
+				}
+				configuration.Config.Detector.Classes = classes
+				break
+			case "AGENT_DETECTOR_MIN_CONFIDENCE":
+				minConfidence, err := strconv.ParseFloat(value, 64)
+				if err == nil {
+					configuration.Config.Detector.MinConfidence = minConfidence
+				}
+				break
+			case "AGENT_DETECTOR_TIMEOUT":
+				timeout, err := strconv.Atoi(value)
+				if err == nil {
+					configuration.Config.Detector.Timeout = timeout
+				}
+				break
+
+			/* Conditions */
+			case "AGENT_CONDITION_URI":
+				configuration.Config.ConditionURI = value
+				break
+			case "AGENT_CONDITION_URI_TIMEOUT":
+				timeout, err := strconv.Atoi(value)
+				if err == nil {
+					configuration.Config.ConditionURIOptions.Timeout = timeout
+				}
+				break
+			case "AGENT_CONDITION_URI_TTL":
+				ttl, err := strconv.Atoi(value)
+				if err == nil {
+					configuration.Config.ConditionURIOptions.TTL = ttl
+				}
+				break
+			case "AGENT_CONDITION_URI_POLICY":
+				configuration.Config.ConditionURIOptions.Policy = value
+				break
+			case "AGENT_CONDITIONS":
+				var list []*models.Condition
+				if err := json.Unmarshal([]byte(value), &list); err == nil {
+					configuration.Config.Conditions.List = list
+				} else {
+					log.Log.Error("config.main.OverrideWithEnvironmentVariables(): AGENT_CONDITIONS is no valid JSON: " + err.Error())
+				}
+				break
+			case "AGENT_CONDITIONS_OPERATOR":
+				configuration.Config.Conditions.Operator = value
+				break
+
+			/* Tamper detection */
+			case "AGENT_TAMPER":
+				configuration.Config.Tamper.Enabled = value
+				break
+			case "AGENT_TAMPER_SENSITIVITY":
+				sensitivity, err := strconv.Atoi(value)
+				if err == nil {
+					configuration.Config.Tamper.Sensitivity = sensitivity
+				}
+				break
+			case "AGENT_TAMPER_HOLD_TIME":
+				holdTime, err := strconv.Atoi(value)
+				if err == nil {
+					configuration.Config.Tamper.HoldTime = holdTime
+				}
+				break
+
+			/* Shape the upload traffic */
+			case "AGENT_UPLOAD_BANDWIDTH_LIMIT":
+				bandwidthLimit, err := strconv.Atoi(value)
+				if err == nil {
+					configuration.Config.UploadSchedule.BandwidthLimit = bandwidthLimit
+				}
+				break
+			case "AGENT_UPLOAD_TIMETABLE":
+				configuration.Config.UploadSchedule.Timetable = parseTimetable(value)
+				break
+			case "AGENT_UPLOAD_ORDER":
+				configuration.Config.UploadSchedule.Order = value
+				break
+
+			/* When triggering a webhook output */
+			case "AGENT_WEBHOOK_URLS":
+				var urls []string
+				for _, u := range strings.Split(value, ",") {
+					if u = strings.TrimSpace(u); u != "" {
+						urls = append(urls, u)
+					}
+				}
+				configuration.Config.Webhook.URLs = urls
+				break
+			case "AGENT_WEBHOOK_METHOD":
+				configuration.Config.Webhook.Method = value
+				break
+			case "AGENT_WEBHOOK_TEMPLATE":
+				configuration.Config.Webhook.Template = value
+				break
+			case "AGENT_WEBHOOK_SECRET":
+				configuration.Config.Webhook.Secret = value
+				break
+			case "AGENT_WEBHOOK_MAX_RETRIES":
+				maxRetries, err := strconv.Atoi(value)
+				if err == nil {
+					configuration.Config.Webhook.MaxRetries = maxRetries
+				}
+				break
+			case "AGENT_WEBHOOK_TIMEOUT":
+				timeout, err := strconv.Atoi(value)
+				if err == nil {
+					configuration.Config.Webhook.Timeout = timeout
+				}
+				break
+
+			/* When triggering a script output */
+			case "AGENT_SCRIPT_PATH":
+				configuration.Config.Script.Path = value
+				break
+			case "AGENT_SCRIPT_TIMEOUT":
+				timeout, err := strconv.Atoi(value)
+				if err == nil {
+					configuration.Config.Script.Timeout = timeout
+				}
+				break
+			case "AGENT_SCRIPT_MAX_CONCURRENT":
+				maxConcurrent, err := strconv.Atoi(value)
+				if err == nil {
+					configuration.Config.Script.MaxConcurrent = maxConcurrent
+				}
+				break
+			case "AGENT_SCRIPT_ALLOWED_PATHS":
+				var paths []string
+				for _, p := range strings.Split(value, ",") {
+					if p = strings.TrimSpace(p); p != "" {
+						paths = append(paths, p)
+					}
+				}
+				configuration.Config.Script.AllowedPaths = paths
+				break
+
+			/* ONVIF relay output */
+			case "AGENT_ONVIF_RELAY_TOKEN":
+				configuration.Config.OnvifRelay.Token = value
+				break
+			case "AGENT_ONVIF_RELAY_XADDR":
+				configuration.Config.OnvifRelay.XAddr = value
+				break
+			case "AGENT_ONVIF_RELAY_USERNAME":
+				configuration.Config.OnvifRelay.Username = value
+				break
+			case "AGENT_ONVIF_RELAY_PASSWORD":
+				configuration.Config.OnvifRelay.Password = value
+				break
+			case "AGENT_ONVIF_RELAY_PULSE_DURATION":
+				pulseDuration, err := strconv.Atoi(value)
+				if err == nil {
+					configuration.Config.OnvifRelay.PulseDuration = pulseDuration
+				}
+				break
+			case "AGENT_ONVIF_RELAY_COOLDOWN":
+				cooldown, err := strconv.Atoi(value)
+				if err == nil {
+					configuration.Config.OnvifRelay.Cooldown = cooldown
+				}
+				break
+			case "AGENT_ONVIF_RELAY_AUTO_RESET":
+				configuration.Config.OnvifRelay.AutoReset = value
+				break
+
+			/* Chat output, the environment variables configure the first channel */
+			case "AGENT_CHAT_TYPE":
+				firstChatChannel(configuration.Config.Chat).Type = value
+				break
+			case "AGENT_CHAT_URL":
+				firstChatChannel(configuration.Config.Chat).URL = value
+				break
+			case "AGENT_CHAT_TOKEN":
+				firstChatChannel(configuration.Config.Chat).Token = value
+				break
+			case "AGENT_CHAT_CHANNEL":
+				firstChatChannel(configuration.Config.Chat).Channel = value
+				break
+			case "AGENT_CHAT_USERNAME":
+				firstChatChannel(configuration.Config.Chat).Username = value
+				break
+			case "AGENT_CHAT_SNAPSHOT":
+				firstChatChannel(configuration.Config.Chat).Snapshot = value
+				break
+			case "AGENT_CHAT_RATE_LIMIT":
+				rateLimit, err := strconv.Atoi(value)
+				if err == nil {
+					firstChatChannel(configuration.Config.Chat).RateLimit = rateLimit
+				}
+				break
+
+			/* Map lifecycle events to outputs, e.g. "recording_finished:webhook,script;motion_detected:webhook" */
+			case "AGENT_OUTPUTS":
+				var rules []*models.OutputRule
+				for _, rule := range strings.Split(value, ";") {
+					event, outputs, found := strings.Cut(rule, ":")
+					event = strings.TrimSpace(event)
+					if !found || event == "" {
+						continue
+					}
+					outputRule := &models.OutputRule{Event: event}
+					for _, output := range strings.Split(outputs, ",") {
+						if output = strings.TrimSpace(output); output != "" {
+							outputRule.Outputs = append(outputRule.Outputs, output)
+						}
+					}
+					rules = append(rules, outputRule)
+				}
+				configuration.Config.Outputs = rules
+				break
+
 			/* When encryption is enabled */
 			case "AGENT_ENCRYPTION":
 				configuration.Config.Encryption.Enabled = value
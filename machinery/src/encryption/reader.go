@@ -0,0 +1,120 @@
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"errors"
+	"io"
+)
+
+// The maximum number of bytes decrypted in one Read.
+const aesReaderChunk = 64 * 1024
+
+// AesReader decrypts content encrypted with AesEncrypt on the fly. A block of
+// AES-CBC only depends on the block before it, so the reader can seek (e.g.
+// for HTTP range requests) without decrypting what comes before.
+type AesReader struct {
+	source io.ReaderAt
+	block  cipher.Block
+	iv     []byte
+	size   int64 // The size of the decrypted content.
+	offset int64
+}
+
+// IsEncrypted tells if the content starts with the header of AesEncrypt.
+// Recordings made before encryption was enabled are not encrypted.
+func IsEncrypted(source io.ReaderAt) bool {
+	header := make([]byte, 8)
+	_, err := source.ReadAt(header, 0)
+	return err == nil && string(header) == "Salted__"
+}
+
+// NewAesReader returns a reader which decrypts the source, of size bytes,
+// with the password.
+func NewAesReader(source io.ReaderAt, size int64, password string) (*AesReader, error) {
+	header := make([]byte, 16)
+	if _, err := source.ReadAt(header, 0); err != nil || string(header[:8]) != "Salted__" {
+		return nil, errors.New("invalid crypto js aes encryption")
+	}
+	cipherSize := size - 16
+	if cipherSize <= 0 || cipherSize%aes.BlockSize != 0 {
+		return nil, errors.New("invalid crypto js aes encryption size")
+	}
+	key, iv, err := DefaultEvpKDF([]byte(password), header[8:16])
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	reader := &AesReader{source: source, block: block, iv: iv, size: cipherSize}
+
+	// The padding of the last block tells the size of the content.
+	last := make([]byte, aes.BlockSize)
+	if err := reader.decryptBlocks(last, cipherSize/aes.BlockSize-1); err != nil {
+		return nil, err
+	}
+	padding := int64(last[aes.BlockSize-1])
+	if padding == 0 || padding > aes.BlockSize {
+		return nil, errors.New("invalid padding, wrong key")
+	}
+	reader.size = cipherSize - padding
+	return reader, nil
+}
+
+// Size returns the size of the decrypted content.
+func (reader *AesReader) Size() int64 {
+	return reader.size
+}
+
+// decryptBlocks decrypts the blocks starting at block index first into dst,
+// which is a multiple of the block size.
+func (reader *AesReader) decryptBlocks(dst []byte, first int64) error {
+	iv := reader.iv
+	offset := 16 + first*aes.BlockSize
+	if first > 0 {
+		iv = make([]byte, aes.BlockSize)
+		if _, err := reader.source.ReadAt(iv, offset-aes.BlockSize); err != nil {
+			return err
+		}
+	}
+	if _, err := reader.source.ReadAt(dst, offset); err != nil {
+		return err
+	}
+	cipher.NewCBCDecrypter(reader.block, iv).CryptBlocks(dst, dst)
+	return nil
+}
+
+func (reader *AesReader) Read(p []byte) (int, error) {
+	if reader.offset >= reader.size {
+		return 0, io.EOF
+	}
+	end := min(reader.offset+int64(len(p)), reader.size, reader.offset+aesReaderChunk)
+	first := reader.offset / aes.BlockSize
+	last := (end - 1) / aes.BlockSize
+	blocks := make([]byte, (last-first+1)*aes.BlockSize)
+	if err := reader.decryptBlocks(blocks, first); err != nil {
+		return 0, err
+	}
+	n := copy(p, blocks[reader.offset-first*aes.BlockSize:end-first*aes.BlockSize])
+	reader.offset += int64(n)
+	return n, nil
+}
+
+func (reader *AesReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += reader.offset
+	case io.SeekEnd:
+		offset += reader.size
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	reader.offset = offset
+	return offset, nil
+}
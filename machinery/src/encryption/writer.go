@@ -0,0 +1,90 @@
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"io"
+)
+
+// AesWriter encrypts what is written to it as AesEncrypt does, without holding
+// the content in memory: the blocks are encrypted as they fill up, and the
+// padding is added on Close. The output can be read with AesDecrypt and
+// NewAesReader.
+type AesWriter struct {
+	destination io.Writer
+	mode        cipher.BlockMode
+	pending     []byte // The bytes of an incomplete block.
+	closed      bool
+}
+
+// NewAesWriter writes the header of the encryption with the password to the
+// destination, and returns the writer of the content.
+func NewAesWriter(destination io.Writer, password string) (*AesWriter, error) {
+	salt := make([]byte, 8)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	key, iv, err := DefaultEvpKDF([]byte(password), salt)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := destination.Write(append([]byte("Salted__"), salt...)); err != nil {
+		return nil, err
+	}
+	return &AesWriter{
+		destination: destination,
+		mode:        cipher.NewCBCEncrypter(block, iv),
+		pending:     make([]byte, 0, aesReaderChunk+aes.BlockSize),
+	}, nil
+}
+
+func (writer *AesWriter) Write(p []byte) (int, error) {
+	if writer.closed {
+		return 0, errors.New("write to a closed aes writer")
+	}
+	written := 0
+	for len(p) > 0 {
+		n := min(len(p), cap(writer.pending)-len(writer.pending))
+		writer.pending = append(writer.pending, p[:n]...)
+		p = p[n:]
+		written += n
+		if err := writer.flush(false); err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// flush encrypts and writes the complete blocks, and on the last flush the
+// padded remainder.
+func (writer *AesWriter) flush(last bool) error {
+	if last {
+		writer.pending = PKCS5Padding(writer.pending, aes.BlockSize)
+	}
+	complete := len(writer.pending) - len(writer.pending)%aes.BlockSize
+	if complete == 0 {
+		return nil
+	}
+	writer.mode.CryptBlocks(writer.pending[:complete], writer.pending[:complete])
+	if _, err := writer.destination.Write(writer.pending[:complete]); err != nil {
+		return err
+	}
+	writer.pending = append(writer.pending[:0], writer.pending[complete:]...)
+	return nil
+}
+
+// Close writes the last block, with the padding. It doesn't close the
+// destination.
+func (writer *AesWriter) Close() error {
+	if writer.closed {
+		return nil
+	}
+	writer.closed = true
+	return writer.flush(true)
+}
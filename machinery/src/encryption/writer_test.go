@@ -0,0 +1,46 @@
+package encryption
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestAesWriter(t *testing.T) {
+	for _, size := range []int{0, 15, 16, 100000, 3*aesReaderChunk + 7} {
+		content := make([]byte, size)
+		for i := range content {
+			content[i] = byte(i * 7)
+		}
+		var encrypted bytes.Buffer
+		writer, err := NewAesWriter(&encrypted, "secret")
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Written in uneven pieces, as io.Copy might.
+		for rest := content; len(rest) > 0; {
+			n := min(len(rest), 1000+len(rest)%33)
+			if _, err := writer.Write(rest[:n]); err != nil {
+				t.Fatal(err)
+			}
+			rest = rest[n:]
+		}
+		if err := writer.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		if !IsEncrypted(bytes.NewReader(encrypted.Bytes())) || IsEncrypted(bytes.NewReader(content)) {
+			t.Errorf("%d bytes: IsEncrypted() doesn't tell the encrypted content", size)
+		}
+		if decrypted, err := AesDecrypt(bytes.Clone(encrypted.Bytes()), "secret"); err != nil || !bytes.Equal(decrypted, content) {
+			t.Errorf("%d bytes: AesDecrypt() doesn't return the content: %v", size, err)
+		}
+		reader, err := NewAesReader(bytes.NewReader(encrypted.Bytes()), int64(encrypted.Len()), "secret")
+		if err != nil {
+			t.Fatalf("%d bytes: NewAesReader() error = %v", size, err)
+		}
+		if decrypted, err := io.ReadAll(reader); err != nil || !bytes.Equal(decrypted, content) {
+			t.Errorf("%d bytes: AesReader doesn't return the content: %v", size, err)
+		}
+	}
+}
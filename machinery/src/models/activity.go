@@ -0,0 +1,19 @@
+package models
+
+// ActivityHeatmap is the motion heatmap of a time range: how often motion was
+// detected in every cell of a grid laid over the frame.
+type ActivityHeatmap struct {
+	From    int64 `json:"from"` // Unix seconds.
+	To      int64 `json:"to"`
+	Columns int   `json:"columns"`
+	Rows    int   `json:"rows"`
+	Max     int   `json:"max"`
+	Cells   []int `json:"cells"` // Row by row.
+}
+
+// ActivityMinute is the motion activity of a minute of the timeline.
+type ActivityMinute struct {
+	Timestamp int64 `json:"timestamp"` // Unix seconds, the start of the minute.
+	Changes   int   `json:"changes"`   // Number of changed pixels of the motion events.
+	Events    int   `json:"events"`    // Number of motion events.
+}
@@ -46,6 +46,10 @@ type Communication struct {
 	// the live session between the main and sub stream on demand.
 	HandleLiveHLS chan string
 	HandleONVIF   chan OnvifAction
+	// HandleOutput buffers the lifecycle events (motion, recordings, uploads,
+	// disconnects) for the outputs dispatcher. Producers never block on it, see
+	// EmitOutputEvent.
+	HandleOutput  chan OutputMessage
 	IsConfiguring *abool.AtomicBool
 	// IsRecordingManual is set while a viewer has requested a manual recording
 	// from the live view (the record button). While set, the motion-based
@@ -0,0 +1,42 @@
+package models
+
+// ConditionDecision is the outcome of the conditions (see Conditions): if
+// detection and recording are enabled, and why.
+type ConditionDecision struct {
+	Valid      bool              `json:"valid"`
+	Operator   string            `json:"operator"`
+	Reason     string            `json:"reason"`
+	Timestamp  int64             `json:"timestamp"`
+	Conditions []ConditionResult `json:"conditions"`
+	// PostRecording (in seconds) and Outputs are set by the ConditionURI, see
+	// ConditionResponse.
+	PostRecording int64         `json:"postRecording,omitempty"`
+	Outputs       []*OutputRule `json:"outputs,omitempty"`
+}
+
+// ConditionResult is the outcome of a condition of the chain.
+type ConditionResult struct {
+	Type   string `json:"type"`
+	Valid  bool   `json:"valid"`
+	Reason string `json:"reason"`
+}
+
+// ConditionRequest is the body posted to the ConditionURI.
+type ConditionRequest struct {
+	CameraId   string `json:"camera_id"`
+	CameraName string `json:"camera_name"`
+	SiteId     string `json:"site_id"`
+	HubKey     string `json:"hub_key"`
+	Timestamp  string `json:"timestamp"`
+}
+
+// ConditionResponse is the (optional) body of a 200 response of the
+// ConditionURI. Record false disables recording, PostRecording overrides the
+// post-recording of the capture (in seconds, within the maximum length of a
+// recording) and Outputs are fired on top of Config.Outputs.
+type ConditionResponse struct {
+	Record        *bool         `json:"record,omitempty"`
+	PostRecording int64         `json:"post_recording,omitempty"`
+	Outputs       []*OutputRule `json:"outputs,omitempty"`
+	Reason        string        `json:"reason,omitempty"`
+}
@@ -12,44 +12,60 @@ type Configuration struct {
 // Config is the highlevel struct which contains all the configuration of
 // your Kerberos Open Source instance.
 type Config struct {
-	Type                    string       `json:"type"`
-	Key                     string       `json:"key"`
-	Name                    string       `json:"name"`
-	FriendlyName            string       `json:"friendly_name"`
-	Time                    string       `json:"time" bson:"time"`
-	Offline                 string       `json:"offline"`
-	AutoClean               string       `json:"auto_clean"`
-	RemoveAfterUpload       string       `json:"remove_after_upload"`
-	MaxDirectorySize        int64        `json:"max_directory_size"`
-	MinFreeSpace            int64        `json:"min_free_space,omitempty"`
-	Timezone                string       `json:"timezone"`
-	Capture                 Capture      `json:"capture"`
-	Timetable               []*Timetable `json:"timetable"`
-	Region                  *Region      `json:"region"`
-	Cloud                   string       `json:"cloud" bson:"cloud"`
-	S3                      *S3          `json:"s3,omitempty" bson:"s3,omitempty"`
-	KStorage                *KStorage    `json:"kstorage,omitempty" bson:"kstorage,omitempty"`
-	KStorageSecondary       *KStorage    `json:"kstorage_secondary,omitempty" bson:"kstorage_secondary,omitempty"`
-	Dropbox                 *Dropbox     `json:"dropbox,omitempty" bson:"dropbox,omitempty"`
-	MQTTURI                 string       `json:"mqtturi" bson:"mqtturi,omitempty"`
-	MQTTUsername            string       `json:"mqtt_username" bson:"mqtt_username"`
-	MQTTPassword            string       `json:"mqtt_password" bson:"mqtt_password"`
-	STUNURI                 string       `json:"stunuri" bson:"stunuri"`
-	ForceTurn               string       `json:"turn_force" bson:"turn_force"`
-	TURNURI                 string       `json:"turnuri" bson:"turnuri"`
-	TURNUsername            string       `json:"turn_username" bson:"turn_username"`
-	TURNPassword            string       `json:"turn_password" bson:"turn_password"`
-	HeartbeatURI            string       `json:"heartbeaturi" bson:"heartbeaturi"` /*obsolete*/
-	HubEncryption           string       `json:"hub_encryption" bson:"hub_encryption"`
-	HubURI                  string       `json:"hub_uri" bson:"hub_uri"`
-	HubKey                  string       `json:"hub_key" bson:"hub_key"`
-	HubPrivateKey           string       `json:"hub_private_key" bson:"hub_private_key"`
-	HubSite                 string       `json:"hub_site" bson:"hub_site"`
-	ConditionURI            string       `json:"condition_uri" bson:"condition_uri"`
-	Encryption              *Encryption  `json:"encryption,omitempty" bson:"encryption,omitempty"`
-	Signing                 *Signing     `json:"signing,omitempty" bson:"signing,omitempty"`
-	RealtimeProcessing      string       `json:"realtimeprocessing,omitempty" bson:"realtimeprocessing,omitempty"`
-	RealtimeProcessingTopic string       `json:"realtimeprocessing_topic" bson:"realtimeprocessing_topic"`
+	Type                    string                `json:"type"`
+	Key                     string                `json:"key"`
+	Name                    string                `json:"name"`
+	FriendlyName            string                `json:"friendly_name"`
+	Time                    string                `json:"time" bson:"time"`
+	Offline                 string                `json:"offline"`
+	AutoClean               string                `json:"auto_clean"`
+	RemoveAfterUpload       string                `json:"remove_after_upload"`
+	MaxDirectorySize        int64                 `json:"max_directory_size"`
+	MinFreeSpace            int64                 `json:"min_free_space,omitempty"`
+	Timezone                string                `json:"timezone"`
+	Capture                 Capture               `json:"capture"`
+	Timetable               []*Timetable          `json:"timetable"`
+	TimetableExceptions     []*TimetableException `json:"timetable_exceptions,omitempty" bson:"timetable_exceptions,omitempty"`
+	TimetableCalendar       string                `json:"timetable_calendar,omitempty" bson:"timetable_calendar,omitempty"`
+	Region                  *Region               `json:"region"`
+	Detector                *Detector             `json:"detector,omitempty" bson:"detector,omitempty"`
+	Tamper                  *Tamper               `json:"tamper,omitempty" bson:"tamper,omitempty"`
+	Cloud                   string                `json:"cloud" bson:"cloud"`
+	S3                      *S3                   `json:"s3,omitempty" bson:"s3,omitempty"`
+	KStorage                *KStorage             `json:"kstorage,omitempty" bson:"kstorage,omitempty"`
+	KStorageSecondary       *KStorage             `json:"kstorage_secondary,omitempty" bson:"kstorage_secondary,omitempty"`
+	Dropbox                 *Dropbox              `json:"dropbox,omitempty" bson:"dropbox,omitempty"`
+	FTP                     *FTP                  `json:"ftp,omitempty" bson:"ftp,omitempty"`
+	WebDAV                  *WebDAV               `json:"webdav,omitempty" bson:"webdav,omitempty"`
+	MinIO                   *MinIO                `json:"minio,omitempty" bson:"minio,omitempty"`
+	UploadTargets           []*UploadTarget       `json:"upload_targets,omitempty" bson:"upload_targets,omitempty"`
+	UploadSchedule          *UploadSchedule       `json:"upload_schedule,omitempty" bson:"upload_schedule,omitempty"`
+	Webhook                 *Webhook              `json:"webhook,omitempty" bson:"webhook,omitempty"`
+	Script                  *Script               `json:"script,omitempty" bson:"script,omitempty"`
+	OnvifRelay              *OnvifRelay           `json:"onvif_relay,omitempty" bson:"onvif_relay,omitempty"`
+	Chat                    *Chat                 `json:"chat,omitempty" bson:"chat,omitempty"`
+	Outputs                 []*OutputRule         `json:"outputs,omitempty" bson:"outputs,omitempty"`
+	MQTTURI                 string                `json:"mqtturi" bson:"mqtturi,omitempty"`
+	MQTTUsername            string                `json:"mqtt_username" bson:"mqtt_username"`
+	MQTTPassword            string                `json:"mqtt_password" bson:"mqtt_password"`
+	STUNURI                 string                `json:"stunuri" bson:"stunuri"`
+	ForceTurn               string                `json:"turn_force" bson:"turn_force"`
+	TURNURI                 string                `json:"turnuri" bson:"turnuri"`
+	TURNUsername            string                `json:"turn_username" bson:"turn_username"`
+	TURNPassword            string                `json:"turn_password" bson:"turn_password"`
+	HeartbeatURI            string                `json:"heartbeaturi" bson:"heartbeaturi"` /*obsolete*/
+	HubEncryption           string                `json:"hub_encryption" bson:"hub_encryption"`
+	HubURI                  string                `json:"hub_uri" bson:"hub_uri"`
+	HubKey                  string                `json:"hub_key" bson:"hub_key"`
+	HubPrivateKey           string                `json:"hub_private_key" bson:"hub_private_key"`
+	HubSite                 string                `json:"hub_site" bson:"hub_site"`
+	ConditionURI            string                `json:"condition_uri" bson:"condition_uri"`
+	ConditionURIOptions     *ConditionURIOptions  `json:"condition_uri_options,omitempty" bson:"condition_uri_options,omitempty"`
+	Conditions              *Conditions           `json:"conditions,omitempty" bson:"conditions,omitempty"`
+	Encryption              *Encryption           `json:"encryption,omitempty" bson:"encryption,omitempty"`
+	Signing                 *Signing              `json:"signing,omitempty" bson:"signing,omitempty"`
+	RealtimeProcessing      string                `json:"realtimeprocessing,omitempty" bson:"realtimeprocessing,omitempty"`
+	RealtimeProcessingTopic string                `json:"realtimeprocessing_topic" bson:"realtimeprocessing_topic"`
 }
 
 // Capture defines which camera type (Id) you are using (IP, USB or Raspberry Pi camera),
@@ -75,6 +91,15 @@ type Capture struct {
 	Fragmented            string      `json:"fragmented,omitempty" bson:"fragmented,omitempty"`
 	FragmentedDuration    int64       `json:"fragmentedduration,omitempty" bson:"fragmentedduration,omitempty"`
 	PixelChangeThreshold  *int        `json:"pixelChangeThreshold,omitempty"`
+	// AnalysisFPS is the number of frames per second motion detection
+	// analyses, decoding the P-frames in between keyframes with a decoder
+	// of its own. Zero (the default) analyses keyframes only. Under load
+	// the agent falls back to keyframes only for a while.
+	AnalysisFPS int `json:"analysis_fps,omitempty" bson:"analysis_fps,omitempty"`
+	// MotionAlgorithm is "framediff" (the default), comparing a frame with
+	// the two previous ones, or "background", comparing it with a running
+	// average of the frames which ignores slow and global light changes.
+	MotionAlgorithm string `json:"motion_algorithm,omitempty" bson:"motion_algorithm,omitempty"`
 	// ONVIFMotion routes the camera's ONVIF motion events into the
 	// agent's motion-triggered recording pipeline. When "true" the
 	// agent opens an event/stream against the configured ONVIF
@@ -131,9 +156,77 @@ type RaspiCamera struct {
 // Region specifies the type (Id) of Region Of Interest (ROI), you
 // would like to use.
 type Region struct {
-	Name      string    `json:"name"`
-	Rectangle Rectangle `json:"rectangle"`
-	Polygon   []Polygon `json:"polygon"`
+	Name      string          `json:"name"`
+	Rectangle Rectangle       `json:"rectangle"`
+	Polygon   []Polygon       `json:"polygon"`
+	Tripwires []Tripwire      `json:"tripwires,omitempty"`
+	Loitering []LoiteringZone `json:"loitering,omitempty"`
+}
+
+// Detector selects what triggers a recording. Type "framediff" (the default)
+// uses frame differencing only, "http" also sends the frame to a local inference
+// server at URL, once motion is detected, and only triggers on its detections
+// of Classes (e.g. person, car; all when empty) with at least MinConfidence.
+// Timeout is in milliseconds.
+type Detector struct {
+	Type          string   `json:"type,omitempty" bson:"type,omitempty"`
+	URL           string   `json:"url,omitempty" bson:"url,omitempty"`
+	Classes       []string `json:"classes,omitempty" bson:"classes,omitempty"`
+	MinConfidence float64  `json:"min_confidence,omitempty" bson:"min_confidence,omitempty"`
+	Timeout       int      `json:"timeout,omitempty" bson:"timeout,omitempty"`
+}
+
+// Tamper detection raises an event when the camera is covered, spray-painted,
+// defocused or turned. Sensitivity goes from 1 (only gross sabotage) to 100,
+// 50 by default. HoldTime is how long, in seconds, the camera has to look
+// tampered (or restored) before the event is raised, 10 by default.
+type Tamper struct {
+	Enabled     string `json:"enabled,omitempty" bson:"enabled,omitempty"`
+	Sensitivity int    `json:"sensitivity,omitempty" bson:"sensitivity,omitempty"`
+	HoldTime    int    `json:"hold_time,omitempty" bson:"hold_time,omitempty"`
+}
+
+// ConditionURIOptions tune the requests to the ConditionURI. Timeout is the
+// time a request may take and TTL the time a response is used, in seconds (5
+// and 30 by default). Policy is "closed" (the default: no recording) or
+// "open" (recording) when the ConditionURI can't be reached or fails.
+type ConditionURIOptions struct {
+	Timeout int    `json:"timeout,omitempty" bson:"timeout,omitempty"`
+	TTL     int    `json:"ttl,omitempty" bson:"ttl,omitempty"`
+	Policy  string `json:"policy,omitempty" bson:"policy,omitempty"`
+}
+
+// Conditions decide if motion is detected and recordings are made. The
+// conditions of the List are combined with Operator "and" (the default, all
+// have to be valid) or "or" (one has to be valid). Without List the time
+// window (Time and Timetable) and the ConditionURI are checked.
+type Conditions struct {
+	Operator string       `json:"operator,omitempty" bson:"operator,omitempty"`
+	List     []*Condition `json:"list,omitempty" bson:"list,omitempty"`
+}
+
+// Condition is a condition of the chain, by Type:
+//   - "timewindow": within the Timetable (when Time is enabled).
+//   - "uri": the ConditionURI allows recording, see ConditionURIOptions.
+//   - "mqtt": the last message on Topic is Value ("armed" by default).
+//   - "sun": Value "day" (the default, between sunrise and sunset) or "night"
+//     at Latitude and Longitude.
+//   - "onvif_input": the digital input with token Input of the camera is
+//     active, or inactive with Value "false".
+//   - "file": the file at Path exists, and contains Value when set.
+//   - "env": the environment variable Name is Value ("true" by default).
+//
+// Negate "true" inverts the condition.
+type Condition struct {
+	Type      string  `json:"type" bson:"type"`
+	Negate    string  `json:"negate,omitempty" bson:"negate,omitempty"`
+	Value     string  `json:"value,omitempty" bson:"value,omitempty"`
+	Topic     string  `json:"topic,omitempty" bson:"topic,omitempty"`
+	Latitude  float64 `json:"latitude,omitempty" bson:"latitude,omitempty"`
+	Longitude float64 `json:"longitude,omitempty" bson:"longitude,omitempty"`
+	Input     string  `json:"input,omitempty" bson:"input,omitempty"`
+	Path      string  `json:"path,omitempty" bson:"path,omitempty"`
+	Name      string  `json:"name,omitempty" bson:"name,omitempty"`
 }
 
 // Rectangle is defined by a starting point, left top (x1,y1) and end point (x2,y2).
@@ -146,9 +239,22 @@ type Rectangle struct {
 
 // Polygon is a sequence of coordinates (x,y). The ID specifies an unique identifier,
 // as multiple polygons can be defined.
+//
+// Every polygon is a motion zone, evaluated independently. A zone can be
+// disabled (Enabled "false"), override the pixel-change threshold of the
+// capture, require a minimum blob size (the area, in pixels, of the largest
+// cluster of changes) and only be active within its own Timetable. A polygon
+// with Exclude "true" is no zone, but an area which is ignored by every zone
+// (e.g. swaying trees, a neighbour's window or a TV screen).
 type Polygon struct {
-	ID          string       `json:"id"`
-	Coordinates []Coordinate `json:"coordinates"`
+	ID                   string       `json:"id"`
+	Name                 string       `json:"name,omitempty"`
+	Enabled              string       `json:"enabled,omitempty"`
+	Exclude              string       `json:"exclude,omitempty"`
+	PixelChangeThreshold int          `json:"pixelChangeThreshold,omitempty"`
+	MinBlobSize          int          `json:"minBlobSize,omitempty"`
+	Timetable            []*Timetable `json:"timetable,omitempty"`
+	Coordinates          []Coordinate `json:"coordinates"`
 }
 
 // Coordinate belongs to a Polygon.
@@ -157,14 +263,56 @@ type Coordinate struct {
 	Y float64 `json:"y"`
 }
 
+// Tripwire is a line, from the first to the second coordinate, which raises an
+// event when a moving object crosses it. Direction is "both" (the default),
+// "left-to-right" or "right-to-left", the sides as seen looking from the first
+// to the second coordinate. The coordinates are those of the region editor,
+// like the polygons.
+type Tripwire struct {
+	ID          string       `json:"id"`
+	Name        string       `json:"name,omitempty"`
+	Enabled     string       `json:"enabled,omitempty"`
+	Direction   string       `json:"direction,omitempty"`
+	Coordinates []Coordinate `json:"coordinates"`
+}
+
+// LoiteringZone is a polygon which raises an event when a moving object stays
+// in it for DwellTime seconds (30 by default).
+type LoiteringZone struct {
+	ID          string       `json:"id"`
+	Name        string       `json:"name,omitempty"`
+	Enabled     string       `json:"enabled,omitempty"`
+	DwellTime   int          `json:"dwellTime,omitempty"`
+	Coordinates []Coordinate `json:"coordinates"`
+}
+
 // Timetable allows you to set a Time Of Intterest (TOI), which limits recording or
 // detection to a predefined time interval. Two tracks can be set, which allows you
-// to give some flexibility.
+// to give some flexibility, and any number of further Windows.
 type Timetable struct {
-	Start1 int `json:"start1"`
-	End1   int `json:"end1"`
-	Start2 int `json:"start2"`
-	End2   int `json:"end2"`
+	Start1  int          `json:"start1"`
+	End1    int          `json:"end1"`
+	Start2  int          `json:"start2"`
+	End2    int          `json:"end2"`
+	Windows []TimeWindow `json:"windows,omitempty"`
+}
+
+// TimeWindow is an interval of a day, in seconds since midnight. A window which
+// ends before it starts crosses midnight, and ends on the next day.
+type TimeWindow struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// TimetableException replaces the timetable on Date, or from Date up to and
+// including EndDate (e.g. a holiday, a closure or a one-off event). Dates are
+// formatted as 2006-01-02, in the timezone of the agent. Without Windows there
+// is no recording that day.
+type TimetableException struct {
+	Name    string       `json:"name,omitempty"`
+	Date    string       `json:"date"`
+	EndDate string       `json:"end_date,omitempty"`
+	Windows []TimeWindow `json:"windows,omitempty"`
 }
 
 // S3 integration
@@ -197,6 +345,161 @@ type Dropbox struct {
 	Directory   string `json:"directory,omitempty" bson:"directory,omitempty"`
 }
 
+// FTP storage, used when Cloud is "ftp" (FTP, or FTPS when TLS is "explicit"
+// or "implicit") or "sftp". Host is "host[:port]". For SFTP a PrivateKey (PEM)
+// can be used instead of, or next to, the Password; HostKey is the expected
+// SHA256 fingerprint of the server ("SHA256:..."), which is required unless
+// InsecureHostKey is "true". Directory is a template, e.g.
+// "{camera}/{yyyy}/{mm}/{dd}".
+type FTP struct {
+	Host            string `json:"host,omitempty" bson:"host,omitempty"`
+	Username        string `json:"username,omitempty" bson:"username,omitempty"`
+	Password        string `json:"password,omitempty" bson:"password,omitempty"`
+	PrivateKey      string `json:"private_key,omitempty" bson:"private_key,omitempty"`
+	HostKey         string `json:"host_key,omitempty" bson:"host_key,omitempty"`
+	InsecureHostKey string `json:"insecure_host_key,omitempty" bson:"insecure_host_key,omitempty"`
+	TLS             string `json:"tls,omitempty" bson:"tls,omitempty"`
+	Directory       string `json:"directory,omitempty" bson:"directory,omitempty"`
+}
+
+// WebDAV storage, used when Cloud is "webdav". URL is the base collection,
+// e.g. "https://cloud.example.com/remote.php/dav/files/<user>". Authentication
+// uses the bearer Token when set, otherwise basic auth. Directory is a template
+// (see FTP). Recordings larger than ChunkSize (MB) are uploaded in chunks, when
+// the server is a Nextcloud.
+type WebDAV struct {
+	URL       string `json:"url,omitempty" bson:"url,omitempty"`
+	Username  string `json:"username,omitempty" bson:"username,omitempty"`
+	Password  string `json:"password,omitempty" bson:"password,omitempty"`
+	Token     string `json:"token,omitempty" bson:"token,omitempty"`
+	Directory string `json:"directory,omitempty" bson:"directory,omitempty"`
+	ChunkSize int    `json:"chunk_size,omitempty" bson:"chunk_size,omitempty"`
+}
+
+// MinIO is a generic S3-compatible storage (MinIO, AWS S3, Wasabi, Ceph, ...),
+// used when Cloud is "minio". Endpoint is "host[:port]", optionally prefixed
+// with "http://" to disable TLS. PathStyle "true" forces path-style requests,
+// "false" virtual-hosted style, empty detects it. SSE is "", "s3", "kms" (with
+// SSEKMSKeyID) or "c" (with a base64 encoded 32 byte SSECustomerKey). Key is
+// the object key template, e.g. "{camera}/{yyyy}/{mm}/{dd}/{filename}".
+// Recordings larger than PartSize (MB) are uploaded using multipart.
+type MinIO struct {
+	Endpoint       string `json:"endpoint,omitempty" bson:"endpoint,omitempty"`
+	Bucket         string `json:"bucket,omitempty" bson:"bucket,omitempty"`
+	Region         string `json:"region,omitempty" bson:"region,omitempty"`
+	AccessKey      string `json:"access_key,omitempty" bson:"access_key,omitempty"`
+	SecretKey      string `json:"secret_key,omitempty" bson:"secret_key,omitempty"`
+	PathStyle      string `json:"path_style,omitempty" bson:"path_style,omitempty"`
+	SSE            string `json:"sse,omitempty" bson:"sse,omitempty"`
+	SSEKMSKeyID    string `json:"sse_kms_key_id,omitempty" bson:"sse_kms_key_id,omitempty"`
+	SSECustomerKey string `json:"sse_customer_key,omitempty" bson:"sse_customer_key,omitempty"`
+	PartSize       int    `json:"part_size,omitempty" bson:"part_size,omitempty"`
+	Key            string `json:"key,omitempty" bson:"key,omitempty"`
+}
+
+// UploadTarget replicates recordings to one storage. When UploadTargets is
+// set, every recording is uploaded to all targets instead of only to Cloud.
+// Cloud is the backend ("kstorage", "dropbox", "ftp", "sftp", "webdav",
+// "minio", ...), its settings are taken from the main config unless they are
+// overridden on the target. A recording is only removed from the upload queue
+// once every required target has it; a target with Required "false" is best
+// effort.
+type UploadTarget struct {
+	Name     string    `json:"name" bson:"name"`
+	Cloud    string    `json:"cloud" bson:"cloud"`
+	Required string    `json:"required,omitempty" bson:"required,omitempty"`
+	KStorage *KStorage `json:"kstorage,omitempty" bson:"kstorage,omitempty"`
+	Dropbox  *Dropbox  `json:"dropbox,omitempty" bson:"dropbox,omitempty"`
+	FTP      *FTP      `json:"ftp,omitempty" bson:"ftp,omitempty"`
+	WebDAV   *WebDAV   `json:"webdav,omitempty" bson:"webdav,omitempty"`
+	MinIO    *MinIO    `json:"minio,omitempty" bson:"minio,omitempty"`
+}
+
+// UploadSchedule shapes the upload traffic, e.g. on a metered or slow uplink.
+// BandwidthLimit caps the upload rate in kbit/s (0 is unlimited). Timetable
+// restricts uploads to time windows, in the same format as the recording
+// Timetable (an entry per weekday, starting on Sunday). Order is "priority"
+// (the default: motion and manual recordings before continuous ones, newest
+// first) or "oldest" (first in, first out).
+type UploadSchedule struct {
+	BandwidthLimit int          `json:"bandwidth_limit,omitempty" bson:"bandwidth_limit,omitempty"`
+	Timetable      []*Timetable `json:"timetable,omitempty" bson:"timetable,omitempty"`
+	Order          string       `json:"order,omitempty" bson:"order,omitempty"`
+}
+
+// OutputRule binds a lifecycle event (see the OutputEvent* constants) to the
+// outputs which should be triggered when it happens, e.g. "recording_finished"
+// to ["webhook", "script"].
+type OutputRule struct {
+	Event   string   `json:"event" bson:"event"`
+	Outputs []string `json:"outputs" bson:"outputs"`
+}
+
+// Webhook output, posts a (templated) payload to one or more HTTP endpoints
+// whenever the "webhook" output is triggered. The body is signed with an
+// HMAC-SHA256 of the secret, so the receiving end can verify the origin.
+// MaxRetries is the number of retries after the first attempt.
+type Webhook struct {
+	URLs       []string          `json:"urls,omitempty" bson:"urls,omitempty"`
+	Method     string            `json:"method,omitempty" bson:"method,omitempty"`
+	Headers    map[string]string `json:"headers,omitempty" bson:"headers,omitempty"`
+	Template   string            `json:"template,omitempty" bson:"template,omitempty"`
+	Secret     string            `json:"secret,omitempty" bson:"secret,omitempty"`
+	MaxRetries int               `json:"max_retries,omitempty" bson:"max_retries,omitempty"`
+	Timeout    int               `json:"timeout,omitempty" bson:"timeout,omitempty"` // seconds
+}
+
+// Script output, runs a local executable whenever the "script" output is
+// triggered. The event is passed as environment variables and as JSON on stdin.
+// When AllowedPaths is set, only executables matching one of the entries (a
+// file, or a directory containing it) can be run. An event is dropped when
+// MaxConcurrent scripts are running already.
+type Script struct {
+	Path          string   `json:"path,omitempty" bson:"path,omitempty"`
+	Arguments     []string `json:"arguments,omitempty" bson:"arguments,omitempty"`
+	Timeout       int      `json:"timeout,omitempty" bson:"timeout,omitempty"` // seconds
+	MaxConcurrent int      `json:"max_concurrent,omitempty" bson:"max_concurrent,omitempty"`
+	AllowedPaths  []string `json:"allowed_paths,omitempty" bson:"allowed_paths,omitempty"`
+}
+
+// OnvifRelay output, switches a relay (digital output) of an ONVIF device when
+// the "onvif_relay" output is triggered. Without an XAddr the relay of this
+// camera (Capture.IPCamera) is used. The relay is activated for PulseDuration
+// and reset afterwards, unless AutoReset is "false". Triggers within Cooldown
+// of the previous activation are ignored.
+type OnvifRelay struct {
+	Token         string `json:"token,omitempty" bson:"token,omitempty"`
+	XAddr         string `json:"xaddr,omitempty" bson:"xaddr,omitempty"`
+	Username      string `json:"username,omitempty" bson:"username,omitempty"`
+	Password      string `json:"password,omitempty" bson:"password,omitempty"`
+	PulseDuration int    `json:"pulse_duration,omitempty" bson:"pulse_duration,omitempty"` // milliseconds
+	Cooldown      int    `json:"cooldown,omitempty" bson:"cooldown,omitempty"`             // seconds
+	AutoReset     string `json:"auto_reset,omitempty" bson:"auto_reset,omitempty"`
+}
+
+// Chat output, posts a message (and a snapshot) to one or more chat channels
+// when the "slack" output is triggered.
+type Chat struct {
+	Channels []*ChatChannel `json:"channels,omitempty" bson:"channels,omitempty"`
+}
+
+// ChatChannel is a single chat destination. Type is "slack" (default),
+// "mattermost" or "discord"; URL is the incoming webhook of the channel.
+// Slack incoming webhooks can't carry files, so a snapshot is only attached to
+// Slack messages when a bot Token and Channel id are configured. Mattermost
+// incoming webhooks can't either, Mattermost messages have no snapshot.
+// RateLimit is the minimum number of seconds between two messages to the
+// channel.
+type ChatChannel struct {
+	Type      string `json:"type,omitempty" bson:"type,omitempty"`
+	URL       string `json:"url,omitempty" bson:"url,omitempty"`
+	Token     string `json:"token,omitempty" bson:"token,omitempty"`
+	Channel   string `json:"channel,omitempty" bson:"channel,omitempty"`
+	Username  string `json:"username,omitempty" bson:"username,omitempty"`
+	Snapshot  string `json:"snapshot,omitempty" bson:"snapshot,omitempty"`
+	RateLimit int    `json:"rate_limit,omitempty" bson:"rate_limit,omitempty"` // seconds
+}
+
 // Encryption
 type Encryption struct {
 	Enabled      string `json:"enabled" bson:"enabled"`
@@ -0,0 +1,38 @@
+package models
+
+// The states of an Export.
+const (
+	ExportQueued    = "queued"
+	ExportRunning   = "running"
+	ExportFinished  = "finished"
+	ExportFailed    = "failed"
+	ExportCancelled = "cancelled"
+)
+
+// ExportRequest requests a clip of the recordings between Start and End.
+type ExportRequest struct {
+	Start   int64 `json:"start"` // Unix seconds.
+	End     int64 `json:"end"`   // Unix seconds.
+	Encrypt bool  `json:"encrypt,omitempty"`
+	Sign    bool  `json:"sign,omitempty"`
+}
+
+// Export is a job which stitches the recordings of a time range into a single
+// MP4, see ExportRequest.
+type Export struct {
+	ID         string   `json:"id"`
+	Status     string   `json:"status"`
+	Progress   int      `json:"progress"`             // Percentage.
+	Start      int64    `json:"start"`                // Unix seconds, as requested.
+	End        int64    `json:"end"`                  // Unix seconds, as requested.
+	ClipStart  int64    `json:"clip_start,omitempty"` // Unix milliseconds of the first frame.
+	ClipEnd    int64    `json:"clip_end,omitempty"`   // Unix milliseconds of the end of the last frame.
+	Duration   uint64   `json:"duration,omitempty"`   // Milliseconds.
+	Size       int64    `json:"size,omitempty"`
+	Recordings []string `json:"recordings,omitempty"`
+	Encrypted  bool     `json:"encrypted,omitempty"`
+	Signed     bool     `json:"signed,omitempty"`
+	Error      string   `json:"error,omitempty"`
+	Created    int64    `json:"created"`
+	Finished   int64    `json:"finished,omitempty"`
+}
@@ -9,6 +9,13 @@ type Media struct {
 	Timestamp  string `json:"timestamp"`
 	CameraName string `json:"camera_name"`
 	CameraKey  string `json:"camera_key"`
+	// Set from the recording index, see Recording.
+	Duration    uint64   `json:"duration,omitempty"`
+	Size        int64    `json:"size,omitempty"`
+	Zones       []string `json:"zones,omitempty"`
+	Labels      []string `json:"labels,omitempty"`
+	UploadState string   `json:"upload_state,omitempty"`
+	Encrypted   bool     `json:"encrypted,omitempty"`
 }
 
 type EventFilter struct {
@@ -4,6 +4,8 @@ type MotionDataPartial struct {
 	Timestamp       int64           `json:"timestamp" bson:"timestamp"`
 	NumberOfChanges int             `json:"numberOfChanges" bson:"numberOfChanges"`
 	Rectangle       MotionRectangle `json:"rectangle" bson:"rectangle"`
+	Zones           []string        `json:"zones,omitempty" bson:"zones,omitempty"`
+	Labels          []string        `json:"labels,omitempty" bson:"labels,omitempty"`
 }
 
 type MotionDataFull struct {
@@ -250,3 +250,11 @@ type TriggerRelay struct {
 	DeviceId  string `json:"device_id"` // device id
 	Token     string `json:"token"`     // token
 }
+
+// We received a request uploads request, we'll send back (a page of) the
+// upload queue. Actions on the queue use UploadQueueRequest.
+type RequestUploadsPayload struct {
+	Timestamp int64 `json:"timestamp"` // timestamp
+	Limit     int   `json:"limit"`     // maximum number of recordings, 100 by default.
+	Offset    int   `json:"offset"`
+}
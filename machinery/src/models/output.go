@@ -1,6 +1,24 @@
 package models
 
-import "time"
+import (
+	"image"
+	"slices"
+	"time"
+)
+
+// The lifecycle events which can trigger one or more outputs,
+// as configured in Config.Outputs.
+const (
+	OutputEventMotionDetected     = "motion_detected"
+	OutputEventRecordingStarted   = "recording_started"
+	OutputEventRecordingFinished  = "recording_finished"
+	OutputEventUploadFinished     = "upload_finished"
+	OutputEventCameraDisconnected = "camera_disconnected"
+	OutputEventTamperDetected     = "tamper_detected"
+	OutputEventTamperCleared      = "tamper_cleared"
+	OutputEventLineCrossed        = "line_crossed"
+	OutputEventLoiteringDetected  = "loitering_detected"
+)
 
 // The OutputMessage contains the relevant information
 // to specify the type of triggers we want to execute.
@@ -12,4 +30,86 @@ type OutputMessage struct {
 	File      string
 	CameraId  string
 	SiteId    string
+	// Rectangle is the bounding box of the motion, in the pixel space of the
+	// stream motion detection ran on (the sub stream when configured). It is
+	// only set for motion_detected, line_crossed and loitering_detected events.
+	Rectangle *MotionRectangle
+	// Zones are the names of the motion zones which fired, for
+	// motion_detected events, or of the tripwire or loitering zone.
+	Zones []string
+	// Reason is why the camera looks tampered: "covered", "defocused" or
+	// "moved", for tamper_detected events, or the direction in which a
+	// tripwire was crossed.
+	Reason string
+	// Snapshot is the frame the event was detected on, in the same pixel
+	// space as Rectangle. It is only set for motion_detected, line_crossed
+	// and loitering_detected events.
+	Snapshot image.Image
+}
+
+// OutputsForEvent returns the outputs configured for a lifecycle event, and
+// those of the policy rules: the rules the ConditionURI decided on (see
+// ConditionResponse).
+func OutputsForEvent(config Config, policy []*OutputRule, event string) []string {
+	var outputs []string
+	for _, rule := range slices.Concat(config.Outputs, policy) {
+		if rule == nil || rule.Event != event {
+			continue
+		}
+		for _, output := range rule.Outputs {
+			if !slices.Contains(outputs, output) {
+				outputs = append(outputs, output)
+			}
+		}
+	}
+	return outputs
+}
+
+// EmitOutputEvent queues an OutputMessage for the given lifecycle event on the
+// HandleOutput channel, see QueueOutputMessage.
+func EmitOutputEvent(configuration *Configuration, communication *Communication, policy []*OutputRule, event string, file string) bool {
+	message, ok := NewOutputMessage(configuration, policy, event, file)
+	if !ok {
+		return false
+	}
+	return QueueOutputMessage(communication, message)
+}
+
+// NewOutputMessage creates the OutputMessage for a lifecycle event, with the
+// outputs of the configuration and the policy rules (see OutputsForEvent). It
+// returns false when no output is configured for the event.
+func NewOutputMessage(configuration *Configuration, policy []*OutputRule, event string, file string) (OutputMessage, bool) {
+	config := configuration.Config
+	outputs := OutputsForEvent(config, policy, event)
+	if len(outputs) == 0 {
+		return OutputMessage{}, false
+	}
+	name := config.Name
+	if config.FriendlyName != "" {
+		name = config.FriendlyName
+	}
+	return OutputMessage{
+		Name:      name,
+		Outputs:   outputs,
+		Trigger:   event,
+		Timestamp: time.Now(),
+		File:      file,
+		CameraId:  config.Key,
+		SiteId:    config.HubSite,
+	}, true
+}
+
+// QueueOutputMessage puts the message on the HandleOutput channel. It never
+// blocks: the caller is usually a capture or motion loop, so when the buffer
+// is full the message is dropped and false is returned.
+func QueueOutputMessage(communication *Communication, message OutputMessage) bool {
+	if communication == nil || communication.HandleOutput == nil {
+		return false
+	}
+	select {
+	case communication.HandleOutput <- message:
+		return true
+	default:
+		return false
+	}
 }
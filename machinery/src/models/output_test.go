@@ -0,0 +1,46 @@
+package models
+
+import "testing"
+
+func TestEmitOutputEvent(t *testing.T) {
+	configuration := &Configuration{
+		Config: Config{
+			Key:          "camera1",
+			Name:         "camera",
+			FriendlyName: "front-door",
+			Outputs: []*OutputRule{
+				{Event: OutputEventRecordingFinished, Outputs: []string{"webhook"}},
+				{Event: OutputEventRecordingFinished, Outputs: []string{"script"}},
+			},
+		},
+	}
+	communication := &Communication{HandleOutput: make(chan OutputMessage, 1)}
+
+	if EmitOutputEvent(configuration, communication, nil, OutputEventMotionDetected, "") {
+		t.Fatal("unconfigured event was queued")
+	}
+	if !EmitOutputEvent(configuration, communication, nil, OutputEventRecordingFinished, "a.mp4") {
+		t.Fatal("configured event was not queued")
+	}
+	// The buffer is full now: the event must be dropped instead of blocking.
+	if EmitOutputEvent(configuration, communication, nil, OutputEventRecordingFinished, "b.mp4") {
+		t.Fatal("event was queued on a full buffer")
+	}
+
+	message := <-communication.HandleOutput
+	if message.Name != "front-door" || message.File != "a.mp4" || message.CameraId != "camera1" {
+		t.Fatalf("unexpected message: %+v", message)
+	}
+	if len(message.Outputs) != 2 || message.Outputs[0] != "webhook" || message.Outputs[1] != "script" {
+		t.Fatalf("Outputs = %v, want [webhook script]", message.Outputs)
+	}
+
+	// The policy rules add outputs, also to events which aren't configured.
+	policy := []*OutputRule{{Event: OutputEventMotionDetected, Outputs: []string{"slack"}}, {Event: OutputEventRecordingFinished, Outputs: []string{"webhook"}}}
+	if outputs := OutputsForEvent(configuration.Config, policy, OutputEventMotionDetected); len(outputs) != 1 || outputs[0] != "slack" {
+		t.Fatalf("OutputsForEvent() = %v, want [slack]", outputs)
+	}
+	if outputs := OutputsForEvent(configuration.Config, policy, OutputEventRecordingFinished); len(outputs) != 2 {
+		t.Fatalf("OutputsForEvent() = %v, want [webhook script]", outputs)
+	}
+}
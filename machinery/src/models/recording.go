@@ -0,0 +1,57 @@
+package models
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// The upload states of a Recording.
+const (
+	RecordingUploadPending   = "pending"
+	RecordingUploadFinished  = "uploaded"
+	RecordingUploadCancelled = "cancelled"
+)
+
+// Recording is an entry of the recording index, see the recordings package.
+type Recording struct {
+	Key             string   `json:"key"`
+	Timestamp       int64    `json:"timestamp"`          // Unix milliseconds, the start of the recording.
+	Duration        uint64   `json:"duration,omitempty"` // Milliseconds.
+	Size            int64    `json:"size"`
+	Region          string   `json:"region,omitempty"` // The motion rectangle, as x-y-width-height.
+	NumberOfChanges int      `json:"number_of_changes,omitempty"`
+	Zones           []string `json:"zones,omitempty"`
+	Labels          []string `json:"labels,omitempty"`
+	UploadState     string   `json:"upload_state,omitempty"`
+	Encrypted       bool     `json:"encrypted,omitempty"`
+}
+
+// ParseRecordingName reads the metadata in the name of a recording:
+// timestamp_length-milliseconds_name_region_changes_duration.mp4, e.g.
+// 1564859471_3-474_oprit_577-283-727-375_1153_27000.mp4.
+func ParseRecordingName(key string) (Recording, bool) {
+	fileParts := strings.Split(strings.TrimSuffix(key, ".mp4"), "_")
+	if len(fileParts) != 6 {
+		return Recording{}, false
+	}
+	seconds, err := strconv.ParseInt(fileParts[0], 10, 64)
+	if err != nil {
+		return Recording{}, false
+	}
+	recording := Recording{Key: key, Timestamp: seconds * 1000, Region: fileParts[3]}
+
+	// Older agents stored microseconds, the length tells.
+	if _, fraction, ok := strings.Cut(fileParts[1], "-"); ok {
+		if value, err := strconv.ParseInt(fraction, 10, 64); err == nil && len(fraction) > 0 {
+			recording.Timestamp += value / int64(math.Pow10(max(len(fraction)-3, 0)))
+		}
+	}
+	if changes, err := strconv.Atoi(fileParts[4]); err == nil {
+		recording.NumberOfChanges = changes
+	}
+	if duration, err := strconv.ParseUint(fileParts[5], 10, 64); err == nil {
+		recording.Duration = duration
+	}
+	return recording, true
+}
@@ -11,11 +11,13 @@ const RecordingUploadMetadataExtension = ".metadata"
 // with a recording. New optional fields can be added without changing the queue
 // mechanism or breaking older agents.
 type RecordingUploadMetadata struct {
-	FileName  string  `json:"filename"`
-	DeviceKey string  `json:"device_key"`
-	Timestamp int64   `json:"timestamp"` // Unix milliseconds.
-	Duration  uint64  `json:"duration"`  // Milliseconds.
-	FPS       float64 `json:"fps,omitempty"`
+	FileName  string   `json:"filename"`
+	DeviceKey string   `json:"device_key"`
+	Timestamp int64    `json:"timestamp"` // Unix milliseconds.
+	Duration  uint64   `json:"duration"`  // Milliseconds.
+	FPS       float64  `json:"fps,omitempty"`
+	Zones     []string `json:"zones,omitempty"`  // Motion zones which fired.
+	Labels    []string `json:"labels,omitempty"` // Objects which were detected.
 }
 
 // RecordingUploadMetadataFileName returns the queue marker name associated
@@ -0,0 +1,62 @@
+package models
+
+// The states of a recording for one upload target.
+const (
+	UploadTargetPending  = "pending"
+	UploadTargetUploaded = "uploaded"
+	UploadTargetFailed   = "failed"  // a best effort target gave up
+	UploadTargetSkipped  = "skipped" // the target is not configured
+)
+
+// UploadTargetMarker is the upload state of one recording for one upload
+// target. It is persisted next to the queue marker of the recording, so a
+// restart doesn't upload a recording twice to a target which already has it.
+type UploadTargetMarker struct {
+	Target      string `json:"target"`
+	FileName    string `json:"filename"`
+	Status      string `json:"status"`
+	Attempts    int    `json:"attempts"`
+	LastAttempt int64  `json:"last_attempt,omitempty"` // Unix seconds.
+	LastError   string `json:"last_error,omitempty"`
+}
+
+// UploadTargetStatus summarises an upload target, as shown on the dashboard.
+type UploadTargetStatus struct {
+	Name        string `json:"name"`
+	Cloud       string `json:"cloud"`
+	Required    bool   `json:"required"`
+	Pending     int    `json:"pending"`
+	Uploaded    int    `json:"uploaded"` // Since the agent started.
+	Failures    int    `json:"failures"` // Consecutive failed attempts.
+	LastError   string `json:"last_error,omitempty"`
+	LastSuccess int64  `json:"last_success,omitempty"` // Unix seconds.
+	RetryAt     int64  `json:"retry_at,omitempty"`     // Unix seconds, while backing off.
+}
+
+// UploadQueueEntry describes a recording waiting in the upload queue.
+type UploadQueueEntry struct {
+	FileName  string               `json:"filename"`
+	Size      int64                `json:"size"`      // Bytes, 0 when the recording is gone.
+	QueuedAt  int64                `json:"queued_at"` // Unix seconds.
+	Age       int64                `json:"age"`       // Seconds.
+	Status    string               `json:"status"`    // "pending" or "backing_off".
+	Attempts  int                  `json:"attempts"`
+	LastError string               `json:"last_error,omitempty"`
+	RetryAt   int64                `json:"retry_at,omitempty"` // Unix seconds.
+	Targets   []UploadTargetMarker `json:"targets"`
+}
+
+// UploadQueueRequest selects the recordings a queue action (retry, cancel or
+// requeue) applies to, over the API or MQTT. All selects the whole queue.
+type UploadQueueRequest struct {
+	Timestamp int64    `json:"timestamp,omitempty"`
+	FileNames []string `json:"filenames"`
+	All       bool     `json:"all,omitempty"`
+}
+
+// UploadQueueResult is the outcome of a queue action for one recording.
+type UploadQueueResult struct {
+	FileName string `json:"filename"`
+	Success  bool   `json:"success"`
+	Error    string `json:"error,omitempty"`
+}
@@ -1335,25 +1335,14 @@ func TriggerRelayOutput(dev *onvif.Device, output string) (err error) {
 	// However in theory there might be multiple outputs. We might need to change
 	// this in the future "kerberos-io/onvif" library.
 	if err == nil {
+		if len(relayoutputs.RelayOutputs) == 0 {
+			err = errors.New("device has no relay outputs")
+			log.Log.Error("onvif.main.TriggerRelayOutput(): " + err.Error())
+			return
+		}
 		token := relayoutputs.RelayOutputs[0].Token
 		if output == string(token+"-output") {
-			outputState := device.SetRelayOutputState{
-				RelayOutputToken: token,
-				LogicalState:     "active",
-			}
-
-			resp, errResp := dev.CallMethod(outputState)
-			var b []byte
-			if errResp != nil {
-				b, err = io.ReadAll(resp.Body)
-				resp.Body.Close() // Ensure the response body is closed
-			}
-			stringBody := string(b)
-			if err == nil && resp.StatusCode == 200 {
-				log.Log.Info("onvif.main.TriggerRelayOutput(): triggered relay output (" + string(token) + ")")
-			} else {
-				log.Log.Error("onvif.main.TriggerRelayOutput(): " + stringBody)
-			}
+			err = SetRelayOutputState(dev, string(token), "active")
 		} else {
 			log.Log.Error("onvif.main.TriggerRelayOutput(): could not find relay output (" + output + ")")
 		}
@@ -1363,6 +1352,33 @@ func TriggerRelayOutput(dev *onvif.Device, output string) (err error) {
 	return
 }
 
+// SetRelayOutputState sets the logical state ("active" or "inactive") of the
+// relay output with the given token.
+func SetRelayOutputState(dev *onvif.Device, token string, state string) error {
+	outputState := device.SetRelayOutputState{
+		RelayOutputToken: xsdonvif.ReferenceToken(token),
+		LogicalState:     xsdonvif.RelayLogicalState(state),
+	}
+
+	resp, err := dev.CallMethod(outputState)
+	if err != nil {
+		log.Log.Error("onvif.main.SetRelayOutputState(): " + err.Error())
+		return err
+	}
+	b, err := io.ReadAll(resp.Body)
+	resp.Body.Close() // Ensure the response body is closed
+	if err != nil {
+		log.Log.Error("onvif.main.SetRelayOutputState(): " + err.Error())
+		return err
+	}
+	if resp.StatusCode != 200 {
+		log.Log.Error("onvif.main.SetRelayOutputState(): " + string(b))
+		return errors.New("could not set relay output (" + token + ") to " + state + ": " + resp.Status)
+	}
+	log.Log.Info("onvif.main.SetRelayOutputState(): relay output (" + token + ") is " + state)
+	return nil
+}
+
 func getXMLNode(xmlBody string, nodeName string) (*xml.Decoder, *xml.StartElement, error) {
 	xmlBytes := bytes.NewBufferString(xmlBody)
 	decodedXML := xml.NewDecoder(xmlBytes)
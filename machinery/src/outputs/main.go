@@ -1,23 +1,60 @@
 package outputs
 
 import (
+	"time"
+
+	"github.com/kerberos-io/agent/machinery/src/capture"
 	"github.com/kerberos-io/agent/machinery/src/log"
 	"github.com/kerberos-io/agent/machinery/src/models"
 )
 
+// outputPayload is the JSON representation of an OutputMessage, as it is
+// handed to external integrations (webhook body, script stdin).
+type outputPayload struct {
+	Name      string   `json:"name"`
+	Trigger   string   `json:"trigger"`
+	Timestamp int64    `json:"timestamp"`
+	File      string   `json:"file"`
+	CameraId  string   `json:"camera_id"`
+	SiteId    string   `json:"site_id"`
+	Zones     []string `json:"zones,omitempty"`
+	Reason    string   `json:"reason,omitempty"`
+}
+
+func newOutputPayload(message *models.OutputMessage) outputPayload {
+	return outputPayload{
+		Name:      message.Name,
+		Trigger:   message.Trigger,
+		Timestamp: message.Timestamp.Unix(),
+		File:      message.File,
+		CameraId:  message.CameraId,
+		SiteId:    message.SiteId,
+		Zones:     message.Zones,
+		Reason:    message.Reason,
+	}
+}
+
+// outputWorkers is the number of lifecycle events handled concurrently, so a
+// slow endpoint (e.g. a webhook being retried) doesn't hold back other events.
+const outputWorkers = 4
+
 type Output interface {
 	// Triggers the integration
-	Trigger(message models.OutputMessage) error
+	Trigger(message *models.OutputMessage) error
 }
 
-func Execute(message *models.OutputMessage) (err error) {
+func Execute(configDirectory string, configuration *models.Configuration, communication *models.Communication, captureDevice *capture.Capture, message *models.OutputMessage) (err error) {
 	err = nil
 
 	outputs := message.Outputs
 	for _, output := range outputs {
 		switch output {
-		case "slack":
-			slack := &SlackOutput{}
+		case "slack", "chat":
+			slack := &SlackOutput{
+				Configuration: configuration,
+				Communication: communication,
+				CaptureDevice: captureDevice,
+			}
 			err := slack.Trigger(message)
 			if err == nil {
 				log.Log.Debug("outputs.main.Execute(slack): message was processed by output.")
@@ -26,7 +63,10 @@ func Execute(message *models.OutputMessage) (err error) {
 			}
 			break
 		case "webhook":
-			webhook := &WebhookOutput{}
+			webhook := &WebhookOutput{
+				ConfigDirectory: configDirectory,
+				Configuration:   configuration,
+			}
 			err := webhook.Trigger(message)
 			if err == nil {
 				log.Log.Debug("outputs.main.Execute(webhook): message was processed by output.")
@@ -35,7 +75,9 @@ func Execute(message *models.OutputMessage) (err error) {
 			}
 			break
 		case "onvif_relay":
-			onvif := &OnvifRelayOutput{}
+			onvif := &OnvifRelayOutput{
+				Configuration: configuration,
+			}
 			err := onvif.Trigger(message)
 			if err == nil {
 				log.Log.Debug("outputs.main.Execute(onvif): message was processed by output.")
@@ -44,7 +86,9 @@ func Execute(message *models.OutputMessage) (err error) {
 			}
 			break
 		case "script":
-			script := &ScriptOutput{}
+			script := &ScriptOutput{
+				Configuration: configuration,
+			}
 			err := script.Trigger(message)
 			if err == nil {
 				log.Log.Debug("outputs.main.Execute(script): message was processed by output.")
@@ -57,3 +101,20 @@ func Execute(message *models.OutputMessage) (err error) {
 
 	return err
 }
+
+// HandleOutputs dispatches the lifecycle events queued on the HandleOutput
+// channel (see models.EmitOutputEvent) to the configured outputs. The channel
+// is buffered and producers never block on it, so the capture, motion and
+// upload loops are not slowed down by the outputs.
+func HandleOutputs(configDirectory string, configuration *models.Configuration, communication *models.Communication, captureDevice *capture.Capture) {
+	log.Log.Debug("outputs.main.HandleOutputs(): started")
+	for i := 0; i < outputWorkers; i++ {
+		go func() {
+			for message := range communication.HandleOutput {
+				start := time.Now()
+				Execute(configDirectory, configuration, communication, captureDevice, &message)
+				log.Log.Debug("outputs.main.HandleOutputs(): handled " + message.Trigger + " in " + time.Since(start).Round(time.Millisecond).String())
+			}
+		}()
+	}
+}
@@ -1,12 +1,135 @@
 package outputs
 
-import "github.com/kerberos-io/agent/machinery/src/models"
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"time"
 
+	"github.com/kerberos-io/agent/machinery/src/log"
+	"github.com/kerberos-io/agent/machinery/src/models"
+	"github.com/kerberos-io/agent/machinery/src/onvif"
+)
+
+const onvifRelayDefaultPulseDuration = time.Second
+
+// relaySwitch sets the logical state ("active" or "inactive") of a relay.
+type relaySwitch func(state string) error
+
+// connectRelay connects to the ONVIF device and returns a switch for the relay
+// with the given token. It is a package variable so tests can replace it.
+var connectRelay = func(camera *models.IPCamera, token string) (relaySwitch, error) {
+	dev, _, err := onvif.ConnectToOnvifDevice(camera)
+	if err != nil {
+		return nil, err
+	}
+	return func(state string) error {
+		return onvif.SetRelayOutputState(dev, token, state)
+	}, nil
+}
+
+// onvifRelayState keeps track of a relay across triggers, so the cooldown and
+// the pending reset are shared by all events driving the same relay. The
+// mutex serialises the (blocking) ONVIF calls to the relay; lastActivation is
+// guarded by onvifRelaysMutex, so a cooldown check never waits for a device.
+type onvifRelayState struct {
+	mutex          sync.Mutex
+	lastActivation time.Time
+	reset          *time.Timer
+}
+
+var (
+	onvifRelaysMutex sync.Mutex
+	onvifRelays      = map[string]*onvifRelayState{}
+)
+
+// coolingDown tells if the relay was activated less than cooldown ago.
+func (state *onvifRelayState) coolingDown(cooldown time.Duration) bool {
+	onvifRelaysMutex.Lock()
+	defer onvifRelaysMutex.Unlock()
+	return cooldown > 0 && !state.lastActivation.IsZero() && time.Since(state.lastActivation) < cooldown
+}
+
+// OnvifRelayOutput switches the relay configured in config.OnvifRelay, e.g. to
+// turn on floodlights or a siren wired to the I/O port of a camera.
 type OnvifRelayOutput struct {
 	Output
+	Configuration *models.Configuration
 }
 
 func (o *OnvifRelayOutput) Trigger(message *models.OutputMessage) (err error) {
-	err = nil
-	return err
+	if o.Configuration == nil || o.Configuration.Config.OnvifRelay == nil || o.Configuration.Config.OnvifRelay.Token == "" {
+		return errors.New("onvif relay not properly configured")
+	}
+	relay := o.Configuration.Config.OnvifRelay
+
+	// Use the credentials of this camera, unless another device is configured.
+	camera := o.Configuration.Config.Capture.IPCamera
+	if relay.XAddr != "" {
+		camera = models.IPCamera{
+			ONVIFXAddr:    relay.XAddr,
+			ONVIFUsername: relay.Username,
+			ONVIFPassword: relay.Password,
+		}
+	}
+	if camera.ONVIFXAddr == "" {
+		return errors.New("onvif relay has no device address")
+	}
+
+	pulse := onvifRelayDefaultPulseDuration
+	if relay.PulseDuration > 0 {
+		pulse = time.Duration(relay.PulseDuration) * time.Millisecond
+	}
+	cooldown := time.Duration(relay.Cooldown) * time.Second
+
+	key := camera.ONVIFXAddr + "/" + relay.Token
+	onvifRelaysMutex.Lock()
+	state, ok := onvifRelays[key]
+	if !ok {
+		state = &onvifRelayState{}
+		onvifRelays[key] = state
+	}
+	onvifRelaysMutex.Unlock()
+	if state.coolingDown(cooldown) {
+		log.Log.Debug("outputs.onvif_relay.Trigger(): relay " + relay.Token + " is cooling down, ignoring " + message.Trigger)
+		return nil
+	}
+
+	// Only triggers of the same relay wait for each other, an unreachable
+	// device doesn't hold up the other relays.
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+	if state.coolingDown(cooldown) {
+		return nil
+	}
+	setState, err := connectRelay(&camera, relay.Token)
+	if err != nil {
+		return errors.New("could not connect to " + camera.ONVIFXAddr + ": " + err.Error())
+	}
+	if err := setState("active"); err != nil {
+		return err
+	}
+	onvifRelaysMutex.Lock()
+	state.lastActivation = time.Now()
+	onvifRelaysMutex.Unlock()
+	log.Log.Info("outputs.onvif_relay.Trigger(): activated relay " + relay.Token + " on " + camera.ONVIFXAddr + " for " + strconv.FormatInt(pulse.Milliseconds(), 10) + "ms")
+
+	if relay.AutoReset == "false" {
+		return nil
+	}
+
+	// A new activation during the pulse extends it, rather than resetting the
+	// relay halfway through.
+	if state.reset != nil {
+		state.reset.Stop()
+	}
+	token := relay.Token
+	state.reset = time.AfterFunc(pulse, func() {
+		state.mutex.Lock()
+		defer state.mutex.Unlock()
+		if err := setState("inactive"); err != nil {
+			log.Log.Error("outputs.onvif_relay.Trigger(): could not reset relay " + token + ": " + err.Error())
+		}
+	})
+	return nil
 }
@@ -0,0 +1,141 @@
+package outputs
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kerberos-io/agent/machinery/src/models"
+)
+
+// fakeRelay records the states set through connectRelay.
+type fakeRelay struct {
+	mutex  sync.Mutex
+	states []string
+}
+
+func (f *fakeRelay) recorded() []string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return append([]string(nil), f.states...)
+}
+
+func withFakeRelay(t *testing.T) *fakeRelay {
+	t.Helper()
+	relay := &fakeRelay{}
+	previous := connectRelay
+	connectRelay = func(camera *models.IPCamera, token string) (relaySwitch, error) {
+		return func(state string) error {
+			relay.mutex.Lock()
+			defer relay.mutex.Unlock()
+			relay.states = append(relay.states, state)
+			return nil
+		}, nil
+	}
+	t.Cleanup(func() {
+		connectRelay = previous
+		onvifRelaysMutex.Lock()
+		onvifRelays = map[string]*onvifRelayState{}
+		onvifRelaysMutex.Unlock()
+	})
+	return relay
+}
+
+func TestOnvifRelayTriggerPulsesAndResets(t *testing.T) {
+	fake := withFakeRelay(t)
+
+	output := &OnvifRelayOutput{
+		Configuration: &models.Configuration{Config: models.Config{
+			Capture:    models.Capture{IPCamera: models.IPCamera{ONVIFXAddr: "192.168.1.10:80"}},
+			OnvifRelay: &models.OnvifRelay{Token: "relay1", PulseDuration: 20},
+		}},
+	}
+	if err := output.Trigger(testOutputMessage()); err != nil {
+		t.Fatalf("Trigger() error = %v", err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for len(fake.recorded()) < 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	states := fake.recorded()
+	if len(states) != 2 || states[0] != "active" || states[1] != "inactive" {
+		t.Fatalf("states = %v, want [active inactive]", states)
+	}
+}
+
+func TestOnvifRelayTriggerCooldown(t *testing.T) {
+	fake := withFakeRelay(t)
+
+	output := &OnvifRelayOutput{
+		Configuration: &models.Configuration{Config: models.Config{
+			Capture:    models.Capture{IPCamera: models.IPCamera{ONVIFXAddr: "192.168.1.10:80"}},
+			OnvifRelay: &models.OnvifRelay{Token: "relay1", Cooldown: 60, AutoReset: "false"},
+		}},
+	}
+	for i := 0; i < 3; i++ {
+		if err := output.Trigger(testOutputMessage()); err != nil {
+			t.Fatalf("Trigger() error = %v", err)
+		}
+	}
+	if states := fake.recorded(); len(states) != 1 || states[0] != "active" {
+		t.Fatalf("states = %v, want a single activation", states)
+	}
+}
+
+func TestOnvifRelayTriggerUnreachableDevice(t *testing.T) {
+	fake := withFakeRelay(t)
+	working := connectRelay
+	unblock := make(chan struct{})
+	connectRelay = func(camera *models.IPCamera, token string) (relaySwitch, error) {
+		if camera.ONVIFXAddr == "192.168.1.99:80" {
+			<-unblock
+		}
+		return working(camera, token)
+	}
+	var stuckDone sync.WaitGroup
+	defer func() {
+		close(unblock)
+		stuckDone.Wait()
+	}()
+
+	stuck := &models.Configuration{Config: models.Config{
+		Capture:    models.Capture{IPCamera: models.IPCamera{ONVIFXAddr: "192.168.1.99:80"}},
+		OnvifRelay: &models.OnvifRelay{Token: "relay1", AutoReset: "false"},
+	}}
+	stuckDone.Add(1)
+	go func() {
+		defer stuckDone.Done()
+		(&OnvifRelayOutput{Configuration: stuck}).Trigger(testOutputMessage())
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	// A relay of another device is switched while the first one hangs.
+	done := make(chan error, 1)
+	go func() {
+		done <- (&OnvifRelayOutput{
+			Configuration: &models.Configuration{Config: models.Config{
+				Capture:    models.Capture{IPCamera: models.IPCamera{ONVIFXAddr: "192.168.1.10:80"}},
+				OnvifRelay: &models.OnvifRelay{Token: "relay1", AutoReset: "false"},
+			}},
+		}).Trigger(testOutputMessage())
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Trigger() error = %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Trigger() waited for the unreachable device")
+	}
+	if states := fake.recorded(); len(states) != 1 || states[0] != "active" {
+		t.Fatalf("states = %v, want a single activation", states)
+	}
+}
+
+func TestOnvifRelayTriggerNotConfigured(t *testing.T) {
+	output := &OnvifRelayOutput{Configuration: &models.Configuration{}}
+	if err := output.Trigger(testOutputMessage()); err == nil {
+		t.Fatal("Trigger() error = nil, want an error")
+	}
+}
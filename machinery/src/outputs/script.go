@@ -1,12 +1,207 @@
 package outputs
 
-import "github.com/kerberos-io/agent/machinery/src/models"
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/kerberos-io/agent/machinery/src/log"
+	"github.com/kerberos-io/agent/machinery/src/models"
+)
+
+const (
+	scriptDefaultTimeout       = 30 * time.Second
+	scriptDefaultMaxConcurrent = 2
+	// scriptOutputLimit is the number of bytes of stdout and stderr that is
+	// kept (and logged) per stream, the rest is discarded.
+	scriptOutputLimit = 4 * 1024
+)
+
+// scriptSlots limits the number of scripts running at the same time. It is
+// shared by all triggers and (re)created when the configured limit changes.
+var (
+	scriptSlotsMutex sync.Mutex
+	scriptSlots      chan struct{}
+)
+
+// ScriptOutput runs the executable configured in config.Script. The message is
+// passed as KERBEROS_* environment variables and as JSON on stdin; stdout and
+// stderr are forwarded to the agent log.
 type ScriptOutput struct {
 	Output
+	Configuration *models.Configuration
 }
 
 func (scr *ScriptOutput) Trigger(message *models.OutputMessage) (err error) {
-	err = nil
-	return err
+	if scr.Configuration == nil || scr.Configuration.Config.Script == nil || scr.Configuration.Config.Script.Path == "" {
+		return errors.New("script not properly configured")
+	}
+	script := scr.Configuration.Config.Script
+
+	path, err := resolveScriptPath(script.Path, script.AllowedPaths)
+	if err != nil {
+		return err
+	}
+
+	stdin, err := json.Marshal(newOutputPayload(message))
+	if err != nil {
+		return err
+	}
+
+	timeout := scriptDefaultTimeout
+	if script.Timeout > 0 {
+		timeout = time.Duration(script.Timeout) * time.Second
+	}
+
+	// A burst of events can't fork an unbounded number of processes on the
+	// edge device, nor hold back the other outputs: without a free slot the
+	// event is dropped.
+	slots := acquireScriptSlots(script.MaxConcurrent)
+	select {
+	case slots <- struct{}{}:
+		defer func() { <-slots }()
+	default:
+		log.Log.Warning("outputs.script.Trigger(): " + strconv.Itoa(cap(slots)) + " script(s) running already, not running " + path + " for " + message.Trigger)
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, path, script.Arguments...)
+	cmd.Env = append(os.Environ(), scriptEnvironment(message)...)
+	cmd.Stdin = bytes.NewReader(stdin)
+	stdout := &limitedBuffer{limit: scriptOutputLimit}
+	stderr := &limitedBuffer{limit: scriptOutputLimit}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	// A script that forks children keeps the output pipes open after it was
+	// killed; stop waiting for them shortly after the timeout.
+	cmd.WaitDelay = time.Second
+
+	start := time.Now()
+	err = cmd.Run()
+	logScriptOutput(path, "stdout", stdout)
+	logScriptOutput(path, "stderr", stderr)
+
+	if ctx.Err() == context.DeadlineExceeded {
+		return errors.New(path + " timed out after " + timeout.String())
+	}
+	if err != nil {
+		return errors.New(path + " failed: " + err.Error())
+	}
+	log.Log.Info("outputs.script.Trigger(): " + path + " finished in " + time.Since(start).Round(time.Millisecond).String())
+	return nil
+}
+
+// resolveScriptPath returns the absolute, symlink-free path of the script and
+// verifies it against the allow-list. An allow-list entry matches the script
+// itself or any directory containing it. An empty allow-list allows any path.
+func resolveScriptPath(path string, allowedPaths []string) (string, error) {
+	resolved, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	if evaluated, err := filepath.EvalSymlinks(resolved); err == nil {
+		resolved = evaluated
+	} else {
+		return "", errors.New("script " + path + " not found: " + err.Error())
+	}
+
+	if len(allowedPaths) == 0 {
+		return resolved, nil
+	}
+	for _, allowed := range allowedPaths {
+		allowed = strings.TrimSpace(allowed)
+		if allowed == "" {
+			continue
+		}
+		allowedResolved, err := filepath.Abs(allowed)
+		if err != nil {
+			continue
+		}
+		if evaluated, err := filepath.EvalSymlinks(allowedResolved); err == nil {
+			allowedResolved = evaluated
+		}
+		if resolved == allowedResolved {
+			return resolved, nil
+		}
+		if relative, err := filepath.Rel(allowedResolved, resolved); err == nil && relative != ".." && !strings.HasPrefix(relative, ".."+string(filepath.Separator)) {
+			return resolved, nil
+		}
+	}
+	return "", errors.New("script " + path + " is not in the list of allowed paths")
+}
+
+// acquireScriptSlots returns the semaphore for the given concurrency limit.
+func acquireScriptSlots(maxConcurrent int) chan struct{} {
+	if maxConcurrent <= 0 {
+		maxConcurrent = scriptDefaultMaxConcurrent
+	}
+	scriptSlotsMutex.Lock()
+	defer scriptSlotsMutex.Unlock()
+	if scriptSlots == nil || cap(scriptSlots) != maxConcurrent {
+		scriptSlots = make(chan struct{}, maxConcurrent)
+	}
+	return scriptSlots
+}
+
+func scriptEnvironment(message *models.OutputMessage) []string {
+	return []string{
+		"KERBEROS_NAME=" + message.Name,
+		"KERBEROS_TRIGGER=" + message.Trigger,
+		"KERBEROS_TIMESTAMP=" + strconv.FormatInt(message.Timestamp.Unix(), 10),
+		"KERBEROS_FILE=" + message.File,
+		"KERBEROS_CAMERA_ID=" + message.CameraId,
+		"KERBEROS_SITE_ID=" + message.SiteId,
+		"KERBEROS_ZONES=" + strings.Join(message.Zones, ","),
+		"KERBEROS_REASON=" + message.Reason,
+	}
+}
+
+// limitedBuffer keeps the first limit bytes written to it and discards the
+// rest, without failing the writes, so a chatty script isn't killed by a
+// broken pipe.
+type limitedBuffer struct {
+	bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.Len(); room < len(p) {
+		b.truncated = true
+		if room > 0 {
+			b.Buffer.Write(p[:room])
+		}
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
+}
+
+func logScriptOutput(path string, stream string, output *limitedBuffer) {
+	if output.truncated {
+		log.Log.Warning("outputs.script.Trigger(" + filepath.Base(path) + "): " + stream + " truncated to " + strconv.Itoa(output.limit) + " bytes")
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(output.Bytes()))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		if stream == "stderr" {
+			log.Log.Warning("outputs.script.Trigger(" + filepath.Base(path) + "): " + line)
+		} else {
+			log.Log.Info("outputs.script.Trigger(" + filepath.Base(path) + "): " + line)
+		}
+	}
 }
@@ -0,0 +1,127 @@
+package outputs
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/kerberos-io/agent/machinery/src/models"
+)
+
+// writeScript creates an executable shell script in a temporary directory.
+func writeScript(t *testing.T, content string) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("shell scripts are not supported on windows")
+	}
+	path := filepath.Join(t.TempDir(), "action.sh")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+content), 0o755); err != nil {
+		t.Fatalf("write script: %v", err)
+	}
+	return path
+}
+
+func TestScriptTriggerPassesEnvironmentAndStdin(t *testing.T) {
+	result := filepath.Join(t.TempDir(), "result")
+	path := writeScript(t, `echo "$KERBEROS_TRIGGER $KERBEROS_CAMERA_ID" > "$1"; cat >> "$1"`)
+
+	script := &ScriptOutput{
+		Configuration: &models.Configuration{Config: models.Config{Script: &models.Script{Path: path, Arguments: []string{result}}}},
+	}
+	if err := script.Trigger(testOutputMessage()); err != nil {
+		t.Fatalf("Trigger() error = %v", err)
+	}
+
+	contents, err := os.ReadFile(result)
+	if err != nil {
+		t.Fatalf("read result: %v", err)
+	}
+	lines := strings.SplitN(string(contents), "\n", 2)
+	if lines[0] != "motion camera1" {
+		t.Fatalf("environment = %q, want %q", lines[0], "motion camera1")
+	}
+	var payload outputPayload
+	if err := json.Unmarshal([]byte(lines[1]), &payload); err != nil {
+		t.Fatalf("stdin is not valid JSON: %v (%s)", err, lines[1])
+	}
+	if payload.File != testOutputMessage().File {
+		t.Fatalf("payload.File = %q, want %q", payload.File, testOutputMessage().File)
+	}
+}
+
+func TestScriptTriggerTimeout(t *testing.T) {
+	path := writeScript(t, "sleep 5")
+
+	script := &ScriptOutput{
+		Configuration: &models.Configuration{Config: models.Config{Script: &models.Script{Path: path, Timeout: 1}}},
+	}
+	err := script.Trigger(testOutputMessage())
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Fatalf("Trigger() error = %v, want a timeout", err)
+	}
+}
+
+func TestScriptTriggerFailingScript(t *testing.T) {
+	path := writeScript(t, "echo oops >&2; exit 3")
+
+	script := &ScriptOutput{
+		Configuration: &models.Configuration{Config: models.Config{Script: &models.Script{Path: path}}},
+	}
+	if err := script.Trigger(testOutputMessage()); err == nil {
+		t.Fatal("Trigger() error = nil, want an error")
+	}
+}
+
+func TestScriptTriggerDropsEventWithoutFreeSlot(t *testing.T) {
+	result := filepath.Join(t.TempDir(), "result")
+	path := writeScript(t, `touch "$1"`)
+
+	slots := acquireScriptSlots(1)
+	slots <- struct{}{}
+	defer func() { <-slots }()
+
+	script := &ScriptOutput{
+		Configuration: &models.Configuration{Config: models.Config{Script: &models.Script{Path: path, Arguments: []string{result}, MaxConcurrent: 1}}},
+	}
+	if err := script.Trigger(testOutputMessage()); err != nil {
+		t.Fatalf("Trigger() error = %v", err)
+	}
+	if _, err := os.Stat(result); !os.IsNotExist(err) {
+		t.Fatalf("the script ran without a free slot: %v", err)
+	}
+}
+
+func TestLimitedBufferDiscardsTheRest(t *testing.T) {
+	buffer := &limitedBuffer{limit: 8}
+	for _, part := range []string{"12345", "67890", "abc"} {
+		if n, err := buffer.Write([]byte(part)); n != len(part) || err != nil {
+			t.Fatalf("Write(%q) = %d, %v", part, n, err)
+		}
+	}
+	if got := buffer.String(); got != "12345678" || !buffer.truncated {
+		t.Fatalf("buffer = %q, truncated = %v, want the first 8 bytes", got, buffer.truncated)
+	}
+}
+
+func TestResolveScriptPathAllowList(t *testing.T) {
+	path := writeScript(t, "exit 0")
+
+	if _, err := resolveScriptPath(path, nil); err != nil {
+		t.Fatalf("empty allow-list: error = %v", err)
+	}
+	if _, err := resolveScriptPath(path, []string{path}); err != nil {
+		t.Fatalf("allowed file: error = %v", err)
+	}
+	if _, err := resolveScriptPath(path, []string{filepath.Dir(path)}); err != nil {
+		t.Fatalf("allowed directory: error = %v", err)
+	}
+	if _, err := resolveScriptPath(path, []string{t.TempDir()}); err == nil {
+		t.Fatal("other directory: error = nil, want an error")
+	}
+	if _, err := resolveScriptPath(path, []string{filepath.Dir(path) + "-suffix"}); err == nil {
+		t.Fatal("sibling prefix: error = nil, want an error")
+	}
+}
@@ -1,12 +1,403 @@
 package outputs
 
-import "github.com/kerberos-io/agent/machinery/src/models"
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/kerberos-io/agent/machinery/src/capture"
+	"github.com/kerberos-io/agent/machinery/src/log"
+	"github.com/kerberos-io/agent/machinery/src/models"
+)
+
+const (
+	chatDefaultTimeout  = 10 * time.Second
+	chatSnapshotTimeout = 3 * time.Second
+	chatSnapshotName    = "snapshot.jpg"
+)
+
+// slackAPIURL is the base URL of the Slack Web API, used to upload snapshots.
+// It is a package variable so tests can point it to a local server.
+var slackAPIURL = "https://slack.com/api"
+
+// chatSnapshot grabs the latest keyframe of the camera, for the events which
+// don't carry the frame they were detected on. JpegImage blocks until a
+// keyframe is read, so a camera that stopped streaming must not hold back the
+// message: we give up after chatSnapshotTimeout.
+var chatSnapshot = func(captureDevice *capture.Capture, communication *models.Communication) (image.Image, error) {
+	if captureDevice == nil || communication == nil {
+		return nil, errors.New("no capture device")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), chatSnapshotTimeout)
+	defer cancel()
+	img := capture.JpegImageContext(ctx, captureDevice, communication)
+	if ctx.Err() != nil {
+		return nil, errors.New("timed out waiting for a keyframe")
+	}
+	if img.Rect.Empty() {
+		return nil, errors.New("could not decode a keyframe")
+	}
+	return &img, nil
+}
+
+// chatChannelState keeps track of the messages sent to a channel, so a busy
+// camera doesn't flood it. Suppressed messages are counted and reported in the
+// next message.
+type chatChannelState struct {
+	lastMessage time.Time
+	suppressed  int
+}
+
+var (
+	chatChannelsMutex sync.Mutex
+	chatChannels      = map[string]*chatChannelState{}
+)
+
+// SlackOutput posts the message to the chat channels configured in
+// config.Chat: Slack, Mattermost or Discord, with a snapshot of the camera on
+// which the motion is highlighted.
 type SlackOutput struct {
 	Output
+	Configuration *models.Configuration
+	Communication *models.Communication
+	CaptureDevice *capture.Capture
 }
 
 func (s *SlackOutput) Trigger(message *models.OutputMessage) (err error) {
-	err = nil
-	return err
+	if s.Configuration == nil || s.Configuration.Config.Chat == nil || len(s.Configuration.Config.Chat.Channels) == 0 {
+		return errors.New("chat not properly configured")
+	}
+	config := s.Configuration.Config
+	client := newWebhookHTTPClient(chatDefaultTimeout)
+
+	// The snapshot is taken once, and only when a channel needs it.
+	var snapshot []byte
+	snapshotTaken := false
+
+	failed := 0
+	for _, channel := range config.Chat.Channels {
+		if channel == nil || (channel.URL == "" && (channel.Token == "" || channel.Channel == "")) {
+			continue
+		}
+		key := chatChannelKey(channel)
+		allowed, suppressed := allowChatMessage(key, time.Duration(channel.RateLimit)*time.Second)
+		if !allowed {
+			log.Log.Debug("outputs.slack.Trigger(): rate limited, not sending " + message.Trigger + " to " + key)
+			continue
+		}
+
+		// Mattermost incoming webhooks can't carry files.
+		withSnapshot := channel.Snapshot != "false" && channel.Type != "mattermost"
+		if withSnapshot && !snapshotTaken {
+			snapshotTaken = true
+			// Prefer the frame the event was detected on over the latest one.
+			img := message.Snapshot
+			var err error
+			if img == nil {
+				img, err = chatSnapshot(s.CaptureDevice, s.Communication)
+			}
+			if err == nil {
+				snapshot, err = encodeChatSnapshot(img, message.Rectangle)
+			}
+			if err != nil {
+				log.Log.Warning("outputs.slack.Trigger(): sending message without snapshot: " + err.Error())
+			}
+		}
+		var attachment []byte
+		if withSnapshot {
+			attachment = snapshot
+		}
+
+		text := chatText(message, config.Timezone, suppressed)
+		switch channel.Type {
+		case "discord":
+			err = postDiscord(client, channel, text, attachment)
+		case "mattermost":
+			err = postChatWebhook(client, channel, text)
+		default:
+			err = postSlack(client, channel, text, attachment)
+		}
+		if err != nil {
+			failed++
+			log.Log.Error("outputs.slack.Trigger(): " + key + ": " + err.Error())
+			continue
+		}
+		recordChatMessage(key, suppressed)
+		log.Log.Info("outputs.slack.Trigger(): posted " + message.Trigger + " to " + key)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d chat channel(s) failed", failed)
+	}
+	return nil
+}
+
+// chatChannelKey identifies a channel for rate limiting and logging, without
+// leaking the secret part of the webhook URL.
+func chatChannelKey(channel *models.ChatChannel) string {
+	channelType := channel.Type
+	if channelType == "" {
+		channelType = "slack"
+	}
+	if channel.Channel != "" {
+		return channelType + ":" + channel.Channel
+	}
+	if u, err := url.Parse(channel.URL); err == nil && u.Host != "" {
+		path := u.Path
+		if len(path) > 12 {
+			path = path[:12] + "…"
+		}
+		return channelType + ":" + u.Host + path
+	}
+	return channelType
+}
+
+// allowChatMessage returns whether a message can be sent to the channel, and
+// how many messages were suppressed since the previous one. The message only
+// counts once it is posted, see recordChatMessage.
+func allowChatMessage(key string, rateLimit time.Duration) (bool, int) {
+	chatChannelsMutex.Lock()
+	defer chatChannelsMutex.Unlock()
+	state, ok := chatChannels[key]
+	if !ok {
+		state = &chatChannelState{}
+		chatChannels[key] = state
+	}
+	if rateLimit > 0 && !state.lastMessage.IsZero() && time.Since(state.lastMessage) < rateLimit {
+		state.suppressed++
+		return false, 0
+	}
+	return true, state.suppressed
+}
+
+// recordChatMessage starts the rate limit of the channel after a message, which
+// reported the suppressed messages, was posted.
+func recordChatMessage(key string, suppressed int) {
+	chatChannelsMutex.Lock()
+	defer chatChannelsMutex.Unlock()
+	if state, ok := chatChannels[key]; ok {
+		state.lastMessage = time.Now()
+		state.suppressed -= suppressed
+	}
+}
+
+// chatText formats the message, e.g. "Motion detected on front-door at
+// 2024-01-02 15:04:05 CET".
+func chatText(message *models.OutputMessage, timezone string, suppressed int) string {
+	trigger := strings.ReplaceAll(message.Trigger, "_", " ")
+	if trigger != "" {
+		trigger = strings.ToUpper(trigger[:1]) + trigger[1:]
+	}
+	timestamp := message.Timestamp
+	if location, err := time.LoadLocation(timezone); err == nil && timezone != "" {
+		timestamp = timestamp.In(location)
+	}
+	text := trigger + " on " + message.Name + " at " + timestamp.Format("2006-01-02 15:04:05 MST")
+	if len(message.Zones) > 0 {
+		text += " in " + strings.Join(message.Zones, ", ")
+	}
+	if message.Reason != "" {
+		text += ": " + message.Reason
+	}
+	if message.File != "" {
+		text += " (" + message.File + ")"
+	}
+	if suppressed > 0 {
+		text += " — " + strconv.Itoa(suppressed) + " earlier event(s) not posted because of the rate limit"
+	}
+	return text
+}
+
+// encodeChatSnapshot draws the motion rectangle (if any) on the image and
+// encodes it as JPEG.
+func encodeChatSnapshot(img image.Image, rectangle *models.MotionRectangle) ([]byte, error) {
+	bounds := img.Bounds()
+	canvas := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(canvas, canvas.Bounds(), img, bounds.Min, draw.Src)
+
+	if rectangle != nil && rectangle.Width > 0 && rectangle.Height > 0 {
+		thickness := bounds.Dx() / 300
+		if thickness < 2 {
+			thickness = 2
+		}
+		r := image.Rect(rectangle.X, rectangle.Y, rectangle.X+rectangle.Width, rectangle.Y+rectangle.Height).Intersect(canvas.Bounds())
+		red := &image.Uniform{C: color.RGBA{R: 255, A: 255}}
+		for _, border := range []image.Rectangle{
+			image.Rect(r.Min.X, r.Min.Y, r.Max.X, r.Min.Y+thickness),
+			image.Rect(r.Min.X, r.Max.Y-thickness, r.Max.X, r.Max.Y),
+			image.Rect(r.Min.X, r.Min.Y, r.Min.X+thickness, r.Max.Y),
+			image.Rect(r.Max.X-thickness, r.Min.Y, r.Max.X, r.Max.Y),
+		} {
+			draw.Draw(canvas, border.Intersect(r), red, image.Point{}, draw.Src)
+		}
+	}
+
+	var buffer bytes.Buffer
+	if err := jpeg.Encode(&buffer, canvas, &jpeg.Options{Quality: 75}); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// postChatWebhook posts a text message to a Slack or Mattermost incoming
+// webhook; both accept the same payload.
+func postChatWebhook(client *http.Client, channel *models.ChatChannel, text string) error {
+	payload := map[string]string{"text": text}
+	if channel.Username != "" {
+		payload["username"] = channel.Username
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return doChatRequest(client, http.MethodPost, channel.URL, "application/json", "", bytes.NewReader(body), nil)
+}
+
+// postSlack posts to Slack. Incoming webhooks can't carry files, so when a
+// snapshot is available and a bot token is configured, the snapshot is
+// uploaded to the channel with the message as comment.
+func postSlack(client *http.Client, channel *models.ChatChannel, text string, snapshot []byte) error {
+	if channel.Token != "" && channel.Channel != "" {
+		if len(snapshot) > 0 {
+			return uploadSlackSnapshot(client, channel, text, snapshot)
+		}
+		if channel.URL == "" {
+			body, err := json.Marshal(map[string]string{"channel": channel.Channel, "text": text})
+			if err != nil {
+				return err
+			}
+			var response slackAPIResponse
+			if err := doChatRequest(client, http.MethodPost, slackAPIURL+"/chat.postMessage", "application/json", channel.Token, bytes.NewReader(body), &response); err != nil {
+				return err
+			}
+			return response.err()
+		}
+	}
+	return postChatWebhook(client, channel, text)
+}
+
+// slackAPIResponse is the envelope of all Slack Web API responses.
+type slackAPIResponse struct {
+	Ok        bool   `json:"ok"`
+	Error     string `json:"error,omitempty"`
+	UploadURL string `json:"upload_url,omitempty"`
+	FileID    string `json:"file_id,omitempty"`
+}
+
+func (r slackAPIResponse) err() error {
+	if !r.Ok {
+		return errors.New("slack: " + r.Error)
+	}
+	return nil
+}
+
+// uploadSlackSnapshot uploads the snapshot using the external upload flow:
+// request an upload URL, send the file, and share it in the channel.
+func uploadSlackSnapshot(client *http.Client, channel *models.ChatChannel, text string, snapshot []byte) error {
+	form := url.Values{}
+	form.Set("filename", chatSnapshotName)
+	form.Set("length", strconv.Itoa(len(snapshot)))
+	var upload slackAPIResponse
+	if err := doChatRequest(client, http.MethodPost, slackAPIURL+"/files.getUploadURLExternal", "application/x-www-form-urlencoded", channel.Token, strings.NewReader(form.Encode()), &upload); err != nil {
+		return err
+	}
+	if err := upload.err(); err != nil {
+		return err
+	}
+
+	if err := doChatRequest(client, http.MethodPost, upload.UploadURL, "image/jpeg", "", bytes.NewReader(snapshot), nil); err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"files":           []map[string]string{{"id": upload.FileID, "title": chatSnapshotName}},
+		"channel_id":      channel.Channel,
+		"initial_comment": text,
+	})
+	if err != nil {
+		return err
+	}
+	var complete slackAPIResponse
+	if err := doChatRequest(client, http.MethodPost, slackAPIURL+"/files.completeUploadExternal", "application/json", channel.Token, bytes.NewReader(body), &complete); err != nil {
+		return err
+	}
+	return complete.err()
+}
+
+// postDiscord posts to a Discord webhook. A snapshot is sent as a multipart
+// attachment next to the JSON payload.
+func postDiscord(client *http.Client, channel *models.ChatChannel, text string, snapshot []byte) error {
+	payload := map[string]string{"content": text}
+	if channel.Username != "" {
+		payload["username"] = channel.Username
+	}
+	payloadJSON, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	if len(snapshot) == 0 {
+		return doChatRequest(client, http.MethodPost, channel.URL, "application/json", "", bytes.NewReader(payloadJSON), nil)
+	}
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	if err := writer.WriteField("payload_json", string(payloadJSON)); err != nil {
+		return err
+	}
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", `form-data; name="files[0]"; filename="`+chatSnapshotName+`"`)
+	header.Set("Content-Type", "image/jpeg")
+	part, err := writer.CreatePart(header)
+	if err != nil {
+		return err
+	}
+	if _, err := part.Write(snapshot); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	return doChatRequest(client, http.MethodPost, channel.URL, writer.FormDataContentType(), "", &body, nil)
+}
+
+// doChatRequest sends the request and, when response is set, decodes the JSON
+// response into it. Any non-2xx response is an error.
+func doChatRequest(client *http.Client, method, endpoint, contentType, token string, body io.Reader, response interface{}) error {
+	req, err := http.NewRequest(method, endpoint, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return errors.New("unexpected response: " + resp.Status + " " + strings.TrimSpace(string(b)))
+	}
+	if response != nil {
+		return json.NewDecoder(resp.Body).Decode(response)
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	return nil
 }
@@ -0,0 +1,216 @@
+package outputs
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kerberos-io/agent/machinery/src/capture"
+	"github.com/kerberos-io/agent/machinery/src/models"
+)
+
+func withChatSnapshot(t *testing.T, img image.Image) {
+	t.Helper()
+	previous := chatSnapshot
+	chatSnapshot = func(*capture.Capture, *models.Communication) (image.Image, error) {
+		if img == nil {
+			return nil, errors.New("no snapshot")
+		}
+		return img, nil
+	}
+	t.Cleanup(func() {
+		chatSnapshot = previous
+		chatChannelsMutex.Lock()
+		chatChannels = map[string]*chatChannelState{}
+		chatChannelsMutex.Unlock()
+	})
+}
+
+func TestSlackTriggerPostsWebhookText(t *testing.T) {
+	withChatSnapshot(t, nil)
+
+	var payload map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&payload)
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	slack := &SlackOutput{
+		Configuration: &models.Configuration{Config: models.Config{Chat: &models.Chat{
+			Channels: []*models.ChatChannel{{URL: server.URL, Username: "agent"}},
+		}}},
+	}
+	if err := slack.Trigger(testOutputMessage()); err != nil {
+		t.Fatalf("Trigger() error = %v", err)
+	}
+	if !strings.HasPrefix(payload["text"], "Motion on front-door at ") || payload["username"] != "agent" {
+		t.Fatalf("unexpected payload: %v", payload)
+	}
+}
+
+func TestSlackTriggerDiscordAttachesSnapshot(t *testing.T) {
+	withChatSnapshot(t, image.NewGray(image.Rect(0, 0, 64, 48)))
+
+	var content string
+	var snapshot []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			t.Errorf("ParseMultipartForm() error = %v", err)
+			return
+		}
+		var payload map[string]string
+		json.Unmarshal([]byte(r.FormValue("payload_json")), &payload)
+		content = payload["content"]
+		if file, _, err := r.FormFile("files[0]"); err == nil {
+			snapshot, _ = io.ReadAll(file)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	message := testOutputMessage()
+	message.Rectangle = &models.MotionRectangle{X: 10, Y: 10, Width: 20, Height: 20}
+	slack := &SlackOutput{
+		Configuration: &models.Configuration{Config: models.Config{Chat: &models.Chat{
+			Channels: []*models.ChatChannel{{Type: "discord", URL: server.URL}},
+		}}},
+	}
+	if err := slack.Trigger(message); err != nil {
+		t.Fatalf("Trigger() error = %v", err)
+	}
+	if content == "" {
+		t.Fatal("payload_json has no content")
+	}
+	img, err := jpeg.Decode(bytes.NewReader(snapshot))
+	if err != nil {
+		t.Fatalf("attachment is not a JPEG: %v", err)
+	}
+	// The border of the motion rectangle is drawn in red.
+	if r, g, _, _ := img.At(10, 20).RGBA(); r>>8 < 200 || g>>8 > 80 {
+		t.Fatalf("pixel on the rectangle border = %v, want red", img.At(10, 20))
+	}
+}
+
+func TestSlackTriggerUsesSnapshotOfEvent(t *testing.T) {
+	withChatSnapshot(t, nil)
+
+	var snapshot []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			t.Errorf("ParseMultipartForm() error = %v", err)
+			return
+		}
+		if file, _, err := r.FormFile("files[0]"); err == nil {
+			snapshot, _ = io.ReadAll(file)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	// The latest keyframe can't be grabbed, the frame of the event is sent.
+	message := testOutputMessage()
+	message.Snapshot = image.NewGray(image.Rect(0, 0, 64, 48))
+	slack := &SlackOutput{
+		Configuration: &models.Configuration{Config: models.Config{Chat: &models.Chat{
+			Channels: []*models.ChatChannel{{Type: "discord", URL: server.URL}},
+		}}},
+	}
+	if err := slack.Trigger(message); err != nil {
+		t.Fatalf("Trigger() error = %v", err)
+	}
+	img, err := jpeg.Decode(bytes.NewReader(snapshot))
+	if err != nil {
+		t.Fatalf("attachment is not a JPEG: %v", err)
+	}
+	if img.Bounds().Dx() != 64 || img.Bounds().Dy() != 48 {
+		t.Fatalf("attachment is %v, want the 64x48 frame of the event", img.Bounds())
+	}
+}
+
+func TestSlackTriggerRateLimit(t *testing.T) {
+	withChatSnapshot(t, nil)
+
+	var requests int32
+	var last string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		var payload map[string]string
+		json.NewDecoder(r.Body).Decode(&payload)
+		last = payload["text"]
+	}))
+	defer server.Close()
+
+	slack := &SlackOutput{
+		Configuration: &models.Configuration{Config: models.Config{Chat: &models.Chat{
+			Channels: []*models.ChatChannel{{Type: "mattermost", URL: server.URL, RateLimit: 60}},
+		}}},
+	}
+	for i := 0; i < 3; i++ {
+		if err := slack.Trigger(testOutputMessage()); err != nil {
+			t.Fatalf("Trigger() error = %v", err)
+		}
+	}
+	if got := atomic.LoadInt32(&requests); got != 1 {
+		t.Fatalf("requests = %d, want 1", got)
+	}
+
+	// Once the rate limit expired, the next message reports the suppressed ones.
+	chatChannelsMutex.Lock()
+	for _, state := range chatChannels {
+		state.lastMessage = state.lastMessage.Add(-2 * time.Minute)
+	}
+	chatChannelsMutex.Unlock()
+	if err := slack.Trigger(testOutputMessage()); err != nil {
+		t.Fatalf("Trigger() error = %v", err)
+	}
+	if !strings.Contains(last, "2 earlier event(s)") {
+		t.Fatalf("text = %q, want the suppressed count", last)
+	}
+}
+
+func TestSlackTriggerRateLimitIgnoresFailures(t *testing.T) {
+	withChatSnapshot(t, nil)
+
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	slack := &SlackOutput{
+		Configuration: &models.Configuration{Config: models.Config{Chat: &models.Chat{
+			Channels: []*models.ChatChannel{{Type: "mattermost", URL: server.URL, RateLimit: 60}},
+		}}},
+	}
+	if err := slack.Trigger(testOutputMessage()); err == nil {
+		t.Fatal("Trigger() error = nil, want an error")
+	}
+	// The failed message doesn't start the rate limit.
+	if err := slack.Trigger(testOutputMessage()); err != nil {
+		t.Fatalf("Trigger() error = %v", err)
+	}
+	if got := atomic.LoadInt32(&requests); got != 2 {
+		t.Fatalf("requests = %d, want 2", got)
+	}
+}
+
+func TestEncodeChatSnapshotClipsRectangle(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 32, 32))
+	img.Set(0, 0, color.White)
+	if _, err := encodeChatSnapshot(img, &models.MotionRectangle{X: 20, Y: 20, Width: 100, Height: 100}); err != nil {
+		t.Fatalf("encodeChatSnapshot() error = %v", err)
+	}
+}
@@ -1,12 +1,257 @@
 package outputs
 
-import "github.com/kerberos-io/agent/machinery/src/models"
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
 
+	"github.com/kerberos-io/agent/machinery/src/log"
+	"github.com/kerberos-io/agent/machinery/src/models"
+)
+
+const (
+	// webhookSignatureHeader carries the HMAC-SHA256 signature of the request,
+	// formatted as "sha256=<hex>". It is computed over "<timestamp>.<body>" so a
+	// receiver can reject replayed requests by checking webhookTimestampHeader.
+	webhookSignatureHeader = "X-Kerberos-Signature"
+	webhookTimestampHeader = "X-Kerberos-Timestamp"
+
+	webhookDefaultMaxRetries = 3
+	webhookDefaultTimeout    = 10 * time.Second
+	webhookMaxBackoff        = 30 * time.Second
+)
+
+// webhookBackoffBaseDelay is the base delay used between two delivery attempts.
+// It is a package variable (rather than a constant) so tests can shrink it.
+var webhookBackoffBaseDelay = time.Second
+
+// WebhookOutput delivers an OutputMessage to the endpoints configured in
+// config.Webhook. Each endpoint is retried with an exponential back-off; when
+// all attempts fail the request is written to a dead-letter directory
+// (data/outputs/webhook/<endpoint>) so no event is silently lost.
 type WebhookOutput struct {
 	Output
+	ConfigDirectory string
+	Configuration   *models.Configuration
+}
+
+// webhookDeadLetter is persisted when an endpoint could not be reached.
+type webhookDeadLetter struct {
+	URL    string `json:"url"`
+	Method string `json:"method"`
+	// The names of the configured headers. Their values (often credentials)
+	// are not stored, a replay applies them from the config again.
+	Headers   []string `json:"headers,omitempty"`
+	Body      string   `json:"body"`
+	Attempts  int      `json:"attempts"`
+	Error     string   `json:"error"`
+	Timestamp int64    `json:"timestamp"`
 }
 
 func (w *WebhookOutput) Trigger(message *models.OutputMessage) (err error) {
-	err = nil
-	return err
+	if w.Configuration == nil || w.Configuration.Config.Webhook == nil || len(w.Configuration.Config.Webhook.URLs) == 0 {
+		return errors.New("webhook not properly configured")
+	}
+	webhook := w.Configuration.Config.Webhook
+
+	body, err := renderWebhookBody(webhook.Template, message)
+	if err != nil {
+		return errors.New("could not render webhook template: " + err.Error())
+	}
+
+	method := strings.ToUpper(webhook.Method)
+	if method == "" {
+		method = http.MethodPost
+	}
+	maxRetries := webhook.MaxRetries
+	if maxRetries <= 0 {
+		maxRetries = webhookDefaultMaxRetries
+	}
+	timeout := webhookDefaultTimeout
+	if webhook.Timeout > 0 {
+		timeout = time.Duration(webhook.Timeout) * time.Second
+	}
+	client := newWebhookHTTPClient(timeout)
+
+	failed := 0
+	for _, endpoint := range webhook.URLs {
+		if endpoint == "" {
+			continue
+		}
+		attempts, err := sendWebhook(client, method, endpoint, webhook.Headers, webhook.Secret, body, maxRetries)
+		if err != nil {
+			failed++
+			log.Log.Error("outputs.webhook.Trigger(): " + endpoint + " failed after " + strconv.Itoa(attempts) + " attempt(s): " + err.Error())
+			writeWebhookDeadLetter(w.ConfigDirectory, webhookDeadLetter{
+				URL:       endpoint,
+				Method:    method,
+				Headers:   slices.Sorted(maps.Keys(webhook.Headers)),
+				Body:      string(body),
+				Attempts:  attempts,
+				Error:     err.Error(),
+				Timestamp: time.Now().Unix(),
+			})
+			continue
+		}
+		log.Log.Info("outputs.webhook.Trigger(): delivered " + message.Trigger + " to " + endpoint)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d webhook endpoint(s) failed", failed, len(webhook.URLs))
+	}
+	return nil
+}
+
+// renderWebhookBody builds the request body. Without a template the message is
+// sent as JSON; otherwise the Go template is executed against the message, with
+// a few helpers (json, unix, rfc3339) to produce well-formed payloads.
+func renderWebhookBody(tmpl string, message *models.OutputMessage) ([]byte, error) {
+	if tmpl == "" {
+		return json.Marshal(newOutputPayload(message))
+	}
+
+	t, err := template.New("webhook").Funcs(template.FuncMap{
+		"json": func(v interface{}) (string, error) {
+			b, err := json.Marshal(v)
+			return string(b), err
+		},
+		"unix": func(t time.Time) int64 {
+			return t.Unix()
+		},
+		"rfc3339": func(t time.Time) string {
+			return t.Format(time.RFC3339)
+		},
+	}).Parse(tmpl)
+	if err != nil {
+		return nil, err
+	}
+
+	var buffer bytes.Buffer
+	if err := t.Execute(&buffer, message); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// signWebhook returns the HMAC-SHA256 signature of "<timestamp>.<body>".
+func signWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// sendWebhook delivers the body to a single endpoint. Transport errors, 429 and
+// 5xx responses are retried; any other non-2xx response is considered final.
+// It makes up to maxRetries retries after the first attempt and returns the
+// number of attempts made.
+func sendWebhook(client *http.Client, method, endpoint string, headers map[string]string, secret string, body []byte, maxRetries int) (int, error) {
+	var lastErr error
+	attempt := 0
+	for attempt <= maxRetries {
+		if attempt > 0 {
+			webhookBackoff(attempt - 1)
+		}
+		attempt++
+
+		req, err := http.NewRequest(method, endpoint, bytes.NewReader(body))
+		if err != nil {
+			return attempt, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		for key, value := range headers {
+			req.Header.Set(key, value)
+		}
+		if secret != "" {
+			timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+			req.Header.Set(webhookTimestampHeader, timestamp)
+			req.Header.Set(webhookSignatureHeader, signWebhook(secret, timestamp, body))
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+		resp.Body.Close()
+
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			return attempt, nil
+		}
+		lastErr = errors.New("unexpected response: " + resp.Status)
+		if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode < 500 {
+			return attempt, lastErr
+		}
+	}
+	return attempt, lastErr
+}
+
+// webhookBackoff sleeps for an exponentially increasing (capped) duration.
+func webhookBackoff(attempt int) {
+	delay := webhookBackoffBaseDelay * time.Duration(1<<uint(attempt))
+	if delay > webhookMaxBackoff {
+		delay = webhookMaxBackoff
+	}
+	time.Sleep(delay)
+}
+
+func newWebhookHTTPClient(timeout time.Duration) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if os.Getenv("AGENT_TLS_INSECURE") == "true" {
+		if transport.TLSClientConfig == nil {
+			transport.TLSClientConfig = &tls.Config{}
+		}
+		transport.TLSClientConfig.InsecureSkipVerify = true
+	}
+	return &http.Client{Transport: transport, Timeout: timeout}
+}
+
+// webhookDeadLetterDirectory returns the dead-letter directory of an endpoint.
+// The directory name combines the host (readable) with a short hash of the full
+// URL (unique), e.g. data/outputs/webhook/hooks.example.com-3fa9c1d2.
+func webhookDeadLetterDirectory(configDirectory, endpoint string) string {
+	host := "endpoint"
+	if u, err := url.Parse(endpoint); err == nil && u.Host != "" {
+		host = strings.NewReplacer(":", "_", "/", "_").Replace(u.Host)
+	}
+	sum := sha1.Sum([]byte(endpoint))
+	return filepath.Join(configDirectory, "data", "outputs", "webhook", host+"-"+hex.EncodeToString(sum[:4]))
+}
+
+func writeWebhookDeadLetter(configDirectory string, letter webhookDeadLetter) {
+	directory := webhookDeadLetterDirectory(configDirectory, letter.URL)
+	if err := os.MkdirAll(directory, 0755); err != nil {
+		log.Log.Error("outputs.webhook.writeWebhookDeadLetter(): " + err.Error())
+		return
+	}
+	payload, err := json.MarshalIndent(letter, "", "\t")
+	if err != nil {
+		log.Log.Error("outputs.webhook.writeWebhookDeadLetter(): " + err.Error())
+		return
+	}
+	name := strconv.FormatInt(time.Now().UnixNano(), 10) + ".json"
+	if err := os.WriteFile(filepath.Join(directory, name), payload, 0644); err != nil {
+		log.Log.Error("outputs.webhook.writeWebhookDeadLetter(): " + err.Error())
+		return
+	}
+	log.Log.Info("outputs.webhook.writeWebhookDeadLetter(): stored failed delivery in " + directory)
 }
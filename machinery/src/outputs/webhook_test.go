@@ -0,0 +1,183 @@
+package outputs
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kerberos-io/agent/machinery/src/models"
+)
+
+func testOutputMessage() *models.OutputMessage {
+	return &models.OutputMessage{
+		Name:      "front-door",
+		Outputs:   []string{"webhook"},
+		Trigger:   "motion",
+		Timestamp: time.Unix(1700000000, 0),
+		File:      "1700000000_6-967003_front-door_200-200-400-400_24_769.mp4",
+		CameraId:  "camera1",
+		SiteId:    "site1",
+	}
+}
+
+func withFastWebhookBackoff(t *testing.T) {
+	t.Helper()
+	previous := webhookBackoffBaseDelay
+	webhookBackoffBaseDelay = time.Millisecond
+	t.Cleanup(func() { webhookBackoffBaseDelay = previous })
+}
+
+func TestWebhookTriggerSignsDefaultPayload(t *testing.T) {
+	var body []byte
+	var signature, timestamp, custom string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		signature = r.Header.Get(webhookSignatureHeader)
+		timestamp = r.Header.Get(webhookTimestampHeader)
+		custom = r.Header.Get("X-Custom")
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	webhook := &WebhookOutput{
+		ConfigDirectory: t.TempDir(),
+		Configuration: &models.Configuration{Config: models.Config{Webhook: &models.Webhook{
+			URLs:    []string{server.URL},
+			Secret:  "s3cr3t",
+			Headers: map[string]string{"X-Custom": "value"},
+		}}},
+	}
+	if err := webhook.Trigger(testOutputMessage()); err != nil {
+		t.Fatalf("Trigger() error = %v", err)
+	}
+
+	var payload outputPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		t.Fatalf("body is not valid JSON: %v (%s)", err, body)
+	}
+	if payload.Trigger != "motion" || payload.CameraId != "camera1" || payload.Timestamp != 1700000000 {
+		t.Fatalf("unexpected payload: %+v", payload)
+	}
+	if want := signWebhook("s3cr3t", timestamp, body); signature != want {
+		t.Fatalf("signature = %q, want %q", signature, want)
+	}
+	if custom != "value" {
+		t.Fatalf("X-Custom = %q, want %q", custom, "value")
+	}
+}
+
+func TestWebhookTriggerRendersTemplate(t *testing.T) {
+	body, err := renderWebhookBody(`{"text":{{json .Name}},"at":{{unix .Timestamp}}}`, testOutputMessage())
+	if err != nil {
+		t.Fatalf("renderWebhookBody() error = %v", err)
+	}
+	if got, want := string(body), `{"text":"front-door","at":1700000000}`; got != want {
+		t.Fatalf("renderWebhookBody() = %s, want %s", got, want)
+	}
+}
+
+func TestWebhookTriggerRetriesServerErrors(t *testing.T) {
+	withFastWebhookBackoff(t)
+
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	webhook := &WebhookOutput{
+		ConfigDirectory: t.TempDir(),
+		Configuration:   &models.Configuration{Config: models.Config{Webhook: &models.Webhook{URLs: []string{server.URL}, MaxRetries: 2}}},
+	}
+	if err := webhook.Trigger(testOutputMessage()); err != nil {
+		t.Fatalf("Trigger() error = %v", err)
+	}
+	if got := atomic.LoadInt32(&requests); got != 3 {
+		t.Fatalf("requests = %d, want 3", got)
+	}
+}
+
+func TestWebhookTriggerRetriesAfterFirstAttempt(t *testing.T) {
+	withFastWebhookBackoff(t)
+
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	webhook := &WebhookOutput{
+		ConfigDirectory: t.TempDir(),
+		Configuration:   &models.Configuration{Config: models.Config{Webhook: &models.Webhook{URLs: []string{server.URL}, MaxRetries: 2}}},
+	}
+	if err := webhook.Trigger(testOutputMessage()); err == nil {
+		t.Fatal("Trigger() error = nil, want an error")
+	}
+	// The first attempt and two retries.
+	if got := atomic.LoadInt32(&requests); got != 3 {
+		t.Fatalf("requests = %d, want 3", got)
+	}
+}
+
+func TestWebhookTriggerWritesDeadLetter(t *testing.T) {
+	withFastWebhookBackoff(t)
+
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	configDirectory := t.TempDir()
+	webhook := &WebhookOutput{
+		ConfigDirectory: configDirectory,
+		Configuration: &models.Configuration{Config: models.Config{Webhook: &models.Webhook{
+			URLs:       []string{server.URL},
+			MaxRetries: 5,
+			Headers:    map[string]string{"Authorization": "Bearer secret-token"},
+		}}},
+	}
+	if err := webhook.Trigger(testOutputMessage()); err == nil {
+		t.Fatal("Trigger() error = nil, want an error")
+	}
+	// A 4xx response is final, so it must not be retried.
+	if got := atomic.LoadInt32(&requests); got != 1 {
+		t.Fatalf("requests = %d, want 1", got)
+	}
+
+	entries, err := os.ReadDir(webhookDeadLetterDirectory(configDirectory, server.URL))
+	if err != nil {
+		t.Fatalf("dead-letter directory: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("dead letters = %d, want 1", len(entries))
+	}
+	letter, err := os.ReadFile(filepath.Join(webhookDeadLetterDirectory(configDirectory, server.URL), entries[0].Name()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Header values are credentials, only their names are kept.
+	if !strings.Contains(string(letter), "Authorization") || strings.Contains(string(letter), "secret-token") {
+		t.Fatalf("dead letter leaks the header values: %s", letter)
+	}
+}
+
+func TestWebhookTriggerNotConfigured(t *testing.T) {
+	webhook := &WebhookOutput{Configuration: &models.Configuration{}}
+	if err := webhook.Trigger(testOutputMessage()); err == nil {
+		t.Fatal("Trigger() error = nil, want an error")
+	}
+}
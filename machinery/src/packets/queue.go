@@ -2,6 +2,7 @@
 package packets
 
 import (
+	"context"
 	"io"
 	"sync"
 )
@@ -201,6 +202,20 @@ func (self *QueueCursor) Streams() (streams []Stream, err error) {
 
 // ReadPacket will not consume packets in Queue, it's just a cursor.
 func (self *QueueCursor) ReadPacket() (pkt Packet, err error) {
+	return self.ReadPacketContext(context.Background())
+}
+
+// ReadPacketContext is ReadPacket, but gives up waiting for the next packet
+// when the context is done, and returns the error of the context.
+func (self *QueueCursor) ReadPacketContext(ctx context.Context) (pkt Packet, err error) {
+	// Wake up the waiting reader, so it sees the context is done.
+	stop := context.AfterFunc(ctx, func() {
+		self.que.lock.Lock()
+		self.que.cond.Broadcast()
+		self.que.lock.Unlock()
+	})
+	defer stop()
+
 	self.que.cond.L.Lock()
 	buf := self.que.buf
 	if !self.gotpos {
@@ -222,6 +237,9 @@ func (self *QueueCursor) ReadPacket() (pkt Packet, err error) {
 			err = io.EOF
 			break
 		}
+		if err = ctx.Err(); err != nil {
+			break
+		}
 		self.que.cond.Wait()
 	}
 	self.que.cond.L.Unlock()
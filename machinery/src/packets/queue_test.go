@@ -0,0 +1,34 @@
+package packets
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestQueueCursorReadPacketContext(t *testing.T) {
+	queue := NewQueue()
+	queue.WriteHeader([]Stream{{IsVideo: true}})
+	cursor := queue.Latest()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		_, err := cursor.ReadPacketContext(ctx)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != context.DeadlineExceeded {
+			t.Fatalf("ReadPacketContext() error = %v, want %v", err, context.DeadlineExceeded)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("ReadPacketContext() still waits for a packet after the deadline")
+	}
+
+	queue.WritePacket(Packet{IsVideo: true, IsKeyFrame: true, Data: []byte{1}})
+	if pkt, err := cursor.ReadPacketContext(context.Background()); err != nil || len(pkt.Data) != 1 {
+		t.Fatalf("ReadPacketContext() = %v, %v, want the written packet", pkt, err)
+	}
+}
@@ -0,0 +1,374 @@
+package recordings
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kerberos-io/agent/machinery/src/log"
+	"github.com/kerberos-io/agent/machinery/src/models"
+)
+
+// Index keeps the recordings of data/recordings in memory, sorted by their
+// start, and in a journal on disk (data/index/recordings.jsonl). Every change
+// is appended to the journal, which is compacted to a snapshot when it grew
+// too long. On open the journal is read and checked against the recordings
+// directory, so recordings which were added or removed while the agent was
+// stopped are picked up.
+type Index struct {
+	mutex            sync.Mutex
+	directory        string // The config directory.
+	recordings       map[string]*models.Recording
+	sorted           []*models.Recording // Oldest first.
+	journal          *os.File
+	journalEntries   int
+	compactThreshold int
+}
+
+// journalEntry is a line of the journal: a recording which was added or
+// updated, or the key of a recording which was removed.
+type journalEntry struct {
+	Recording *models.Recording `json:"recording,omitempty"`
+	Delete    string            `json:"delete,omitempty"`
+}
+
+// The journal is compacted when it has this many entries more than the index.
+const journalSlack = 1000
+
+// OpenIndex opens the index of the recordings in the config directory.
+func OpenIndex(configDirectory string) (*Index, error) {
+	index := &Index{
+		directory:        configDirectory,
+		recordings:       map[string]*models.Recording{},
+		compactThreshold: journalSlack,
+	}
+	if err := os.MkdirAll(filepath.Join(configDirectory, "data", "index"), 0755); err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	index.readJournal()
+	index.reconcile()
+	if err := index.compact(); err != nil {
+		return nil, err
+	}
+	log.Log.Info("recordings.index.OpenIndex(): indexed " + strconv.Itoa(len(index.sorted)) + " recordings in " + time.Since(start).Round(time.Millisecond).String())
+	return index, nil
+}
+
+// Close closes the journal.
+func (index *Index) Close() error {
+	index.mutex.Lock()
+	defer index.mutex.Unlock()
+	if index.journal == nil {
+		return nil
+	}
+	err := index.journal.Close()
+	index.journal = nil
+	return err
+}
+
+func (index *Index) journalPath() string {
+	return filepath.Join(index.directory, "data", "index", "recordings.jsonl")
+}
+
+func (index *Index) recordingsDirectory() string {
+	return filepath.Join(index.directory, "data", "recordings")
+}
+
+// readJournal replays the journal. A line which can't be read (e.g. the last
+// one after a power cut) is skipped.
+func (index *Index) readJournal() {
+	file, err := os.Open(index.journalPath())
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry journalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+		if entry.Recording != nil && entry.Recording.Key != "" {
+			index.set(entry.Recording)
+		} else if entry.Delete != "" {
+			index.remove(entry.Delete)
+		}
+	}
+}
+
+// reconcile brings the index in line with the recordings directory, and the
+// upload queue.
+func (index *Index) reconcile() {
+	entries, err := os.ReadDir(index.recordingsDirectory())
+	if err != nil {
+		entries = nil
+	}
+	onDisk := map[string]bool{}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".mp4") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		key := entry.Name()
+		onDisk[key] = true
+
+		recording, ok := index.recordings[key]
+		if ok && recording.Size == info.Size() {
+			continue
+		}
+		if ok {
+			// Rewritten, e.g. encrypted after it was indexed.
+			updated := *recording
+			updated.Size = info.Size()
+			updated.Encrypted = isEncrypted(filepath.Join(index.recordingsDirectory(), key))
+			index.set(&updated)
+			continue
+		}
+		created := index.newRecording(key, info)
+		index.set(&created)
+	}
+	for _, recording := range slices.Clone(index.sorted) {
+		if !onDisk[recording.Key] {
+			index.remove(recording.Key)
+		}
+	}
+
+	// The upload queue is the truth for pending uploads.
+	for _, recording := range index.sorted {
+		pending := uploadQueued(index.directory, recording.Key)
+		if pending && recording.UploadState != models.RecordingUploadPending {
+			recording.UploadState = models.RecordingUploadPending
+		} else if !pending && recording.UploadState == models.RecordingUploadPending {
+			recording.UploadState = ""
+		}
+	}
+}
+
+// newRecording creates the entry of a recording from its name and file.
+func (index *Index) newRecording(key string, info os.FileInfo) models.Recording {
+	recording, ok := models.ParseRecordingName(key)
+	if !ok {
+		// Not named by the agent, the modification time is the best guess.
+		recording = models.Recording{Key: key, Timestamp: info.ModTime().UnixMilli()}
+	}
+	recording.Size = info.Size()
+	recording.Encrypted = isEncrypted(filepath.Join(index.recordingsDirectory(), key))
+	return recording
+}
+
+// compact writes the index as a new journal, and opens it to append to.
+func (index *Index) compact() error {
+	path := index.journalPath()
+	file, err := os.CreateTemp(filepath.Dir(path), ".recordings-*")
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+	for _, recording := range index.sorted {
+		if err = encoder.Encode(journalEntry{Recording: recording}); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = writer.Flush()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), path)
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return err
+	}
+
+	if index.journal != nil {
+		index.journal.Close()
+	}
+	index.journal, err = os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	index.journalEntries = len(index.sorted)
+	return err
+}
+
+// write appends an entry to the journal.
+func (index *Index) write(entry journalEntry) {
+	if index.journal == nil {
+		return
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	if _, err := index.journal.Write(append(line, '\n')); err != nil {
+		log.Log.Error("recordings.index.write(): " + err.Error())
+		return
+	}
+	index.journalEntries++
+	if index.journalEntries > len(index.sorted)+index.compactThreshold {
+		if err := index.compact(); err != nil {
+			log.Log.Error("recordings.index.write(): " + err.Error())
+		}
+	}
+}
+
+// set adds or replaces a recording, without writing the journal.
+func (index *Index) set(recording *models.Recording) {
+	if previous, ok := index.recordings[recording.Key]; ok {
+		if previous.Timestamp == recording.Timestamp {
+			*previous = *recording
+			return
+		}
+		index.remove(recording.Key)
+	}
+	index.recordings[recording.Key] = recording
+	position, _ := slices.BinarySearchFunc(index.sorted, recording, compareRecordings)
+	index.sorted = slices.Insert(index.sorted, position, recording)
+}
+
+// remove removes a recording, without writing the journal.
+func (index *Index) remove(key string) bool {
+	recording, ok := index.recordings[key]
+	if !ok {
+		return false
+	}
+	delete(index.recordings, key)
+	if position, found := slices.BinarySearchFunc(index.sorted, recording, compareRecordings); found {
+		index.sorted = slices.Delete(index.sorted, position, position+1)
+	}
+	return true
+}
+
+func compareRecordings(a *models.Recording, b *models.Recording) int {
+	if a.Timestamp != b.Timestamp {
+		if a.Timestamp < b.Timestamp {
+			return -1
+		}
+		return 1
+	}
+	return strings.Compare(a.Key, b.Key)
+}
+
+// Add adds a recording to the index, or replaces it.
+func (index *Index) Add(recording models.Recording) {
+	index.mutex.Lock()
+	defer index.mutex.Unlock()
+	index.set(&recording)
+	index.write(journalEntry{Recording: &recording})
+}
+
+// Remove removes a recording from the index.
+func (index *Index) Remove(key string) {
+	index.mutex.Lock()
+	defer index.mutex.Unlock()
+	if index.remove(key) {
+		index.write(journalEntry{Delete: key})
+	}
+}
+
+// SetUploadState sets the upload state of a recording, see
+// models.RecordingUploadPending.
+func (index *Index) SetUploadState(key string, state string) {
+	index.mutex.Lock()
+	defer index.mutex.Unlock()
+	recording, ok := index.recordings[key]
+	if !ok || recording.UploadState == state {
+		return
+	}
+	recording.UploadState = state
+	index.write(journalEntry{Recording: recording})
+}
+
+// Get returns a recording.
+func (index *Index) Get(key string) (models.Recording, bool) {
+	index.mutex.Lock()
+	defer index.mutex.Unlock()
+	recording, ok := index.recordings[key]
+	if !ok {
+		return models.Recording{}, false
+	}
+	return *recording, true
+}
+
+// Count returns the number of recordings.
+func (index *Index) Count() int {
+	index.mutex.Lock()
+	defer index.mutex.Unlock()
+	return len(index.sorted)
+}
+
+// Query returns a page of recordings, the newest first, as filtered by the
+// event filter: the recordings which started (in unix seconds) before
+// TimestampOffsetEnd and from TimestampOffsetStart, at most NumberOfElements.
+func (index *Index) Query(filter models.EventFilter) []models.Recording {
+	index.mutex.Lock()
+	defer index.mutex.Unlock()
+
+	end := len(index.sorted)
+	if filter.TimestampOffsetEnd > 0 {
+		end, _ = slices.BinarySearchFunc(index.sorted, filter.TimestampOffsetEnd*1000, func(recording *models.Recording, timestamp int64) int {
+			return compareTimestamps(recording.Timestamp/1000*1000, timestamp)
+		})
+	}
+	recordings := []models.Recording{}
+	for i := end - 1; i >= 0; i-- {
+		recording := index.sorted[i]
+		if filter.TimestampOffsetStart > 0 && recording.Timestamp/1000 < filter.TimestampOffsetStart {
+			break
+		}
+		recordings = append(recordings, *recording)
+		if filter.NumberOfElements > 0 && len(recordings) >= filter.NumberOfElements {
+			break
+		}
+	}
+	return recordings
+}
+
+func compareTimestamps(a int64, b int64) int {
+	if a < b {
+		return -1
+	} else if a > b {
+		return 1
+	}
+	return 0
+}
+
+// Days returns the days with recordings, formatted as 02-01-2006 in the
+// location, the newest first.
+func (index *Index) Days(location *time.Location) []string {
+	index.mutex.Lock()
+	defer index.mutex.Unlock()
+	days := []string{}
+	for i := len(index.sorted) - 1; i >= 0; i-- {
+		day := time.UnixMilli(index.sorted[i].Timestamp).In(location).Format("02-01-2006")
+		if len(days) == 0 || days[len(days)-1] != day {
+			days = append(days, day)
+		}
+	}
+	return days
+}
+
+// Oldest calls found for the recordings, the oldest first, until it returns
+// false. found can't use the index.
+func (index *Index) Oldest(found func(recording models.Recording) bool) {
+	index.mutex.Lock()
+	defer index.mutex.Unlock()
+	for _, recording := range index.sorted {
+		if !found(*recording) {
+			return
+		}
+	}
+}
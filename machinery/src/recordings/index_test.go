@@ -0,0 +1,110 @@
+package recordings
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/kerberos-io/agent/machinery/src/models"
+)
+
+func writeRecording(t *testing.T, configDirectory string, key string, content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(configDirectory, "data", "recordings", key), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func keys(recordings []models.Recording) []string {
+	result := []string{}
+	for _, recording := range recordings {
+		result = append(result, recording.Key)
+	}
+	return result
+}
+
+func TestIndex(t *testing.T) {
+	configDirectory := t.TempDir()
+	for _, directory := range []string{"recordings", "cloud"} {
+		if err := os.MkdirAll(filepath.Join(configDirectory, "data", directory), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	first := "1700000000_6-474_camera_200-200-400-400_24_769.mp4"
+	second := "1700000100_6-120_camera_0-0-100-100_12_5000.mp4"
+	third := "1700086400_6-000_camera_0-0-100-100_3_1000.mp4"
+	writeRecording(t, configDirectory, first, "first")
+	writeRecording(t, configDirectory, second, "Salted__second")
+	writeRecording(t, configDirectory, third, "third")
+	writeRecording(t, configDirectory, "notes.txt", "not a recording")
+	if err := os.WriteFile(filepath.Join(configDirectory, "data", "cloud", second), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	index, err := OpenIndex(configDirectory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if index.Count() != 3 {
+		t.Fatalf("expected 3 recordings, got %d", index.Count())
+	}
+	recording, ok := index.Get(first)
+	if !ok || recording.Timestamp != 1700000000474 || recording.Duration != 769 || recording.NumberOfChanges != 24 || recording.Size != 5 {
+		t.Errorf("unexpected recording %+v", recording)
+	}
+	if recording, _ = index.Get(second); !recording.Encrypted || recording.UploadState != models.RecordingUploadPending {
+		t.Errorf("expected the second recording to be encrypted and pending, got %+v", recording)
+	}
+
+	// Queries are the newest first, the offsets in seconds.
+	if result := keys(index.Query(models.EventFilter{})); !slices.Equal(result, []string{third, second, first}) {
+		t.Errorf("unexpected query %v", result)
+	}
+	if result := keys(index.Query(models.EventFilter{NumberOfElements: 1, TimestampOffsetEnd: 1700086400})); !slices.Equal(result, []string{second}) {
+		t.Errorf("expected the next page to start after the third recording, got %v", result)
+	}
+	if result := keys(index.Query(models.EventFilter{TimestampOffsetStart: 1700000100})); !slices.Equal(result, []string{third, second}) {
+		t.Errorf("unexpected query from a start %v", result)
+	}
+	if days := index.Days(time.UTC); !slices.Equal(days, []string{"15-11-2023", "14-11-2023"}) {
+		t.Errorf("unexpected days %v", days)
+	}
+
+	// Changes are kept in the journal.
+	fourth := "1700090000_6-000_camera_0-0-100-100_3_1000.mp4"
+	writeRecording(t, configDirectory, fourth, "fourth")
+	info, _ := os.Stat(filepath.Join(configDirectory, "data", "recordings", fourth))
+	added := index.newRecording(fourth, info)
+	added.Labels = []string{"person"}
+	index.Add(added)
+	index.SetUploadState(third, models.RecordingUploadFinished)
+	index.Remove(first)
+	if err := os.Remove(filepath.Join(configDirectory, "data", "recordings", first)); err != nil {
+		t.Fatal(err)
+	}
+	index.Close()
+
+	// Changes made while the agent was stopped are picked up.
+	if err := os.Remove(filepath.Join(configDirectory, "data", "recordings", second)); err != nil {
+		t.Fatal(err)
+	}
+	fifth := "1700100000_6-000_camera_0-0-100-100_3_1000.mp4"
+	writeRecording(t, configDirectory, fifth, "fifth")
+
+	index, err = OpenIndex(configDirectory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer index.Close()
+	if result := keys(index.Query(models.EventFilter{})); !slices.Equal(result, []string{fifth, fourth, third}) {
+		t.Errorf("unexpected recordings after reopening %v", result)
+	}
+	if recording, _ = index.Get(fourth); !slices.Equal(recording.Labels, []string{"person"}) {
+		t.Errorf("expected the labels to be kept, got %+v", recording)
+	}
+	if recording, _ = index.Get(third); recording.UploadState != models.RecordingUploadFinished {
+		t.Errorf("expected the upload state to be kept, got %+v", recording)
+	}
+}
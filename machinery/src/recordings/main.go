@@ -0,0 +1,95 @@
+package recordings
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/kerberos-io/agent/machinery/src/encryption"
+	"github.com/kerberos-io/agent/machinery/src/log"
+	"github.com/kerberos-io/agent/machinery/src/models"
+)
+
+var (
+	defaultIndexMutex sync.Mutex
+	defaultIndex      *Index
+)
+
+// Open opens the index of the agent, see Default. It is only opened once.
+func Open(configDirectory string) *Index {
+	defaultIndexMutex.Lock()
+	defer defaultIndexMutex.Unlock()
+	if defaultIndex != nil {
+		return defaultIndex
+	}
+	index, err := OpenIndex(configDirectory)
+	if err != nil {
+		log.Log.Error("recordings.main.Open(): " + err.Error())
+		return nil
+	}
+	defaultIndex = index
+	return index
+}
+
+// Default returns the index of the agent, or nil when it isn't open: then
+// the recordings directory has to be read instead.
+func Default() *Index {
+	defaultIndexMutex.Lock()
+	defer defaultIndexMutex.Unlock()
+	return defaultIndex
+}
+
+// Add indexes a recording which was written to the recordings directory,
+// with the metadata of its name and file.
+func Add(configDirectory string, key string, update func(recording *models.Recording)) {
+	index := Default()
+	if index == nil {
+		return
+	}
+	info, err := os.Stat(filepath.Join(configDirectory, "data", "recordings", key))
+	if err != nil {
+		log.Log.Error("recordings.main.Add(): " + err.Error())
+		return
+	}
+	recording := index.newRecording(key, info)
+	if update != nil {
+		update(&recording)
+	}
+	index.Add(recording)
+}
+
+// Remove removes a recording from the index, when it is open.
+func Remove(key string) {
+	if index := Default(); index != nil {
+		index.Remove(key)
+	}
+}
+
+// SetUploadState sets the upload state of a recording, when the index is
+// open.
+func SetUploadState(key string, state string) {
+	if index := Default(); index != nil {
+		index.SetUploadState(key, state)
+	}
+}
+
+// isEncrypted tells if the file is encrypted, see encryption.IsEncrypted.
+func isEncrypted(path string) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	return encryption.IsEncrypted(file)
+}
+
+// uploadQueued tells if the recording has a marker in the upload queue, by
+// its current or older name.
+func uploadQueued(configDirectory string, key string) bool {
+	for _, marker := range []string{models.RecordingUploadMetadataFileName(key), key} {
+		if _, err := os.Stat(filepath.Join(configDirectory, "data", "cloud", marker)); err == nil {
+			return true
+		}
+	}
+	return false
+}
@@ -35,6 +35,11 @@ func AddRoutes(r *gin.Engine, authMiddleware *jwt.GinJWTMiddleware, configDirect
 		// Public endpoints (no authentication required)
 		api.POST("/login", authMiddleware.LoginHandler)
 
+		// A recording with a signed URL, see /api/recordings/:key/url.
+		api.GET("/recordings/:key/signed", func(c *gin.Context) {
+			components.GetSignedRecording(c, configDirectory, configuration)
+		})
+
 		// Apply JWT authentication middleware.
 		// All routes registered below this line require a valid JWT token.
 		api.Use(authMiddleware.MiddlewareFunc())
@@ -47,6 +52,35 @@ func AddRoutes(r *gin.Engine, authMiddleware *jwt.GinJWTMiddleware, configDirect
 				components.GetLatestEvents(c, configDirectory, configuration, communication)
 			})
 
+			// Stream or download a recording.
+			api.GET("/recordings/:key", func(c *gin.Context) {
+				components.GetRecording(c, configDirectory, configuration)
+			})
+
+			api.POST("/recordings/:key/url", func(c *gin.Context) {
+				components.GetRecordingURL(c, configDirectory, configuration)
+			})
+
+			api.POST("/exports", func(c *gin.Context) {
+				components.CreateExport(c, configDirectory, configuration)
+			})
+
+			api.GET("/exports", func(c *gin.Context) {
+				components.GetExports(c)
+			})
+
+			api.GET("/exports/:id", func(c *gin.Context) {
+				components.GetExport(c)
+			})
+
+			api.GET("/exports/:id/download", func(c *gin.Context) {
+				components.DownloadExport(c, configDirectory)
+			})
+
+			api.DELETE("/exports/:id", func(c *gin.Context) {
+				components.DeleteExport(c, configDirectory)
+			})
+
 			api.GET("/days", func(c *gin.Context) {
 				components.GetDays(c, configDirectory, configuration, communication)
 			})
@@ -74,6 +108,32 @@ func AddRoutes(r *gin.Engine, authMiddleware *jwt.GinJWTMiddleware, configDirect
 				cloud.VerifySecondaryPersistence(c, configDirectory)
 			})
 
+			// Upload queue inspection and control.
+			api.GET("/uploads", func(c *gin.Context) {
+				components.GetUploads(c, configDirectory, configuration)
+			})
+
+			api.POST("/uploads/retry", func(c *gin.Context) {
+				components.RetryUploads(c, configDirectory, configuration)
+			})
+
+			api.POST("/uploads/cancel", func(c *gin.Context) {
+				components.CancelUploads(c, configDirectory, configuration)
+			})
+
+			api.POST("/uploads/requeue", func(c *gin.Context) {
+				components.RequeueUploads(c, configDirectory, configuration)
+			})
+
+			// Motion activity, to tune the motion zones.
+			api.GET("/activity/heatmap", func(c *gin.Context) {
+				components.GetActivityHeatmap(c, configDirectory, configuration)
+			})
+
+			api.GET("/activity/timeline", func(c *gin.Context) {
+				components.GetActivityTimeline(c, configDirectory, configuration)
+			})
+
 			// Camera specific methods.
 			api.POST("/camera/restart", func(c *gin.Context) {
 				components.RestartAgent(c, communication)
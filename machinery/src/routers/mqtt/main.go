@@ -18,6 +18,8 @@ import (
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
 	"github.com/kerberos-io/agent/machinery/src/capture"
+	"github.com/kerberos-io/agent/machinery/src/cloud"
+	"github.com/kerberos-io/agent/machinery/src/conditions"
 	configService "github.com/kerberos-io/agent/machinery/src/config"
 	"github.com/kerberos-io/agent/machinery/src/encryption"
 	"github.com/kerberos-io/agent/machinery/src/log"
@@ -119,6 +121,7 @@ func ConfigureMQTT(configDirectory string, configuration *models.Configuration,
 		})
 		opts.SetOnConnectHandler(func(c mqtt.Client) {
 			log.Log.Info("routers.mqtt.main.ConfigureMQTT(): MQTT session is online")
+			conditions.UseMQTTClient(c)
 		})
 
 		hubKey := ""
@@ -156,6 +159,9 @@ func ConfigureMQTT(configDirectory string, configuration *models.Configuration,
 
 				// Create a susbcription for listen and reply
 				MQTTListenerHandler(c, hubKey, configDirectory, configuration, communication)
+
+				// The MQTT conditions subscribe to their topics again.
+				conditions.UseMQTTClient(c)
 			}
 		}
 		mqc := mqtt.NewClient(opts)
@@ -355,6 +361,10 @@ func MQTTListenerHandler(mqttClient mqtt.Client, hubKey string, configDirectory
 					go HandleReceiveHDCandidates(mqttClient, hubKey, payload, configuration, communication)
 				case "trigger-relay":
 					go HandleTriggerRelay(mqttClient, hubKey, payload, configuration, communication)
+				case "request-uploads":
+					go HandleRequestUploads(mqttClient, hubKey, payload, configDirectory, configuration, communication)
+				case "retry-uploads", "cancel-uploads", "requeue-uploads":
+					go HandleUploadQueueAction(mqttClient, hubKey, payload, configDirectory, configuration, communication)
 				}
 
 			}
@@ -861,6 +871,91 @@ func HandleTriggerRelay(mqttClient mqtt.Client, hubKey string, payload models.Pa
 	}
 }
 
+// HandleRequestUploads sends (a page of) the upload queue back to Hub, so an
+// operator can see what is pending or failing, e.g. after a long outage.
+func HandleRequestUploads(mqttClient mqtt.Client, hubKey string, payload models.Payload, configDirectory string, configuration *models.Configuration, communication *models.Communication) {
+	value := payload.Value
+	jsonData, _ := json.Marshal(value)
+	var requestUploadsPayload models.RequestUploadsPayload
+	json.Unmarshal(jsonData, &requestUploadsPayload)
+
+	if requestUploadsPayload.Timestamp != 0 {
+		entries := cloud.ListUploadQueue(configDirectory, configuration)
+		total := len(entries)
+
+		limit := requestUploadsPayload.Limit
+		if limit <= 0 {
+			limit = 100
+		}
+		offset := requestUploadsPayload.Offset
+		if offset < 0 || offset > total {
+			offset = total
+		}
+		entries = entries[offset:]
+		if limit < len(entries) {
+			entries = entries[:limit]
+		}
+
+		message := models.Message{
+			Payload: models.Payload{
+				Action:   "receive-uploads",
+				DeviceId: configuration.Config.Key,
+				Value: map[string]interface{}{
+					"timestamp": time.Now().Unix(),
+					"total":     total,
+					"uploads":   entries,
+					"targets":   cloud.GetUploadTargetStatus(configuration),
+				},
+			},
+		}
+		payload, err := models.PackageMQTTMessage(configuration, message)
+		if err == nil {
+			mqttClient.Publish("kerberos/hub/"+hubKey, 2, false, payload)
+		} else {
+			log.Log.Info("routers.mqtt.main.HandleRequestUploads(): something went wrong while sending the upload queue to hub: " + string(payload))
+		}
+	}
+}
+
+// HandleUploadQueueAction retries, cancels or requeues recordings in the upload
+// queue, and acknowledges the outcome per recording.
+func HandleUploadQueueAction(mqttClient mqtt.Client, hubKey string, payload models.Payload, configDirectory string, configuration *models.Configuration, communication *models.Communication) {
+	value := payload.Value
+	jsonData, _ := json.Marshal(value)
+	var request models.UploadQueueRequest
+	json.Unmarshal(jsonData, &request)
+
+	if request.Timestamp != 0 {
+		var results []models.UploadQueueResult
+		switch payload.Action {
+		case "retry-uploads":
+			results = cloud.RetryUploads(configDirectory, configuration, request)
+		case "cancel-uploads":
+			results = cloud.CancelUploads(configDirectory, configuration, request)
+		case "requeue-uploads":
+			results = cloud.RequeueUploads(configDirectory, configuration, request)
+		}
+		log.Log.Info("routers.mqtt.main.HandleUploadQueueAction(): " + payload.Action + " applied to " + strconv.Itoa(len(results)) + " recording(s)")
+
+		message := models.Message{
+			Payload: models.Payload{
+				Action:   "acknowledge-" + payload.Action,
+				DeviceId: configuration.Config.Key,
+				Value: map[string]interface{}{
+					"timestamp": time.Now().Unix(),
+					"results":   results,
+				},
+			},
+		}
+		payload, err := models.PackageMQTTMessage(configuration, message)
+		if err == nil {
+			mqttClient.Publish("kerberos/hub/"+hubKey, 2, false, payload)
+		} else {
+			log.Log.Info("routers.mqtt.main.HandleUploadQueueAction(): something went wrong while sending the acknowledgement to hub: " + string(payload))
+		}
+	}
+}
+
 func DisconnectMQTT(mqttClient mqtt.Client, config *models.Config) {
 	if mqttClient != nil {
 		// Cleanup all subscriptions
@@ -1,12 +1,60 @@
 package mqtt
 
 import (
+	"encoding/json"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/kerberos-io/agent/machinery/src/cloud"
 	"github.com/kerberos-io/agent/machinery/src/models"
 )
 
+// publishedToken is the token of a publish which completed right away.
+type publishedToken struct{}
+
+func (publishedToken) Wait() bool                     { return true }
+func (publishedToken) WaitTimeout(time.Duration) bool { return true }
+func (publishedToken) Done() <-chan struct{} {
+	done := make(chan struct{})
+	close(done)
+	return done
+}
+func (publishedToken) Error() error { return nil }
+
+// publishClient is an MQTT client which keeps the messages it publishes.
+type publishClient struct {
+	mqtt.Client
+	messages []models.Message
+}
+
+func (c *publishClient) Publish(topic string, qos byte, retained bool, payload interface{}) mqtt.Token {
+	var message models.Message
+	json.Unmarshal(payload.([]byte), &message)
+	c.messages = append(c.messages, message)
+	return publishedToken{}
+}
+
+// acknowledgedResults returns the results of the last acknowledgement.
+func (c *publishClient) acknowledgedResults(t *testing.T, action string) []models.UploadQueueResult {
+	t.Helper()
+	if len(c.messages) == 0 {
+		t.Fatal("nothing was published")
+	}
+	message := c.messages[len(c.messages)-1]
+	if message.Payload.Action != action {
+		t.Fatalf("published %q, want %q", message.Payload.Action, action)
+	}
+	var value struct {
+		Results []models.UploadQueueResult `json:"results"`
+	}
+	data, _ := json.Marshal(message.Payload.Value)
+	json.Unmarshal(data, &value)
+	return value.Results
+}
+
 func TestEnqueueLatestAudioReplacesOldestFrameWhenFull(t *testing.T) {
 	audioChannel := make(chan models.AudioDataPartial, 2)
 	audioChannel <- models.AudioDataPartial{Timestamp: 1}
@@ -37,3 +85,53 @@ func TestEnqueueLatestAudioDoesNotBlockNilChannel(t *testing.T) {
 		t.Fatal("enqueueLatestAudio() blocked on a nil channel")
 	}
 }
+
+func TestHandleUploadQueueActionRetryAndCancel(t *testing.T) {
+	fileName := "1704200000_6-967003_front_0-0-0-0_0_0.mp4"
+	markerFileName := models.RecordingUploadMetadataFileName(fileName)
+	configDirectory := t.TempDir()
+	for _, directory := range []string{"cloud", "recordings", filepath.Join("uploads", "nas")} {
+		os.MkdirAll(filepath.Join(configDirectory, "data", directory), 0755)
+	}
+	os.WriteFile(filepath.Join(configDirectory, "data", "recordings", fileName), []byte("recording"), 0644)
+	os.WriteFile(filepath.Join(configDirectory, "data", "cloud", markerFileName), []byte("{}"), 0644)
+	failed, _ := json.Marshal(models.UploadTargetMarker{Target: "nas", FileName: fileName, Status: models.UploadTargetFailed, Attempts: 3})
+	os.WriteFile(filepath.Join(configDirectory, "data", "uploads", "nas", markerFileName+".json"), failed, 0644)
+
+	configuration := &models.Configuration{Config: models.Config{Key: "camera1", UploadTargets: []*models.UploadTarget{
+		{Name: "nas", Cloud: "sftp", Required: "false"},
+	}}}
+	client := &publishClient{}
+	request := func(action string) models.Payload {
+		return models.Payload{Action: action, Value: map[string]interface{}{
+			"timestamp": time.Now().Unix(),
+			"filenames": []string{fileName},
+		}}
+	}
+
+	HandleUploadQueueAction(client, "hub", request("retry-uploads"), configDirectory, configuration, nil)
+	if results := client.acknowledgedResults(t, "acknowledge-retry-uploads"); len(results) != 1 || !results[0].Success {
+		t.Fatalf("retry results = %+v", results)
+	}
+	entries := cloud.ListUploadQueue(configDirectory, configuration)
+	if len(entries) != 1 || entries[0].Targets[0].Status != models.UploadTargetPending || entries[0].Targets[0].Attempts != 0 {
+		t.Fatalf("queue after retry = %+v, want the target pending again", entries)
+	}
+
+	HandleUploadQueueAction(client, "hub", request("cancel-uploads"), configDirectory, configuration, nil)
+	if results := client.acknowledgedResults(t, "acknowledge-cancel-uploads"); len(results) != 1 || !results[0].Success {
+		t.Fatalf("cancel results = %+v", results)
+	}
+	if entries := cloud.ListUploadQueue(configDirectory, configuration); len(entries) != 0 {
+		t.Fatalf("queue after cancel = %+v, want empty", entries)
+	}
+	if _, err := os.Stat(filepath.Join(configDirectory, "data", "recordings", fileName)); err != nil {
+		t.Fatalf("cancel removed the recording: %v", err)
+	}
+
+	// A cancelled recording can't be retried.
+	HandleUploadQueueAction(client, "hub", request("retry-uploads"), configDirectory, configuration, nil)
+	if results := client.acknowledgedResults(t, "acknowledge-retry-uploads"); len(results) != 1 || results[0].Success {
+		t.Fatalf("retry after cancel results = %+v, want an error", results)
+	}
+}
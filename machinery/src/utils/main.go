@@ -13,6 +13,7 @@ import (
 	"os/exec"
 	"path/filepath"
 	"reflect"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
@@ -243,6 +244,33 @@ func GetMediaFormatted(files []os.FileInfo, recordingDirectory string, configura
 	return filePaths
 }
 
+// GetRecordingsFormatted formats recordings of the recording index, as
+// GetMediaFormatted does for the files of the recordings directory.
+func GetRecordingsFormatted(recordings []models.Recording, recordingDirectory string, configuration *models.Configuration) []models.Media {
+	loc, _ := time.LoadLocation(configuration.Config.Timezone)
+	filePaths := []models.Media{}
+	for _, recording := range recordings {
+		start := time.UnixMilli(recording.Timestamp).In(loc)
+		filePaths = append(filePaths, models.Media{
+			Key:         recording.Key,
+			Path:        recordingDirectory + "/" + recording.Key,
+			CameraName:  configuration.Config.Name,
+			CameraKey:   configuration.Config.Key,
+			Day:         start.Format("02-01-2006"),
+			ShortDay:    start.Format("Jan _2"),
+			Time:        start.Format("15:04:05"),
+			Timestamp:   strconv.FormatInt(recording.Timestamp/1000, 10),
+			Duration:    recording.Duration,
+			Size:        recording.Size,
+			Zones:       recording.Zones,
+			Labels:      recording.Labels,
+			UploadState: recording.UploadState,
+			Encrypted:   recording.Encrypted,
+		})
+	}
+	return filePaths
+}
+
 func GetDays(files []os.FileInfo, recordingDirectory string, configuration *models.Configuration) []string {
 	days := []string{}
 	for _, file := range files {
@@ -263,6 +291,16 @@ func GetDays(files []os.FileInfo, recordingDirectory string, configuration *mode
 	return uniqueDays
 }
 
+// AppendUnique adds the values which aren't in the list yet, in order.
+func AppendUnique(values []string, more []string) []string {
+	for _, value := range more {
+		if !slices.Contains(values, value) {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
 func Unique(intSlice []string) []string {
 	keys := make(map[string]bool)
 	list := []string{}
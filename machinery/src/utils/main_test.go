@@ -52,3 +52,10 @@ func TestGetMediaFormattedHonorsTimestampRange(t *testing.T) {
 		t.Fatalf("expected camera key to be preserved, got %s", media[0].CameraKey)
 	}
 }
+
+func TestAppendUnique(t *testing.T) {
+	values := AppendUnique([]string{"door"}, []string{"gate", "door", "gate", "yard"})
+	if len(values) != 3 || values[0] != "door" || values[1] != "gate" || values[2] != "yard" {
+		t.Fatalf("AppendUnique() = %v, want [door gate yard]", values)
+	}
+}
@@ -0,0 +1,343 @@
+package video
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/Eyevinn/mp4ff/hevc"
+	mp4ff "github.com/Eyevinn/mp4ff/mp4"
+	"github.com/kerberos-io/agent/machinery/src/log"
+	"github.com/kerberos-io/agent/machinery/src/models"
+)
+
+// ExportMaxGapMs is the longest gap between two recordings which is kept in
+// an export. Longer gaps (e.g. between motion recordings) are cut, so the
+// export doesn't show a frozen frame for minutes.
+const ExportMaxGapMs = 2000
+
+// ExportSource is a recording which is stitched into an export.
+type ExportSource struct {
+	Name  string
+	Start int64 // Unix milliseconds, the start of the recording.
+	// Open returns the (decrypted) content of the recording.
+	Open func() (io.ReadCloser, error)
+}
+
+// ExportResult describes an export written by Export.
+type ExportResult struct {
+	Start      int64    // Unix milliseconds of the first frame, the keyframe at or before the requested start.
+	End        int64    // Unix milliseconds of the end of the last frame.
+	Duration   uint64   // Milliseconds, without the gaps which were cut.
+	Recordings []string // The recordings of which frames were used.
+}
+
+// exportTrack is the video or audio track of a recording.
+type exportTrack struct {
+	trak      *mp4ff.TrakBox
+	trex      *mp4ff.TrexBox
+	timescale uint64
+}
+
+// exportSample is a sample of a recording, at its time in the recording.
+type exportSample struct {
+	video bool
+	time  int64 // Unix milliseconds.
+	full  mp4ff.FullSample
+}
+
+// Export stitches the frames between start and end (unix milliseconds) of
+// the sources, sorted by their start, into a single MP4 at fileName. The
+// samples are copied without re-encoding, so the export starts at the
+// keyframe at or before start. Where sources overlap (e.g. the pre-recording
+// of a motion recording) the frames of the first one are used. progress is
+// called with the fraction of the sources which is done. The config signs the
+// export, as the recordings are signed, see MP4.Close.
+func Export(ctx context.Context, fileName string, sources []ExportSource, start int64, end int64, config *models.Config, progress func(done float64)) (ExportResult, error) {
+	var result ExportResult
+	if progress == nil {
+		progress = func(done float64) {}
+	}
+	if end <= start {
+		return result, errors.New("the end of the export is before its start")
+	}
+
+	var mp4Video *MP4
+	var codec string
+	var spsNALUs, ppsNALUs [][]byte
+	var videoTrack, audioTrack uint32
+	exportConfig := *config
+
+	var origin, shift int64        // The time of the first frame, and the gaps which were cut.
+	var lastVideo, lastAudio int64 // The time of the last sample written.
+	var lastFrameDuration int64 = 40
+
+	for i, source := range sources {
+		if err := ctx.Err(); err != nil {
+			if mp4Video != nil {
+				mp4Video.FileWriter.Close()
+			}
+			return result, err
+		}
+		if source.Start >= end {
+			break
+		}
+
+		file, err := readExportSource(source)
+		if err != nil {
+			log.Log.Warning("video.export.Export(): skipping " + source.Name + ": " + err.Error())
+			continue
+		}
+		video, audio := exportTracks(file)
+		if video == nil {
+			log.Log.Warning("video.export.Export(): skipping " + source.Name + ": no video track")
+			continue
+		}
+		sourceCodec, vps, sps, pps := exportParameterSets(video.trak)
+		if sourceCodec == "" {
+			log.Log.Warning("video.export.Export(): skipping " + source.Name + ": unsupported codec")
+			continue
+		}
+
+		samples, err := exportSamples(file, source.Start, video, audio)
+		if err != nil {
+			log.Log.Warning("video.export.Export(): skipping " + source.Name + ": " + err.Error())
+			continue
+		}
+
+		// The first frame is the keyframe at or before the start of the export.
+		first := 0
+		if result.Recordings == nil {
+			if !slices.ContainsFunc(samples, func(sample exportSample) bool { return sample.video && sample.time >= start }) {
+				continue
+			}
+			for j, sample := range samples {
+				if sample.video && sample.full.IsSync() && sample.time <= start {
+					first = j
+				}
+			}
+		}
+
+		if mp4Video == nil {
+			codec, spsNALUs, ppsNALUs = sourceCodec, sps, pps
+			// The keyframe before the start adds at most a GOP.
+			mp4Video = NewMP4(fileName, sps, pps, vps, (end-start)/1000+30)
+			if entry := video.trak.Mdia.Minf.Stbl.Stsd.AvcX; entry != nil {
+				mp4Video.SetWidth(int(entry.Width))
+				mp4Video.SetHeight(int(entry.Height))
+			} else if entry := video.trak.Mdia.Minf.Stbl.Stsd.HvcX; entry != nil {
+				mp4Video.SetWidth(int(entry.Width))
+				mp4Video.SetHeight(int(entry.Height))
+			}
+			videoTrack = mp4Video.AddVideoTrack(codec)
+			if audio != nil && audio.trak.Mdia.Minf.Stbl.Stsd.Mp4a != nil {
+				audioTrack = mp4Video.AddAudioTrack("AAC")
+				exportConfig.Capture.IPCamera.SampleRate = int(audio.trak.Mdia.Minf.Stbl.Stsd.Mp4a.SampleRate)
+			}
+		} else if sourceCodec != codec {
+			log.Log.Warning("video.export.Export(): skipping " + source.Name + ": " + sourceCodec + " instead of " + codec)
+			continue
+		}
+
+		// Parameter sets which changed (e.g. the resolution) are sent in-band.
+		var inBand []byte
+		if !slices.EqualFunc(sps, spsNALUs, slices.Equal) || !slices.EqualFunc(pps, ppsNALUs, slices.Equal) {
+			for _, nalu := range slices.Concat(vps, sps, pps) {
+				inBand = append(inBand, 0, 0, 0, 1)
+				inBand = append(inBand, nalu...)
+			}
+		}
+
+		used := false
+		keyframe := false // Each recording is joined at a keyframe.
+		var joined int64
+		for j := first; j < len(samples); j++ {
+			sample := samples[j]
+			if j%100 == 0 {
+				if err := ctx.Err(); err != nil {
+					mp4Video.FileWriter.Close()
+					return result, err
+				}
+				progress((float64(i) + float64(j)/float64(len(samples))) / float64(len(sources)))
+			}
+			if sample.video {
+				if sample.time >= end {
+					break
+				}
+				if result.Recordings != nil && sample.time <= lastVideo {
+					continue
+				}
+				if !keyframe {
+					if !sample.full.IsSync() {
+						continue
+					}
+					keyframe = true
+					joined = sample.time
+					if result.Recordings == nil {
+						origin = sample.time
+						result.Start = sample.time
+					} else if gap := sample.time - lastVideo; gap > ExportMaxGapMs {
+						shift += gap - lastFrameDuration
+					}
+				}
+				data := lengthPrefixedToAnnexB(sample.full.Data)
+				if sample.full.IsSync() && inBand != nil {
+					data = append(slices.Clone(inBand), data...)
+				}
+				offset := int64(sample.full.CompositionTimeOffset) * 1000 / int64(video.timescale)
+				if err := mp4Video.AddSampleToTrack(videoTrack, sample.full.IsSync(), data, uint64(sample.time-shift-origin), offset); err != nil {
+					log.Log.Error("video.export.Export(): " + err.Error())
+				}
+				if lastVideo > 0 && sample.time > lastVideo {
+					lastFrameDuration = sample.time - lastVideo
+				}
+				lastVideo = sample.time
+				result.End = sample.time + int64(sample.full.Dur)*1000/int64(video.timescale)
+				if !used {
+					used = true
+					result.Recordings = append(result.Recordings, source.Name)
+				}
+			} else if keyframe && audioTrack > 0 && sample.time > lastAudio && sample.time >= joined && sample.time < end {
+				if adts, err := ConvertASCToADTS(exportAudioConfig(audio.trak), len(sample.full.Data)+7); err == nil {
+					if err := mp4Video.AddSampleToTrack(audioTrack, false, append(adts.Encode(), sample.full.Data...), uint64(sample.time-shift-origin), 0); err != nil {
+						log.Log.Error("video.export.Export(): " + err.Error())
+					}
+				}
+				lastAudio = sample.time
+			}
+		}
+		progress(float64(i+1) / float64(len(sources)))
+	}
+
+	if mp4Video == nil || result.Recordings == nil {
+		if mp4Video != nil {
+			mp4Video.FileWriter.Close()
+		}
+		return result, errors.New("no recordings found between the start and end of the export")
+	}
+	mp4Video.Close(&exportConfig)
+	result.Duration = mp4Video.VideoTotalDuration
+	log.Log.Info(fmt.Sprintf("video.export.Export(): exported %d ms of %d recordings to %s", result.Duration, len(result.Recordings), fileName))
+	return result, nil
+}
+
+func readExportSource(source ExportSource) (*mp4ff.File, error) {
+	reader, err := source.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return mp4ff.DecodeFile(reader)
+}
+
+// exportTracks returns the video and audio track of a recording.
+func exportTracks(file *mp4ff.File) (video *exportTrack, audio *exportTrack) {
+	if file.Init == nil || file.Init.Moov == nil {
+		return nil, nil
+	}
+	moov := file.Init.Moov
+	for _, trak := range moov.Traks {
+		track := &exportTrack{trak: trak, timescale: uint64(trak.Mdia.Mdhd.Timescale)}
+		if track.timescale == 0 {
+			continue
+		}
+		if moov.Mvex != nil {
+			track.trex, _ = moov.Mvex.GetTrex(trak.Tkhd.TrackID)
+		}
+		switch trak.Mdia.Hdlr.HandlerType {
+		case "vide":
+			if video == nil {
+				video = track
+			}
+		case "soun":
+			if audio == nil {
+				audio = track
+			}
+		}
+	}
+	return video, audio
+}
+
+// exportParameterSets returns the codec and parameter sets of a video track.
+func exportParameterSets(trak *mp4ff.TrakBox) (codec string, vps [][]byte, sps [][]byte, pps [][]byte) {
+	stsd := trak.Mdia.Minf.Stbl.Stsd
+	if stsd.AvcX != nil && stsd.AvcX.AvcC != nil {
+		return "H264", nil, stsd.AvcX.AvcC.SPSnalus, stsd.AvcX.AvcC.PPSnalus
+	}
+	if stsd.HvcX != nil && stsd.HvcX.HvcC != nil {
+		record := stsd.HvcX.HvcC.DecConfRec
+		return "H265", record.GetNalusForType(hevc.NALU_VPS), record.GetNalusForType(hevc.NALU_SPS), record.GetNalusForType(hevc.NALU_PPS)
+	}
+	return "", nil, nil, nil
+}
+
+// exportAudioConfig returns the AudioSpecificConfig of an AAC track.
+func exportAudioConfig(trak *mp4ff.TrakBox) []byte {
+	entry := trak.Mdia.Minf.Stbl.Stsd.Mp4a
+	if entry == nil || entry.Esds == nil || entry.Esds.DecConfigDescriptor == nil || entry.Esds.DecConfigDescriptor.DecSpecificInfo == nil {
+		return nil
+	}
+	return entry.Esds.DecConfigDescriptor.DecSpecificInfo.DecConfig
+}
+
+// exportSamples returns the samples of the video and audio track of a
+// recording, in order of their time.
+func exportSamples(file *mp4ff.File, start int64, video *exportTrack, audio *exportTrack) ([]exportSample, error) {
+	samples := []exportSample{}
+	for _, segment := range file.Segments {
+		for _, fragment := range segment.Fragments {
+			for _, track := range []*exportTrack{video, audio} {
+				if track == nil {
+					continue
+				}
+				trex := track.trex
+				if trex == nil {
+					trex = &mp4ff.TrexBox{TrackID: track.trak.Tkhd.TrackID}
+				}
+				fullSamples, err := fragment.GetFullSamples(trex)
+				if err != nil {
+					return nil, err
+				}
+				for _, full := range fullSamples {
+					samples = append(samples, exportSample{
+						video: track == video,
+						time:  start + int64(full.DecodeTime*1000/track.timescale),
+						full:  full,
+					})
+				}
+			}
+		}
+	}
+	slices.SortStableFunc(samples, func(a exportSample, b exportSample) int {
+		return compareInt64(a.time, b.time)
+	})
+	return samples, nil
+}
+
+func compareInt64(a int64, b int64) int {
+	if a < b {
+		return -1
+	} else if a > b {
+		return 1
+	}
+	return 0
+}
+
+// lengthPrefixedToAnnexB converts length-prefixed NAL units (as stored in
+// MP4) to Annex B, as AddSampleToTrack expects.
+func lengthPrefixedToAnnexB(data []byte) []byte {
+	out := make([]byte, 0, len(data))
+	for len(data) >= 4 {
+		length := int(data[0])<<24 | int(data[1])<<16 | int(data[2])<<8 | int(data[3])
+		data = data[4:]
+		if length > len(data) {
+			length = len(data)
+		}
+		out = append(out, 0, 0, 0, 1)
+		out = append(out, data[:length]...)
+		data = data[length:]
+	}
+	return out
+}
@@ -0,0 +1,106 @@
+package video
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	mp4ff "github.com/Eyevinn/mp4ff/mp4"
+	"github.com/kerberos-io/agent/machinery/src/models"
+)
+
+// writeExportRecording writes a recording of frames at 25fps, with a keyframe
+// every second.
+func writeExportRecording(t *testing.T, fileName string, frames int) {
+	t.Helper()
+	sps := []byte{0x67, 0x42, 0xc0, 0x1e, 0xd9, 0x00, 0xa0, 0x47, 0xfe, 0xc8}
+	pps := []byte{0x68, 0xce, 0x38, 0x80}
+	mp4Video := NewMP4(fileName, [][]byte{sps}, [][]byte{pps}, nil, 10)
+	mp4Video.SetWidth(640)
+	mp4Video.SetHeight(480)
+	videoTrack := mp4Video.AddVideoTrack("H264")
+	for i := 0; i < frames; i++ {
+		isKeyframe := i%25 == 0
+		if err := mp4Video.AddSampleToTrack(videoTrack, isKeyframe, makeAnnexBFrame(isKeyframe), uint64(i)*40, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mp4Video.Close(&models.Config{})
+}
+
+func TestExport(t *testing.T) {
+	directory := t.TempDir()
+	sources := []ExportSource{}
+	for _, start := range []int64{1700000000000, 1700000006000, 1700000066000} {
+		fileName := filepath.Join(directory, filepath.Base(t.Name())+"_"+string(rune('a'+len(sources)))+".mp4")
+		writeExportRecording(t, fileName, 150)
+		sources = append(sources, ExportSource{
+			Name:  filepath.Base(fileName),
+			Start: start,
+			Open: func() (io.ReadCloser, error) {
+				return os.Open(fileName)
+			},
+		})
+	}
+
+	output := filepath.Join(directory, "export.mp4")
+	progress := 0.0
+	result, err := Export(context.Background(), output, sources, 1700000002500, 1700000067000, &models.Config{}, func(done float64) {
+		if done < progress {
+			t.Errorf("progress went back from %f to %f", progress, done)
+		}
+		progress = done
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if progress != 1 {
+		t.Errorf("expected the progress to end at 1, got %f", progress)
+	}
+
+	// The export starts at the keyframe before the start, and the minute
+	// between the second and third recording is cut.
+	if result.Start != 1700000002000 {
+		t.Errorf("expected the export to start at the keyframe at 2s, got %d", result.Start)
+	}
+	if len(result.Recordings) != 3 {
+		t.Errorf("expected frames of 3 recordings, got %v", result.Recordings)
+	}
+	if result.Duration != 4000+6000+1000 {
+		t.Errorf("expected 11000 ms, got %d", result.Duration)
+	}
+
+	f, err := os.Open(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	parsed, err := mp4ff.DecodeFile(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	samples := 0
+	for _, segment := range parsed.Segments {
+		for _, fragment := range segment.Fragments {
+			fullSamples, err := fragment.GetFullSamples(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, sample := range fullSamples {
+				if samples == 0 && !sample.IsSync() {
+					t.Error("expected the export to start with a keyframe")
+				}
+				samples++
+			}
+		}
+	}
+	if samples != 100+150+25 {
+		t.Errorf("expected 275 frames, got %d", samples)
+	}
+
+	if _, err := Export(context.Background(), filepath.Join(directory, "empty.mp4"), sources, 1700000030000, 1700000040000, &models.Config{}, nil); err == nil {
+		t.Error("expected an export without recordings to fail")
+	}
+}
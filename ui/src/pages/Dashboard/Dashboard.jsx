@@ -682,6 +682,128 @@ class Dashboard extends React.Component {
                 )}
               </Table>
             )}
+
+            {dashboard.offlineMode !== 'true' &&
+              dashboard.uploadTargets &&
+              dashboard.uploadTargets.length > 0 && (
+                <>
+                  <h2>{t('dashboard.upload_targets')}</h2>
+                  <Table>
+                    <TableHeader>
+                      <TableRow
+                        id="header"
+                        headercells={[
+                          t('dashboard.upload_target'),
+                          t('dashboard.upload_status'),
+                          t('dashboard.upload_pending'),
+                          t('dashboard.upload_uploaded'),
+                        ]}
+                      />
+                    </TableHeader>
+                    <TableBody>
+                      {dashboard.uploadTargets.map((target) => (
+                        <TableRow
+                          key={target.name}
+                          id={`upload-${target.name}`}
+                          bodycells={[
+                            <>
+                              <span className="version">{target.name}</span>
+                              &nbsp;
+                              <p>
+                                {target.cloud}
+                                {!target.required &&
+                                  ` (${t('dashboard.upload_optional')})`}
+                              </p>
+                            </>,
+                            <div className="time" data-tip={target.last_error}>
+                              <Ellipse
+                                status={
+                                  target.failures > 0 ? 'warning' : 'success'
+                                }
+                              />{' '}
+                              <p>
+                                {target.failures > 0
+                                  ? t('dashboard.upload_retrying')
+                                  : t('dashboard.upload_ok')}
+                              </p>
+                            </div>,
+                            <p>{target.pending}</p>,
+                            <p>{target.uploaded}</p>,
+                          ]}
+                        />
+                      ))}
+                    </TableBody>
+                  </Table>
+                </>
+              )}
+
+            {dashboard.conditions && dashboard.conditions.timestamp > 0 && (
+              <>
+                <h2>{t('dashboard.conditions')}</h2>
+                <Table>
+                  <TableHeader>
+                    <TableRow
+                      id="header"
+                      headercells={[
+                        t('dashboard.condition'),
+                        t('dashboard.condition_status'),
+                        t('dashboard.condition_reason'),
+                      ]}
+                    />
+                  </TableHeader>
+                  <TableBody>
+                    <TableRow
+                      id="condition-decision"
+                      bodycells={[
+                        <>
+                          <span className="version">
+                            {t('dashboard.condition_decision')}
+                          </span>
+                          &nbsp;
+                          <p>{dashboard.conditions.operator}</p>
+                        </>,
+                        <div className="time">
+                          <Ellipse
+                            status={
+                              dashboard.conditions.valid ? 'success' : 'warning'
+                            }
+                          />{' '}
+                          <p>
+                            {dashboard.conditions.valid
+                              ? t('dashboard.condition_enabled')
+                              : t('dashboard.condition_disabled')}
+                          </p>
+                        </div>,
+                        <p>{dashboard.conditions.reason}</p>,
+                      ]}
+                    />
+                    {dashboard.conditions.conditions &&
+                      dashboard.conditions.conditions.map((condition) => (
+                        <TableRow
+                          key={`${condition.type}-${condition.reason}`}
+                          id={`condition-${condition.type}`}
+                          bodycells={[
+                            <span className="version">{condition.type}</span>,
+                            <div className="time">
+                              <Ellipse
+                                status={
+                                  condition.valid ? 'success' : 'warning'
+                                }
+                              />{' '}
+                              <p>
+                                {condition.valid
+                                  ? t('dashboard.condition_valid')
+                                  : t('dashboard.condition_not_valid')}
+                              </p>
+                            </div>,
+                            <p>{condition.reason}</p>,
+                          ]}
+                        />
+                      ))}
+                  </TableBody>
+                </Table>
+              </>
+            )}
           </div>
           <div>
             <h2>